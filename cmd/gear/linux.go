@@ -8,6 +8,7 @@ import (
 	ctrcmd "github.com/openshift/geard/containers/cmd"
 	chttp "github.com/openshift/geard/containers/http"
 	cjobs "github.com/openshift/geard/containers/jobs/linux"
+	monitor "github.com/openshift/geard/containers/monitor"
 	initcmd "github.com/openshift/geard/containers/systemd/init"
 	"github.com/openshift/geard/daemon"
 	daemoncmd "github.com/openshift/geard/daemon/cmd"
@@ -52,6 +53,7 @@ func init() {
 
 	cmd.AddCommandExtension(cleancmd.RegisterCleanup, true)
 	cmd.AddCommandExtension(initcmd.RegisterInit, true)
+	cmd.AddCommandExtension(monitor.RegisterLinkMonitor, true)
 
 	jobs.AddJobExtension(cjobs.NewContainerExtension())
 	jobs.AddJobExtension(gitjobs.NewGitExtension())
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/openshift/geard/cmd"
@@ -31,7 +32,9 @@ type CommandContext struct {
 
 	dockerSocket string
 
-	resetEnv bool
+	resolvedEnv bool
+	envUpdate   cjobs.EnvironmentUpdate
+	resetEnv    bool
 
 	start        bool
 	isolate      bool
@@ -44,47 +47,72 @@ type CommandContext struct {
 	environment  EnvironmentDescription
 	portPairs    PortPairs
 	networkLinks NetworkLinks
+	routes       Routes
+	idle         IdlePolicy
 	volumeConfig VolumeConfig
 
-	deploymentPath string
+	deploymentPath   string
+	deploymentName   string
+	deploymentParams DeploymentParameters
+	paramsPath       string
+	validateOnly     bool
 
 	buildReq sti.STIRequest
 
-	quiet   bool
-	all     bool
-	timeout int64
-	noWait  bool
+	quiet    bool
+	all      bool
+	timeout  int64
+	noWait   bool
+	orphaned bool
+	force    bool
 }
 
 // Parse the command line arguments and invoke one of the support subcommands.
 func (ctx *CommandContext) RegisterRemote(parent *cobra.Command) {
-	parent.PersistentFlags().StringVar(&(ctx.deploymentPath), "with", "", "Provide a deployment descriptor to operate on")
+	parent.PersistentFlags().StringVar(&(ctx.deploymentPath), "with", "", "Provide a deployment descriptor or the name of a stored deployment to operate on")
 
 	deployCmd := &cobra.Command{
-		Use:   "deploy <file|url> <host>...",
+		Use:   "deploy <file|url|name> <host>...",
 		Short: "Deploy a set of containers to the named hosts",
-		Long:  "Given a simple description of a group of containers, wire them together using the gear primitives.",
+		Long:  "Given a simple description of a group of containers, wire them together using the gear primitives.\n\nThe description may be JSON or YAML.  References of the form ${NAME} in the image, environment, and port fields are replaced with values from --params and --set.\n\nUse --name to store the result on a server as '[<host>/]<name>' (the first host by default).  A stored deployment may be passed in place of a file and is updated in place.",
 		Run:   ctx.deployContainers,
 	}
+	deployCmd.Flags().StringVar(&(ctx.deploymentName), "name", "", "Store the deployment on a server under '[<host>/]<name>'")
+	deployCmd.Flags().Var(&(ctx.deploymentParams), "set", "Set a parameter referenced by the deployment as ${<name>} '<name>=<value>'. May be repeated and overrides --params.")
+	deployCmd.Flags().StringVar(&(ctx.paramsPath), "params", "", "Path to a file of '<name>=<value>' parameters referenced by the deployment")
+	deployCmd.Flags().BoolVar(&(ctx.validateOnly), "validate", false, "Check the deployment for errors and exit without deploying")
 	deployCmd.Flags().BoolVar(&(ctx.isolate), "isolate", false, "Use an isolated container running as a user")
 	deployCmd.Flags().Int64VarP(&(ctx.timeout), "timeout", "", 300, "Number of seconds to wait for a response")
 	parent.AddCommand(deployCmd)
 
+	scaleCmd := &cobra.Command{
+		Use:   "scale <file|name> <container>=<count>... [<host>...]",
+		Short: "Change the number of instances of containers in a deployment",
+		Long:  "Adds or removes instances of the named containers in an existing deployment.  New instances are placed on the hosts the deployment already uses, and any hosts listed.  Only new instances and the instances that link to a scaled container are changed.",
+		Run:   ctx.scaleDeployment,
+	}
+	scaleCmd.Flags().BoolVar(&(ctx.isolate), "isolate", false, "Use an isolated container running as a user")
+	parent.AddCommand(scaleCmd)
+
 	installImageCmd := &cobra.Command{
 		Use:   "install <image> <name>... [<env>]",
 		Short: "Install a docker image as a systemd service",
 		Long:  "Install a docker image as one or more systemd services on one or more servers.\n\nSpecify a location on a remote server with <host>[:<port>]/<name> instead of <name>.  The default port is 2223.",
 		Run:   ctx.installImage,
 	}
-	installImageCmd.Flags().VarP(&(ctx.portPairs), "ports", "p", "List of comma separated port pairs to bind '<internal>:<external>,...'. Use zero to request a port be assigned.")
-	installImageCmd.Flags().VarP(&(ctx.networkLinks), "net-links", "n", "List of comma separated port pairs to wire '<local_host>:<local_port>:<remote_host>:<remote_port>,...'. local_host may be empty. It defaults to 127.0.0.1.")
+	installImageCmd.Flags().VarP(&(ctx.portPairs), "ports", "p", "List of comma separated port pairs to bind '<internal>:<external>[@<address>][/udp],...'. Either port may be a '<first>-<last>' range. Use zero to request a port be assigned, or the name of a pool to assign one from that pool, and an address to bind the port on one interface of the host.")
+	installImageCmd.Flags().VarP(&(ctx.networkLinks), "net-links", "n", "List of comma separated port pairs to wire '<local_host>:<local_port>:<remote_host>:<remote_port>[+<host>:<remote_port>...][/udp],...'. local_host may be empty. It defaults to 127.0.0.1. The ports may be '<first>-<last>' ranges.")
 	installImageCmd.Flags().VarP(&(ctx.volumeConfig), "volumes", "v", "List of comma separated volume and bind-mount specs")
+	installImageCmd.Flags().Var(&(ctx.idle), "idle", "When the idler may stop the container: 'never', 'default', or a comma separated list of 'timeout=<minutes>', 'packets=<count>', and 'bytes=<count>'. The container is idled when it receives fewer packets and bytes than the thresholds within the timeout.")
+	installImageCmd.Flags().Var(&(ctx.routes), "routes", "List of comma separated routes to register with the router while the container runs '<host>[:<port>][/<path>][@TERM_EDGE|TERM_GEAR|TERM_RESSL]'. The port defaults to the first TCP port.")
 	installImageCmd.Flags().BoolVar(&(ctx.start), "start", false, "Start the container immediately")
 	installImageCmd.Flags().BoolVar(&(ctx.isolate), "isolate", false, "Use an isolated container running as a user")
 	installImageCmd.Flags().BoolVar(&(ctx.sockAct), "socket-activated", false, "Use a socket-activated container (experimental, requires Docker branch)")
 	installImageCmd.Flags().StringVar(&(ctx.environment.Path), "env-file", "", "Path to an environment file to load")
 	installImageCmd.Flags().StringVar(&(ctx.environment.Description.Source), "env-url", "", "A url to download environment files from")
 	installImageCmd.Flags().StringVar((*string)(&(ctx.environment.Description.Id)), "env-id", "", "An optional identifier for the environment being set")
+	installImageCmd.Flags().Var(&(ctx.environment.Parents), "env-parent", "Inherit the variables of these comma separated environment ids, later ids overriding earlier ones. May be repeated.")
+	installImageCmd.Flags().Var(&(ctx.environment.Secrets), "secret", "Set an environment variable '<name>=<value>' whose value is encrypted on the server and only readable by the container. May be repeated.")
 	installImageCmd.Flags().StringVar(&(ctx.systemdSlice), "slice", cjobs.DefaultSlice, "systemd slice to use. default: "+cjobs.DefaultSlice)
 	parent.AddCommand(installImageCmd)
 
@@ -117,28 +145,33 @@ func (ctx *CommandContext) RegisterRemote(parent *cobra.Command) {
 	setEnvCmd := &cobra.Command{
 		Use:   "set-env <name>... [<env>]",
 		Short: "Set environment variable values on servers",
-		Long:  "Adds the listed environment values to the specified locations. The name is the environment id that multiple containers may reference. You can pass an environment file or key value pairs on the commandline.",
+		Long:  "Adds the listed environment values to the specified locations. The name is the environment id that multiple containers may reference. You can pass an environment file or key value pairs on the commandline. Running containers keep their old values unless --dependents is set.",
 		Run:   ctx.setEnvironment,
 	}
 	setEnvCmd.Flags().BoolVar(&(ctx.resetEnv), "reset", false, "Remove any existing values")
 	setEnvCmd.Flags().StringVar(&(ctx.environment.Path), "env-file", "", "Path to an environment file to load")
+	setEnvCmd.Flags().StringVar(&(ctx.envUpdate.Dependents), "dependents", "", "Once the environment is set, 'restart' the running containers that use it so they receive the new values")
+	setEnvCmd.Flags().BoolVar(&(ctx.envUpdate.Rolling), "rolling", false, "Restart the containers one at a time, stopping at the first that fails")
+	setEnvCmd.Flags().Var(&(ctx.environment.Parents), "parent", "Inherit the variables of these comma separated environment ids, later ids overriding earlier ones. Replaces any existing parents. May be repeated.")
+	setEnvCmd.Flags().Var(&(ctx.environment.Secrets), "secret", "Set an environment variable '<name>=<value>' whose value is encrypted on the server and only readable by containers. May be repeated.")
 	parent.AddCommand(setEnvCmd)
 
 	envCmd := &cobra.Command{
 		Use:   "env <name>...",
 		Short: "Retrieve environment variable values by id",
-		Long:  "Return the environment variables matching the provided ids",
+		Long:  "Return the environment variables matching the provided ids.  The values of secrets are masked.",
 		Run:   ctx.showEnvironment,
 	}
+	envCmd.Flags().BoolVar(&(ctx.resolvedEnv), "resolved", false, "Show the values containers receive after merging in parent environments, grouped by the environment each came from")
 	parent.AddCommand(envCmd)
 
 	linkCmd := &cobra.Command{
 		Use:   "link <name>...",
 		Short: "Set network links for the named containers",
-		Long:  "Sets the network links for the named containers. A restart may be required to use the latest links.",
+		Long:  "Sets the network links for the named containers. Links are applied immediately to running containers.",
 		Run:   ctx.linkContainers,
 	}
-	linkCmd.Flags().VarP(&(ctx.networkLinks), "net-links", "n", "List of comma separated port pairs to wire '<local_host>:local_port>:<host>:<remote_port>,...'. local_host may be empty. It defaults to 127.0.0.1")
+	linkCmd.Flags().VarP(&(ctx.networkLinks), "net-links", "n", "List of comma separated port pairs to wire '<local_host>:local_port>:<host>:<remote_port>[+<host>:<remote_port>...][/udp],...'. local_host may be empty. It defaults to 127.0.0.1. The ports may be '<first>-<last>' ranges.")
 	parent.AddCommand(linkCmd)
 
 	startCmd := &cobra.Command{
@@ -166,6 +199,22 @@ func (ctx *CommandContext) RegisterRemote(parent *cobra.Command) {
 	}
 	parent.AddCommand(restartCmd)
 
+	idleCmd := &cobra.Command{
+		Use:   "idle <name>...",
+		Short: "Stop a container until traffic arrives for it",
+		Long:  "Stops the container but leaves it started on boot.  When the idler daemon is running it wakes the container on its next connection.",
+		Run:   ctx.idleContainer,
+	}
+	parent.AddCommand(idleCmd)
+
+	unidleCmd := &cobra.Command{
+		Use:   "unidle <name>...",
+		Short: "Start an idled container",
+		Long:  "Queues the start of an idled container and immediately returns.",
+		Run:   ctx.unidleContainer,
+	}
+	parent.AddCommand(unidleCmd)
+
 	statusCmd := &cobra.Command{
 		Use:   "status <name>...",
 		Short: "Retrieve the systemd status of one or more containers",
@@ -184,6 +233,15 @@ func (ctx *CommandContext) RegisterRemote(parent *cobra.Command) {
 	listUnitsCmd.Flags().BoolVarP(&(ctx.quiet), "quiet", "q", false, "Return only the id of each unit")
 	parent.AddCommand(listUnitsCmd)
 
+	portsCmd := &cobra.Command{
+		Use:   "ports <name>...",
+		Short: "Retrieve the ports mapped by one or more containers",
+		Long:  "Shows the port pairs of each container.  With --all, pass hosts instead and every port reserved on each host is listed with the container that holds it, followed by the free ports on each interface.",
+		Run:   ctx.listPorts,
+	}
+	portsCmd.Flags().BoolVarP(&(ctx.all), "all", "a", false, "List every reservation on the named hosts")
+	parent.AddCommand(portsCmd)
+
 	purgeCmd := &cobra.Command{
 		Use:   "purge",
 		Short: "Stop and disable all containers",
@@ -191,6 +249,43 @@ func (ctx *CommandContext) RegisterRemote(parent *cobra.Command) {
 		Run:   ctx.purge,
 	}
 	parent.AddCommand(purgeCmd)
+
+	deploymentsCmd := &cobra.Command{
+		Use:   "deployments",
+		Short: "Manage deployments stored on servers",
+		Long:  "List, show, or delete the deployments stored on servers by 'gear deploy --name'.",
+	}
+	listDeploymentsCmd := &cobra.Command{
+		Use:   "list <host>...",
+		Short: "List the deployments stored on the named hosts",
+		Long:  "Shows the name, number of containers and instances, and last update of each stored deployment.",
+		Run:   ctx.listDeployments,
+	}
+	listDeploymentsCmd.Flags().BoolVarP(&(ctx.quiet), "quiet", "q", false, "Return only the name of each deployment")
+	deploymentsCmd.AddCommand(listDeploymentsCmd)
+	showDeploymentCmd := &cobra.Command{
+		Use:   "show <name>...",
+		Short: "Display a stored deployment",
+		Long:  "Prints the descriptor and instances of each stored deployment.  Specify a location on a remote server with <host>[:<port>]/<name>.",
+		Run:   ctx.showDeployment,
+	}
+	deploymentsCmd.AddCommand(showDeploymentCmd)
+	deleteDeploymentCmd := &cobra.Command{
+		Use:   "delete <name>...",
+		Short: "Delete a stored deployment",
+		Long:  "Removes the stored deployment only.  Use 'gear delete --with <name>' first to remove its containers.",
+		Run:   ctx.deleteDeployment,
+	}
+	deploymentsCmd.AddCommand(deleteDeploymentCmd)
+	parent.AddCommand(deploymentsCmd)
+
+	discoverCmd := &cobra.Command{
+		Use:   "discover <container>.<deployment>...",
+		Short: "Resolve a container in a stored deployment to its instances",
+		Long:  "Lists the id, internal port, and external host:port of each instance of a container in a deployment stored on the server.  Specify a remote server with <host>[:<port>]/<container>.<deployment>.",
+		Run:   ctx.discover,
+	}
+	parent.AddCommand(discoverCmd)
 }
 
 func (ctx *CommandContext) RegisterLocal(parent *cobra.Command) {
@@ -203,6 +298,16 @@ func (ctx *CommandContext) RegisterLocal(parent *cobra.Command) {
 	createTokenCmd.Flags().StringVar(&(ctx.keyPath), "key-path", "", "Specify the directory containing the client private and server public keys")
 	createTokenCmd.Flags().Int64Var(&(ctx.expiresAt), "expires-at", time.Now().Unix()+3600, "Specify the content request token expiration time in seconds after the Unix epoch")
 	parent.AddCommand(createTokenCmd)
+
+	releasePortsCmd := &cobra.Command{
+		Use:   "release-ports [<port>[/udp][@<device>]...]",
+		Short: "(Local) Release reserved ports that no container holds",
+		Long:  "Removes port reservations on this host whose container was deleted or no longer maps the port.  Name each port, or pass --orphaned to release every orphaned reservation.  The device defaults to '" + string(port.DefaultDevice) + "'.",
+		Run:   ctx.releasePorts,
+	}
+	releasePortsCmd.Flags().BoolVar(&(ctx.orphaned), "orphaned", false, "Release every orphaned reservation")
+	releasePortsCmd.Flags().BoolVar(&(ctx.force), "force", false, "Release the named ports even if a container still holds them")
+	parent.AddCommand(releasePortsCmd)
 }
 
 func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
@@ -222,14 +327,20 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 		cmd.Fail(1, "Cannot Parse Argument 1: %s", err.Error())
 	}
 
+	params, err := ctx.deploymentParams.Merge(ctx.paramsPath)
+	if err != nil {
+		cmd.Fail(1, "Unable to load deployment parameters: %s", err.Error())
+	}
+
 	var deploy *deployment.Deployment
+	var stored cmd.Locator
 	switch u.Scheme {
 	case "":
-		deploy, err = deployment.NewDeploymentFromFile(u.Path)
+		deploy, stored, err = LoadDeployment(t, u.Path, params)
 	case "file":
-		deploy, err = deployment.NewDeploymentFromFile(u.Path)
+		deploy, err = deployment.NewDeploymentFromFile(u.Path, params)
 	case "http", "https":
-		deploy, err = deployment.NewDeploymentFromURL(u.String(), *ctx.Insecure, time.Duration(ctx.timeout))
+		deploy, err = deployment.NewDeploymentFromURL(u.String(), *ctx.Insecure, time.Duration(ctx.timeout), params)
 	default:
 		cmd.Fail(1, "Unsupported URL Scheme '%s' for deployment", u.Scheme)
 	}
@@ -237,6 +348,13 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 	if nil != err {
 		cmd.Fail(1, "Unable to load deployment from %s: %s", path, err.Error())
 	}
+	if err := deploy.Validate(); err != nil {
+		cmd.Fail(1, "Deployment %s is not valid:\n%s", path, err.Error())
+	}
+	if ctx.validateOnly {
+		fmt.Printf("==> %s is valid\n", path)
+		os.Exit(0)
+	}
 
 	if len(args) == 1 {
 		args = append(args, transport.Local.String())
@@ -246,11 +364,17 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 		cmd.Fail(1, "You must pass zero or more valid host names (use '%s' or pass no arguments for the current server): %s", transport.Local.String(), err.Error())
 	}
 
-	re := regexp.MustCompile("\\.\\d{8}\\-\\d{6}\\z")
-	now := time.Now().Format(".20060102-150405")
-	base := filepath.Base(path)
-	base = re.ReplaceAllString(base, "")
-	newPath := base + now
+	if ctx.deploymentName != "" {
+		if stored, err = deploymentStoreFor(t, ctx.deploymentName, servers[0]); err != nil {
+			cmd.Fail(1, "You must pass a valid deployment name to --name: %s", err.Error())
+		}
+	}
+	if deploy.Discovery {
+		if stored == nil {
+			cmd.Fail(1, "Deployment %s uses discovery and must be stored with --name", path)
+		}
+		deploy.Name = cloc.AsDeploymentName(stored)
+	}
 
 	fmt.Printf("==> Deploying %s\n", path)
 	changes, removed, err := deploy.Describe(deployment.SimplePlacement(servers), t)
@@ -258,6 +382,20 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 		cmd.Fail(1, "Deployment is not valid: %s", err.Error())
 	}
 
+	ctx.applyDeployment(t, path, changes, removed, changes.Instances.Linked(), stored)
+}
+
+// Delete the removed instances, install the added instances, write
+// the result next to path and to the stored deployment, if any, and
+// then set links on the linked instances and start the added ones.
+// Exits with an error if any step failed.
+func (ctx *CommandContext) applyDeployment(t transport.Transport, path string, changes *deployment.Deployment, removed, linked deployment.InstanceRefs, stored cmd.Locator) {
+	re := regexp.MustCompile("\\.\\d{8}\\-\\d{6}\\z")
+	now := time.Now().Format(".20060102-150405")
+	base := filepath.Base(path)
+	base = re.ReplaceAllString(base, "")
+	newPath := base + now
+
 	if len(removed) > 0 {
 		removedIds, err := LocatorsForDeploymentInstances(t, removed)
 		if err != nil {
@@ -303,6 +441,8 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 
 				Ports:        instance.Ports.PortPairs(),
 				NetworkLinks: &links,
+				Routes:       instance.Routes(),
+				Idle:         instance.IdlePolicy(),
 			}
 		},
 		OnSuccess: func(r *cmd.CliJobResponse, w io.Writer, job cmd.RequestedJob) {
@@ -329,30 +469,50 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 		}
 	}
 
-	contents, _ := json.MarshalIndent(changes, "", "  ")
-	contents = append(contents, []byte("\n")...)
+	contents, _ := changes.Descriptor()
 	if err := ioutil.WriteFile(newPath, contents, 0664); err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to write %s: %s\n", newPath, err.Error())
 	}
 
-	linkedIds, err := LocatorsForDeploymentInstances(t, changes.Instances.Linked())
+	// Discovered links are resolved from the stored deployment, so it
+	// must list the new instances before they are linked and started.
+	if stored != nil {
+		storeOn := cmd.Locators{stored}
+		if changes.Discovery {
+			// each host resolves discovery names from its own copy
+			storeOn, err = discoveryStoresFor(t, stored, changes)
+			if err != nil {
+				cmd.Fail(1, "Unable to generate deployment info: %s", err.Error())
+			}
+		}
+		fmt.Printf("==> Storing deployment as %s\n", stored.Identity())
+		errors = append(errors, cmd.Executor{
+			On: storeOn,
+			Serial: func(on cmd.Locator) cmd.JobRequest {
+				return &cjobs.PutDeploymentRequest{Name: cloc.AsDeploymentName(on), Deployment: changes}
+			},
+			Output:    os.Stdout,
+			Transport: t,
+		}.Stream()...)
+	}
+
+	linkedIds, err := LocatorsForDeploymentInstances(t, linked)
 	if err != nil {
 		cmd.Fail(1, "Unable to generate deployment info: %s", err.Error())
 	}
 
+	// An instance with no remaining links is still sent so that
+	// stale links are cleared.
 	cmd.Executor{
 		On: linkedIds,
 		Group: func(on ...cmd.Locator) cmd.JobRequest {
 			links := []containers.ContainerLink{}
 			for i := range on {
 				instance, _ := changes.Instances.Find(cloc.AsIdentifier(on[i]))
-				network := instance.NetworkLinks()
-				if len(network) > 0 {
-					links = append(links, containers.ContainerLink{instance.Id, network})
-				}
+				links = append(links, containers.ContainerLink{instance.Id, instance.NetworkLinks()})
 			}
 
-			return &cjobs.LinkContainersRequest{&containers.ContainerLinks{links}}
+			return &cjobs.LinkContainersRequest{ContainerLinks: &containers.ContainerLinks{links}}
 		},
 		Output:    os.Stdout,
 		Transport: t,
@@ -378,6 +538,244 @@ func (ctx *CommandContext) deployContainers(c *cobra.Command, args []string) {
 	}
 }
 
+func (ctx *CommandContext) scaleDeployment(c *cobra.Command, args []string) {
+	if len(args) < 2 {
+		cmd.Fail(1, "Valid arguments: <deployment_file|name> <container>=<count>... [<host>...]")
+	}
+
+	t := ctx.Transport.Get()
+
+	path := args[0]
+	deploy, stored, err := LoadDeployment(t, path, nil)
+	if err != nil {
+		cmd.Fail(1, "Unable to load deployment from %s: %s", path, err.Error())
+	}
+
+	counts := make(map[string]int)
+	names := []string{}
+	hosts := []string{}
+	for _, arg := range args[1:] {
+		if !strings.Contains(arg, "=") {
+			hosts = append(hosts, arg)
+			continue
+		}
+		name, count, err := deployment.ParseScale(arg)
+		if err != nil {
+			cmd.Fail(1, err.Error())
+		}
+		if _, found := counts[name]; !found {
+			names = append(names, name)
+		}
+		counts[name] = count
+	}
+	if len(counts) == 0 {
+		cmd.Fail(1, "You must pass one or more <container>=<count> arguments")
+	}
+	if err := deploy.Scale(counts); err != nil {
+		cmd.Fail(1, "Unable to scale %s: %s", path, err.Error())
+	}
+
+	servers, err := transport.NewTransportLocators(t, hosts...)
+	if err != nil {
+		cmd.Fail(1, "You must pass zero or more valid host names: %s", err.Error())
+	}
+	placement, err := deploy.ExistingPlacement(t, servers...)
+	if err != nil {
+		cmd.Fail(1, "Unable to generate deployment info: %s", err.Error())
+	}
+	if len(placement) == 0 {
+		cmd.Fail(1, "The deployment %s has no instances on any host - pass one or more hosts to place new instances on", path)
+	}
+
+	fmt.Printf("==> Scaling %s\n", path)
+	changes, removed, err := deploy.Describe(placement, t)
+	if err != nil {
+		cmd.Fail(1, "Deployment is not valid: %s", err.Error())
+	}
+
+	// Only new instances and the instances that link to a scaled
+	// container need their links updated.  With discovery the links
+	// of dependents don't change, but they are applied again so that
+	// they resolve to the current instances.
+	linked := changes.Instances.AddedOrFrom(changes.Containers.Dependents(names...)...)
+	ctx.applyDeployment(t, path, changes, removed, linked, stored)
+}
+
+// A deployment name without a host is stored on the first host
+// deployed to.
+func deploymentStoreFor(t transport.Transport, value string, defaultHost transport.Locator) (cmd.Locator, error) {
+	_, host, _, err := cmd.SplitTypeHostSuffix(value)
+	if err != nil {
+		return nil, err
+	}
+	locators, err := cloc.NewDeploymentLocators(t, value)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		locators[0].(*cmd.ResourceLocator).At = defaultHost
+	}
+	return locators[0], nil
+}
+
+// The stored deployment and a copy of it on every host with an
+// instance.
+func discoveryStoresFor(t transport.Transport, stored cmd.Locator, d *deployment.Deployment) (cmd.Locators, error) {
+	locators := cmd.Locators{stored}
+	seen := map[string]bool{stored.TransportLocator().String(): true}
+	for i := range d.Instances {
+		on := d.Instances[i].On
+		if on == nil || seen[*on] {
+			continue
+		}
+		seen[*on] = true
+		at, err := t.LocatorFor(*on)
+		if err != nil {
+			return nil, err
+		}
+		locators = append(locators, &cmd.ResourceLocator{Type: cloc.ResourceTypeDeployment, Id: cloc.AsDeploymentName(stored), At: at})
+	}
+	return locators, nil
+}
+
+func (ctx *CommandContext) discover(c *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Fail(1, "Valid arguments: <container>.<deployment> ...")
+	}
+
+	t := ctx.Transport.Get()
+
+	locators, err := cmd.NewResourceLocators(t, "", args...)
+	if err != nil {
+		cmd.Fail(1, "You must pass one or more valid names: %s", err.Error())
+	}
+
+	data, errors := cmd.Executor{
+		On: locators,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return &cjobs.DiscoveryRequest{Name: on.(*cmd.ResourceLocator).Id}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.Gather()
+
+	for i := range data {
+		if r, ok := data[i].(*cjobs.DiscoveryResponse); ok {
+			for _, endpoint := range r.Endpoints {
+				for _, p := range endpoint.Ports {
+					fmt.Fprintf(os.Stdout, "%s\t%s\t%d\t%s:%d\n", r.Name, endpoint.Id, p.Internal, endpoint.Host, p.External)
+				}
+			}
+		}
+	}
+	if len(errors) > 0 {
+		for i := range errors {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors[i])
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func (ctx *CommandContext) listDeployments(c *cobra.Command, args []string) {
+	t, servers := ctx.transportAndHosts(args...)
+
+	data, errors := cmd.Executor{
+		On: servers,
+		Group: func(on ...cmd.Locator) cmd.JobRequest {
+			return &cjobs.ListDeploymentsRequest{}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.Gather()
+
+	combined := cjobs.ListDeploymentsResponse{}
+	for i := range data {
+		if j, ok := data[i].(*cjobs.ListDeploymentsResponse); ok {
+			combined.Append(j)
+		}
+	}
+	combined.Sort()
+	if ctx.quiet {
+		for i := range combined.Deployments {
+			d := &combined.Deployments[i]
+			if d.Server != "" {
+				fmt.Fprintf(os.Stdout, "%s/%s\n", d.Server, d.Name)
+			} else {
+				fmt.Fprintf(os.Stdout, "%s\n", d.Name)
+			}
+		}
+	} else {
+		combined.WriteTableTo(os.Stdout)
+	}
+	if len(errors) > 0 {
+		for i := range errors {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors[i])
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func (ctx *CommandContext) showDeployment(c *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Fail(1, "Valid arguments: <name> ...")
+	}
+
+	t := ctx.Transport.Get()
+
+	locators, err := cloc.NewDeploymentLocators(t, args...)
+	if err != nil {
+		cmd.Fail(1, "You must pass one or more valid deployment names: %s", err.Error())
+	}
+
+	data, errors := cmd.Executor{
+		On: locators,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return &cjobs.GetDeploymentRequest{Name: cloc.AsDeploymentName(on)}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.Gather()
+
+	for i := range data {
+		contents, _ := json.MarshalIndent(data[i], "", "  ")
+		fmt.Fprintf(os.Stdout, "%s\n", contents)
+	}
+	if len(errors) > 0 {
+		for i := range errors {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors[i])
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func (ctx *CommandContext) deleteDeployment(c *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Fail(1, "Valid arguments: <name> ...")
+	}
+
+	t := ctx.Transport.Get()
+
+	locators, err := cloc.NewDeploymentLocators(t, args...)
+	if err != nil {
+		cmd.Fail(1, "You must pass one or more valid deployment names: %s", err.Error())
+	}
+
+	cmd.Executor{
+		On: locators,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return &cjobs.DeleteDeploymentRequest{Name: cloc.AsDeploymentName(on)}
+		},
+		Output: os.Stdout,
+		OnSuccess: func(r *cmd.CliJobResponse, w io.Writer, job cmd.RequestedJob) {
+			fmt.Fprintf(w, "Deleted deployment %s", job.Request.(*cjobs.DeleteDeploymentRequest).Name)
+		},
+		Transport: t,
+	}.StreamAndExit()
+}
+
 func (ctx *CommandContext) installImage(c *cobra.Command, args []string) {
 	if err := ctx.environment.ExtractVariablesFrom(&args, true); err != nil {
 		cmd.Fail(1, err.Error())
@@ -420,6 +818,8 @@ func (ctx *CommandContext) installImage(c *cobra.Command, args []string) {
 				Environment:  &ctx.environment.Description,
 				NetworkLinks: ctx.networkLinks.NetworkLinks,
 				VolumeConfig: ctx.volumeConfig.VolumeConfig,
+				Routes:       ctx.routes.Routes,
+				Idle:         ctx.idle.IdlePolicy,
 				SystemdSlice: ctx.systemdSlice,
 			}
 			return &r
@@ -473,6 +873,9 @@ func (ctx *CommandContext) setEnvironment(c *cobra.Command, args []string) {
 	if len(args) < 1 {
 		cmd.Fail(1, "Valid arguments: <name>... <key>=<value>...")
 	}
+	if err := ctx.envUpdate.Check(); err != nil {
+		cmd.Fail(1, err.Error())
+	}
 
 	t := ctx.Transport.Get()
 
@@ -486,10 +889,10 @@ func (ctx *CommandContext) setEnvironment(c *cobra.Command, args []string) {
 		Serial: func(on cmd.Locator) cmd.JobRequest {
 			ctx.environment.Description.Id = cloc.AsIdentifier(on)
 			if ctx.resetEnv {
-				return &cjobs.PutEnvironmentRequest{ctx.environment.Description}
+				return &cjobs.PutEnvironmentRequest{EnvironmentDescription: ctx.environment.Description, EnvironmentUpdate: ctx.envUpdate}
 			}
 
-			return &cjobs.PatchEnvironmentRequest{ctx.environment.Description}
+			return &cjobs.PatchEnvironmentRequest{EnvironmentDescription: ctx.environment.Description, EnvironmentUpdate: ctx.envUpdate}
 		},
 		Output:    os.Stdout,
 		Transport: t,
@@ -512,7 +915,8 @@ func (ctx *CommandContext) showEnvironment(c *cobra.Command, args []string) {
 		On: ids,
 		Serial: func(on cmd.Locator) cmd.JobRequest {
 			return &cjobs.GetEnvironmentRequest{
-				Id: cloc.AsIdentifier(on),
+				Id:       cloc.AsIdentifier(on),
+				Resolved: ctx.resolvedEnv,
 			}
 		},
 		Output:    os.Stdout,
@@ -586,7 +990,7 @@ func (ctx *CommandContext) linkContainers(c *cobra.Command, args []string) {
 			for i := range on {
 				links.Links = append(links.Links, containers.ContainerLink{cloc.AsIdentifier(on[i]), *ctx.networkLinks.NetworkLinks})
 			}
-			return &cjobs.LinkContainersRequest{links}
+			return &cjobs.LinkContainersRequest{ContainerLinks: links}
 		},
 		Output: os.Stdout,
 		OnSuccess: func(r *cmd.CliJobResponse, w io.Writer, job cmd.RequestedJob) {
@@ -675,6 +1079,58 @@ func (ctx *CommandContext) restartContainer(c *cobra.Command, args []string) {
 	}.StreamAndExit()
 }
 
+func (ctx *CommandContext) idleContainer(c *cobra.Command, args []string) {
+	t := ctx.Transport.Get()
+
+	if err := ExtractContainerLocatorsFromDeployment(t, ctx.deploymentPath, &args); err != nil {
+		cmd.Fail(1, err.Error())
+	}
+	if len(args) < 1 {
+		cmd.Fail(1, "Valid arguments: <id> ...")
+	}
+	ids, err := cloc.NewContainerLocators(t, args...)
+	if err != nil {
+		cmd.Fail(1, "You must pass one or more valid service names: %s", err.Error())
+	}
+
+	cmd.Executor{
+		On: ids,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return &cjobs.IdleContainerRequest{
+				Id: cloc.AsIdentifier(on),
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
+}
+
+func (ctx *CommandContext) unidleContainer(c *cobra.Command, args []string) {
+	t := ctx.Transport.Get()
+
+	if err := ExtractContainerLocatorsFromDeployment(t, ctx.deploymentPath, &args); err != nil {
+		cmd.Fail(1, err.Error())
+	}
+	if len(args) < 1 {
+		cmd.Fail(1, "Valid arguments: <id> ...")
+	}
+	ids, err := cloc.NewContainerLocators(t, args...)
+	if err != nil {
+		cmd.Fail(1, "You must pass one or more valid service names: %s", err.Error())
+	}
+
+	cmd.Executor{
+		On: ids,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return &cjobs.UnidleContainerRequest{
+				Id: cloc.AsIdentifier(on),
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
+}
+
 func (ctx *CommandContext) containerStatus(c *cobra.Command, args []string) {
 	t := ctx.Transport.Get()
 
@@ -760,6 +1216,62 @@ func (ctx *CommandContext) listUnits(c *cobra.Command, args []string) {
 	os.Exit(0)
 }
 
+func (ctx *CommandContext) listPorts(c *cobra.Command, args []string) {
+	if !ctx.all {
+		t := ctx.Transport.Get()
+
+		if err := ExtractContainerLocatorsFromDeployment(t, ctx.deploymentPath, &args); err != nil {
+			cmd.Fail(1, err.Error())
+		}
+		if len(args) < 1 {
+			cmd.Fail(1, "Valid arguments: <id> ...")
+		}
+		ids, err := cloc.NewContainerLocators(t, args...)
+		if err != nil {
+			cmd.Fail(1, "You must pass one or more valid service names: %s", err.Error())
+		}
+
+		cmd.Executor{
+			On: ids,
+			Serial: func(on cmd.Locator) cmd.JobRequest {
+				return &cjobs.ContainerPortsRequest{
+					Id: cloc.AsIdentifier(on),
+				}
+			},
+			Output:    os.Stdout,
+			Transport: t,
+		}.StreamAndExit()
+		return
+	}
+
+	t, servers := ctx.transportAndHosts(args...)
+
+	data, errors := cmd.Executor{
+		On: servers,
+		Group: func(on ...cmd.Locator) cmd.JobRequest {
+			return &cjobs.ListPortsRequest{}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.Gather()
+
+	combined := cjobs.ListPortsResponse{}
+	for i := range data {
+		if j, ok := data[i].(*cjobs.ListPortsResponse); ok {
+			combined.Append(j)
+		}
+	}
+	combined.Sort()
+	combined.WriteTableTo(os.Stdout)
+	if len(errors) > 0 {
+		for i := range errors {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors[i])
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func (ctx *CommandContext) purge(c *cobra.Command, args []string) {
 	t, servers := ctx.transportAndHosts(args...)
 
@@ -797,6 +1309,43 @@ func (ctx *CommandContext) createToken(c *cobra.Command, args []string) {
 	os.Exit(0)
 }
 
+var allowedReservation = regexp.MustCompile(`\A(\d+)(/udp)?(?:@([a-zA-Z0-9_\-]+))?\z`)
+
+func (ctx *CommandContext) releasePorts(c *cobra.Command, args []string) {
+	if len(args) == 0 && !ctx.orphaned {
+		cmd.Fail(1, "Valid arguments: <port>[/udp][@<device>] ... or --orphaned")
+	}
+	req := &cjobs.ReleasePortsRequest{Force: ctx.force}
+	for _, arg := range args {
+		match := allowedReservation.FindStringSubmatch(arg)
+		if match == nil {
+			cmd.Fail(1, "The reservation '%s' must be '<port>[/udp][@<device>]'", arg)
+		}
+		p, err := port.NewPortFromString(match[1])
+		if err != nil {
+			cmd.Fail(1, "The reservation '%s' is not valid: %s", arg, err.Error())
+		}
+		r := port.Reservation{Device: port.DefaultDevice, Port: p}
+		if match[2] != "" {
+			r.Protocol = port.UDP
+		}
+		if match[3] != "" {
+			r.Device = port.Device(match[3])
+		}
+		req.Ports = append(req.Ports, r)
+	}
+
+	t, servers := ctx.transportAndHosts()
+	cmd.Executor{
+		On: servers,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return req
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
+}
+
 func (ctx *CommandContext) transportAndHosts(args ...string) (transport.Transport, cmd.Locators) {
 	t := ctx.Transport.Get()
 
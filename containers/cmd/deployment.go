@@ -3,20 +3,22 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/openshift/geard/cmd"
+	cjobs "github.com/openshift/geard/containers/jobs"
 	cloc "github.com/openshift/geard/containers/locator"
 	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/transport"
 )
 
 // Return a set of container locators from the specified deployment
-// descriptor.
+// descriptor or stored deployment.
 func ExtractContainerLocatorsFromDeployment(t transport.Transport, path string, args *[]string) error {
 	if path == "" {
 		return nil
 	}
-	deployment, err := deployment.NewDeploymentFromFile(path)
+	deployment, _, err := LoadDeployment(t, path, nil)
 	if err != nil {
 		return err
 	}
@@ -47,3 +49,34 @@ func LocatorsForDeploymentInstances(t transport.Transport, instances deployment.
 	}
 	return locators, nil
 }
+
+// Load a deployment descriptor from path, or if no file exists at
+// path, the deployment stored on a server under that name ('<name>'
+// or '<host>/<name>').  The locator of a stored deployment is
+// returned so that it may be updated.
+func LoadDeployment(t transport.Transport, path string, params deployment.Parameters) (*deployment.Deployment, cmd.Locator, error) {
+	d, errf := deployment.NewDeploymentFromFile(path, params)
+	if !os.IsNotExist(errf) {
+		return d, nil, errf
+	}
+	locators, err := cloc.NewDeploymentLocators(t, path)
+	if err != nil {
+		return nil, nil, errf
+	}
+
+	data, errors := cmd.Executor{
+		On: locators,
+		Serial: func(on cmd.Locator) cmd.JobRequest {
+			return &cjobs.GetDeploymentRequest{Name: cloc.AsDeploymentName(on)}
+		},
+		Transport: t,
+	}.Gather()
+	if len(errors) > 0 {
+		return nil, nil, fmt.Errorf("No file exists at %s and it could not be loaded as a stored deployment: %s", path, errors[0].Error())
+	}
+	d, ok := data[0].(*deployment.Deployment)
+	if !ok {
+		return nil, nil, fmt.Errorf("The stored deployment %s could not be read", path)
+	}
+	return d, locators[0], nil
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	. "github.com/openshift/geard/containers/cmd"
+	cjobs "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/transport"
 )
@@ -42,3 +44,55 @@ func TestShouldExtractLocators(t *testing.T) {
 		t.Fatalf("Expected args to have 3 locators, not %d", len(args))
 	}
 }
+
+// Serves stored deployments by name
+type storeTransport struct {
+	testTransport
+	Stored map[string]*deployment.Deployment
+}
+
+func (t *storeTransport) RemoteJobFor(locator transport.Locator, job interface{}) (jobs.Job, error) {
+	req, ok := job.(*cjobs.GetDeploymentRequest)
+	if !ok {
+		panic("should not be called")
+	}
+	return jobs.JobFunction(func(resp jobs.Response) {
+		d, found := t.Stored[locator.String()+"/"+req.Name]
+		if !found {
+			resp.Failure(cjobs.ErrDeploymentNotFound)
+			return
+		}
+		resp.SuccessWithData(jobs.ResponseOk, d)
+	}), nil
+}
+
+func TestShouldExtractLocatorsFromStoredDeployment(t *testing.T) {
+	d, err := deployment.NewDeploymentFromFile("../../deployment/fixtures/mongo_deploy_existing.json", nil)
+	if err != nil {
+		t.Fatalf("Unable to load fixture: %+v", err)
+	}
+	trans := &storeTransport{Stored: map[string]*deployment.Deployment{"server1/mongo": d}}
+
+	args := []string{}
+	if err := ExtractContainerLocatorsFromDeployment(trans, "server1/mongo", &args); err != nil {
+		t.Fatalf("Expected no error from extract: %+v", err)
+	}
+	if len(args) != 3 {
+		t.Fatalf("Expected args to have 3 locators, not %d", len(args))
+	}
+
+	_, stored, err := LoadDeployment(trans, "server1/mongo", nil)
+	if err != nil {
+		t.Fatalf("Expected no error from load: %+v", err)
+	}
+	if stored == nil || stored.Identity() != "deployment://server1/mongo" {
+		t.Errorf("Expected the stored deployment locator to be returned: %+v", stored)
+	}
+
+	if err := ExtractContainerLocatorsFromDeployment(trans, "server1/other", &args); err == nil {
+		t.Errorf("Expected an error for a deployment that is not stored")
+	}
+	if err := ExtractContainerLocatorsFromDeployment(trans, "server1/.hidden", &args); err == nil {
+		t.Errorf("Expected an error for a missing file with an invalid deployment name")
+	}
+}
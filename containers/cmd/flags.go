@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/openshift/geard/cmd"
 	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/port"
 )
 
@@ -89,9 +91,101 @@ func (n *NetworkLinks) Set(s string) error {
 	return nil
 }
 
+type Routes struct {
+	*containers.Routes
+}
+
+func (r *Routes) Get() interface{} {
+	return r.Routes
+}
+
+func (r *Routes) String() string {
+	if r.Routes == nil {
+		return ""
+	}
+	return r.Routes.String()
+}
+
+func (r *Routes) Set(s string) error {
+	routes, err := containers.NewRoutesFromString(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	r.Routes = &routes
+	return nil
+}
+
+type IdlePolicy struct {
+	*containers.IdlePolicy
+}
+
+func (p *IdlePolicy) Get() interface{} {
+	return p.IdlePolicy
+}
+
+func (p *IdlePolicy) String() string {
+	if p.IdlePolicy == nil {
+		return ""
+	}
+	return p.IdlePolicy.String()
+}
+
+func (p *IdlePolicy) Set(s string) error {
+	policy, err := containers.NewIdlePolicyFromString(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	p.IdlePolicy = policy
+	return nil
+}
+
+type DeploymentParameters struct {
+	deployment.Parameters
+}
+
+func (d *DeploymentParameters) Get() interface{} {
+	return d.Parameters
+}
+
+func (d *DeploymentParameters) String() string {
+	return ""
+}
+
+func (d *DeploymentParameters) Set(s string) error {
+	if d.Parameters == nil {
+		d.Parameters = deployment.Parameters{}
+	}
+	if err := d.Parameters.Set(s); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Load the parameters file at path (if any) and apply the values
+// set on the command line over it.
+func (d *DeploymentParameters) Merge(path string) (deployment.Parameters, error) {
+	params := deployment.Parameters{}
+	if path != "" {
+		loaded, err := deployment.NewParametersFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		params = loaded
+	}
+	for k, v := range d.Parameters {
+		params[k] = v
+	}
+	return params, nil
+}
+
 type EnvironmentDescription struct {
 	Description containers.EnvironmentDescription
 	Path        string
+	Secrets     SecretVariables
+	Parents     EnvironmentParents
 }
 
 func (e *EnvironmentDescription) ExtractVariablesFrom(args *[]string, generateId bool) error {
@@ -111,9 +205,69 @@ func (e *EnvironmentDescription) ExtractVariablesFrom(args *[]string, generateId
 		return err
 	}
 	e.Description.Variables = append(e.Description.Variables, env...)
+	e.Description.Variables = append(e.Description.Variables, e.Secrets.EnvironmentVariables...)
+	e.Description.Parents = append(e.Description.Parents, e.Parents...)
 	if generateId && !e.Description.Empty() && e.Description.Id == "" {
 		e.Description.Id = containers.Identifier(cmd.GenerateId())
 		log.Printf("Setting --env-id to %s", e.Description.Id)
 	}
 	return nil
 }
+
+// Environment variables whose values are only readable by the
+// container, given as '<name>=<value>'.
+type SecretVariables struct {
+	containers.EnvironmentVariables
+}
+
+func (s *SecretVariables) Get() interface{} {
+	return s.EnvironmentVariables
+}
+
+// The values are never printed
+func (s *SecretVariables) String() string {
+	return ""
+}
+
+func (s *SecretVariables) Set(value string) error {
+	e := containers.Environment{}
+	match, err := e.FromString(value)
+	if err == nil && !match {
+		err = fmt.Errorf("The secret '%s' must be <name>=<value>", value)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	e.Secret = true
+	s.EnvironmentVariables = append(s.EnvironmentVariables, e)
+	return nil
+}
+
+// Environment ids to inherit variables from, separated by commas.
+// Later ids override earlier ones.
+type EnvironmentParents []containers.Identifier
+
+func (p *EnvironmentParents) Get() interface{} {
+	return *p
+}
+
+func (p *EnvironmentParents) String() string {
+	ids := make([]string, len(*p))
+	for i := range *p {
+		ids[i] = string((*p)[i])
+	}
+	return strings.Join(ids, ",")
+}
+
+func (p *EnvironmentParents) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		id, err := containers.NewIdentifier(strings.TrimSpace(s))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "The parent environment '%s' is not valid: %s\n", s, err.Error())
+			return err
+		}
+		*p = append(*p, id)
+	}
+	return nil
+}
@@ -2,20 +2,38 @@ package containers
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/openshift/geard/config"
+	"github.com/openshift/geard/encrypted"
 )
 
+// Secret values are written to environment files sealed with the host
+// secret key and prefixed by SecretPrefix.  Which variables are secret
+// is recorded separately, see EnvironmentSecretsPathFor.
+const SecretPrefix = "encrypted:"
+
+// Shown in place of the value of a secret.
+const MaskedValue = "********"
+
 type Environment struct {
 	Name  string
 	Value string
+	// The value is only readable by the container.  Once stored it is
+	// sealed with the host secret key.
+	Secret bool `json:"Secret,omitempty"`
 }
 
 func (e *Environment) Check() error {
@@ -25,15 +43,42 @@ func (e *Environment) Check() error {
 	if len(e.Name) > 1024 {
 		return errors.New("Name must be shorter than 1024 characters.")
 	}
+	if e.Sealed() {
+		if len(e.Value) > 12*1024 {
+			return errors.New("Sealed value must be less than 12KB.")
+		}
+		return nil
+	}
 	if len(e.Value) > 8*1024 {
 		return errors.New("Value must be less than 8KB.")
 	}
+	if e.Secret && strings.ContainsAny(e.Value, "\r\n") {
+		return errors.New("Secret values may not contain line breaks.")
+	}
 	return nil
 }
 
+// True if the value of a stored secret is sealed with a host key.
+func (e *Environment) Sealed() bool {
+	return e.Secret && strings.HasPrefix(e.Value, SecretPrefix)
+}
+
 var whiteSpaces = " \t"
 
+// Parse a <name>=<value> line.  The variable is never marked secret,
+// whatever its value.
 func (e *Environment) FromString(s string) (bool, error) {
+	match, err := e.parse(s)
+	if err != nil || !match {
+		return match, err
+	}
+	if err := e.Check(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (e *Environment) parse(s string) (bool, error) {
 	pair := strings.SplitN(s, "=", 2)
 	if len(pair) != 2 {
 		return false, nil
@@ -51,11 +96,7 @@ func (e *Environment) FromString(s string) (bool, error) {
 	}
 	e.Name = variable
 	e.Value = strings.TrimSpace(second)
-
-	if err := e.Check(); err != nil {
-		return false, err
-	}
-
+	e.Secret = false
 	return true, nil
 }
 
@@ -64,7 +105,7 @@ type EnvironmentVariables []Environment
 func ToArray(v map[string]string) EnvironmentVariables {
 	env := make(EnvironmentVariables, 0, len(v))
 	for name := range v {
-		env = append(env, Environment{name, v[name]})
+		env = append(env, Environment{Name: name, Value: v[name]})
 	}
 	return env
 }
@@ -96,13 +137,16 @@ type EnvironmentDescription struct {
 	Variables []Environment
 	Source    string
 	Id        Identifier // Used on creation only
+	// Environments whose variables are inherited, in override order.
+	// Replaces any existing parents when set.
+	Parents []Identifier `json:"Parents,omitempty"`
 }
 
 func (d *EnvironmentDescription) Empty() bool {
 	if len(d.Variables) > 0 {
 		return false
 	}
-	if d.Source != "" || d.Id != "" {
+	if d.Source != "" || d.Id != "" || len(d.Parents) > 0 {
 		return false
 	}
 	return true
@@ -114,6 +158,14 @@ func (d *EnvironmentDescription) Check() error {
 			return fmt.Errorf("invalid environment id: %s", err.Error())
 		}
 	}
+	for _, parent := range d.Parents {
+		if _, err := NewIdentifier(string(parent)); err != nil {
+			return fmt.Errorf("invalid parent environment id: %s", err.Error())
+		}
+		if parent == d.Id {
+			return errors.New("an environment may not inherit from itself")
+		}
+	}
 	for i := range d.Variables {
 		e := &d.Variables[i]
 		if err := e.Check(); err != nil {
@@ -158,12 +210,20 @@ func (j *EnvironmentDescription) Fetch(upto int64) error {
 	return nil
 }
 
-// Write the provided enviroment data to an appropriate location
+// Write the provided enviroment data to an appropriate location.
+// Secret values are sealed with the host secret key.  The parents are
+// replaced if any are given, or removed if the environment is not
+// appended to.
 func (j *EnvironmentDescription) Write(appends bool) error {
 	envPath := j.Id.EnvironmentPathFor()
 
+	env, err := sealSecrets(j.Variables)
+	if err != nil {
+		log.Print("job_environment: Unable to seal secret values: ", err)
+		return err
+	}
+
 	var file *os.File
-	var err error
 
 	if appends {
 		file, err = os.OpenFile(envPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0660)
@@ -179,7 +239,6 @@ func (j *EnvironmentDescription) Write(appends bool) error {
 	}
 	defer file.Close()
 
-	env := j.Variables
 	for i := range env {
 		if _, errw := fmt.Fprintf(file, "%s=%s\n", env[i].Name, env[i].Value); errw != nil {
 			log.Print("job_environment: Unable to write to environment file: ", err)
@@ -190,11 +249,31 @@ func (j *EnvironmentDescription) Write(appends bool) error {
 		log.Print("job_environment: Unable to close environment file: ", errc)
 		return err
 	}
+	secrets := make(map[string]bool)
+	if appends {
+		if secrets, err = ReadEnvironmentSecrets(j.Id); err != nil {
+			log.Print("job_environment: Unable to read environment secrets: ", err)
+			return err
+		}
+	}
+	for i := range env {
+		secrets[env[i].Name] = env[i].Secret
+	}
+	if errs := writeEnvironmentSecrets(j.Id, secrets); errs != nil {
+		log.Print("job_environment: Unable to write environment secrets: ", errs)
+		return errs
+	}
+	if !appends || len(j.Parents) > 0 {
+		if errp := WriteEnvironmentParents(j.Id, j.Parents); errp != nil {
+			log.Print("job_environment: Unable to write environment parents: ", errp)
+			return errp
+		}
+	}
 	return nil
 }
 
 func (j *EnvironmentDescription) ReadFrom(r io.Reader) error {
-	all := make(map[string]string)
+	all := make(map[string]Environment)
 	scanner := bufio.NewScanner(r)
 	e := Environment{}
 	for scanner.Scan() {
@@ -207,14 +286,17 @@ func (j *EnvironmentDescription) ReadFrom(r io.Reader) error {
 			continue
 		}
 		if match {
-			all[e.Name] = e.Value
+			all[e.Name] = e
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return err
 	}
 
-	j.Variables = ToArray(all)
+	j.Variables = make([]Environment, 0, len(all))
+	for name := range all {
+		j.Variables = append(j.Variables, all[name])
+	}
 
 	if err := j.Check(); err != nil {
 		return err
@@ -223,6 +305,84 @@ func (j *EnvironmentDescription) ReadFrom(r io.Reader) error {
 	return nil
 }
 
+// Read the variables stored for an environment, marking the ones that
+// were written as secrets.
+func ReadStoredEnvironment(id Identifier) (*EnvironmentDescription, error) {
+	secrets, err := ReadEnvironmentSecrets(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(id.EnvironmentPathFor())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	all := make(map[string]Environment)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		e := Environment{}
+		if match, err := e.parse(scanner.Text()); err != nil || !match {
+			continue
+		}
+		e.Secret = secrets[e.Name]
+		if err := e.Check(); err != nil {
+			continue
+		}
+		all[e.Name] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	j := &EnvironmentDescription{Id: id, Variables: make([]Environment, 0, len(all))}
+	for name := range all {
+		j.Variables = append(j.Variables, all[name])
+	}
+	return j, nil
+}
+
+// The names of the secret variables of an environment.
+func ReadEnvironmentSecrets(id Identifier) (map[string]bool, error) {
+	secrets := make(map[string]bool)
+	file, err := os.Open(id.EnvironmentSecretsPathFor())
+	if os.IsNotExist(err) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			secrets[name] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func writeEnvironmentSecrets(id Identifier, secrets map[string]bool) error {
+	names := make([]string, 0, len(secrets))
+	for name, secret := range secrets {
+		if secret {
+			names = append(names, name)
+		}
+	}
+	path := id.EnvironmentSecretsPathFor()
+	if len(names) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sort.Strings(names)
+	return writeFileAtomic(path, []byte(strings.Join(names, "\n")+"\n"), 0660)
+}
+
 func (j *EnvironmentDescription) Map() map[string]string {
 	env := make(map[string]string)
 	vars := j.Variables
@@ -233,3 +393,112 @@ func (j *EnvironmentDescription) Map() map[string]string {
 
 	return env
 }
+
+func SecretKeyPath() string {
+	return filepath.Join(config.ContainerBasePath(), "env", "secret.key")
+}
+
+// Seal the values of secrets, creating the host secret key if
+// necessary.  Values are always sealed, even if they already look
+// sealed.
+func sealSecrets(variables []Environment) ([]Environment, error) {
+	var key encrypted.SecretKey
+	sealed := make([]Environment, len(variables))
+	for i := range variables {
+		e := variables[i]
+		if e.Secret {
+			if key == nil {
+				k, err := encrypted.LoadOrCreateSecretKey(SecretKeyPath())
+				if err != nil {
+					return nil, err
+				}
+				key = k
+			}
+			value, err := key.Seal(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			e.Value = SecretPrefix + value
+		}
+		sealed[i] = e
+	}
+	return sealed, nil
+}
+
+// Copy an environment file to w with the value of every variable named
+// in secrets replaced by MaskedValue.
+func MaskEnvironment(r io.Reader, w io.Writer, secrets map[string]bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		e := Environment{}
+		if match, err := e.parse(line); err == nil && match && secrets[e.Name] {
+			line = e.Name + "=" + MaskedValue
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Write the environment file that is passed to the container when it
+// starts, with the variables of its parents merged in and every secret
+// decrypted.  The file is only readable by its owner and is kept under
+// the run path so it doesn't outlive a reboot.
+func WriteRuntimeEnvironment(id Identifier) error {
+	resolved, err := ResolveEnvironment(id)
+	if err != nil {
+		return err
+	}
+
+	var key encrypted.SecretKey
+	var runtime bytes.Buffer
+	for i := range resolved.Variables {
+		e := &resolved.Variables[i]
+		value := e.Value
+		if e.Secret {
+			if !e.Sealed() {
+				return fmt.Errorf("The secret %s is not sealed", e.Name)
+			}
+			if key == nil {
+				if key, err = encrypted.LoadSecretKey(SecretKeyPath()); err != nil {
+					return err
+				}
+			}
+			if value, err = key.Open(strings.TrimPrefix(e.Value, SecretPrefix)); err != nil {
+				return fmt.Errorf("Unable to decrypt %s: %s", e.Name, err.Error())
+			}
+		}
+		fmt.Fprintf(&runtime, "%s=%s\n", e.Name, value)
+	}
+
+	return writeFileAtomic(id.RuntimeEnvironmentPathFor(), runtime.Bytes(), 0600)
+}
+
+// Write data to a temporary file of its own next to path and rename it
+// into place, so that concurrent writers never share a file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Chmod(file.Name(), mode); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
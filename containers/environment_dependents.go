@@ -0,0 +1,193 @@
+package containers
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/openshift/geard/config"
+)
+
+// The environment a container references, read from its unit
+// definition.  Empty if it has none.
+func GetExistingEnvironmentId(id Identifier) (Identifier, error) {
+	r, err := os.Open(id.UnitPathFor())
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := scan.Text()
+		if strings.HasPrefix(line, "X-ContainerEnvironmentId=") {
+			return NewIdentifier(strings.TrimPrefix(line, "X-ContainerEnvironmentId="))
+		}
+	}
+	return "", scan.Err()
+}
+
+// Record that a container references an environment by linking the
+// container's unit definition under the environment.
+func AddEnvironmentDependent(envId, id Identifier) error {
+	dir := envId.EnvironmentDependentsPathFor()
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+	link := filepath.Join(dir, string(id))
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(id.UnitPathFor(), link)
+}
+
+var reContainerUnitFile = regexp.MustCompile("\\A" + regexp.QuoteMeta(IdentifierPrefix) + "(" + IdentifierSuffixPattern + ")\\.service\\z")
+
+// Record the environment of every installed container that references
+// one, so that containers installed before environments tracked their
+// dependents are restarted with the others.  Returns the containers
+// that were added.
+func BackfillEnvironmentDependents() ([]Identifier, error) {
+	unitsPath := filepath.Join(config.ContainerBasePath(), "units")
+	buckets, err := ioutil.ReadDir(unitsPath)
+	if os.IsNotExist(err) {
+		return []Identifier{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	added := []Identifier{}
+	for _, bucket := range buckets {
+		if !bucket.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(unitsPath, bucket.Name()))
+		if err != nil {
+			return added, err
+		}
+		for _, file := range files {
+			match := reContainerUnitFile.FindStringSubmatch(file.Name())
+			if file.IsDir() || match == nil {
+				continue
+			}
+			id, err := NewIdentifier(match[1])
+			if err != nil {
+				continue
+			}
+			envId, err := GetExistingEnvironmentId(id)
+			if err != nil {
+				return added, err
+			}
+			if envId == "" {
+				continue
+			}
+			if _, err := os.Lstat(filepath.Join(envId.EnvironmentDependentsPathFor(), string(id))); err == nil {
+				continue
+			}
+			if err := AddEnvironmentDependent(envId, id); err != nil {
+				return added, err
+			}
+			added = append(added, id)
+		}
+	}
+	return added, nil
+}
+
+func RemoveEnvironmentDependent(envId, id Identifier) error {
+	if err := os.Remove(filepath.Join(envId.EnvironmentDependentsPathFor(), string(id))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// The containers that receive the variables of an environment, because
+// they reference it or an environment that inherits from it.  Links to
+// containers that no longer exist are ignored.
+func EnvironmentDependents(envId Identifier) ([]Identifier, error) {
+	envs, err := environmentDescendants(envId)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[Identifier]bool)
+	for _, env := range envs {
+		dir := env.EnvironmentDependentsPathFor()
+		links, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			id, err := NewIdentifier(link.Name())
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, link.Name())); err != nil {
+				continue
+			}
+			found[id] = true
+		}
+	}
+
+	dependents := make([]Identifier, 0, len(found))
+	for id := range found {
+		dependents = append(dependents, id)
+	}
+	sort.Sort(identifiers(dependents))
+	return dependents, nil
+}
+
+// The environment and every environment that inherits from it.
+func environmentDescendants(envId Identifier) ([]Identifier, error) {
+	children := make(map[Identifier][]Identifier)
+	root := filepath.Join(config.ContainerBasePath(), "env", "parents")
+	prefixes, err := ioutil.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(root, prefix.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			id, err := NewIdentifier(file.Name())
+			if err != nil {
+				continue
+			}
+			parents, err := ReadEnvironmentParents(id)
+			if err != nil {
+				return nil, err
+			}
+			for _, parent := range parents {
+				children[parent] = append(children[parent], id)
+			}
+		}
+	}
+
+	envs := []Identifier{envId}
+	seen := map[Identifier]bool{envId: true}
+	for i := 0; i < len(envs); i++ {
+		for _, child := range children[envs[i]] {
+			if !seen[child] {
+				seen[child] = true
+				envs = append(envs, child)
+			}
+		}
+	}
+	return envs, nil
+}
+
+type identifiers []Identifier
+
+func (ids identifiers) Len() int           { return len(ids) }
+func (ids identifiers) Swap(a, b int)      { ids[a], ids[b] = ids[b], ids[a] }
+func (ids identifiers) Less(a, b int) bool { return ids[a] < ids[b] }
@@ -0,0 +1,220 @@
+package containers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// How many levels of parents an environment may inherit from.
+const maxEnvironmentDepth = 8
+
+// Read the environments that id inherits from, in override order.  An
+// environment without parents returns an empty list.
+func ReadEnvironmentParents(id Identifier) ([]Identifier, error) {
+	file, err := os.Open(id.EnvironmentParentsPathFor())
+	if os.IsNotExist(err) {
+		return []Identifier{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parents := []Identifier{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parent, err := NewIdentifier(line)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, parent)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return parents, nil
+}
+
+// Replace the parents of id.  An empty list removes them.
+func WriteEnvironmentParents(id Identifier, parents []Identifier) error {
+	path := id.EnvironmentParentsPathFor()
+	if len(parents) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for i := range parents {
+		if _, err := fmt.Fprintln(file, parents[i]); err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// The parents must already exist, and may not inherit from the
+// environment they are being added to.
+func (d *EnvironmentDescription) CheckParents() error {
+	for _, parent := range d.Parents {
+		if _, err := os.Stat(parent.EnvironmentPathFor()); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("The parent environment %s does not exist.", parent)
+			}
+			return err
+		}
+		ancestors, err := environmentAncestors(parent, 1)
+		if err != nil {
+			return err
+		}
+		for _, ancestor := range ancestors {
+			if ancestor == d.Id {
+				return fmt.Errorf("The environment %s already inherits from %s.", parent, d.Id)
+			}
+		}
+	}
+	return nil
+}
+
+func environmentAncestors(id Identifier, depth int) ([]Identifier, error) {
+	if depth > maxEnvironmentDepth {
+		return nil, fmt.Errorf("The environment %s inherits through more than %d levels of parents.", id, maxEnvironmentDepth)
+	}
+	parents, err := ReadEnvironmentParents(id)
+	if err != nil {
+		return nil, err
+	}
+	ancestors := append([]Identifier{}, parents...)
+	for _, parent := range parents {
+		more, err := environmentAncestors(parent, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, more...)
+	}
+	return ancestors, nil
+}
+
+// A variable of a resolved environment and the environment its value
+// came from.
+type ResolvedVariable struct {
+	Environment
+	Source Identifier
+}
+
+// The variables a container referencing an environment receives.
+type ResolvedEnvironment struct {
+	Id Identifier
+	// Sorted by name
+	Variables []ResolvedVariable
+	// Every environment that was read, in override order
+	Sources []Identifier
+}
+
+// Merge the variables of id with those of its parents.  Parents are
+// applied in the order they are listed, each overriding the ones
+// before it, and a parent's own parents are applied before it.  An
+// environment inherited more than once is applied once, before every
+// environment that inherits from it.  The variables of id override all
+// of its parents.
+func ResolveEnvironment(id Identifier) (*ResolvedEnvironment, error) {
+	r := &ResolvedEnvironment{Id: id}
+	if err := r.linearize(id, []Identifier{}); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]ResolvedVariable)
+	for i, source := range r.Sources {
+		env, err := ReadStoredEnvironment(source)
+		if err != nil {
+			if os.IsNotExist(err) && i < len(r.Sources)-1 {
+				return nil, fmt.Errorf("The parent environment %s of %s does not exist.", source, id)
+			}
+			return nil, err
+		}
+		for j := range env.Variables {
+			values[env.Variables[j].Name] = ResolvedVariable{env.Variables[j], source}
+		}
+	}
+	r.Variables = make([]ResolvedVariable, 0, len(values))
+	for name := range values {
+		r.Variables = append(r.Variables, values[name])
+	}
+	sort.Sort(resolvedByName(r.Variables))
+	return r, nil
+}
+
+// Add id to the sources after its parents, depth first.  An
+// environment that is already a source is not added again, since its
+// own parents are already before it.
+func (r *ResolvedEnvironment) linearize(id Identifier, path []Identifier) error {
+	for i := range path {
+		if path[i] == id {
+			return fmt.Errorf("The environment %s inherits from itself.", id)
+		}
+	}
+	if len(path) > maxEnvironmentDepth {
+		return fmt.Errorf("The environment %s inherits through more than %d levels of parents.", r.Id, maxEnvironmentDepth)
+	}
+	for i := range r.Sources {
+		if r.Sources[i] == id {
+			return nil
+		}
+	}
+	parents, err := ReadEnvironmentParents(id)
+	if err != nil {
+		return err
+	}
+	for _, parent := range parents {
+		if err := r.linearize(parent, append(path, id)); err != nil {
+			return err
+		}
+	}
+	r.Sources = append(r.Sources, id)
+	return nil
+}
+
+// Write the resolved variables with the values of secrets masked,
+// grouped under a comment naming the environment they came from.
+func (r *ResolvedEnvironment) WriteMaskedTo(w io.Writer) error {
+	for _, source := range r.Sources {
+		header := false
+		for i := range r.Variables {
+			v := &r.Variables[i]
+			if v.Source != source {
+				continue
+			}
+			if !header {
+				if _, err := fmt.Fprintf(w, "# from %s\n", source); err != nil {
+					return err
+				}
+				header = true
+			}
+			value := v.Value
+			if v.Secret {
+				value = MaskedValue
+			}
+			if _, err := fmt.Fprintf(w, "%s=%s\n", v.Name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type resolvedByName []ResolvedVariable
+
+func (r resolvedByName) Len() int           { return len(r) }
+func (r resolvedByName) Swap(a, b int)      { r[a], r[b] = r[b], r[a] }
+func (r resolvedByName) Less(a, b int) bool { return r[a].Name < r[b].Name }
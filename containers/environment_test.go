@@ -1,8 +1,14 @@
 package containers_test
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/openshift/geard/config"
 	. "github.com/openshift/geard/containers"
 )
 
@@ -45,3 +51,260 @@ func (e *envTest) assert(t *testing.T) {
 		t.Errorf("Expected value %s to equal %s", env.Value, e.value)
 	}
 }
+
+func TestSecretEnvironment(t *testing.T) {
+	base, _ := ioutil.TempDir(os.TempDir(), "envtest")
+	defer os.RemoveAll(base)
+	defer config.SetContainerBasePath(config.ContainerBasePath())
+	defer config.SetContainerRunPath(config.ContainerRunPath())
+	config.SetContainerBasePath(filepath.Join(base, "lib"))
+	config.SetContainerRunPath(filepath.Join(base, "run"))
+
+	env := EnvironmentDescription{
+		Id: "secretenv",
+		Variables: []Environment{
+			{Name: "USER", Value: "admin"},
+			{Name: "PASSWORD", Value: "s3cret", Secret: true},
+		},
+	}
+	if err := env.Write(false); err != nil {
+		t.Fatalf("Unable to write the environment: %v", err)
+	}
+	stored, _ := ioutil.ReadFile(env.Id.EnvironmentPathFor())
+	if strings.Contains(string(stored), "s3cret") || !strings.Contains(string(stored), "PASSWORD="+SecretPrefix) {
+		t.Errorf("Expected the secret to be sealed at rest: %s", stored)
+	}
+	if info, err := os.Stat(SecretKeyPath()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a host key only its owner can read: %v", err)
+	}
+
+	file, _ := os.Open(env.Id.EnvironmentPathFor())
+	defer file.Close()
+	masked := &bytes.Buffer{}
+	secrets, err := ReadEnvironmentSecrets(env.Id)
+	if err != nil || len(secrets) != 1 || !secrets["PASSWORD"] {
+		t.Fatalf("Expected only PASSWORD to be recorded as secret: %v %v", secrets, err)
+	}
+	if err := MaskEnvironment(file, masked, secrets); err != nil {
+		t.Fatalf("Unable to mask the environment: %v", err)
+	}
+	if s := masked.String(); s != "USER=admin\nPASSWORD="+MaskedValue+"\n" {
+		t.Errorf("Expected the secret to be masked: %s", s)
+	}
+
+	if err := WriteRuntimeEnvironment(env.Id); err != nil {
+		t.Fatalf("Unable to write the runtime environment: %v", err)
+	}
+	runtime, _ := ioutil.ReadFile(env.Id.RuntimeEnvironmentPathFor())
+	if string(runtime) != "PASSWORD=s3cret\nUSER=admin\n" {
+		t.Errorf("Expected the secret to be decrypted for the container: %s", runtime)
+	}
+	if info, _ := os.Stat(env.Id.RuntimeEnvironmentPathFor()); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the runtime environment to be readable only by its owner: %v", info.Mode())
+	}
+
+	// A plain value is never taken for a secret, whatever its prefix
+	plain := EnvironmentDescription{
+		Id:        env.Id,
+		Variables: []Environment{{Name: "TOKEN", Value: SecretPrefix + "abc"}},
+	}
+	if err := plain.Write(true); err != nil {
+		t.Fatalf("Unable to append to the environment: %v", err)
+	}
+	if secrets, _ := ReadEnvironmentSecrets(env.Id); len(secrets) != 1 || !secrets["PASSWORD"] {
+		t.Errorf("Expected the secrets to survive an append: %v", secrets)
+	}
+	if err := WriteRuntimeEnvironment(env.Id); err != nil {
+		t.Fatalf("Unable to write the runtime environment: %v", err)
+	}
+	runtime, _ = ioutil.ReadFile(env.Id.RuntimeEnvironmentPathFor())
+	if string(runtime) != "PASSWORD=s3cret\nTOKEN="+SecretPrefix+"abc\nUSER=admin\n" {
+		t.Errorf("Expected the plain value to be passed through unchanged: %s", runtime)
+	}
+
+	// Replacing a secret with a plain value makes it plain
+	replaced := EnvironmentDescription{
+		Id:        env.Id,
+		Variables: []Environment{{Name: "PASSWORD", Value: "public"}},
+	}
+	if err := replaced.Write(false); err != nil {
+		t.Fatalf("Unable to rewrite the environment: %v", err)
+	}
+	if _, err := os.Stat(env.Id.EnvironmentSecretsPathFor()); !os.IsNotExist(err) {
+		t.Errorf("Expected the secrets to be removed with the last secret: %v", err)
+	}
+}
+
+func TestResolveEnvironment(t *testing.T) {
+	base, _ := ioutil.TempDir(os.TempDir(), "envtest")
+	defer os.RemoveAll(base)
+	defer config.SetContainerBasePath(config.ContainerBasePath())
+	defer config.SetContainerRunPath(config.ContainerRunPath())
+	config.SetContainerBasePath(filepath.Join(base, "lib"))
+	config.SetContainerRunPath(filepath.Join(base, "run"))
+
+	for _, env := range []EnvironmentDescription{
+		{Id: "common", Variables: []Environment{{Name: "LOG_LEVEL", Value: "info"}, {Name: "REGION", Value: "east"}}},
+		{Id: "database", Variables: []Environment{{Name: "DB_URL", Value: "postgres://db"}, {Name: "DB_PASSWORD", Value: "s3cret", Secret: true}}, Parents: []Identifier{"common"}},
+		{Id: "debug", Variables: []Environment{{Name: "LOG_LEVEL", Value: "debug"}}},
+		{Id: "service", Variables: []Environment{{Name: "REGION", Value: "west"}}, Parents: []Identifier{"database", "debug"}},
+	} {
+		if err := env.CheckParents(); err != nil {
+			t.Fatalf("Unexpected invalid parents of %s: %v", env.Id, err)
+		}
+		if err := env.Write(false); err != nil {
+			t.Fatalf("Unable to write the environment %s: %v", env.Id, err)
+		}
+	}
+
+	resolved, err := ResolveEnvironment("service")
+	if err != nil {
+		t.Fatalf("Unable to resolve the environment: %v", err)
+	}
+	var shown bytes.Buffer
+	if err := resolved.WriteMaskedTo(&shown); err != nil {
+		t.Fatalf("Unable to write the resolved environment: %v", err)
+	}
+	expected := "# from database\nDB_PASSWORD=" + MaskedValue + "\nDB_URL=postgres://db\n# from debug\nLOG_LEVEL=debug\n# from service\nREGION=west\n"
+	if s := shown.String(); s != expected {
+		t.Errorf("Expected later parents and the environment itself to override earlier parents: %s", s)
+	}
+
+	if err := WriteRuntimeEnvironment("service"); err != nil {
+		t.Fatalf("Unable to write the runtime environment: %v", err)
+	}
+	runtime, _ := ioutil.ReadFile(Identifier("service").RuntimeEnvironmentPathFor())
+	if string(runtime) != "DB_PASSWORD=s3cret\nDB_URL=postgres://db\nLOG_LEVEL=debug\nREGION=west\n" {
+		t.Errorf("Expected the container to receive the merged environment: %s", runtime)
+	}
+
+	cycle := EnvironmentDescription{Id: "common", Parents: []Identifier{"service"}}
+	if err := cycle.CheckParents(); err == nil {
+		t.Errorf("Expected a parent that inherits from the environment to be rejected")
+	}
+	missing := EnvironmentDescription{Id: "other", Parents: []Identifier{"unknown"}}
+	if err := missing.CheckParents(); err == nil {
+		t.Errorf("Expected a parent that doesn't exist to be rejected")
+	}
+	self := EnvironmentDescription{Id: "other", Parents: []Identifier{"other"}}
+	if err := self.Check(); err == nil {
+		t.Errorf("Expected an environment that inherits from itself to be rejected")
+	}
+
+	// Patching without parents keeps them, replacing the environment removes them
+	patch := EnvironmentDescription{Id: "service", Variables: []Environment{{Name: "A", Value: "B"}}}
+	if err := patch.Write(true); err != nil {
+		t.Fatalf("Unable to patch the environment: %v", err)
+	}
+	if parents, _ := ReadEnvironmentParents("service"); len(parents) != 2 {
+		t.Errorf("Expected patching variables to keep the parents: %v", parents)
+	}
+	if err := patch.Write(false); err != nil {
+		t.Fatalf("Unable to replace the environment: %v", err)
+	}
+	if parents, _ := ReadEnvironmentParents("service"); len(parents) != 0 {
+		t.Errorf("Expected replacing the environment to remove the parents: %v", parents)
+	}
+}
+
+func TestResolveEnvironmentDiamond(t *testing.T) {
+	base, _ := ioutil.TempDir(os.TempDir(), "envtest")
+	defer os.RemoveAll(base)
+	defer config.SetContainerBasePath(config.ContainerBasePath())
+	config.SetContainerBasePath(base)
+
+	for _, env := range []EnvironmentDescription{
+		{Id: "base", Variables: []Environment{{Name: "LOG_LEVEL", Value: "info"}, {Name: "REGION", Value: "east"}}},
+		{Id: "logging", Variables: []Environment{{Name: "LOG_LEVEL", Value: "debug"}}, Parents: []Identifier{"base"}},
+		{Id: "region", Variables: []Environment{{Name: "ZONE", Value: "a"}}, Parents: []Identifier{"base"}},
+		{Id: "service", Parents: []Identifier{"logging", "region"}},
+	} {
+		if err := env.Write(false); err != nil {
+			t.Fatalf("Unable to write the environment %s: %v", env.Id, err)
+		}
+	}
+
+	resolved, err := ResolveEnvironment("service")
+	if err != nil {
+		t.Fatalf("Unable to resolve the environment: %v", err)
+	}
+	if len(resolved.Sources) != 4 || resolved.Sources[0] != "base" || resolved.Sources[1] != "logging" || resolved.Sources[2] != "region" || resolved.Sources[3] != "service" {
+		t.Errorf("Expected a shared parent to be applied once, before the environments that inherit from it: %v", resolved.Sources)
+	}
+	values := make(map[string]ResolvedVariable)
+	for _, v := range resolved.Variables {
+		values[v.Name] = v
+	}
+	if v := values["LOG_LEVEL"]; v.Value != "debug" || v.Source != "logging" {
+		t.Errorf("Expected a shared parent not to override the environments that inherit from it: %+v", v)
+	}
+	if v := values["REGION"]; v.Value != "east" || v.Source != "base" {
+		t.Errorf("Expected the variables of the shared parent to be inherited: %+v", v)
+	}
+}
+
+func TestEnvironmentDependents(t *testing.T) {
+	base, _ := ioutil.TempDir(os.TempDir(), "envtest")
+	defer os.RemoveAll(base)
+	defer config.SetContainerBasePath(config.ContainerBasePath())
+	config.SetContainerBasePath(base)
+
+	for _, env := range []EnvironmentDescription{
+		{Id: "common", Variables: []Environment{{Name: "A", Value: "B"}}},
+		{Id: "service", Parents: []Identifier{"common"}},
+		{Id: "other"},
+	} {
+		if err := env.Write(false); err != nil {
+			t.Fatalf("Unable to write the environment %s: %v", env.Id, err)
+		}
+	}
+	for id, envId := range map[Identifier]Identifier{"web1": "service", "web2": "service", "worker": "common", "batch": "other", "gone": "common"} {
+		if id != "gone" {
+			unit := "[Service]\nX-ContainerId=" + string(id) + "\nX-ContainerEnvironmentId=" + string(envId) + "\n"
+			if err := ioutil.WriteFile(id.UnitPathFor(), []byte(unit), 0664); err != nil {
+				t.Fatalf("Unable to write the unit of %s: %v", id, err)
+			}
+		}
+		if err := AddEnvironmentDependent(envId, id); err != nil {
+			t.Fatalf("Unable to record the environment of %s: %v", id, err)
+		}
+	}
+
+	if envId, err := GetExistingEnvironmentId("web1"); err != nil || envId != "service" {
+		t.Errorf("Expected the environment to be read from the unit: %s %v", envId, err)
+	}
+	dependents, err := EnvironmentDependents("common")
+	if err != nil {
+		t.Fatalf("Unable to find the dependents: %v", err)
+	}
+	if len(dependents) != 3 || dependents[0] != "web1" || dependents[1] != "web2" || dependents[2] != "worker" {
+		t.Errorf("Expected the containers of the environment and its children, without deleted containers: %v", dependents)
+	}
+
+	// Containers installed before their environment was recorded are found
+	legacy := Identifier("legacy")
+	unit := "[Service]\nX-ContainerId=legacy\nX-ContainerEnvironmentId=service\n"
+	if err := ioutil.WriteFile(legacy.UnitPathFor(), []byte(unit), 0664); err != nil {
+		t.Fatalf("Unable to write the unit of %s: %v", legacy, err)
+	}
+	added, err := BackfillEnvironmentDependents()
+	if err != nil {
+		t.Fatalf("Unable to record the environments of existing containers: %v", err)
+	}
+	if len(added) != 1 || added[0] != legacy {
+		t.Errorf("Expected only the unrecorded container to be added: %v", added)
+	}
+	if dependents, _ := EnvironmentDependents("service"); len(dependents) != 3 || dependents[0] != legacy {
+		t.Errorf("Expected the existing container to depend on its environment: %v", dependents)
+	}
+	if err := RemoveEnvironmentDependent("service", legacy); err != nil {
+		t.Fatalf("Unable to remove the dependent: %v", err)
+	}
+
+	if err := RemoveEnvironmentDependent("service", "web2"); err != nil {
+		t.Fatalf("Unable to remove the dependent: %v", err)
+	}
+	if dependents, _ := EnvironmentDependents("service"); len(dependents) != 1 || dependents[0] != "web1" {
+		t.Errorf("Expected the removed container not to depend on the environment: %v", dependents)
+	}
+}
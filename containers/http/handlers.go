@@ -7,6 +7,7 @@ import (
 	"github.com/openshift/geard/containers"
 	"github.com/openshift/geard/containers/http/remote"
 	cjobs "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/http"
 	"github.com/openshift/geard/http/client"
 	"github.com/openshift/go-json-rest"
@@ -22,11 +23,14 @@ func (h *HttpExtension) Routes() http.ExtensionMap {
 		&remote.HttpContainerLogRequest{}:       HandleContainerLogRequest,
 		&remote.HttpContainerStatusRequest{}:    HandleContainerStatusRequest,
 		&remote.HttpListContainerPortsRequest{}: HandleContainerPortsRequest,
+		&remote.HttpListPortsRequest{}:          HandleListPortsRequest,
 		&remote.HttpPurgeContainersRequest{}:    HandlePurgeContainersRequest,
 
 		&remote.HttpStartContainerRequest{}:   HandleStartContainerRequest,
 		&remote.HttpStopContainerRequest{}:    HandleStopContainerRequest,
 		&remote.HttpRestartContainerRequest{}: HandleRestartContainerRequest,
+		&remote.HttpIdleContainerRequest{}:    HandleIdleContainerRequest,
+		&remote.HttpUnidleContainerRequest{}:  HandleUnidleContainerRequest,
 
 		&remote.HttpLinkContainersRequest{}: HandleLinkContainersRequest,
 
@@ -39,6 +43,12 @@ func (h *HttpExtension) Routes() http.ExtensionMap {
 		&remote.HttpGetEnvironmentRequest{}:   HandleGetEnvironmentRequest,
 		&remote.HttpPatchEnvironmentRequest{}: HandlePatchEnvironmentRequest,
 		&remote.HttpPutEnvironmentRequest{}:   HandlePutEnvironmentRequest,
+
+		&remote.HttpListDeploymentsRequest{}:  HandleListDeploymentsRequest,
+		&remote.HttpGetDeploymentRequest{}:    HandleGetDeploymentRequest,
+		&remote.HttpPutDeploymentRequest{}:    HandlePutDeploymentRequest,
+		&remote.HttpDeleteDeploymentRequest{}: HandleDeleteDeploymentRequest,
+		&remote.HttpDiscoveryRequest{}:        HandleDiscoveryRequest,
 	}
 }
 func (h *HttpExtension) HttpJobFor(job interface{}) (exc client.RemoteExecutable, err error) {
@@ -152,6 +162,22 @@ func HandleRestartContainerRequest(conf *http.HttpConfiguration, context *http.H
 	return &cjobs.RestartContainerRequest{id}, nil
 }
 
+func HandleIdleContainerRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	id, errg := containers.NewIdentifier(r.PathParam("id"))
+	if errg != nil {
+		return nil, errg
+	}
+	return &cjobs.IdleContainerRequest{Id: id}, nil
+}
+
+func HandleUnidleContainerRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	id, errg := containers.NewIdentifier(r.PathParam("id"))
+	if errg != nil {
+		return nil, errg
+	}
+	return &cjobs.UnidleContainerRequest{Id: id}, nil
+}
+
 func HandleBuildImageRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
 	data := &cjobs.BuildImageRequest{}
 	if err := decodeBody(r, data); err != nil {
@@ -169,7 +195,7 @@ func HandleGetEnvironmentRequest(conf *http.HttpConfiguration, context *http.Htt
 	if errg != nil {
 		return nil, errg
 	}
-	return &cjobs.GetEnvironmentRequest{id}, nil
+	return &cjobs.GetEnvironmentRequest{Id: id, Resolved: r.URL.Query().Get("resolved") == "1"}, nil
 }
 
 func HandlePutEnvironmentRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
@@ -182,7 +208,11 @@ func HandlePutEnvironmentRequest(conf *http.HttpConfiguration, context *http.Htt
 		return nil, err
 	}
 	data.Id = id
-	return &cjobs.PutEnvironmentRequest{data}, nil
+	update, err := environmentUpdateFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	return &cjobs.PutEnvironmentRequest{EnvironmentDescription: data, EnvironmentUpdate: update}, nil
 }
 
 func HandlePatchEnvironmentRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
@@ -195,7 +225,22 @@ func HandlePatchEnvironmentRequest(conf *http.HttpConfiguration, context *http.H
 		return nil, err
 	}
 	data.Id = id
-	return &cjobs.PatchEnvironmentRequest{data}, nil
+	update, err := environmentUpdateFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	return &cjobs.PatchEnvironmentRequest{EnvironmentDescription: data, EnvironmentUpdate: update}, nil
+}
+
+func environmentUpdateFrom(r *rest.Request) (cjobs.EnvironmentUpdate, error) {
+	update := cjobs.EnvironmentUpdate{
+		Dependents: r.URL.Query().Get("dependents"),
+		Rolling:    r.URL.Query().Get("rolling") == "1",
+	}
+	if err := update.Check(); err != nil {
+		return update, err
+	}
+	return update, nil
 }
 
 func HandleLinkContainersRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
@@ -203,7 +248,7 @@ func HandleLinkContainersRequest(conf *http.HttpConfiguration, context *http.Htt
 	if err := decodeAndCheck(r, data); err != nil {
 		return nil, err
 	}
-	return &cjobs.LinkContainersRequest{ContainerLinks: data}, nil
+	return &cjobs.LinkContainersRequest{ContainerLinks: data, DockerSocket: conf.Docker.Socket}, nil
 }
 
 func limitedBodyReader(r *rest.Request) io.Reader {
@@ -214,6 +259,50 @@ type check interface {
 	Check() error
 }
 
+func HandleListPortsRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	return &cjobs.ListPortsRequest{}, nil
+}
+
+func HandleListDeploymentsRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	return &cjobs.ListDeploymentsRequest{}, nil
+}
+
+func HandleGetDeploymentRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	data := &cjobs.GetDeploymentRequest{Name: r.PathParam("id")}
+	if err := data.Check(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func HandlePutDeploymentRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	data := &cjobs.PutDeploymentRequest{Deployment: &deployment.Deployment{}}
+	if err := decodeBody(r, data.Deployment); err != nil {
+		return nil, err
+	}
+	data.Name = r.PathParam("id")
+	if err := data.Check(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func HandleDeleteDeploymentRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	data := &cjobs.DeleteDeploymentRequest{Name: r.PathParam("id")}
+	if err := data.Check(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func HandleDiscoveryRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+	data := &cjobs.DiscoveryRequest{Name: r.PathParam("id")}
+	if err := data.Check(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 func decodeBody(r *rest.Request, into interface{}) error {
 	if r.Body != nil {
 		dec := json.NewDecoder(limitedBodyReader(r))
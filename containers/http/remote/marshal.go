@@ -8,6 +8,7 @@ import (
 	"net/url"
 
 	cjobs "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/http/client"
 	"github.com/openshift/geard/port"
 )
@@ -46,6 +47,29 @@ func (h *HttpPatchEnvironmentRequest) MarshalHttpRequestBody(w io.Writer) error
 	return encoder.Encode(h.EnvironmentDescription)
 }
 
+func (h *HttpPutEnvironmentRequest) MarshalUrlQuery(values *url.Values) {
+	marshalEnvironmentUpdate(&h.EnvironmentUpdate, values)
+}
+
+func (h *HttpPatchEnvironmentRequest) MarshalUrlQuery(values *url.Values) {
+	marshalEnvironmentUpdate(&h.EnvironmentUpdate, values)
+}
+
+func marshalEnvironmentUpdate(u *cjobs.EnvironmentUpdate, values *url.Values) {
+	if u.Dependents != "" {
+		values.Add("dependents", u.Dependents)
+	}
+	if u.Rolling {
+		values.Add("rolling", "1")
+	}
+}
+
+func (h *HttpGetEnvironmentRequest) MarshalUrlQuery(values *url.Values) {
+	if h.GetEnvironmentRequest.Resolved {
+		values.Add("resolved", "1")
+	}
+}
+
 func (h *HttpLinkContainersRequest) MarshalHttpRequestBody(w io.Writer) error {
 	encoder := json.NewEncoder(w)
 	return encoder.Encode(h.LinkContainersRequest)
@@ -73,3 +97,79 @@ func (h *HttpListContainersRequest) UnmarshalHttpResponse(headers http.Header, r
 	}
 	return list, nil
 }
+
+func (h *HttpPutDeploymentRequest) MarshalHttpRequestBody(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(h.Deployment)
+}
+
+func (h *HttpGetDeploymentRequest) UnmarshalHttpResponse(headers http.Header, r io.Reader, mode client.ResponseContentMode) (interface{}, error) {
+	if r == nil {
+		return nil, errors.New("Unexpected empty response body to HttpGetDeploymentRequest")
+	}
+	decoder := json.NewDecoder(r)
+	d := &deployment.Deployment{}
+	if err := decoder.Decode(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Apply the "label" from the job to the response
+func (h *HttpListDeploymentsRequest) UnmarshalHttpResponse(headers http.Header, r io.Reader, mode client.ResponseContentMode) (interface{}, error) {
+	if r == nil {
+		return nil, errors.New("Unexpected empty response body to HttpListDeploymentsRequest")
+	}
+	decoder := json.NewDecoder(r)
+	list := &cjobs.ListDeploymentsResponse{}
+	if err := decoder.Decode(list); err != nil {
+		return nil, err
+	}
+	for i := range list.Deployments {
+		list.Deployments[i].Server = h.Server
+	}
+	return list, nil
+}
+
+func (h *HttpDiscoveryRequest) UnmarshalHttpResponse(headers http.Header, r io.Reader, mode client.ResponseContentMode) (interface{}, error) {
+	if r == nil {
+		return nil, errors.New("Unexpected empty response body to HttpDiscoveryRequest")
+	}
+	decoder := json.NewDecoder(r)
+	discovered := &cjobs.DiscoveryResponse{}
+	if err := decoder.Decode(discovered); err != nil {
+		return nil, err
+	}
+	return discovered, nil
+}
+
+func (h *HttpListContainerPortsRequest) UnmarshalHttpResponse(headers http.Header, r io.Reader, mode client.ResponseContentMode) (interface{}, error) {
+	if r == nil {
+		return nil, errors.New("Unexpected empty response body to HttpListContainerPortsRequest")
+	}
+	decoder := json.NewDecoder(r)
+	ports := &cjobs.ContainerPortsResponse{}
+	if err := decoder.Decode(ports); err != nil {
+		return nil, err
+	}
+	return ports, nil
+}
+
+// Apply the "label" from the job to the response
+func (h *HttpListPortsRequest) UnmarshalHttpResponse(headers http.Header, r io.Reader, mode client.ResponseContentMode) (interface{}, error) {
+	if r == nil {
+		return nil, errors.New("Unexpected empty response body to HttpListPortsRequest")
+	}
+	decoder := json.NewDecoder(r)
+	list := &cjobs.ListPortsResponse{}
+	if err := decoder.Decode(list); err != nil {
+		return nil, err
+	}
+	for i := range list.Reservations {
+		list.Reservations[i].Server = h.Server
+	}
+	for i := range list.Interfaces {
+		list.Interfaces[i].Server = h.Server
+	}
+	return list, nil
+}
@@ -16,6 +16,10 @@ func HttpJobFor(job interface{}) (exc client.RemoteExecutable, err error) {
 		exc = &HttpStopContainerRequest{StoppedContainerStateRequest: *j}
 	case *cjobs.RestartContainerRequest:
 		exc = &HttpRestartContainerRequest{RestartContainerRequest: *j}
+	case *cjobs.IdleContainerRequest:
+		exc = &HttpIdleContainerRequest{IdleContainerRequest: *j}
+	case *cjobs.UnidleContainerRequest:
+		exc = &HttpUnidleContainerRequest{UnidleContainerRequest: *j}
 	case *cjobs.GetEnvironmentRequest:
 		exc = &HttpGetEnvironmentRequest{GetEnvironmentRequest: *j}
 	case *cjobs.PutEnvironmentRequest:
@@ -34,6 +38,20 @@ func HttpJobFor(job interface{}) (exc client.RemoteExecutable, err error) {
 		exc = &HttpListContainersRequest{ListContainersRequest: *j}
 	case *cjobs.PurgeContainersRequest:
 		exc = &HttpPurgeContainersRequest{PurgeContainersRequest: *j}
+	case *cjobs.ListDeploymentsRequest:
+		exc = &HttpListDeploymentsRequest{ListDeploymentsRequest: *j}
+	case *cjobs.GetDeploymentRequest:
+		exc = &HttpGetDeploymentRequest{GetDeploymentRequest: *j}
+	case *cjobs.PutDeploymentRequest:
+		exc = &HttpPutDeploymentRequest{PutDeploymentRequest: *j}
+	case *cjobs.DeleteDeploymentRequest:
+		exc = &HttpDeleteDeploymentRequest{DeleteDeploymentRequest: *j}
+	case *cjobs.DiscoveryRequest:
+		exc = &HttpDiscoveryRequest{DiscoveryRequest: *j}
+	case *cjobs.ContainerPortsRequest:
+		exc = &HttpListContainerPortsRequest{ContainerPortsRequest: *j}
+	case *cjobs.ListPortsRequest:
+		exc = &HttpListPortsRequest{ListPortsRequest: *j}
 	default:
 		err = jobs.ErrNoJobForRequest
 	}
@@ -122,6 +140,14 @@ func (h *HttpListContainerPortsRequest) HttpPath() string {
 	return client.Inline("/container/:id/ports", string(h.Id))
 }
 
+type HttpListPortsRequest struct {
+	cjobs.ListPortsRequest
+	client.DefaultRequest
+}
+
+func (h *HttpListPortsRequest) HttpMethod() string { return "GET" }
+func (h *HttpListPortsRequest) HttpPath() string   { return "/ports" }
+
 type HttpStartContainerRequest struct {
 	cjobs.StartedContainerStateRequest
 	client.DefaultRequest
@@ -152,6 +178,26 @@ func (h *HttpRestartContainerRequest) HttpPath() string {
 	return client.Inline("/container/:id/restart", string(h.Id))
 }
 
+type HttpIdleContainerRequest struct {
+	cjobs.IdleContainerRequest
+	client.DefaultRequest
+}
+
+func (h *HttpIdleContainerRequest) HttpMethod() string { return "POST" }
+func (h *HttpIdleContainerRequest) HttpPath() string {
+	return client.Inline("/container/:id/idle", string(h.Id))
+}
+
+type HttpUnidleContainerRequest struct {
+	cjobs.UnidleContainerRequest
+	client.DefaultRequest
+}
+
+func (h *HttpUnidleContainerRequest) HttpMethod() string { return "POST" }
+func (h *HttpUnidleContainerRequest) HttpPath() string {
+	return client.Inline("/container/:id/unidle", string(h.Id))
+}
+
 type HttpBuildImageRequest struct {
 	cjobs.BuildImageRequest
 	client.DefaultRequest
@@ -225,3 +271,51 @@ type HttpPurgeContainersRequest struct {
 
 func (h *HttpPurgeContainersRequest) HttpMethod() string { return "DELETE" }
 func (h *HttpPurgeContainersRequest) HttpPath() string   { return "/containers" }
+
+type HttpListDeploymentsRequest struct {
+	cjobs.ListDeploymentsRequest
+	client.DefaultRequest
+}
+
+func (h *HttpListDeploymentsRequest) HttpMethod() string { return "GET" }
+func (h *HttpListDeploymentsRequest) HttpPath() string   { return "/deployments" }
+
+type HttpGetDeploymentRequest struct {
+	cjobs.GetDeploymentRequest
+	client.DefaultRequest
+}
+
+func (h *HttpGetDeploymentRequest) HttpMethod() string { return "GET" }
+func (h *HttpGetDeploymentRequest) HttpPath() string {
+	return client.Inline("/deployments/:id", h.Name)
+}
+
+type HttpPutDeploymentRequest struct {
+	cjobs.PutDeploymentRequest
+	client.DefaultRequest
+}
+
+func (h *HttpPutDeploymentRequest) HttpMethod() string { return "PUT" }
+func (h *HttpPutDeploymentRequest) HttpPath() string {
+	return client.Inline("/deployments/:id", h.Name)
+}
+
+type HttpDeleteDeploymentRequest struct {
+	cjobs.DeleteDeploymentRequest
+	client.DefaultRequest
+}
+
+func (h *HttpDeleteDeploymentRequest) HttpMethod() string { return "DELETE" }
+func (h *HttpDeleteDeploymentRequest) HttpPath() string {
+	return client.Inline("/deployments/:id", h.Name)
+}
+
+type HttpDiscoveryRequest struct {
+	cjobs.DiscoveryRequest
+	client.DefaultRequest
+}
+
+func (h *HttpDiscoveryRequest) HttpMethod() string { return "GET" }
+func (h *HttpDiscoveryRequest) HttpPath() string {
+	return client.Inline("/discovery/:id", h.Name)
+}
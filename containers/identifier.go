@@ -95,10 +95,42 @@ func (i Identifier) EnvironmentPathFor() string {
 	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "env", "contents"), string(i), "")
 }
 
+// The environments whose variables the environment inherits, one per
+// line.
+func (i Identifier) EnvironmentParentsPathFor() string {
+	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "env", "parents"), string(i), "")
+}
+
+// The names of the variables of the environment that are secret, one
+// per line.  Kept apart from the variables so that no value can make a
+// variable secret.
+func (i Identifier) EnvironmentSecretsPathFor() string {
+	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "env", "secrets"), string(i), "")
+}
+
+// The directory of links to the unit definitions of the containers
+// that reference the environment.
+func (i Identifier) EnvironmentDependentsPathFor() string {
+	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "env", "dependents"), string(i), "")
+}
+
+// The environment passed to containers, with secrets decrypted.
+func (i Identifier) RuntimeEnvironmentPathFor() string {
+	return utils.IsolateContentPathWithPerm(filepath.Join(config.ContainerRunPath(), "env"), string(i), "", 0700)
+}
+
 func (i Identifier) NetworkLinksPathFor() string {
 	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "ports", "links"), string(i), "")
 }
 
+func (i Identifier) RoutesPathFor() string {
+	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "routes"), string(i), "")
+}
+
+func (i Identifier) IdlePolicyPathFor() string {
+	return utils.IsolateContentPath(filepath.Join(config.ContainerBasePath(), "idle"), string(i), "")
+}
+
 func (i Identifier) BaseHomePath() string {
 	return utils.IsolateContentPathWithPerm(filepath.Join(config.ContainerBasePath(), "home"), string(i), "", 0775)
 }
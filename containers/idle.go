@@ -0,0 +1,223 @@
+package containers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/geard/config"
+)
+
+// When the idler may stop a container for lack of traffic.  The zero
+// value idles a container that received no packets during the idler's
+// default timeout.
+type IdlePolicy struct {
+	// The container is never idled
+	Never bool `json:"Never,omitempty"`
+	// Minutes of low traffic before the container is idled.  Zero uses
+	// the timeout of the idler.
+	Timeout int `json:"Timeout,omitempty"`
+	// The container is idled when it receives fewer packets and fewer
+	// bytes than these within the timeout.  A threshold of zero is
+	// ignored.
+	MinPackets uint64 `json:"MinPackets,omitempty"`
+	MinBytes   uint64 `json:"MinBytes,omitempty"`
+}
+
+func (p *IdlePolicy) Check() error {
+	if p.Timeout < 0 {
+		return errors.New("The idle timeout must not be negative")
+	}
+	if p.Never && (p.Timeout != 0 || p.MinPackets != 0 || p.MinBytes != 0) {
+		return errors.New("An idle policy that never idles may not have a timeout or thresholds")
+	}
+	return nil
+}
+
+// True if the policy is the same as not having one.
+func (p *IdlePolicy) Default() bool {
+	return *p == IdlePolicy{}
+}
+
+// How long the container must have low traffic before it is idled.
+func (p *IdlePolicy) TimeoutOr(defaultTimeout time.Duration) time.Duration {
+	if p.Timeout > 0 {
+		return time.Duration(p.Timeout) * time.Minute
+	}
+	return defaultTimeout
+}
+
+// True if a container that received this traffic within the timeout
+// should be idled.
+func (p *IdlePolicy) ShouldIdle(packets, bytes uint64) bool {
+	if p.Never {
+		return false
+	}
+	if p.MinPackets == 0 && p.MinBytes == 0 {
+		return packets == 0
+	}
+	if p.MinPackets != 0 && packets >= p.MinPackets {
+		return false
+	}
+	if p.MinBytes != 0 && bytes >= p.MinBytes {
+		return false
+	}
+	return true
+}
+
+// Replace the policy stored at path, removing the file for the
+// default policy.
+func (p *IdlePolicy) Write(path string) error {
+	if p == nil || p.Default() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0640)
+}
+
+// Read the idle policy of a container.  A container without a policy
+// returns the default policy.
+func ReadIdlePolicy(path string) (*IdlePolicy, error) {
+	policy := &IdlePolicy{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return policy, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Parse an idle policy of the form 'never', 'default', or a comma
+// delimited list of 'timeout=<minutes>', 'packets=<count>', and
+// 'bytes=<count>'.
+func NewIdlePolicyFromString(s string) (*IdlePolicy, error) {
+	policy := &IdlePolicy{}
+	switch strings.TrimSpace(s) {
+	case "", "default":
+		return policy, nil
+	case "never":
+		policy.Never = true
+		return policy, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		pair := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(pair) != 2 {
+			return nil, errors.New(fmt.Sprintf("The idle policy setting '%s' must be of the form <name>=<value>", item))
+		}
+		value, err := strconv.ParseUint(pair[1], 10, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("The idle policy setting '%s' must be a non-negative integer", item))
+		}
+		switch pair[0] {
+		case "timeout":
+			policy.Timeout = int(value)
+		case "packets":
+			policy.MinPackets = value
+		case "bytes":
+			policy.MinBytes = value
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown idle policy setting '%s', expected timeout, packets, or bytes", pair[0]))
+		}
+	}
+	if err := policy.Check(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *IdlePolicy) String() string {
+	if p.Never {
+		return "never"
+	}
+	if p.Default() {
+		return "default"
+	}
+	values := []string{}
+	if p.Timeout != 0 {
+		values = append(values, "timeout="+strconv.Itoa(p.Timeout))
+	}
+	if p.MinPackets != 0 {
+		values = append(values, "packets="+strconv.FormatUint(p.MinPackets, 10))
+	}
+	if p.MinBytes != 0 {
+		values = append(values, "bytes="+strconv.FormatUint(p.MinBytes, 10))
+	}
+	return strings.Join(values, ",")
+}
+
+// A sentence describing when the policy idles a container.
+func (p *IdlePolicy) Describe() string {
+	if p.Never {
+		return "never idled"
+	}
+	var buf bytes.Buffer
+	if p.Timeout != 0 {
+		fmt.Fprintf(&buf, "idled after %d minutes", p.Timeout)
+	} else {
+		buf.WriteString("idled after the idler timeout")
+	}
+	switch {
+	case p.MinPackets != 0 && p.MinBytes != 0:
+		fmt.Fprintf(&buf, " with fewer than %d packets and %d bytes", p.MinPackets, p.MinBytes)
+	case p.MinPackets != 0:
+		fmt.Fprintf(&buf, " with fewer than %d packets", p.MinPackets)
+	case p.MinBytes != 0:
+		fmt.Fprintf(&buf, " with fewer than %d bytes", p.MinBytes)
+	default:
+		buf.WriteString(" without traffic")
+	}
+	return buf.String()
+}
+
+// When the idler next decides whether each running container should
+// be idled.  Written by the idler after every check.
+type IdleSchedule map[Identifier]time.Time
+
+func IdleSchedulePath() string {
+	return filepath.Join(config.ContainerBasePath(), "idle", "schedule.json")
+}
+
+func (s IdleSchedule) Write(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Read the idle schedule.  Returns an empty schedule if the idler has
+// not written one.
+func ReadIdleSchedule(path string) (IdleSchedule, error) {
+	schedule := IdleSchedule{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return schedule, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
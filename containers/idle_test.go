@@ -0,0 +1,59 @@
+package containers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewIdlePolicyFromString(t *testing.T) {
+	policy, err := NewIdlePolicyFromString("timeout=30,packets=10,bytes=4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *policy != (IdlePolicy{Timeout: 30, MinPackets: 10, MinBytes: 4096}) {
+		t.Fatalf("Unexpected policy %+v", policy)
+	}
+	if s := policy.String(); s != "timeout=30,packets=10,bytes=4096" {
+		t.Errorf("Unexpected compact policy: %s", s)
+	}
+	if policy.TimeoutOr(time.Hour) != 30*time.Minute {
+		t.Errorf("Expected the policy timeout to override the default")
+	}
+
+	never, err := NewIdlePolicyFromString("never")
+	if err != nil || !never.Never || never.String() != "never" {
+		t.Errorf("Unexpected never policy %+v: %v", never, err)
+	}
+	if def, err := NewIdlePolicyFromString("default"); err != nil || !def.Default() || def.TimeoutOr(time.Hour) != time.Hour {
+		t.Errorf("Unexpected default policy %+v: %v", def, err)
+	}
+
+	for _, invalid := range []string{"timeout", "timeout=-1", "minutes=5", "packets=ten"} {
+		if _, err := NewIdlePolicyFromString(invalid); err == nil {
+			t.Errorf("Expected '%s' to be rejected", invalid)
+		}
+	}
+}
+
+func TestIdlePolicyShouldIdle(t *testing.T) {
+	tests := []struct {
+		policy  IdlePolicy
+		packets uint64
+		bytes   uint64
+		idle    bool
+	}{
+		{IdlePolicy{}, 0, 0, true},
+		{IdlePolicy{}, 1, 40, false},
+		{IdlePolicy{Never: true}, 0, 0, false},
+		{IdlePolicy{MinPackets: 10}, 9, 100000, true},
+		{IdlePolicy{MinPackets: 10}, 10, 0, false},
+		{IdlePolicy{MinBytes: 1024}, 500, 1023, true},
+		{IdlePolicy{MinPackets: 10, MinBytes: 1024}, 5, 2048, false},
+		{IdlePolicy{MinPackets: 10, MinBytes: 1024}, 5, 512, true},
+	}
+	for i, test := range tests {
+		if idle := test.policy.ShouldIdle(test.packets, test.bytes); idle != test.idle {
+			t.Errorf("%d: expected %+v with %d packets and %d bytes to idle=%t", i, test.policy, test.packets, test.bytes, test.idle)
+		}
+	}
+}
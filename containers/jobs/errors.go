@@ -10,6 +10,9 @@ var (
 	ErrContainerStartFailed    = jobs.SimpleError{jobs.ResponseError, "Unable to start this container."}
 	ErrContainerStopFailed     = jobs.SimpleError{jobs.ResponseError, "Unable to stop this container."}
 	ErrContainerRestartFailed  = jobs.SimpleError{jobs.ResponseError, "Unable to restart this container."}
+	ErrContainerIdleFailed     = jobs.SimpleError{jobs.ResponseError, "Unable to idle this container."}
+	ErrContainerUnidleFailed   = jobs.SimpleError{jobs.ResponseError, "Unable to unidle this container."}
+	ErrContainerNotStarted     = jobs.SimpleError{jobs.ResponseNotAcceptable, "Only started containers can be idled."}
 	ErrEnvironmentNotFound     = jobs.SimpleError{jobs.ResponseNotFound, "Unable to find the requested environment."}
 	ErrEnvironmentUpdateFailed = jobs.SimpleError{jobs.ResponseError, "Unable to update the specified environment."}
 	ErrListImagesFailed        = jobs.SimpleError{jobs.ResponseError, "Unable to list docker images."}
@@ -19,6 +22,14 @@ var (
 	ErrRestartRequestThrottled = jobs.SimpleError{jobs.ResponseRateLimit, "It has been too soon since the last request to restart or the state is currently changing."}
 	ErrLinkContainersFailed    = jobs.SimpleError{jobs.ResponseError, "Not all links could be set."}
 	ErrDeleteContainerFailed   = jobs.SimpleError{jobs.ResponseError, "Unable to delete the container."}
+	ErrDeploymentNotFound      = jobs.SimpleError{jobs.ResponseNotFound, "No deployment is stored with this name."}
+	ErrDeploymentReadFailed    = jobs.SimpleError{jobs.ResponseError, "Unable to read the stored deployment."}
+	ErrDeploymentUpdateFailed  = jobs.SimpleError{jobs.ResponseError, "Unable to store the deployment."}
+	ErrDeleteDeploymentFailed  = jobs.SimpleError{jobs.ResponseError, "Unable to delete the deployment."}
+	ErrListDeploymentsFailed   = jobs.SimpleError{jobs.ResponseError, "Unable to list the stored deployments."}
+	ErrDiscoveryNotFound       = jobs.SimpleError{jobs.ResponseNotFound, "No container with this name is part of a stored deployment."}
+	ErrListPortsFailed         = jobs.SimpleError{jobs.ResponseError, "Unable to list the reserved ports."}
+	ErrReleasePortsFailed      = jobs.SimpleError{jobs.ResponseError, "Unable to release the reserved ports."}
 
 	ErrContainerCreateFailed              = jobs.SimpleError{jobs.ResponseError, "Unable to create container."}
 	ErrContainerCreateFailedInvalidSlice  = jobs.SimpleError{jobs.ResponseError, "Provided systemd slice is not installed on system."}
@@ -2,9 +2,12 @@ package jobs
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/port"
 )
@@ -74,6 +77,11 @@ type InstallContainerRequest struct {
 	Environment  *containers.EnvironmentDescription
 	NetworkLinks *containers.NetworkLinks
 	VolumeConfig *containers.VolumeConfig
+	// Routes to register with the router while the container runs
+	Routes *containers.Routes `json:"Routes,omitempty"`
+	// When the idler may stop the container.  Nil leaves an existing
+	// policy unchanged.
+	Idle *containers.IdlePolicy `json:"Idle,omitempty"`
 
 	// Should the container be started by default
 	Started bool
@@ -108,6 +116,29 @@ func (req *InstallContainerRequest) Check() error {
 	if req.Ports == nil {
 		req.Ports = make([]port.PortPair, 0)
 	}
+	for i := range req.Ports {
+		if err := req.Ports[i].Check(); err != nil {
+			return err
+		}
+		if req.SocketActivation && !req.SkipSocketProxy && req.Ports[i].Protocol.UDP() {
+			return errors.New("UDP ports cannot be proxied - use socket activation without the proxy.")
+		}
+	}
+	if req.Routes != nil {
+		if err := req.Routes.Check(); err != nil {
+			return err
+		}
+		for i := range *req.Routes {
+			if _, found := (*req.Routes)[i].PortFrom(req.Ports); !found {
+				return errors.New(fmt.Sprintf("The route to %s must use one of the container's TCP ports", (*req.Routes)[i].FrontendName()))
+			}
+		}
+	}
+	if req.Idle != nil {
+		if err := req.Idle.Check(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -131,6 +162,17 @@ type RestartContainerRequest struct {
 	Id containers.Identifier
 }
 
+// Stop a running container until traffic arrives for it.  The
+// container remains started on boot, and the idler wakes it with an
+// UnidleContainerRequest.
+type IdleContainerRequest struct {
+	Id containers.Identifier
+}
+
+type UnidleContainerRequest struct {
+	Id containers.Identifier
+}
+
 type BuildImageRequest struct {
 	Name         string
 	Source       string
@@ -173,6 +215,58 @@ type ContainerPortsResponse struct {
 	Ports port.PortPairs
 }
 
+// List every port reserved on a host, with the container that holds
+// it, and how much of each interface's range is free.
+type ListPortsRequest struct{}
+
+type PortReservationResponse struct {
+	port.Reservation
+	Owner containers.Identifier `json:"Owner,omitempty"`
+	// The reservation no longer belongs to an installed container
+	Orphaned bool `json:"Orphaned,omitempty"`
+	// Used by consumers
+	Server string `json:"Server,omitempty"`
+}
+type PortReservationResponses []PortReservationResponse
+
+type InterfaceUsageResponse struct {
+	port.InterfaceUsage
+	// Used by consumers
+	Server string `json:"Server,omitempty"`
+}
+type InterfaceUsageResponses []InterfaceUsageResponse
+
+type ListPortsResponse struct {
+	Reservations PortReservationResponses
+	Interfaces   InterfaceUsageResponses
+}
+
+// Release port reservations on a host that no container holds.  There
+// is no remote API for this request - it only runs on the host itself,
+// by an administrator.
+type ReleasePortsRequest struct {
+	// The reservations to release, or every orphaned one if empty.  The
+	// Path of each is ignored.
+	Ports port.Reservations `json:"Ports,omitempty"`
+	// Release the named ports even if a container still holds them
+	Force bool `json:"Force,omitempty"`
+}
+
+func (r *ReleasePortsRequest) Check() error {
+	for i := range r.Ports {
+		if r.Ports[i].Device == "" {
+			return errors.New("Each port to release must name a device.")
+		}
+		if err := r.Ports[i].Port.Check(); err != nil {
+			return err
+		}
+		if err := r.Ports[i].Protocol.Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type ContainerStatusRequest struct {
 	Id containers.Identifier
 }
@@ -191,18 +285,51 @@ type DeleteContainerRequest struct {
 
 type GetEnvironmentRequest struct {
 	Id containers.Identifier
+	// Merge in the variables of the parent environments and show the
+	// environment each value came from
+	Resolved bool
 }
 
 type PutEnvironmentRequest struct {
 	containers.EnvironmentDescription
+	EnvironmentUpdate
 }
 
 type PatchEnvironmentRequest struct {
 	containers.EnvironmentDescription
+	EnvironmentUpdate
+}
+
+// Running processes keep the environment they were started with, and
+// docker only reads it when a container is created, so restarting the
+// containers that use an environment is the only way to give them the
+// new values.
+const RestartDependents = "restart"
+
+// What to do with the running containers that use an environment,
+// directly or through a child environment, once it has changed.
+type EnvironmentUpdate struct {
+	// RestartDependents, or empty to leave them running
+	Dependents string
+	// Update one container at a time and stop at the first failure
+	Rolling bool
+}
+
+func (u *EnvironmentUpdate) Check() error {
+	switch u.Dependents {
+	case "", RestartDependents:
+	default:
+		return errors.New(fmt.Sprintf("Dependents must be '%s'", RestartDependents))
+	}
+	if u.Rolling && u.Dependents == "" {
+		return errors.New("A rolling update requires dependents to be restarted")
+	}
+	return nil
 }
 
 type LinkContainersRequest struct {
 	*containers.ContainerLinks
+	DockerSocket string `json:"-"`
 }
 
 type ListImagesRequest struct {
@@ -240,6 +367,70 @@ type ListBuildsResponse struct {
 
 type PurgeContainersRequest struct{}
 
+// Store a deployment and the state of its instances on a server
+// under a name, replacing any deployment already stored there.
+type PutDeploymentRequest struct {
+	Name string
+	*deployment.Deployment
+}
+
+func (r *PutDeploymentRequest) Check() error {
+	if err := deployment.CheckName(r.Name); err != nil {
+		return err
+	}
+	if r.Deployment == nil {
+		return errors.New("A deployment must be provided")
+	}
+	return r.Deployment.Validate()
+}
+
+type GetDeploymentRequest struct {
+	Name string
+}
+
+func (r *GetDeploymentRequest) Check() error {
+	return deployment.CheckName(r.Name)
+}
+
+type DeleteDeploymentRequest struct {
+	Name string
+}
+
+func (r *DeleteDeploymentRequest) Check() error {
+	return deployment.CheckName(r.Name)
+}
+
+type ListDeploymentsRequest struct{}
+
+// Resolve a '<container>.<deployment>' name to the instances of a
+// stored deployment.
+type DiscoveryRequest struct {
+	Name string
+}
+
+func (r *DiscoveryRequest) Check() error {
+	_, _, err := deployment.ParseDiscoveryName(r.Name)
+	return err
+}
+
+type DiscoveryResponse struct {
+	Name      string
+	Endpoints deployment.Endpoints
+}
+
+type DeploymentResponse struct {
+	Name       string
+	Server     string `json:"Server,omitempty"`
+	Containers int
+	Instances  int
+	Updated    time.Time
+}
+type DeploymentResponses []DeploymentResponse
+
+type ListDeploymentsResponse struct {
+	Deployments DeploymentResponses
+}
+
 type RunContainerRequest struct {
 	Name      string
 	Image     string
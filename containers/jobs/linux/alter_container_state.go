@@ -92,6 +92,13 @@ func inStateOrTooSoon(id containers.Identifier, unit string, active, transition
 	return
 }
 
+// A container that is explicitly started is no longer idle.
+func clearIdleFlag(id containers.Identifier) {
+	if err := os.Remove(id.IdleUnitPathFor()); err != nil && !os.IsNotExist(err) {
+		log.Printf("alter_container_state: Unable to remove the idle marker for %s: %v", id, err)
+	}
+}
+
 type startContainer struct {
 	*StartedContainerStateRequest
 	systemd systemd.Systemd
@@ -117,6 +124,7 @@ func (j *startContainer) Execute(resp jobs.Response) {
 		resp.Failure(ErrContainerStartFailed)
 		return
 	}
+	clearIdleFlag(j.Id)
 
 	if err := systemd.EnableAndReloadUnit(systemd.Connection(), unitName, unitPath); err != nil {
 		if systemd.IsNoSuchUnit(err) || systemd.IsFileNotFound(err) {
@@ -246,6 +254,7 @@ func (j *restartContainer) Execute(resp jobs.Response) {
 		resp.Failure(ErrContainerRestartFailed)
 		return
 	}
+	clearIdleFlag(j.Id)
 
 	if err := systemd.EnableAndReloadUnit(systemd.Connection(), unitName, unitPath); err != nil {
 		if systemd.IsNoSuchUnit(err) || systemd.IsFileNotFound(err) {
@@ -1,9 +1,14 @@
 package linux
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/openshift/geard/containers"
 	. "github.com/openshift/geard/containers/jobs"
 	"github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/systemd"
@@ -25,4 +30,70 @@ func (j *containerStatus) Execute(resp jobs.Response) {
 	if err != nil {
 		log.Printf("container_status: Unable to fetch container status logs: %s\n", err.Error())
 	}
+	writeLinkStatusTo(w, j.Id)
+	writeIdleStatusTo(w, j.Id, time.Now())
+}
+
+// Describe whether the container is idle, the policy the idler applies
+// to it, and when the idler next checks its traffic.
+func writeIdleStatusTo(w io.Writer, id containers.Identifier, now time.Time) {
+	policy, err := containers.ReadIdlePolicy(id.IdlePolicyPathFor())
+	if err != nil {
+		log.Printf("container_status: Unable to read idle policy: %v", err)
+		return
+	}
+	_, err = os.Stat(id.IdleUnitPathFor())
+	idle := err == nil
+
+	fmt.Fprintf(w, "\nIdling:\n")
+	if idle {
+		fmt.Fprintf(w, "  Idle: yes, started on the next connection\n")
+	} else {
+		fmt.Fprintf(w, "  Idle: no\n")
+	}
+	fmt.Fprintf(w, "  Policy: %s (%s)\n", policy.String(), policy.Describe())
+	if idle || policy.Never {
+		return
+	}
+
+	schedule, err := containers.ReadIdleSchedule(containers.IdleSchedulePath())
+	if err != nil {
+		log.Printf("container_status: Unable to read idle schedule: %v", err)
+		return
+	}
+	if next, found := schedule[id]; found {
+		until := next.Sub(now)
+		if until < 0 {
+			until = 0
+		}
+		fmt.Fprintf(w, "  Next check: in %s (%s)\n", until/time.Second*time.Second, next.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, "  Next check: not scheduled, the idler is not monitoring this container\n")
+	}
+}
+
+// Describe the network links of the container, including any targets
+// the link monitor replaced.
+func writeLinkStatusTo(w io.Writer, id containers.Identifier) {
+	file, err := os.Open(id.NetworkLinksPathFor())
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	links, err := containers.ReadNetworkLinks(file)
+	if err != nil || len(links) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nNetwork links:\n")
+	for i := range links {
+		fmt.Fprintf(w, "  %s", links[i].String())
+		if len(links[i].Replaced) > 0 {
+			replaced := make([]string, len(links[i].Replaced))
+			for j := range links[i].Replaced {
+				replaced[j] = links[i].Replaced[j].String()
+			}
+			fmt.Fprintf(w, " (failed over from %s)", strings.Join(replaced, ", "))
+		}
+		fmt.Fprintf(w, "\n")
+	}
 }
@@ -10,6 +10,7 @@ import (
 	csystemd "github.com/openshift/geard/containers/systemd"
 	"github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/port"
+	"github.com/openshift/geard/router"
 	"github.com/openshift/geard/systemd"
 )
 
@@ -27,6 +28,8 @@ func (j *deleteContainer) Execute(resp jobs.Response) {
 	homeDirPath := j.Id.BaseHomePath()
 	runDirPath := j.Id.RunPathFor()
 	networkLinksPath := j.Id.NetworkLinksPathFor()
+	routesPath := j.Id.RoutesPathFor()
+	idlePolicyPath := j.Id.IdlePolicyPathFor()
 
 	_, err := systemd.Connection().GetUnitProperties(unitName)
 	switch {
@@ -50,6 +53,18 @@ func (j *deleteContainer) Execute(resp jobs.Response) {
 		ports = port.PortPairs{}
 	}
 
+	if envId, err := containers.GetExistingEnvironmentId(j.Id); err == nil && envId != "" {
+		if err := containers.RemoveEnvironmentDependent(envId, j.Id); err != nil {
+			log.Printf("delete_container: Unable to remove the container from its environment: %v", err)
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		log.Printf("delete_container: Unable to read the container environment: %v", err)
+	}
+
+	if err := router.DeregisterContainer(j.Id); err != nil {
+		log.Printf("delete_container: Unable to remove routes from the router: %v", err)
+	}
+
 	if err := portReserver.ReleaseExternalPorts(ports); err != nil {
 		log.Printf("delete_container: Unable to release ports: %v", err)
 	}
@@ -76,6 +91,14 @@ func (j *deleteContainer) Execute(resp jobs.Response) {
 		log.Printf("delete_container: Unable to remove network links file: %v", err)
 	}
 
+	if err := os.Remove(routesPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("delete_container: Unable to remove routes file: %v", err)
+	}
+
+	if err := os.Remove(idlePolicyPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("delete_container: Unable to remove idle policy file: %v", err)
+	}
+
 	if err := os.RemoveAll(unitDefinitionsPath); err != nil {
 		log.Printf("delete_container: Unable to remove definitions for container: %v", err)
 	}
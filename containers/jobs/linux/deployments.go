@@ -0,0 +1,111 @@
+package linux
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/deployment"
+	"github.com/openshift/geard/jobs"
+)
+
+type putDeployment struct {
+	*PutDeploymentRequest
+}
+
+func (j *putDeployment) Execute(resp jobs.Response) {
+	if err := j.Deployment.Store(j.Name); err != nil {
+		log.Printf("deployments: Unable to store deployment %s: %v", j.Name, err)
+		resp.Failure(ErrDeploymentUpdateFailed)
+		return
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+type discover struct {
+	*DiscoveryRequest
+}
+
+func (j *discover) Execute(resp jobs.Response) {
+	endpoints, err := deployment.Discover(j.Name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("deployments: Unable to discover %s: %v", j.Name, err)
+		}
+		resp.Failure(ErrDiscoveryNotFound)
+		return
+	}
+	resp.SuccessWithData(jobs.ResponseOk, &DiscoveryResponse{Name: j.Name, Endpoints: endpoints})
+}
+
+type getDeployment struct {
+	*GetDeploymentRequest
+}
+
+func (j *getDeployment) Execute(resp jobs.Response) {
+	d, err := deployment.StoredDeployment(j.Name)
+	if os.IsNotExist(err) {
+		resp.Failure(ErrDeploymentNotFound)
+		return
+	} else if err != nil {
+		log.Printf("deployments: Unable to read deployment %s: %v", j.Name, err)
+		resp.Failure(ErrDeploymentReadFailed)
+		return
+	}
+	resp.SuccessWithData(jobs.ResponseOk, d)
+}
+
+type deleteDeployment struct {
+	*DeleteDeploymentRequest
+}
+
+func (j *deleteDeployment) Execute(resp jobs.Response) {
+	if err := os.Remove(deployment.StoredDeploymentPathFor(j.Name)); err != nil {
+		if os.IsNotExist(err) {
+			resp.Failure(ErrDeploymentNotFound)
+			return
+		}
+		log.Printf("deployments: Unable to delete deployment %s: %v", j.Name, err)
+		resp.Failure(ErrDeleteDeploymentFailed)
+		return
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+type listDeployments struct {
+	*ListDeploymentsRequest
+}
+
+func (j *listDeployments) Execute(resp jobs.Response) {
+	infos, err := ioutil.ReadDir(deployment.StoredDeploymentsPath())
+	if err != nil {
+		log.Printf("deployments: Unable to read %s: %v", deployment.StoredDeploymentsPath(), err)
+		resp.Failure(ErrListDeploymentsFailed)
+		return
+	}
+
+	r := &ListDeploymentsResponse{Deployments: make(DeploymentResponses, 0, len(infos))}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		name = strings.TrimSuffix(name, ".json")
+		d, err := deployment.NewDeploymentFromFile(filepath.Join(deployment.StoredDeploymentsPath(), info.Name()), nil)
+		if err != nil {
+			log.Printf("deployments: Skipping unreadable deployment %s: %v", name, err)
+			continue
+		}
+		r.Deployments = append(r.Deployments, DeploymentResponse{
+			Name:       name,
+			Containers: len(d.Containers),
+			Instances:  len(d.Instances),
+			Updated:    info.ModTime(),
+		})
+	}
+	r.Sort()
+	resp.SuccessWithData(jobs.ResponseOk, r)
+}
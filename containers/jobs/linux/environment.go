@@ -1,12 +1,14 @@
 package linux
 
 import (
-	"io"
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/openshift/geard/containers"
 	. "github.com/openshift/geard/containers/jobs"
 	"github.com/openshift/geard/jobs"
+	"github.com/openshift/geard/systemd"
 )
 
 type getEnvironment struct {
@@ -16,14 +18,37 @@ type getEnvironment struct {
 func (j *getEnvironment) Execute(resp jobs.Response) {
 	id := j.Id
 
+	if j.Resolved {
+		resolved, err := containers.ResolveEnvironment(id)
+		if os.IsNotExist(err) {
+			resp.Failure(ErrEnvironmentNotFound)
+			return
+		} else if err != nil {
+			log.Printf("job_content: Unable to resolve environment %s: %v", id, err)
+			resp.Failure(jobs.SimpleError{Failure: jobs.ResponseError, Reason: fmt.Sprintf("Unable to resolve the environment: %s", err.Error())})
+			return
+		}
+		w := resp.SuccessWithWrite(jobs.ResponseOk, false, false)
+		if err := resolved.WriteMaskedTo(w); err != nil {
+			log.Printf("job_content: Unable to write environment file: %+v", err)
+		}
+		return
+	}
+
 	file, erro := os.Open(id.EnvironmentPathFor())
 	if erro != nil {
 		resp.Failure(ErrEnvironmentNotFound)
 		return
 	}
 	defer file.Close()
+	secrets, errs := containers.ReadEnvironmentSecrets(id)
+	if errs != nil {
+		log.Printf("job_content: Unable to read the secrets of environment %s: %v", id, errs)
+		resp.Failure(jobs.SimpleError{Failure: jobs.ResponseError, Reason: "Unable to read the environment."})
+		return
+	}
 	w := resp.SuccessWithWrite(jobs.ResponseOk, false, false)
-	if _, err := io.Copy(w, file); err != nil {
+	if err := containers.MaskEnvironment(file, w, secrets); err != nil {
 		log.Printf("job_content: Unable to write environment file: %+v", err)
 		return
 	}
@@ -31,6 +56,7 @@ func (j *getEnvironment) Execute(resp jobs.Response) {
 
 type putEnvironent struct {
 	*PutEnvironmentRequest
+	systemd systemd.Systemd
 }
 
 func (j *putEnvironent) Execute(resp jobs.Response) {
@@ -38,22 +64,119 @@ func (j *putEnvironent) Execute(resp jobs.Response) {
 		resp.Failure(ErrEnvironmentUpdateFailed)
 		return
 	}
+	if err := j.CheckParents(); err != nil {
+		resp.Failure(invalidEnvironmentParents(err))
+		return
+	}
+	dependents, err := environmentDependents(j.Id, &j.EnvironmentUpdate)
+	if err != nil {
+		resp.Failure(ErrEnvironmentUpdateFailed)
+		return
+	}
 	if err := j.Write(false); err != nil {
 		resp.Failure(ErrEnvironmentUpdateFailed)
 		return
 	}
 
-	resp.Success(jobs.ResponseOk)
+	updateDependents(j.systemd, j.Id, dependents, &j.EnvironmentUpdate, resp)
 }
 
 type patchEnvironment struct {
 	*PatchEnvironmentRequest
+	systemd systemd.Systemd
 }
 
 func (j *patchEnvironment) Execute(resp jobs.Response) {
+	if err := j.CheckParents(); err != nil {
+		resp.Failure(invalidEnvironmentParents(err))
+		return
+	}
+	dependents, err := environmentDependents(j.Id, &j.EnvironmentUpdate)
+	if err != nil {
+		resp.Failure(ErrEnvironmentUpdateFailed)
+		return
+	}
 	if err := j.Write(true); err != nil {
 		resp.Failure(ErrEnvironmentUpdateFailed)
 		return
 	}
-	resp.Success(jobs.ResponseOk)
+
+	updateDependents(j.systemd, j.Id, dependents, &j.EnvironmentUpdate, resp)
+}
+
+// The containers to update after the environment changes, read before
+// it is written so a failure leaves the environment unchanged.
+func environmentDependents(id containers.Identifier, update *EnvironmentUpdate) ([]containers.Identifier, error) {
+	if update.Dependents == "" {
+		return nil, nil
+	}
+	dependents, err := containers.EnvironmentDependents(id)
+	if err != nil {
+		log.Printf("job_environment: Unable to find the containers using environment %s: %v", id, err)
+		return nil, err
+	}
+	return dependents, nil
+}
+
+// Restart the running dependents of an environment and
+// report what happened to each.  Stopped containers receive the new
+// values the next time they start.
+func updateDependents(s systemd.Systemd, id containers.Identifier, dependents []containers.Identifier, update *EnvironmentUpdate, resp jobs.Response) {
+	if update.Dependents == "" {
+		resp.Success(jobs.ResponseOk)
+		return
+	}
+
+	w := resp.SuccessWithWrite(jobs.ResponseOk, true, false)
+	if len(dependents) == 0 {
+		fmt.Fprintf(w, "No containers use environment %s\n", id)
+		return
+	}
+	for i, dependent := range dependents {
+		unitName := dependent.UnitNameFor()
+		if props, err := s.GetUnitProperties(unitName); err != nil || !runningState(props["ActiveState"]) {
+			fmt.Fprintf(w, "Container %s is not running and will use the new environment when started\n", dependent)
+			continue
+		}
+
+		var result string
+		var err error
+		if update.Rolling {
+			result, err = s.RestartUnit(unitName, "replace")
+		} else {
+			result, err = "queued", s.RestartUnitJob(unitName, "replace")
+		}
+		if err == nil && result != "done" && result != "queued" {
+			err = fmt.Errorf("the job was %s", result)
+		}
+		if err != nil {
+			log.Printf("job_environment: Unable to restart container %s: %v", dependent, err)
+			fmt.Fprintf(w, "Container %s could not restart: %s\n", dependent, err.Error())
+			if update.Rolling {
+				for _, skipped := range dependents[i+1:] {
+					fmt.Fprintf(w, "Container %s was skipped\n", skipped)
+				}
+				return
+			}
+			continue
+		}
+
+		if update.Rolling {
+			fmt.Fprintf(w, "Container %s restarted\n", dependent)
+		} else {
+			fmt.Fprintf(w, "Container %s restarting\n", dependent)
+		}
+	}
+}
+
+func runningState(state interface{}) bool {
+	switch state {
+	case "active", "activating", "reloading":
+		return true
+	}
+	return false
+}
+
+func invalidEnvironmentParents(err error) jobs.SimpleError {
+	return jobs.SimpleError{Failure: jobs.ResponseInvalidRequest, Reason: err.Error()}
 }
@@ -1,9 +1,11 @@
 package linux
 
 import (
+	"log"
 	"path/filepath"
 
 	"github.com/openshift/geard/config"
+	"github.com/openshift/geard/containers"
 	cjobs "github.com/openshift/geard/containers/jobs"
 	"github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/port"
@@ -36,6 +38,10 @@ func implementsJob(request interface{}) (jobs.Job, error) {
 		return &stopContainer{r, systemd.Connection()}, nil
 	case *cjobs.RestartContainerRequest:
 		return &restartContainer{r, systemd.Connection()}, nil
+	case *cjobs.IdleContainerRequest:
+		return &idleContainer{r, systemd.Connection()}, nil
+	case *cjobs.UnidleContainerRequest:
+		return &unidleContainer{r, systemd.Connection()}, nil
 	case *cjobs.BuildImageRequest:
 		return &buildImage{r, systemd.Connection()}, nil
 	case *cjobs.ContainerLogRequest:
@@ -49,9 +55,9 @@ func implementsJob(request interface{}) (jobs.Job, error) {
 	case *cjobs.GetEnvironmentRequest:
 		return &getEnvironment{r}, nil
 	case *cjobs.PatchEnvironmentRequest:
-		return &patchEnvironment{r}, nil
+		return &patchEnvironment{r, systemd.Connection()}, nil
 	case *cjobs.PutEnvironmentRequest:
-		return &putEnvironent{r}, nil
+		return &putEnvironent{r, systemd.Connection()}, nil
 	case *cjobs.InstallContainerRequest:
 		return &installContainer{r, systemd.Connection()}, nil
 	case *cjobs.LinkContainersRequest:
@@ -66,6 +72,20 @@ func implementsJob(request interface{}) (jobs.Job, error) {
 		return &purgeContainers{r}, nil
 	case *cjobs.RunContainerRequest:
 		return &runContainer{r, systemd.Connection()}, nil
+	case *cjobs.PutDeploymentRequest:
+		return &putDeployment{r}, nil
+	case *cjobs.GetDeploymentRequest:
+		return &getDeployment{r}, nil
+	case *cjobs.DeleteDeploymentRequest:
+		return &deleteDeployment{r}, nil
+	case *cjobs.ListDeploymentsRequest:
+		return &listDeployments{r}, nil
+	case *cjobs.ListPortsRequest:
+		return &listPorts{r}, nil
+	case *cjobs.ReleasePortsRequest:
+		return &releasePorts{r}, nil
+	case *cjobs.DiscoveryRequest:
+		return &discover{r}, nil
 	}
 	return nil, jobs.ErrNoJobForRequest
 }
@@ -83,9 +103,18 @@ func initContainers() error {
 	if err := InitializeData(); err != nil {
 		return err
 	}
-	allocator := port.NewPortAllocator(config.ContainerBasePath(), 4000, 60000)
-	go allocator.Run()
-	portReserver = &port.PortReservation{allocator}
+	if added, err := containers.BackfillEnvironmentDependents(); err != nil {
+		log.Printf("WARNING: Unable to record the environments of existing containers - they may not be restarted when their environment changes: %v", err)
+	} else if len(added) > 0 {
+		log.Printf("Recorded the environments of %d existing containers", len(added))
+	}
+	interfaces, err := port.ReadInterfaces(config.ContainerBasePath())
+	if err != nil {
+		return err
+	}
+	reservation := port.NewPortReservation(config.ContainerBasePath(), interfaces)
+	go reservation.Run()
+	portReserver = reservation
 	return nil
 }
 
@@ -95,6 +124,9 @@ func init() {
 		filepath.Join(config.ContainerBasePath(), "env", "contents"),
 		filepath.Join(config.ContainerBasePath(), "ports", "descriptions"),
 		filepath.Join(config.ContainerBasePath(), "ports", "interfaces"),
+		filepath.Join(config.ContainerBasePath(), "deployments"),
+		filepath.Join(config.ContainerBasePath(), "routes"),
+		filepath.Join(config.ContainerBasePath(), "idle"),
 	)
 	config.AddRequiredDirectory(
 		0755,
@@ -0,0 +1,105 @@
+package linux
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	. "github.com/openshift/geard/containers/jobs"
+	csystemd "github.com/openshift/geard/containers/systemd"
+	"github.com/openshift/geard/jobs"
+	"github.com/openshift/geard/systemd"
+)
+
+type idleContainer struct {
+	*IdleContainerRequest
+	systemd systemd.Systemd
+}
+
+func (j *idleContainer) Execute(resp jobs.Response) {
+	unitName := j.Id.UnitNameFor()
+	idleFlagPath := j.Id.IdleUnitPathFor()
+
+	if _, err := os.Stat(j.Id.UnitPathFor()); err != nil {
+		if os.IsNotExist(err) {
+			resp.Failure(ErrContainerNotFound)
+			return
+		}
+		log.Printf("idle_container: Unable to check the unit for %s: %v", j.Id, err)
+		resp.Failure(ErrContainerIdleFailed)
+		return
+	}
+	if started, err := csystemd.UnitStartOnBoot(j.Id); err != nil {
+		log.Printf("idle_container: Unable to read whether %s is started on boot: %v", j.Id, err)
+		resp.Failure(ErrContainerIdleFailed)
+		return
+	} else if !started {
+		resp.Failure(ErrContainerNotStarted)
+		return
+	}
+
+	if _, err := os.Stat(idleFlagPath); err == nil {
+		w := resp.SuccessWithWrite(jobs.ResponseOk, true, false)
+		fmt.Fprintf(w, "Container %s is idle\n", j.Id)
+		return
+	}
+
+	// The flag distinguishes an idled container from a failed one when
+	// the unit stops
+	f, err := os.Create(idleFlagPath)
+	if err != nil {
+		log.Printf("idle_container: Could not create idle marker for %s: %v", unitName, err)
+		resp.Failure(ErrContainerIdleFailed)
+		return
+	}
+	f.Close()
+
+	if err := systemd.Connection().StopUnitJob(unitName, "fail"); err != nil {
+		log.Printf("idle_container: Could not stop container %s: %v", unitName, err)
+		os.Remove(idleFlagPath)
+		resp.Failure(ErrContainerIdleFailed)
+		return
+	}
+
+	w := resp.SuccessWithWrite(jobs.ResponseAccepted, true, false)
+	fmt.Fprintf(w, "Container %s is idling\n", j.Id)
+}
+
+type unidleContainer struct {
+	*UnidleContainerRequest
+	systemd systemd.Systemd
+}
+
+func (j *unidleContainer) Execute(resp jobs.Response) {
+	unitName := j.Id.UnitNameFor()
+
+	if _, err := os.Stat(j.Id.UnitPathFor()); err != nil {
+		if os.IsNotExist(err) {
+			resp.Failure(ErrContainerNotFound)
+			return
+		}
+		log.Printf("unidle_container: Unable to check the unit for %s: %v", j.Id, err)
+		resp.Failure(ErrContainerUnidleFailed)
+		return
+	}
+
+	if err := os.Remove(j.Id.IdleUnitPathFor()); err != nil {
+		if os.IsNotExist(err) {
+			w := resp.SuccessWithWrite(jobs.ResponseOk, true, false)
+			fmt.Fprintf(w, "Container %s is not idle\n", j.Id)
+			return
+		}
+		log.Printf("unidle_container: Could not remove idle marker for %s: %v", unitName, err)
+		resp.Failure(ErrContainerUnidleFailed)
+		return
+	}
+
+	if err := systemd.Connection().StartUnitJob(unitName, "replace"); err != nil {
+		log.Printf("unidle_container: Could not start container %s: %v", unitName, err)
+		resp.Failure(ErrContainerUnidleFailed)
+		return
+	}
+
+	w := resp.SuccessWithWrite(jobs.ResponseAccepted, true, false)
+	fmt.Fprintf(w, "Container %s is unidling\n", j.Id)
+}
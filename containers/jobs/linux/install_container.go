@@ -14,6 +14,7 @@ import (
 	csystemd "github.com/openshift/geard/containers/systemd"
 	"github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/port"
+	"github.com/openshift/geard/router"
 	"github.com/openshift/geard/systemd"
 	"github.com/openshift/geard/utils"
 )
@@ -21,7 +22,15 @@ import (
 func dockerPortSpec(p port.PortPairs) string {
 	var portSpec bytes.Buffer
 	for i := range p {
-		portSpec.WriteString(fmt.Sprintf("-p %d:%d ", p[i].External, p[i].Internal))
+		portSpec.WriteString("-p ")
+		if p[i].Address != "" {
+			portSpec.WriteString(p[i].Address + ":")
+		}
+		portSpec.WriteString(fmt.Sprintf("%s:%s", port.FormatPortRange(p[i].External, p[i].Count), port.FormatPortRange(p[i].Internal, p[i].Count)))
+		if p[i].Protocol.UDP() {
+			portSpec.WriteString("/" + p[i].Protocol.String())
+		}
+		portSpec.WriteString(" ")
 	}
 	return portSpec.String()
 }
@@ -77,8 +86,13 @@ func (req *installContainer) Execute(resp jobs.Response) {
 	defer unit.Close()
 
 	// if this is an existing container, read the currently reserved ports
+	// and environment
 	existingPorts := port.PortPairs{}
+	var existingEnvironmentId containers.Identifier
 	if exists {
+		if existingEnvironmentId, err = containers.GetExistingEnvironmentId(id); err != nil && !os.IsNotExist(err) {
+			log.Print("install_container: Unable to read existing environment from file: ", err)
+		}
 		existingPorts, err = containers.GetExistingPorts(id)
 		if err != nil {
 			if _, ok := err.(*os.PathError); !ok {
@@ -93,6 +107,10 @@ func (req *installContainer) Execute(resp jobs.Response) {
 	reserved, erra := portReserver.AtomicReserveExternalPorts(unitVersionPath, req.Ports, existingPorts)
 	if erra != nil {
 		log.Printf("install_container: Unable to reserve external ports: %+v", erra)
+		if exhausted, ok := erra.(*port.PoolExhaustedError); ok {
+			resp.Failure(jobs.SimpleError{Failure: jobs.ResponseError, Reason: "Unable to create container: " + exhausted.Error() + "."})
+			return
+		}
 		resp.Failure(ErrContainerCreateFailedPortsReserved)
 		return
 	}
@@ -108,13 +126,30 @@ func (req *installContainer) Execute(resp jobs.Response) {
 	}
 
 	// write the environment to disk
-	var environmentPath string
+	var environmentPath, runtimeEnvironmentPath string
+	var environmentId containers.Identifier
 	if env != nil {
+		if errp := env.CheckParents(); errp != nil {
+			resp.Failure(invalidEnvironmentParents(errp))
+			return
+		}
 		if errw := env.Write(false); errw != nil {
 			resp.Failure(ErrContainerCreateFailed)
 			return
 		}
+		environmentId = env.Id
 		environmentPath = env.Id.EnvironmentPathFor()
+		runtimeEnvironmentPath = env.Id.RuntimeEnvironmentPathFor()
+		if errd := containers.AddEnvironmentDependent(env.Id, id); errd != nil {
+			log.Print("install_container: Unable to record the container using the environment: ", errd)
+			resp.Failure(ErrContainerCreateFailed)
+			return
+		}
+	}
+	if existingEnvironmentId != "" && existingEnvironmentId != environmentId {
+		if errd := containers.RemoveEnvironmentDependent(existingEnvironmentId, id); errd != nil {
+			log.Print("install_container: Unable to remove the container from its previous environment: ", errd)
+		}
 	}
 
 	// write the network links (if any) to disk
@@ -125,6 +160,30 @@ func (req *installContainer) Execute(resp jobs.Response) {
 		}
 	}
 
+	// replace the routes (if any), removing the old endpoints from the
+	// router so they are registered again with the new routes on start
+	if req.Routes != nil {
+		if exists {
+			if errd := router.DeregisterContainer(id); errd != nil {
+				log.Printf("install_container: Unable to remove existing routes: %v", errd)
+			}
+		}
+		if errw := req.Routes.Write(id.RoutesPathFor()); errw != nil {
+			log.Printf("install_container: Unable to write routes: %v", errw)
+			resp.Failure(ErrContainerCreateFailed)
+			return
+		}
+	}
+
+	// replace the idle policy (if any)
+	if req.Idle != nil {
+		if errw := req.Idle.Write(id.IdlePolicyPathFor()); errw != nil {
+			log.Printf("install_container: Unable to write idle policy: %v", errw)
+			resp.Failure(ErrContainerCreateFailed)
+			return
+		}
+	}
+
 	var sliceName string
 	if "" == req.SystemdSlice {
 		sliceName = DefaultSlice
@@ -173,6 +232,9 @@ func (req *installContainer) Execute(resp jobs.Response) {
 		ExecutablePath:  filepath.Join("/", "usr", "bin", "gear"),
 		IncludePath:     "",
 
+		EnvironmentId:          environmentId,
+		RuntimeEnvironmentPath: runtimeEnvironmentPath,
+
 		PortPairs:            reserved,
 		SocketUnitName:       socketUnitName,
 		SocketActivationType: socketActivationType,
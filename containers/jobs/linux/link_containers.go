@@ -1,7 +1,11 @@
 package linux
 
 import (
+	"log"
+
 	. "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/containers/network"
+	"github.com/openshift/geard/docker"
 	"github.com/openshift/geard/jobs"
 )
 
@@ -17,5 +21,28 @@ func (j *linkContainers) Execute(resp jobs.Response) {
 		}
 	}
 
+	socket := j.DockerSocket
+	if socket == "" {
+		socket = "unix:///var/run/docker.sock"
+	}
+	d, err := docker.GetConnection(socket)
+	if err != nil {
+		log.Printf("link_containers: Unable to connect to docker on %s: %v", socket, err)
+		resp.Failure(ErrLinkContainersFailed)
+		return
+	}
+
+	failed := false
+	for i := range j.Links {
+		if err := network.ApplyRunningLinks(d, j.Links[i].Id); err != nil {
+			log.Printf("link_containers: Unable to apply links to %s: %v", j.Links[i].Id, err)
+			failed = true
+		}
+	}
+	if failed {
+		resp.Failure(ErrLinkContainersFailed)
+		return
+	}
+
 	resp.Success(jobs.ResponseOk)
 }
@@ -0,0 +1,44 @@
+package linux
+
+import (
+	"log"
+
+	"github.com/openshift/geard/config"
+	"github.com/openshift/geard/containers"
+	. "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/jobs"
+	"github.com/openshift/geard/port"
+)
+
+type listPorts struct {
+	*ListPortsRequest
+}
+
+func (j *listPorts) Execute(resp jobs.Response) {
+	interfaces, err := port.ReadInterfaces(config.ContainerBasePath())
+	if err != nil {
+		log.Printf("list_ports: Unable to read the host interfaces: %v", err)
+		resp.Failure(ErrListPortsFailed)
+		return
+	}
+	reservations, err := port.ListReservations(config.ContainerBasePath())
+	if err != nil {
+		log.Printf("list_ports: Unable to read the reserved ports: %v", err)
+		resp.Failure(ErrListPortsFailed)
+		return
+	}
+
+	r := &ListPortsResponse{
+		Reservations: make(PortReservationResponses, 0, len(reservations)),
+		Interfaces:   make(InterfaceUsageResponses, 0, len(interfaces)),
+	}
+	for i := range reservations {
+		owner, orphaned := containers.CheckPortReservation(&reservations[i])
+		r.Reservations = append(r.Reservations, PortReservationResponse{Reservation: reservations[i], Owner: owner, Orphaned: orphaned})
+	}
+	for _, usage := range interfaces.Usage(reservations) {
+		r.Interfaces = append(r.Interfaces, InterfaceUsageResponse{InterfaceUsage: usage})
+	}
+	r.Sort()
+	resp.SuccessWithData(jobs.ResponseOk, r)
+}
@@ -0,0 +1,75 @@
+package linux
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/openshift/geard/config"
+	"github.com/openshift/geard/containers"
+	. "github.com/openshift/geard/containers/jobs"
+	"github.com/openshift/geard/jobs"
+	"github.com/openshift/geard/port"
+)
+
+type releasePorts struct {
+	*ReleasePortsRequest
+}
+
+// Reservations are checked and released while holding the reservation
+// lock, so a port can't be reserved again or reused by its container
+// between the check and the release.
+func (j *releasePorts) Execute(resp jobs.Response) {
+	base := config.ContainerBasePath()
+	unlock, err := port.LockReservations(base)
+	if err != nil {
+		log.Printf("release_ports: Unable to lock the reserved ports: %v", err)
+		resp.Failure(ErrReleasePortsFailed)
+		return
+	}
+	defer unlock()
+
+	reservations, err := port.ListReservations(base)
+	if err != nil {
+		log.Printf("release_ports: Unable to read the reserved ports: %v", err)
+		resp.Failure(ErrReleasePortsFailed)
+		return
+	}
+
+	release := port.Reservations{}
+	if len(j.Ports) == 0 {
+		for i := range reservations {
+			if _, orphaned := containers.CheckPortReservation(&reservations[i]); orphaned {
+				release = append(release, reservations[i])
+			}
+		}
+	}
+	for _, p := range j.Ports {
+		var found *port.Reservation
+		for i := range reservations {
+			if reservations[i].Device == p.Device && reservations[i].Port == p.Port && reservations[i].Protocol.Equal(p.Protocol) {
+				found = &reservations[i]
+				break
+			}
+		}
+		if found == nil {
+			resp.Failure(jobs.SimpleError{Failure: jobs.ResponseNotFound, Reason: fmt.Sprintf("Port %s/%s on device %s is not reserved.", p.Port, p.Protocol, p.Device)})
+			return
+		}
+		if owner, orphaned := containers.CheckPortReservation(found); !orphaned && !j.Force {
+			resp.Failure(jobs.SimpleError{Failure: jobs.ResponseNotAcceptable, Reason: fmt.Sprintf("Port %s/%s on device %s is held by %s, force the release to remove it.", p.Port, p.Protocol, p.Device, owner)})
+			return
+		}
+		release = append(release, *found)
+	}
+
+	w := resp.SuccessWithWrite(jobs.ResponseOk, true, false)
+	for i := range release {
+		r := &release[i]
+		if err := r.Release(base); err != nil {
+			log.Printf("release_ports: Unable to release %s/%s on device %s: %v", r.Port, r.Protocol, r.Device, err)
+			fmt.Fprintf(w, "Unable to release port %s/%s on device %s\n", r.Port, r.Protocol, r.Device)
+			continue
+		}
+		fmt.Fprintf(w, "Released port %s/%s on device %s\n", r.Port, r.Protocol, r.Device)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"io"
 	"sort"
 	"text/tabwriter"
+	"time"
+
+	"github.com/openshift/geard/port"
 )
 
 func (c UnitResponses) Less(a, b int) bool {
@@ -67,3 +70,113 @@ func (l *ListServerContainersResponse) WriteTableTo(w io.Writer) error {
 	tw.Flush()
 	return nil
 }
+
+func (c DeploymentResponses) Less(a, b int) bool {
+	if c[a].Name == c[b].Name {
+		return c[a].Server < c[b].Server
+	}
+	return c[a].Name < c[b].Name
+}
+func (c DeploymentResponses) Len() int {
+	return len(c)
+}
+func (c DeploymentResponses) Swap(a, b int) {
+	c[a], c[b] = c[b], c[a]
+}
+
+func (r *ListDeploymentsResponse) Append(other *ListDeploymentsResponse) {
+	r.Deployments = append(r.Deployments, other.Deployments...)
+}
+func (r *ListDeploymentsResponse) Sort() {
+	sort.Sort(r.Deployments)
+}
+
+func (l *ListDeploymentsResponse) WriteTableTo(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 8, 4, 1, ' ', tabwriter.DiscardEmptyColumns)
+	if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", "NAME", "SERVER", "CONTAINERS", "INSTANCES", "UPDATED"); err != nil {
+		return err
+	}
+	for i := range l.Deployments {
+		d := &l.Deployments[i]
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", d.Name, d.Server, d.Containers, d.Instances, d.Updated.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	tw.Flush()
+	return nil
+}
+
+func (c PortReservationResponses) Less(a, b int) bool {
+	if c[a].Server != c[b].Server {
+		return c[a].Server < c[b].Server
+	}
+	return port.Reservations{c[a].Reservation, c[b].Reservation}.Less(0, 1)
+}
+func (c PortReservationResponses) Len() int {
+	return len(c)
+}
+func (c PortReservationResponses) Swap(a, b int) {
+	c[a], c[b] = c[b], c[a]
+}
+
+func (c InterfaceUsageResponses) Less(a, b int) bool {
+	if c[a].Server != c[b].Server {
+		return c[a].Server < c[b].Server
+	}
+	if c[a].Device != c[b].Device {
+		return c[a].Device < c[b].Device
+	}
+	return c[a].Pool < c[b].Pool
+}
+func (c InterfaceUsageResponses) Len() int {
+	return len(c)
+}
+func (c InterfaceUsageResponses) Swap(a, b int) {
+	c[a], c[b] = c[b], c[a]
+}
+
+func (r *ListPortsResponse) Append(other *ListPortsResponse) {
+	r.Reservations = append(r.Reservations, other.Reservations...)
+	r.Interfaces = append(r.Interfaces, other.Interfaces...)
+}
+func (r *ListPortsResponse) Sort() {
+	sort.Sort(r.Reservations)
+	sort.Sort(r.Interfaces)
+}
+
+// The reservations, then the usage of each interface.
+func (l *ListPortsResponse) WriteTableTo(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 8, 4, 1, ' ', tabwriter.DiscardEmptyColumns)
+	if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", "PORT", "DEVICE", "SERVER", "OWNER", "STATE", "PATH"); err != nil {
+		return err
+	}
+	for i := range l.Reservations {
+		r := &l.Reservations[i]
+		state := "reserved"
+		if r.Orphaned {
+			state = "orphaned"
+		}
+		if _, err := fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\t%s\t%s\n", r.Port, r.Protocol, r.Device, r.Server, r.Owner, state, r.Path); err != nil {
+			return err
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 8, 4, 1, ' ', tabwriter.DiscardEmptyColumns)
+	if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", "DEVICE", "ADDRESS", "POOL", "SERVER", "RANGES", "RESERVED", "FREE", "LARGEST FREE"); err != nil {
+		return err
+	}
+	for i := range l.Interfaces {
+		u := &l.Interfaces[i]
+		address := u.Address
+		if address == "" {
+			address = "*"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", u.Device, address, u.Pool, u.Server, u.Ranges, u.Reserved, u.Free, u.LargestFree); err != nil {
+			return err
+		}
+	}
+	tw.Flush()
+	return nil
+}
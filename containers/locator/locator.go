@@ -3,6 +3,7 @@ package locator
 import (
 	"github.com/openshift/geard/cmd"
 	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/transport"
 )
 
@@ -27,3 +28,23 @@ func AsIdentifier(locator cmd.Locator) containers.Identifier {
 	id, _ := containers.NewIdentifier(locator.(*cmd.ResourceLocator).Id)
 	return id
 }
+
+// A deployment stored on a server
+const ResourceTypeDeployment cmd.ResourceType = "deployment"
+
+func NewDeploymentLocators(t transport.Transport, values ...string) (cmd.Locators, error) {
+	locators, err := cmd.NewResourceLocators(t, ResourceTypeDeployment, values...)
+	if err != nil {
+		return cmd.Locators{}, err
+	}
+	for i := range locators {
+		if err := deployment.CheckName(AsDeploymentName(locators[i])); err != nil {
+			return cmd.Locators{}, err
+		}
+	}
+	return locators, nil
+}
+
+func AsDeploymentName(locator cmd.Locator) string {
+	return locator.(*cmd.ResourceLocator).Id
+}
@@ -75,3 +75,18 @@ func TestShouldConvertLocator(t *testing.T) {
 		t.Errorf("Locator should not have error on converting to identifier")
 	}
 }
+
+func TestShouldCheckDeploymentArgs(t *testing.T) {
+	ids, err := NewDeploymentLocators(&testTransport{}, "localhost/app.v2", "web")
+	if err != nil {
+		t.Fatalf("No error should occur reading deployment locators: %s", err.Error())
+	}
+	if AsDeploymentName(ids[0]) != "app.v2" || AsDeploymentName(ids[1]) != "web" {
+		t.Errorf("Unexpected deployment names: %+v", ids)
+	}
+	for _, value := range []string{"localhost/..", "localhost/a b", "localhost/"} {
+		if _, err := NewDeploymentLocators(&testTransport{}, value); err == nil {
+			t.Errorf("The deployment locator %s should be invalid", value)
+		}
+	}
+}
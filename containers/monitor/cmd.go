@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/geard/cmd"
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/containers/network"
+	"github.com/openshift/geard/deployment"
+	"github.com/openshift/geard/docker"
+	"github.com/openshift/geard/systemd"
+)
+
+var (
+	interval     int
+	failures     int
+	timeout      int
+	dockerSocket string
+)
+
+func RegisterLinkMonitor(parent *cobra.Command) {
+	monitorCmd := &cobra.Command{
+		Use:   "link-monitor",
+		Short: "(Local) A daemon that moves network links off targets that stop responding",
+		Long:  "Probes the targets of every container's network links. When a target fails several probes in a row, links to it are changed to a healthy instance of the same container from a deployment stored on this server. Changes are recorded in the container's link file and shown by 'gear status'.",
+		Run:   startLinkMonitor,
+	}
+	monitorCmd.Flags().IntVar(&interval, "interval", 10, "Seconds between probes of each target")
+	monitorCmd.Flags().IntVar(&failures, "failures", 3, "Consecutive failed probes before a target is replaced")
+	monitorCmd.Flags().IntVar(&timeout, "timeout", 2, "Seconds to wait for a target to accept a connection")
+	monitorCmd.Flags().StringVarP(&dockerSocket, "docker-socket", "S", "unix:///var/run/docker.sock", "Set the docker socket to use")
+	parent.AddCommand(monitorCmd)
+}
+
+func startLinkMonitor(c *cobra.Command, args []string) {
+	if interval < 1 || failures < 1 || timeout < 1 {
+		cmd.Fail(1, "--interval, --failures, and --timeout must be positive")
+	}
+	systemd.Require()
+
+	d, err := docker.GetConnection(dockerSocket)
+	if err != nil {
+		cmd.Fail(1, "Unable to connect to docker on URI %s", dockerSocket)
+	}
+
+	m := &LinkMonitor{
+		Interval:    time.Duration(interval) * time.Second,
+		Failures:    failures,
+		Probe:       DialProbe(time.Duration(timeout) * time.Second),
+		Deployments: deployment.StoredDeployments,
+		Apply: func(id containers.Identifier) error {
+			return network.ApplyRunningLinks(d, id)
+		},
+	}
+	m.Run()
+}
@@ -0,0 +1,6 @@
+/*
+Watches the targets of container network links and moves links off
+targets that stop responding onto other instances of the same
+deployment.
+*/
+package monitor
@@ -0,0 +1,250 @@
+package monitor
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openshift/geard/config"
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/deployment"
+	"github.com/openshift/geard/port"
+)
+
+// Probes the targets of every container's network links and replaces
+// targets that fail Failures consecutive probes with a healthy
+// instance of the same container from a stored deployment.
+type LinkMonitor struct {
+	// How often targets are probed
+	Interval time.Duration
+	// The number of consecutive failed probes before a target is
+	// replaced
+	Failures int
+	// Return true if the target accepts connections
+	Probe func(target port.HostPort) bool
+	// Return the deployments an alternative may be chosen from
+	Deployments func() ([]*deployment.Deployment, error)
+	// Apply the links on disk to the container if it is running
+	Apply func(id containers.Identifier) error
+
+	failed map[port.HostPort]int
+}
+
+// A probe that attempts a TCP connection within timeout.
+func DialProbe(timeout time.Duration) func(port.HostPort) bool {
+	return func(target port.HostPort) bool {
+		conn, err := net.DialTimeout("tcp", target.String(), timeout)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+}
+
+// Probe all link targets every Interval.  Does not return.
+func (m *LinkMonitor) Run() {
+	log.Printf("link_monitor: Checking links every %v, replacing targets after %d failures", m.Interval, m.Failures)
+	for {
+		m.CheckLinks()
+		time.Sleep(m.Interval)
+	}
+}
+
+// Probe every link target once and fail over any links whose targets
+// have stayed unreachable.
+func (m *LinkMonitor) CheckLinks() {
+	paths, err := filepath.Glob(filepath.Join(config.ContainerBasePath(), "ports", "links", "*", "*"))
+	if err != nil {
+		log.Printf("link_monitor: Unable to list link files: %v", err)
+		return
+	}
+	var deployments []*deployment.Deployment
+	loaded := false
+	health := m.newHealthCheck()
+	for _, path := range paths {
+		id, err := containers.NewIdentifier(filepath.Base(path))
+		if err != nil {
+			continue
+		}
+		links, err := readLinks(path)
+		if err != nil {
+			log.Printf("link_monitor: Unable to read links of %s: %v", id, err)
+			continue
+		}
+		if !m.probeLinks(links, health) {
+			continue
+		}
+
+		if !loaded {
+			loaded = true
+			if deployments, err = m.Deployments(); err != nil {
+				log.Printf("link_monitor: Unable to load deployments: %v", err)
+			}
+		}
+		if !m.failover(id, links, deployments, health) {
+			continue
+		}
+		if err := links.Write(path, false); err != nil {
+			log.Printf("link_monitor: Unable to record new links for %s: %v", id, err)
+			continue
+		}
+		if err := m.Apply(id); err != nil {
+			log.Printf("link_monitor: Unable to apply new links to %s: %v", id, err)
+		}
+	}
+}
+
+func readLinks(path string) (containers.NetworkLinks, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return containers.ReadNetworkLinks(file)
+}
+
+// Probes each target at most once per pass.
+type healthCheck struct {
+	m      *LinkMonitor
+	probed map[port.HostPort]bool
+}
+
+func (m *LinkMonitor) newHealthCheck() *healthCheck {
+	if m.failed == nil {
+		m.failed = make(map[port.HostPort]int)
+	}
+	return &healthCheck{m, make(map[port.HostPort]bool)}
+}
+
+func (h *healthCheck) healthy(target port.HostPort) bool {
+	if healthy, ok := h.probed[target]; ok {
+		return healthy
+	}
+	healthy := h.m.Probe(target)
+	h.probed[target] = healthy
+	if healthy {
+		delete(h.m.failed, target)
+	} else {
+		h.m.failed[target] += 1
+	}
+	return healthy
+}
+
+func (h *healthCheck) down(target port.HostPort) bool {
+	return h.m.failed[target] >= h.m.Failures
+}
+
+// Probe the targets of links that can be monitored and return true if
+// any of them are down.
+func (m *LinkMonitor) probeLinks(links containers.NetworkLinks, health *healthCheck) bool {
+	down := false
+	for i := range links {
+		for _, target := range m.monitored(&links[i]) {
+			if !health.healthy(target) && health.down(target) {
+				down = true
+			}
+		}
+	}
+	return down
+}
+
+// True if the targets of a link can be probed.  UDP has no connection
+// to test.  Discovered names are resolved to instances only when the
+// link is applied, so links to them are neither probed nor failed
+// over - apply them again, for instance with gear scale, to reach the
+// current instances.
+func (m *LinkMonitor) canMonitor(link *containers.NetworkLink) bool {
+	if link.Protocol.UDP() || !link.Complete() {
+		return false
+	}
+	_, discovered := deployment.DiscoveryNameFromHost(link.ToHost)
+	return !discovered
+}
+
+// The targets of a link that can be probed.
+func (m *LinkMonitor) monitored(link *containers.NetworkLink) []port.HostPort {
+	if !m.canMonitor(link) {
+		return nil
+	}
+	targets := []port.HostPort{}
+	for _, target := range link.Targets() {
+		if !target.Port.Default() {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// Replace each down target with a healthy instance of the same
+// container from a deployment that includes id.  Returns true if any
+// link changed.
+func (m *LinkMonitor) failover(id containers.Identifier, links containers.NetworkLinks, deployments []*deployment.Deployment, health *healthCheck) bool {
+	changed := false
+	for i := range links {
+		link := &links[i]
+		if !m.canMonitor(link) {
+			continue
+		}
+		targets := link.Targets()
+		for j, target := range targets {
+			if target.Port.Default() || !health.down(target) {
+				continue
+			}
+			replacement, ok := m.replacementFor(id, target, targets, deployments, health)
+			if !ok {
+				log.Printf("link_monitor: %s is not responding and has no healthy alternative for %s", target.String(), id)
+				continue
+			}
+			log.Printf("link_monitor: Replacing %s with %s for %s", target.String(), replacement.String(), id)
+			if j == 0 {
+				link.ToHost, link.ToPort = replacement.Host, replacement.Port
+			} else {
+				link.Alternates[j-1] = replacement
+			}
+			targets[j] = replacement
+			link.Replaced = appendMissing(link.Replaced, target)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (m *LinkMonitor) replacementFor(id containers.Identifier, target port.HostPort, targets []port.HostPort, deployments []*deployment.Deployment, health *healthCheck) (port.HostPort, bool) {
+	for _, d := range deployments {
+		if _, found := d.Instances.Find(id); !found {
+			continue
+		}
+		alternatives, found := d.Alternatives(target)
+		if !found {
+			continue
+		}
+		for _, alternative := range alternatives {
+			if contains(targets, alternative) {
+				continue
+			}
+			if health.healthy(alternative) {
+				return alternative, true
+			}
+		}
+	}
+	return port.HostPort{}, false
+}
+
+func contains(hostports []port.HostPort, find port.HostPort) bool {
+	for i := range hostports {
+		if hostports[i] == find {
+			return true
+		}
+	}
+	return false
+}
+
+func appendMissing(hostports []port.HostPort, add port.HostPort) []port.HostPort {
+	if contains(hostports, add) {
+		return hostports
+	}
+	return append(hostports, add)
+}
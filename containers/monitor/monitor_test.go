@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/deployment"
+	"github.com/openshift/geard/port"
+)
+
+func instanceOn(id, from, host string, external port.Port) deployment.Instance {
+	return deployment.Instance{
+		Id:   containers.Identifier(id),
+		From: from,
+		On:   &host,
+		Ports: deployment.PortMappings{
+			{PortPair: port.PortPair{Internal: 27017, External: external}},
+		},
+	}
+}
+
+func testDeployment() *deployment.Deployment {
+	return &deployment.Deployment{
+		Containers: deployment.Containers{
+			{Name: "web", Links: deployment.Links{{To: "db"}}},
+			{Name: "db", PublicPorts: port.PortPairs{{Internal: 27017}}},
+		},
+		Instances: deployment.Instances{
+			instanceOn("web-1", "web", "10.0.0.1", 0),
+			instanceOn("db-1", "db", "10.0.0.1", 4000),
+			instanceOn("db-2", "db", "10.0.0.2", 4000),
+			instanceOn("db-3", "db", "10.0.0.3", 4000),
+		},
+	}
+}
+
+func TestFailoverAfterRepeatedFailures(t *testing.T) {
+	down := map[port.HostPort]bool{
+		{Host: "10.0.0.1", Port: 4000}: true,
+		{Host: "10.0.0.2", Port: 4000}: true,
+	}
+	m := &LinkMonitor{
+		Failures: 2,
+		Probe:    func(target port.HostPort) bool { return !down[target] },
+	}
+	deployments := []*deployment.Deployment{testDeployment()}
+	links := containers.NetworkLinks{
+		{FromHost: "127.0.0.1", FromPort: 27017, ToHost: "10.0.0.1", ToPort: 4000},
+	}
+
+	health := m.newHealthCheck()
+	if m.probeLinks(links, health) {
+		t.Fatal("Expected the target to stay linked after a single failure")
+	}
+	health = m.newHealthCheck()
+	if !m.probeLinks(links, health) {
+		t.Fatal("Expected the target to be down after repeated failures")
+	}
+	if !m.failover("web-1", links, deployments, health) {
+		t.Fatal("Expected the link to be replaced")
+	}
+	if links[0].ToHost != "10.0.0.3" || links[0].ToPort != 4000 {
+		t.Errorf("Expected the link to skip the unhealthy db-2 for db-3: %+v", links[0])
+	}
+	if len(links[0].Replaced) != 1 || links[0].Replaced[0] != (port.HostPort{Host: "10.0.0.1", Port: 4000}) {
+		t.Errorf("Expected the replaced target to be recorded: %+v", links[0].Replaced)
+	}
+}
+
+func TestFailoverAfterUnassignedAlternate(t *testing.T) {
+	down := map[port.HostPort]bool{{Host: "10.0.0.2", Port: 4000}: true}
+	m := &LinkMonitor{
+		Failures: 1,
+		Probe:    func(target port.HostPort) bool { return !down[target] },
+	}
+	deployments := []*deployment.Deployment{testDeployment()}
+	links := containers.NetworkLinks{
+		{
+			FromHost: "127.0.0.1", FromPort: 27017, ToHost: "10.0.0.1", ToPort: 4000,
+			Alternates: []port.HostPort{{Host: "10.0.0.9"}, {Host: "10.0.0.2", Port: 4000}},
+		},
+	}
+	health := m.newHealthCheck()
+	if !m.probeLinks(links, health) {
+		t.Fatal("Expected the alternate to be down")
+	}
+	if !m.failover("web-1", links, deployments, health) {
+		t.Fatal("Expected the link to be replaced")
+	}
+	alternates := links[0].Alternates
+	if links[0].ToHost != "10.0.0.1" || alternates[0] != (port.HostPort{Host: "10.0.0.9"}) || alternates[1] != (port.HostPort{Host: "10.0.0.3", Port: 4000}) {
+		t.Errorf("Expected only the down alternate to be replaced: %+v", links[0])
+	}
+}
+
+func TestFailoverSkipsUnmonitoredLinks(t *testing.T) {
+	m := &LinkMonitor{
+		Failures: 1,
+		Probe:    func(target port.HostPort) bool { return false },
+	}
+	links := containers.NetworkLinks{
+		{FromHost: "127.0.0.1", FromPort: 53, ToHost: "10.0.0.1", ToPort: 4000, Protocol: port.UDP},
+		{FromHost: "127.0.0.1", FromPort: 27017, ToHost: "@db.simple", ToPort: 27017},
+	}
+	if m.probeLinks(links, m.newHealthCheck()) {
+		t.Error("Expected UDP and discovered links not to be probed")
+	}
+}
+
+func TestFailoverWithoutAlternative(t *testing.T) {
+	m := &LinkMonitor{
+		Failures: 1,
+		Probe:    func(target port.HostPort) bool { return false },
+	}
+	deployments := []*deployment.Deployment{testDeployment()}
+	links := containers.NetworkLinks{
+		{FromHost: "127.0.0.1", FromPort: 27017, ToHost: "10.0.0.1", ToPort: 4000},
+	}
+	health := m.newHealthCheck()
+	if !m.probeLinks(links, health) {
+		t.Fatal("Expected the target to be down")
+	}
+	if m.failover("web-1", links, deployments, health) {
+		t.Errorf("Expected no change when every alternative is down: %+v", links[0])
+	}
+}
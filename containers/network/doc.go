@@ -0,0 +1,5 @@
+/*
+Applies container network links as iptables rules inside the network
+namespace of a running container.
+*/
+package network
@@ -0,0 +1,393 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/deployment"
+	"github.com/openshift/geard/docker"
+	"github.com/openshift/geard/port"
+)
+
+// Return the instances of a link destination marked with
+// deployment.DiscoveryPrefix.  Returns an error if the name is not
+// known.
+type DiscoverFunc func(host string) (deployment.Endpoints, error)
+
+func discoverLink(discover DiscoverFunc, host string) (deployment.Endpoints, error) {
+	if discover == nil {
+		return nil, errors.New("discovery is not available")
+	}
+	return discover(host)
+}
+
+// The addresses a container sends traffic from.  Either may be nil
+// when the container has no address in that family.
+type SourceAddrs struct {
+	IPv4 net.IP
+	IPv6 net.IP
+}
+
+func (s SourceAddrs) Empty() bool {
+	return s.IPv4 == nil && s.IPv6 == nil
+}
+
+func (s SourceAddrs) For(ipv6 bool) net.IP {
+	if ipv6 {
+		return s.IPv6
+	}
+	return s.IPv4
+}
+
+// Apply the links read from ports to the running process pid,
+// waiting up to wait for the process to report an IP address.
+func ApplyNetworkLinks(pid int, ports io.Reader, wait time.Duration, discover DiscoverFunc) error {
+	name, errl := LinkNamespace(pid)
+	if errl != nil {
+		return errl
+	}
+	defer UnlinkNamespace(pid)
+
+	const interval = time.Second / 10
+	var source SourceAddrs
+	errs := errors.New("IP never became available")
+	for i := 0; i < int(wait/interval); i++ {
+		if source, errs = HostIPsFromNamespace(name); errs == nil {
+			break
+		}
+		time.Sleep(interval)
+	}
+	if source.Empty() {
+		return fmt.Errorf("unable to get the container's IP address: %s", errs.Error())
+	}
+
+	log.Printf("Updating network namespaces for %d", pid)
+	return UpdateNamespaceNetworkLinks(name, source, ports, discover)
+}
+
+// Make the network namespace of pid available to 'ip netns' and
+// return its name.
+func LinkNamespace(pid int) (string, error) {
+	name := "netlink-" + strconv.Itoa(pid)
+	path := fmt.Sprintf("/var/run/netns/%s", name)
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
+	if err := os.MkdirAll("/var/run/netns", 0755); err != nil {
+		return name, err
+	}
+	if err := os.Symlink(nsPath, path); err != nil && !os.IsExist(err) {
+		return name, err
+	}
+	return name, nil
+}
+
+func UnlinkNamespace(pid int) error {
+	name := "netlink-" + strconv.Itoa(pid)
+	path := fmt.Sprintf("/var/run/netns/%s", name)
+	return os.Remove(path)
+}
+
+// Return the first IPv4 and the first global IPv6 address of the
+// named namespace.
+func HostIPsFromNamespace(name string) (SourceAddrs, error) {
+	// Resolve the containers local IPs
+	cmd := exec.Command("ip", "netns", "exec", name, "hostname", "-I")
+	cmd.Stderr = os.Stderr
+	source, erro := cmd.Output()
+	if erro != nil {
+		log.Printf("gear: Could not read IP for container: %v", erro)
+		return SourceAddrs{}, erro
+	}
+	addrs := SourceAddrs{}
+	for _, field := range strings.Fields(string(source)) {
+		ip := net.ParseIP(field)
+		switch {
+		case ip == nil:
+			log.Printf("gear: Host source IP %s is not valid", field)
+		case ip.To4() != nil:
+			if addrs.IPv4 == nil {
+				addrs.IPv4 = ip
+			}
+		case ip.IsGlobalUnicast():
+			if addrs.IPv6 == nil {
+				addrs.IPv6 = ip
+			}
+		}
+	}
+	if addrs.Empty() {
+		return addrs, errors.New("the container has no IP address")
+	}
+	return addrs, nil
+}
+
+// Resolves link hosts to an address of the requested family, using
+// the first address of a host interface for the local host.
+type addressResolver struct {
+	local   [2]net.IP
+	checked [2]bool
+}
+
+func family(ipv6 bool) int {
+	if ipv6 {
+		return 1
+	}
+	return 0
+}
+
+func (resolver *addressResolver) ResolveIP(host string, ipv6 bool) (net.IP, error) {
+	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+		f := family(ipv6)
+		if resolver.local[f] != nil {
+			return resolver.local[f], nil
+		}
+		if !resolver.checked[f] {
+			resolver.checked[f] = true
+			devices, err := net.Interfaces()
+			if err != nil {
+				return nil, err
+			}
+			for _, dev := range devices {
+				if (dev.Flags&net.FlagUp != 0) && (dev.Flags&net.FlagLoopback == 0) {
+					addrs, err := dev.Addrs()
+					if err != nil {
+						continue
+					}
+					for i := range addrs {
+						if ip, ok := addrs[i].(*net.IPNet); ok {
+							if (ip.IP.To4() == nil) == ipv6 && ip.IP.IsGlobalUnicast() {
+								log.Printf("Using %v for %s", ip, host)
+								resolver.local[f] = ip.IP
+								return resolver.local[f], nil
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if (ip.To4() == nil) != ipv6 {
+			return nil, fmt.Errorf("%s is not an %s address", host, familyName(ipv6))
+		}
+		return ip, nil
+	}
+	// A dual stack host may have addresses in both families
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if (ip.To4() == nil) == ipv6 {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no %s address", host, familyName(ipv6))
+}
+
+func familyName(ipv6 bool) string {
+	if ipv6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// Replace the NAT rules in the named namespace with rules for each
+// complete link read from ports.  Rules for links that are no longer
+// listed are removed.  Links from an IPv6 address are written with
+// ip6tables.
+func UpdateNamespaceNetworkLinks(name string, source SourceAddrs, ports io.Reader, discover DiscoverFunc) error {
+	links, errr := containers.ReadNetworkLinks(ports)
+	if errr != nil {
+		log.Printf("gear: Could not read from network links file: %v", errr)
+	}
+
+	// Local addresses are cached for this update only, since updates to
+	// different containers may run at the same time
+	resolver := &addressResolver{}
+	rules := [2]*bytes.Buffer{&bytes.Buffer{}, &bytes.Buffer{}}
+	mapped := [2]bool{}
+	for i := range links {
+		link := &links[i]
+		if err := link.Check(); err != nil {
+			log.Printf("gear: Link in file is not valid: %v", err)
+			continue
+		}
+		if link.Complete() {
+			srcIP, err := net.ResolveIPAddr("ip", link.FromHost)
+			if err != nil {
+				log.Printf("gear: Link source host does not resolve %v", err)
+				continue
+			}
+			ipv6 := srcIP.IP.To4() == nil
+			sourceAddr := source.For(ipv6)
+			if sourceAddr == nil {
+				log.Printf("gear: The container has no %s address to link %s from", familyName(ipv6), link.FromHost)
+				continue
+			}
+
+			targets := link.Targets()
+			if _, ok := deployment.DiscoveryNameFromHost(link.ToHost); ok {
+				endpoints, err := discoverLink(discover, link.ToHost)
+				if err != nil {
+					log.Printf("gear: Unable to discover %s: %v", link.ToHost, err)
+					continue
+				}
+				found := endpoints.HostPortsFor(link.ToPort, link.Protocol)
+				if len(found) == 0 {
+					log.Printf("gear: No instances of %s expose port %d", link.ToHost, link.ToPort)
+					continue
+				}
+				log.Printf("Discovered %s:%d at %v", link.ToHost, link.ToPort, found)
+				targets = append(found, link.Alternates...)
+			}
+
+			dests := make([]port.HostPort, 0, len(targets))
+			for _, target := range targets {
+				if target.Port.Default() {
+					continue
+				}
+				destIP, err := resolver.ResolveIP(target.Host, ipv6)
+				if err != nil {
+					log.Printf("gear: Link destination host does not resolve %v", err)
+					continue
+				}
+				dests = append(dests, port.HostPort{Host: destIP.String(), Port: target.Port})
+				log.Printf("Mapping %s(%s):%s -> %s:%s/%s", sourceAddr.String(), srcIP.String(), port.FormatPortRange(link.FromPort, link.Count), destIP.String(), port.FormatPortRange(target.Port, link.Count), link.Protocol)
+			}
+			if len(dests) == 0 {
+				continue
+			}
+
+			// NAT to a port range does not preserve the offset within
+			// the range, so each port of a range gets its own rule.
+			// Each destination but the last takes an even share of the
+			// connections the earlier rules did not match.
+			f := family(ipv6)
+			for n := uint(0); n < link.Size(); n++ {
+				for j, dest := range dests {
+					data := OutboundNetworkIptables{sourceAddr.String(), srcIP.IP.String(), link.FromPort + port.Port(n), dest.Host, dest.Port + port.Port(n), link.Protocol, ""}
+					if remaining := len(dests) - j; remaining > 1 {
+						data.Probability = strconv.FormatFloat(1/float64(remaining), 'f', 5, 64)
+					}
+					if err := OutboundNetworkIptablesTemplate.Execute(rules[f], &data); err != nil {
+						log.Printf("gear: Unable to write network link rules: %v", err)
+						return err
+					}
+				}
+			}
+			mapped[f] = true
+		}
+	}
+
+	if source.IPv4 != nil {
+		// Enable routing in the namespace
+		if err := namespaceSysctl(name, "net.ipv4.conf.all.route_localnet=1"); err != nil {
+			return err
+		}
+		// Enable ip forwarding
+		if err := namespaceSysctl(name, "net.ipv4.ip_forward=1"); err != nil {
+			return err
+		}
+		if err := restoreNatRules(name, "iptables-restore", rules[0], mapped[0], source.IPv4); err != nil {
+			return err
+		}
+	}
+
+	// Hosts without ip6tables are only an error when there are IPv6
+	// links to apply.
+	if source.IPv6 != nil {
+		if mapped[1] {
+			if err := namespaceSysctl(name, "net.ipv6.conf.all.forwarding=1"); err != nil {
+				return err
+			}
+		}
+		if err := restoreNatRules(name, "ip6tables-restore", rules[1], mapped[1], source.IPv6); err != nil && mapped[1] {
+			return err
+		}
+	}
+	return nil
+}
+
+func namespaceSysctl(name, setting string) error {
+	output, err := exec.Command("ip", "netns", "exec", name, "sysctl", "-w", setting).Output()
+	if err != nil {
+		log.Printf("gear: Failed to set %s: %v", setting, err)
+		log.Printf("gear: error output: %v", output)
+		return err
+	}
+	return nil
+}
+
+// Restore a set of rules to the nat table
+func restoreNatRules(name, command string, rules io.Reader, mapped bool, sourceAddr net.IP) error {
+	cmd := exec.Command("ip", "netns", "exec", name, command)
+	stdin, errp := cmd.StdinPipe()
+	if errp != nil {
+		log.Printf("gear: Could not open pipe to %s: %v", command, errp)
+		return errp
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	defer stdin.Close()
+	if err := cmd.Start(); err != nil {
+		log.Printf("gear: Could not start %s: %v", command, err)
+		return err
+	}
+
+	fmt.Fprintf(stdin, "*nat\n")
+	if _, err := io.Copy(stdin, rules); err != nil {
+		log.Printf("gear: Unable to write network link rules: %v", err)
+		return err
+	}
+	if mapped {
+		data := OutboundNetworkIptables{SourceAddr: sourceAddr.String()}
+		if err := SourceNetworkIptablesTemplate.Execute(stdin, &data); err != nil {
+			log.Printf("gear: Unable to write network link rules: %v", err)
+			return err
+		}
+	}
+	fmt.Fprintf(stdin, "COMMIT\n")
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		log.Printf("gear: %s did not successfully complete: %v", command, err)
+		return err
+	}
+	return nil
+}
+
+// Replace the network links of a running container with the ones
+// on disk.  Stopped containers pick up their links when they start.
+func ApplyRunningLinks(d *docker.DockerClient, id containers.Identifier) error {
+	container, err := d.InspectContainer(id.ContainerFor())
+	if err == docker.ErrNoSuchContainer {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !container.State.Running || container.State.Pid == 0 {
+		return nil
+	}
+
+	pid, err := d.ChildProcessForContainer(container)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(id.NetworkLinksPathFor())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ApplyNetworkLinks(pid, file, time.Second*5, deployment.DiscoverHost)
+}
@@ -0,0 +1,46 @@
+package network
+
+import (
+	"net"
+	"text/template"
+
+	"github.com/openshift/geard/port"
+)
+
+type OutboundNetworkIptables struct {
+	// The IP address for inbound source NAT
+	SourceAddr string
+	// The local IP and port to connect to
+	LocalAddr string
+	LocalPort port.Port
+	// The remote IP and port to connect to
+	DestAddr string
+	DestPort port.Port
+	// The protocol of both ports
+	Protocol port.Protocol
+	// The share of new connections sent to this destination, or empty
+	// for all remaining connections
+	Probability string
+}
+
+// The local address as a single host network.
+func (o *OutboundNetworkIptables) LocalNet() string {
+	if ip := net.ParseIP(o.LocalAddr); ip != nil && ip.To4() == nil {
+		return o.LocalAddr + "/128"
+	}
+	return o.LocalAddr + "/32"
+}
+
+// The remote address and port, bracketing IPv6 addresses.
+func (o *OutboundNetworkIptables) Destination() string {
+	return net.JoinHostPort(o.DestAddr, o.DestPort.String())
+}
+
+var OutboundNetworkIptablesTemplate = template.Must(template.New("outbound_network.iptables").Parse(`
+-A PREROUTING -d {{.LocalNet}} -p {{.Protocol}} -m {{.Protocol}} --dport {{.LocalPort}}{{if .Probability}} -m statistic --mode random --probability {{.Probability}}{{end}} -j DNAT --to-destination {{.Destination}}
+-A OUTPUT -d {{.LocalNet}} -p {{.Protocol}} -m {{.Protocol}} --dport {{.LocalPort}}{{if .Probability}} -m statistic --mode random --probability {{.Probability}}{{end}} -j DNAT --to-destination {{.Destination}}
+`))
+
+var SourceNetworkIptablesTemplate = template.Must(template.New("source_network.iptables").Parse(`
+-A POSTROUTING -o eth0 -j SNAT --to-source {{.SourceAddr}}
+`))
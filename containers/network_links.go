@@ -1,10 +1,13 @@
 package containers
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -12,11 +15,21 @@ import (
 	"github.com/openshift/geard/port"
 )
 
+// A local address inside a container that is forwarded to a remote
+// host and port.  When Count is greater than one the link forwards
+// that many consecutive ports starting at FromPort and ToPort.  New
+// connections are spread evenly across ToHost:ToPort and any
+// Alternates.
 type NetworkLink struct {
-	FromHost string
-	FromPort port.Port
-	ToPort   port.Port `json:"ToPort,omitempty"`
-	ToHost   string    `json:"ToHost,omitempty"`
+	FromHost   string
+	FromPort   port.Port
+	ToPort     port.Port       `json:"ToPort,omitempty"`
+	ToHost     string          `json:"ToHost,omitempty"`
+	Protocol   port.Protocol   `json:"Protocol,omitempty"`
+	Count      uint            `json:"Count,omitempty"`
+	Alternates []port.HostPort `json:"Alternates,omitempty"`
+	// Targets that stopped responding and were replaced
+	Replaced []port.HostPort `json:"Replaced,omitempty"`
 }
 
 type NetworkLinks []NetworkLink
@@ -30,13 +43,46 @@ func (n *NetworkLink) Check() error {
 			return errors.New("The to port value must be a positive integer less than 65536 or zero")
 		}
 	}
+	if err := n.Protocol.Check(); err != nil {
+		return err
+	}
+	if n.Size() > port.MaxRange {
+		return errors.New(fmt.Sprintf("A link may not forward more than %d ports", port.MaxRange))
+	}
+	if uint(n.FromPort)+n.Size()-1 > 65535 || uint(n.ToPort)+n.Size()-1 > 65535 {
+		return errors.New("The ports of a link may not extend past 65535")
+	}
+	for i := range n.Alternates {
+		if n.Alternates[i].Host == "" {
+			return errors.New("Each alternate target of a link must have a host")
+		}
+		if uint(n.Alternates[i].Port)+n.Size()-1 > 65535 {
+			return errors.New("The port of each alternate target must be a positive integer less than 65536 or zero")
+		}
+	}
 	return nil
 }
 
+// Every destination of the link, starting with ToHost:ToPort.  A
+// destination without a port has not been assigned one yet.
+func (n *NetworkLink) Targets() []port.HostPort {
+	targets := make([]port.HostPort, 0, len(n.Alternates)+1)
+	targets = append(targets, port.HostPort{Host: n.ToHost, Port: n.ToPort})
+	return append(targets, n.Alternates...)
+}
+
 func (n *NetworkLink) Complete() bool {
 	return n.ToPort >= 1 && n.ToHost != ""
 }
 
+// The number of ports forwarded by the link.
+func (n *NetworkLink) Size() uint {
+	if n.Count == 0 {
+		return 1
+	}
+	return n.Count
+}
+
 func (n NetworkLinks) Check() error {
 	for i := range n {
 		if err := n[i].Check(); err != nil {
@@ -65,7 +111,7 @@ func (n NetworkLinks) Write(path string, appends bool) error {
 	defer file.Close()
 
 	for i := range n {
-		if _, errw := fmt.Fprintf(file, "%s\t%d\t%d\t%s\n", n[i].FromHost, n[i].FromPort, n[i].ToPort, n[i].ToHost); errw != nil {
+		if _, errw := fmt.Fprintf(file, "%s\t%d\t%d\t%s\t%s\t%d\t%s\t%s\n", n[i].FromHost, n[i].FromPort, n[i].ToPort, n[i].ToHost, n[i].Protocol, n[i].Size(), joinHostPorts(n[i].Alternates), joinHostPorts(n[i].Replaced)); errw != nil {
 			log.Print("network_links: Unable to write network links: ", err)
 			return err
 		}
@@ -77,19 +123,120 @@ func (n NetworkLinks) Write(path string, appends bool) error {
 	return nil
 }
 
+func joinHostPorts(hostports []port.HostPort) string {
+	values := make([]string, len(hostports))
+	for i := range hostports {
+		values[i] = hostports[i].String()
+	}
+	return strings.Join(values, ",")
+}
+
+func splitHostPorts(s string) ([]port.HostPort, error) {
+	if s == "" {
+		return nil, nil
+	}
+	values := strings.Split(s, ",")
+	hostports := make([]port.HostPort, 0, len(values))
+	for i := range values {
+		hostport, err := port.NewHostPort(values[i])
+		if err != nil {
+			return nil, err
+		}
+		hostports = append(hostports, hostport)
+	}
+	return hostports, nil
+}
+
+// Read the links written by Write.  Lines that cannot be parsed are
+// logged and skipped.  Files written before links carried a protocol,
+// count, and alternates are read as single TCP ports to one target.
+func ReadNetworkLinks(r io.Reader) (NetworkLinks, error) {
+	links := NetworkLinks{}
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := scan.Text()
+		if line == "" {
+			continue
+		}
+		link, err := newNetworkLinkFromLine(line)
+		if err != nil {
+			log.Printf("network_links: Could not read network link '%s': %v", line, err)
+			continue
+		}
+		links = append(links, *link)
+	}
+	return links, scan.Err()
+}
+
+func newNetworkLinkFromLine(line string) (*NetworkLink, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 4 && len(fields) != 6 && len(fields) != 7 && len(fields) != 8 {
+		return nil, errors.New("a link must have 4, 6, 7, or 8 tab separated fields")
+	}
+	link := NetworkLink{FromHost: fields[0], ToHost: fields[3]}
+	from, err := port.NewPortFromString(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	to, err := port.NewPortFromString(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	link.FromPort, link.ToPort = from, to
+	if len(fields) == 6 {
+		if link.Protocol, err = port.NewProtocolFromString(fields[4]); err != nil {
+			return nil, err
+		}
+		count, err := strconv.ParseUint(fields[5], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		if count > 1 {
+			link.Count = uint(count)
+		}
+	}
+	if len(fields) >= 7 {
+		if link.Alternates, err = splitHostPorts(fields[6]); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) == 8 {
+		if link.Replaced, err = splitHostPorts(fields[7]); err != nil {
+			return nil, err
+		}
+	}
+	return &link, nil
+}
+
+func (n *NetworkLink) String() string {
+	var link bytes.Buffer
+	link.WriteString(linkHost(n.FromHost))
+	link.WriteString(":")
+	link.WriteString(port.FormatPortRange(n.FromPort, n.Count))
+	link.WriteString(" -> ")
+	link.WriteString(linkHost(n.ToHost))
+	link.WriteString(":")
+	link.WriteString(port.FormatPortRange(n.ToPort, n.Count))
+	for _, alternate := range n.Alternates {
+		link.WriteString("+")
+		link.WriteString(linkHost(alternate.Host))
+		link.WriteString(":")
+		link.WriteString(port.FormatPortRange(alternate.Port, n.Count))
+	}
+	if n.Protocol.UDP() {
+		link.WriteString("/")
+		link.WriteString(n.Protocol.String())
+	}
+	return link.String()
+}
+
 func (n NetworkLinks) String() string {
 	var pairs bytes.Buffer
 	for i := range n {
 		if i != 0 {
 			pairs.WriteString(", ")
 		}
-		pairs.WriteString(n[i].FromHost)
-		pairs.WriteString(":")
-		pairs.WriteString(strconv.Itoa(int(n[i].FromPort)))
-		pairs.WriteString(" -> ")
-		pairs.WriteString(n[i].ToHost)
-		pairs.WriteString(":")
-		pairs.WriteString(strconv.Itoa(int(n[i].ToPort)))
+		pairs.WriteString(n[i].String())
 	}
 	return pairs.String()
 }
@@ -108,53 +255,141 @@ func NewNetworkLinksFromString(s string) (NetworkLinks, error) {
 }
 
 func NewNetworkLinkFromString(s string) (*NetworkLink, error) {
-	value := strings.Split(s, ":")
-	if len(value) < 3 {
-		return nil, errors.New(fmt.Sprintf("The network link '%s' must be of the form <from_host>:<from_port>:<to_host>:<to_port> where <from_host> is optional", s))
+	s, protocol, err := port.SplitProtocol(s)
+	if err != nil {
+		return nil, err
+	}
+	targets := strings.Split(s, "+")
+	s = targets[0]
+	value, err := splitLinkString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) != 3 && len(value) != 4 {
+		return nil, errors.New(fmt.Sprintf("The network link '%s' must be of the form <from_host>:<from_port>:<to_host>:<to_port>[+<to_host>:<to_port>...][/<protocol>] where <from_host> is optional and the ports may be ranges", s))
 	}
 
-	// Handle the case where from_host isn't specified
+	// Handle the case where from_host isn't specified.  IPv6 has no
+	// loopback address that can be forwarded, so one must be given.
 	if len(value) == 3 {
+		if ip := net.ParseIP(value[1]); ip != nil && ip.To4() == nil {
+			return nil, errors.New(fmt.Sprintf("The network link '%s' must specify a local IPv6 address to link to an IPv6 host", s))
+		}
 		value = append([]string{"127.0.0.1"}, value...)
 	}
 
-	link := NetworkLink{}
+	link := NetworkLink{Protocol: protocol}
 	link.FromHost = value[0]
-	from_port, err := strconv.Atoi(value[1])
+	from, count, err := port.NewPortRangeFromString(value[1])
 	if err != nil {
 		return nil, err
 	}
-	link.FromPort = port.Port(from_port)
+	link.FromPort, link.Count = from, count
 	if err := link.FromPort.Check(); err != nil {
 		return nil, errors.New("From port value must be between 0 and 65535")
 	}
 	link.ToHost = value[2]
 	if value[3] != "" {
-		to, err := strconv.Atoi(value[3])
+		to, toCount, err := port.NewPortRangeFromString(value[3])
 		if err != nil {
 			return nil, err
 		}
-		link.ToPort = port.Port(to)
+		if toCount != count {
+			return nil, errors.New(fmt.Sprintf("The from and to port ranges of '%s' must be the same size", s))
+		}
+		link.ToPort = to
 		if err := link.ToPort.Check(); err != nil {
 			return nil, errors.New("To port value must be between 0 and 65535")
 		}
 	}
+	for _, alternate := range targets[1:] {
+		value, err := splitLinkString(alternate)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) != 2 || value[0] == "" {
+			return nil, errors.New(fmt.Sprintf("The alternate target '%s' must be of the form <to_host>:<to_port>", alternate))
+		}
+		to, toCount, err := port.NewPortRangeFromString(value[1])
+		if err != nil {
+			return nil, err
+		}
+		if toCount != link.Count {
+			return nil, errors.New(fmt.Sprintf("The port range of the alternate target '%s' must be the same size as the from ports", alternate))
+		}
+		if err := to.Check(); err != nil {
+			return nil, errors.New("To port value must be between 0 and 65535")
+		}
+		link.Alternates = append(link.Alternates, port.HostPort{Host: value[0], Port: to})
+	}
 	return &link, nil
 }
 
+// Split a link on ':', treating an IPv6 literal in '[...]' as a
+// single value.  The brackets are removed.
+func splitLinkString(s string) ([]string, error) {
+	values := []string{}
+	for len(s) > 0 || len(values) == 0 {
+		var value string
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end == -1 {
+				return nil, errors.New(fmt.Sprintf("The network link '%s' has an unterminated '['", s))
+			}
+			value, s = s[1:end], s[end+1:]
+			if net.ParseIP(value) == nil {
+				return nil, errors.New(fmt.Sprintf("The address '%s' must be an IPv6 address", value))
+			}
+			if s != "" && !strings.HasPrefix(s, ":") {
+				return nil, errors.New(fmt.Sprintf("The address '[%s]' must be followed by ':'", value))
+			}
+		} else if i := strings.Index(s, ":"); i != -1 {
+			value, s = s[:i], s[i:]
+		} else {
+			value, s = s, ""
+		}
+		values = append(values, value)
+		if strings.HasPrefix(s, ":") {
+			s = s[1:]
+			if s == "" {
+				values = append(values, "")
+			}
+		}
+	}
+	return values, nil
+}
+
+// Bracket IPv6 literals so the host can be followed by ':<port>'.
+func linkHost(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
 func (n NetworkLinks) ToCompact() string {
 	var pairs bytes.Buffer
 	for i := range n {
 		if i != 0 {
 			pairs.WriteString(",")
 		}
-		pairs.WriteString(n[i].FromHost)
+		pairs.WriteString(linkHost(n[i].FromHost))
 		pairs.WriteString(":")
-		pairs.WriteString(strconv.Itoa(int(n[i].FromPort)))
+		pairs.WriteString(port.FormatPortRange(n[i].FromPort, n[i].Count))
 		pairs.WriteString(":")
-		pairs.WriteString(n[i].ToHost)
+		pairs.WriteString(linkHost(n[i].ToHost))
 		pairs.WriteString(":")
-		pairs.WriteString(strconv.Itoa(int(n[i].ToPort)))
+		pairs.WriteString(port.FormatPortRange(n[i].ToPort, n[i].Count))
+		for _, alternate := range n[i].Alternates {
+			pairs.WriteString("+")
+			pairs.WriteString(linkHost(alternate.Host))
+			pairs.WriteString(":")
+			pairs.WriteString(port.FormatPortRange(alternate.Port, n[i].Count))
+		}
+		if n[i].Protocol.UDP() {
+			pairs.WriteString("/")
+			pairs.WriteString(n[i].Protocol.String())
+		}
 	}
 	return pairs.String()
 }
@@ -0,0 +1,61 @@
+package containers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openshift/geard/port"
+)
+
+func TestNetworkLinkFromString(t *testing.T) {
+	links, err := NewNetworkLinksFromString("8081:9.8.23.14:8080,[fd00::2]:53:[2001:db8::1]:53/udp,127.0.0.2:10000-10009:media:20000-20009/udp,8082:db1:27017+db2:27018+[2001:db8::3]:27017")
+	if err != nil {
+		t.Fatalf("Unable to parse links: %v", err)
+	}
+	expected := NetworkLinks{
+		NetworkLink{FromHost: "127.0.0.1", FromPort: 8081, ToHost: "9.8.23.14", ToPort: 8080},
+		NetworkLink{FromHost: "fd00::2", FromPort: 53, ToHost: "2001:db8::1", ToPort: 53, Protocol: port.UDP},
+		NetworkLink{FromHost: "127.0.0.2", FromPort: 10000, ToHost: "media", ToPort: 20000, Protocol: port.UDP, Count: 10},
+		NetworkLink{FromHost: "127.0.0.1", FromPort: 8082, ToHost: "db1", ToPort: 27017, Alternates: []port.HostPort{
+			port.HostPort{Host: "db2", Port: 27018},
+			port.HostPort{Host: "2001:db8::3", Port: 27017},
+		}},
+	}
+	if len(links) != len(expected) {
+		t.Fatalf("Expected %d links, got %+v", len(expected), links)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(links[i], expected[i]) {
+			t.Errorf("Link %d: expected %+v, got %+v", i, expected[i], links[i])
+		}
+	}
+	if s := links.ToCompact(); s != "127.0.0.1:8081:9.8.23.14:8080,[fd00::2]:53:[2001:db8::1]:53/udp,127.0.0.2:10000-10009:media:20000-20009/udp,127.0.0.1:8082:db1:27017+db2:27018+[2001:db8::3]:27017" {
+		t.Errorf("Links did not round trip: %s", s)
+	}
+
+	for _, s := range []string{"53:[2001:db8::1]:53", "[fd00::2:53:host:53", "[host]:53:other:53", "1:2:3:4:5", "10-11:host:20-22", "8082:db1:27017+db2", "10-11:db1:20-21+db2:30"} {
+		if _, err := NewNetworkLinkFromString(s); err == nil {
+			t.Errorf("Expected '%s' to be rejected", s)
+		}
+	}
+}
+
+func TestReadNetworkLinks(t *testing.T) {
+	links, err := ReadNetworkLinks(strings.NewReader("127.0.0.1\t8081\t8080\t9.8.23.14\nfd00::2\t53\t53\t2001:db8::1\tudp\t1\nbad\n127.0.0.1\t8082\t27017\tdb1\ttcp\t1\tdb2:27018,[2001:db8::3]:27017\n"))
+	if err != nil {
+		t.Fatalf("Unable to read links: %v", err)
+	}
+	if len(links) != 3 {
+		t.Fatalf("Expected the invalid line to be skipped, got %+v", links)
+	}
+	if links[0].Protocol.UDP() || links[0].Size() != 1 {
+		t.Errorf("Links without a protocol and count should be single TCP ports: %+v", links[0])
+	}
+	if !links[1].Protocol.UDP() || links[1].ToHost != "2001:db8::1" || links[1].Count != 0 {
+		t.Errorf("Unexpected link %+v", links[1])
+	}
+	if targets := links[2].Targets(); len(targets) != 3 || targets[1].String() != "db2:27018" || targets[2].Host != "2001:db8::3" {
+		t.Errorf("Unexpected targets %+v", targets)
+	}
+}
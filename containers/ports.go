@@ -2,6 +2,7 @@ package containers
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"os"
 	"strings"
@@ -41,3 +42,47 @@ func readPortsFromUnitFile(r io.Reader) (port.PortPairs, error) {
 	}
 	return pairs, nil
 }
+
+// The container a port reservation belongs to, read from the unit
+// definition the reservation links to.
+func GetPortReservationOwner(path string) (Identifier, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := scan.Text()
+		if strings.HasPrefix(line, "X-ContainerId=") {
+			return NewIdentifier(strings.TrimPrefix(line, "X-ContainerId="))
+		}
+	}
+	if scan.Err() != nil {
+		return "", scan.Err()
+	}
+	return "", ErrNoPortReservationOwner
+}
+
+var ErrNoPortReservationOwner = errors.New("The reserved port does not belong to a container")
+
+// The owner of a reservation, and whether the reservation is orphaned:
+// the definition it links to is gone, the container was removed, or
+// the container no longer maps the port.
+func CheckPortReservation(r *port.Reservation) (Identifier, bool) {
+	id, err := GetPortReservationOwner(r.Path)
+	if err != nil {
+		return "", true
+	}
+	pairs, err := GetExistingPorts(id)
+	if err != nil {
+		return id, true
+	}
+	for _, pair := range pairs {
+		if pair.Protocol.Equal(r.Protocol) && r.Port >= pair.External && r.Port < pair.External+port.Port(pair.Size()) {
+			return id, false
+		}
+	}
+	return id, true
+}
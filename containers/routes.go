@@ -0,0 +1,213 @@
+package containers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/geard/port"
+)
+
+// How a route handles TLS.  The router terminates TLS at the edge,
+// passes it through to the container, or terminates and re-encrypts
+// it.
+const (
+	RouteTermEdge  = "TERM_EDGE"
+	RouteTermGear  = "TERM_GEAR"
+	RouteTermRessl = "TERM_RESSL"
+)
+
+// Host names the router should send to a port of the container.  The
+// container is registered with the router when it starts and removed
+// when it stops or is deleted.
+type Route struct {
+	// The router frontend to add the container to.  Defaults to the
+	// first host.
+	Frontend string `json:"Frontend,omitempty"`
+	Hosts    []string
+	// The path requests are received on and the path they are sent
+	// to.  Both default to "/".
+	FrontendPath string `json:"FrontendPath,omitempty"`
+	BackendPath  string `json:"BackendPath,omitempty"`
+	// The internal port to send requests to.  Defaults to the first
+	// TCP port of the container.
+	Port      port.Port `json:"Port,omitempty"`
+	Protocols []string  `json:"Protocols,omitempty"`
+	SslTerm   string    `json:"SslTerm,omitempty"`
+}
+
+type Routes []Route
+
+var allowedHostLabel = regexp.MustCompile("\\A[a-zA-Z0-9]([a-zA-Z0-9\\-]{0,61}[a-zA-Z0-9])?\\z")
+
+// Check that host is a DNS host name, which is all a router alias may
+// be since it is written into proxy configurations and file names.
+func CheckHostName(host string) error {
+	if host == "" || len(host) > 253 {
+		return errors.New(fmt.Sprintf("The host name '%s' must be between 1 and 253 characters", host))
+	}
+	for _, label := range strings.Split(host, ".") {
+		if !allowedHostLabel.MatchString(label) {
+			return errors.New(fmt.Sprintf("The host name '%s' may only contain labels of letters, numbers, and inner hyphens separated by dots", host))
+		}
+	}
+	return nil
+}
+
+func (r *Route) Check() error {
+	if r.Frontend == "" && len(r.Hosts) == 0 {
+		return errors.New("A route must have a frontend or at least one host")
+	}
+	for i := range r.Hosts {
+		if err := CheckHostName(r.Hosts[i]); err != nil {
+			return errors.New(fmt.Sprintf("The route host '%s' is not a valid host name", r.Hosts[i]))
+		}
+	}
+	if r.FrontendPath != "" && !strings.HasPrefix(r.FrontendPath, "/") {
+		return errors.New("The frontend path of a route must start with '/'")
+	}
+	if r.BackendPath != "" && !strings.HasPrefix(r.BackendPath, "/") {
+		return errors.New("The backend path of a route must start with '/'")
+	}
+	if !r.Port.Default() {
+		if err := r.Port.Check(); err != nil {
+			return errors.New("The port of a route must be a positive integer less than 65536 or zero")
+		}
+	}
+	switch r.SslTerm {
+	case "", RouteTermEdge, RouteTermGear, RouteTermRessl:
+	default:
+		return errors.New(fmt.Sprintf("The TLS termination of a route must be one of %s, %s, or %s", RouteTermEdge, RouteTermGear, RouteTermRessl))
+	}
+	return nil
+}
+
+func (routes Routes) Check() error {
+	for i := range routes {
+		if err := routes[i].Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The frontend the route is added to.
+func (r *Route) FrontendName() string {
+	if r.Frontend != "" {
+		return r.Frontend
+	}
+	return r.Hosts[0]
+}
+
+// The port pair of the container the route sends requests to.
+// Returns false if the container has no matching TCP port.
+func (r *Route) PortFrom(ports port.PortPairs) (port.PortPair, bool) {
+	for i := range ports {
+		if ports[i].Protocol.UDP() {
+			continue
+		}
+		if r.Port.Default() || ports[i].Internal == r.Port {
+			return ports[i], true
+		}
+	}
+	return port.PortPair{}, false
+}
+
+// Replace the routes stored at path, removing the file when there are
+// no routes.
+func (routes Routes) Write(path string) error {
+	if len(routes) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(routes)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0640)
+}
+
+// Read the routes of a container.  A container without routes returns
+// an empty list.
+func ReadRoutes(path string) (Routes, error) {
+	routes := Routes{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return routes, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// Parse a comma delimited list of routes of the form
+// '<host>[:<port>][/<path>][@<TERM_EDGE|TERM_GEAR|TERM_RESSL>]'.
+func NewRoutesFromString(s string) (Routes, error) {
+	set := strings.Split(s, ",")
+	routes := make(Routes, 0, len(set))
+	for i := range set {
+		value := strings.TrimSpace(set[i])
+		if value == "" {
+			continue
+		}
+		route := Route{}
+		if at := strings.LastIndex(value, "@"); at != -1 {
+			route.SslTerm = strings.ToUpper(value[at+1:])
+			value = value[:at]
+		}
+		if slash := strings.Index(value, "/"); slash != -1 {
+			route.FrontendPath = value[slash:]
+			value = value[:slash]
+		}
+		if colon := strings.Index(value, ":"); colon != -1 {
+			p, err := strconv.Atoi(value[colon+1:])
+			if err != nil || p < 1 || p > 65535 {
+				return nil, errors.New(fmt.Sprintf("The route '%s' must have a port between 1 and 65535", set[i]))
+			}
+			route.Port = port.Port(p)
+			value = value[:colon]
+		}
+		if value != "" {
+			route.Hosts = []string{value}
+		}
+		if err := route.Check(); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (routes Routes) String() string {
+	var buf bytes.Buffer
+	for i := range routes {
+		if i != 0 {
+			buf.WriteString(",")
+		}
+		r := &routes[i]
+		if len(r.Hosts) > 0 {
+			buf.WriteString(r.Hosts[0])
+		} else {
+			buf.WriteString(r.Frontend)
+		}
+		if !r.Port.Default() {
+			buf.WriteString(":" + strconv.Itoa(int(r.Port)))
+		}
+		buf.WriteString(r.FrontendPath)
+		if r.SslTerm != "" {
+			buf.WriteString("@" + r.SslTerm)
+		}
+	}
+	return buf.String()
+}
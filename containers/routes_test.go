@@ -0,0 +1,65 @@
+package containers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openshift/geard/port"
+)
+
+func TestNewRoutesFromString(t *testing.T) {
+	routes, err := NewRoutesFromString("www.example.com,api.example.com:8443/v1@term_ressl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Routes{
+		{Hosts: []string{"www.example.com"}},
+		{Hosts: []string{"api.example.com"}, Port: 8443, FrontendPath: "/v1", SslTerm: RouteTermRessl},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("Unexpected routes: %+v", routes)
+	}
+	if s := routes.String(); s != "www.example.com,api.example.com:8443/v1@TERM_RESSL" {
+		t.Errorf("Unexpected compact routes: %s", s)
+	}
+
+	for _, invalid := range []string{"/app", "www.example.com:0", "www.example.com@TERM_NONE", "../../etc/foo", "-www.example.com", "www..example.com"} {
+		if _, err := NewRoutesFromString(invalid); err == nil {
+			t.Errorf("Expected '%s' to be rejected", invalid)
+		}
+	}
+}
+
+func TestCheckHostName(t *testing.T) {
+	for _, valid := range []string{"localhost", "www.example.com", "my-app1.example.com", "EXAMPLE.com"} {
+		if err := CheckHostName(valid); err != nil {
+			t.Errorf("Expected '%s' to be accepted: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "../../etc/foo", "www.example.com\n    server evil", "example.com.", "*.example.com", "app_1.example.com", strings.Repeat("a", 64) + ".com"} {
+		if err := CheckHostName(invalid); err == nil {
+			t.Errorf("Expected '%s' to be rejected", invalid)
+		}
+	}
+}
+
+func TestRoutePortFrom(t *testing.T) {
+	ports := port.PortPairs{
+		{Internal: 53, External: 4000, Protocol: port.UDP},
+		{Internal: 8080, External: 4001},
+		{Internal: 8443, External: 4002},
+	}
+	route := Route{Hosts: []string{"www.example.com"}}
+	if pair, found := route.PortFrom(ports); !found || pair.External != 4001 {
+		t.Errorf("Expected the first TCP port to be routed: %+v", pair)
+	}
+	route.Port = 8443
+	if pair, found := route.PortFrom(ports); !found || pair.External != 4002 {
+		t.Errorf("Expected the named port to be routed: %+v", pair)
+	}
+	route.Port = 53
+	if _, found := route.PortFrom(ports); found {
+		t.Error("Expected a UDP port not to be routed")
+	}
+}
@@ -5,21 +5,21 @@ import (
 	"fmt"
 	dc "github.com/fsouza/go-dockerclient"
 	"github.com/spf13/cobra"
-	"io"
 	"log"
-	"net"
 	"os"
 	"os/exec"
 	"os/user"
 	"path"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/openshift/geard/cmd"
 	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/containers/network"
 	"github.com/openshift/geard/containers/systemd"
+	"github.com/openshift/geard/deployment"
 	"github.com/openshift/geard/docker"
+	"github.com/openshift/geard/router"
 	"github.com/openshift/geard/selinux"
 	"github.com/openshift/geard/ssh"
 	"github.com/openshift/geard/utils"
@@ -28,6 +28,8 @@ import (
 var (
 	pre          bool
 	post         bool
+	postStop     bool
+	env          bool
 	dockerSocket string
 )
 
@@ -40,13 +42,25 @@ func RegisterInit(parent *cobra.Command) {
 	}
 	initGearCmd.Flags().BoolVarP(&pre, "pre", "", false, "Perform pre-start initialization")
 	initGearCmd.Flags().BoolVarP(&post, "post", "", false, "Perform post-start initialization")
+	initGearCmd.Flags().BoolVarP(&postStop, "post-stop", "", false, "Perform post-stop cleanup")
+	initGearCmd.Flags().BoolVarP(&env, "env", "", false, "Write the environment passed to containers, with secrets decrypted, for the environment <name>")
 	initGearCmd.Flags().StringVarP(&dockerSocket, "docker-socket", "S", "unix:///var/run/docker.sock", "Set the docker socket to use")
 	parent.AddCommand(initGearCmd)
 }
 
 func initGear(c *cobra.Command, args []string) {
-	if len(args) != 2 || !(pre || post) || (pre && post) {
-		cmd.Fail(1, "Valid arguments: <id> <image_name> (--pre|--post)")
+	if env && len(args) == 1 && countTrue(pre, post, postStop) == 0 {
+		envId, err := containers.NewIdentifier(args[0])
+		if err != nil {
+			cmd.Fail(1, "Argument 1 must be a valid environment identifier: %s", err.Error())
+		}
+		if err := containers.WriteRuntimeEnvironment(envId); err != nil {
+			cmd.Fail(2, "Unable to write the container environment %s", err.Error())
+		}
+		return
+	}
+	if len(args) != 2 || countTrue(pre, post, postStop, env) != 1 {
+		cmd.Fail(1, "Valid arguments: <id> <image_name> (--pre|--post|--post-stop) or <env_id> --env")
 	}
 	containerId, err := containers.NewIdentifier(args[0])
 	if err != nil {
@@ -64,10 +78,22 @@ func initGear(c *cobra.Command, args []string) {
 		if err := initPostStart(dockerSocket, containerId); err != nil {
 			cmd.Fail(2, "Unable to initialize container %s", err.Error())
 		}
+	case postStop:
+		if err := router.DeregisterContainer(containerId); err != nil {
+			cmd.Fail(2, "Unable to remove container routes %s", err.Error())
+		}
 	}
 }
 
-var resolver addressResolver = addressResolver{}
+func countTrue(values ...bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
 
 func initPreStart(dockerSocket string, id containers.Identifier, imageName string) error {
 	var (
@@ -191,6 +217,10 @@ func initPostStart(dockerSocket string, id containers.Identifier) error {
 		log.Print(err.Error())
 	}
 
+	if err := router.RegisterContainer(id); err != nil {
+		log.Printf("init_post_start: Unable to register routes: %v", err)
+	}
+
 	if d, err = docker.GetConnection(dockerSocket); err != nil {
 		return err
 	}
@@ -229,186 +259,10 @@ func initPostStart(dockerSocket string, id containers.Identifier) error {
 			return errors.New("child PID is not correct")
 		}
 
-		name, errl := linkNetworkNamespace(pid)
-		if errl != nil {
-			return errl
-		}
-		defer unlinkNetworkNamespace(pid)
-
-		var sourceAddr *net.IPAddr
-		errs := errors.New("IP never became available")
-		for i := 0; i < int(ContainerWait/ContainerInterval); i++ {
-			if sourceAddr, errs = getHostIPFromNamespace(name); errs == nil {
-				break
-			}
-			time.Sleep(ContainerInterval)
-		}
-		if sourceAddr == nil {
-			return fmt.Errorf("unable to get the container's IP address: %s", errs.Error())
-		}
-
-		log.Printf("Updating network namespaces for %d", pid)
-		if err := updateNamespaceNetworkLinks(name, sourceAddr, file); err != nil {
+		if err := network.ApplyNetworkLinks(pid, file, ContainerWait, deployment.DiscoverHost); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
-
-func linkNetworkNamespace(pid int) (string, error) {
-	name := "netlink-" + strconv.Itoa(pid)
-	path := fmt.Sprintf("/var/run/netns/%s", name)
-	nsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
-	if err := os.MkdirAll("/var/run/netns", 0755); err != nil {
-		return name, err
-	}
-	if err := os.Symlink(nsPath, path); err != nil && !os.IsExist(err) {
-		return name, err
-	}
-	return name, nil
-}
-
-func unlinkNetworkNamespace(pid int) error {
-	name := "netlink-" + strconv.Itoa(pid)
-	path := fmt.Sprintf("/var/run/netns/%s", name)
-	return os.Remove(path)
-}
-
-func getHostIPFromNamespace(name string) (*net.IPAddr, error) {
-	// Resolve the containers local IP
-	cmd := exec.Command("ip", "netns", "exec", name, "hostname", "-I")
-	cmd.Stderr = os.Stderr
-	source, erro := cmd.Output()
-	if erro != nil {
-		log.Printf("gear: Could not read IP for container: %v", erro)
-		return nil, erro
-	}
-	sourceAddr, errr := net.ResolveIPAddr("ip", strings.TrimSpace(string(source)))
-	if errr != nil {
-		log.Printf("gear: Host source IP %s does not resolve %v", sourceAddr, errr)
-		return nil, errr
-	}
-	return sourceAddr, nil
-}
-
-type addressResolver struct {
-	local   net.IP
-	checked bool
-}
-
-func (resolver *addressResolver) ResolveIP(host string) (net.IP, error) {
-	if host == "localhost" || host == "127.0.0.1" {
-		if resolver.local != nil {
-			return resolver.local, nil
-		}
-		if !resolver.checked {
-			resolver.checked = true
-			devices, err := net.Interfaces()
-			if err != nil {
-				return nil, err
-			}
-			for _, dev := range devices {
-				if (dev.Flags&net.FlagUp != 0) && (dev.Flags&net.FlagLoopback == 0) {
-					addrs, err := dev.Addrs()
-					if err != nil {
-						continue
-					}
-					for i := range addrs {
-						if ip, ok := addrs[i].(*net.IPNet); ok {
-							if ip.IP.To4() != nil {
-								log.Printf("Using %v for %s", ip, host)
-								resolver.local = ip.IP
-								return resolver.local, nil
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	addr, err := net.ResolveIPAddr("ip", host)
-	if err != nil {
-		return nil, err
-	}
-	return addr.IP, nil
-}
-
-func updateNamespaceNetworkLinks(name string, sourceAddr *net.IPAddr, ports io.Reader) error {
-
-	// Enable routing in the namespace
-	output, err := exec.Command("ip", "netns", "exec", name, "sysctl", "-w", "net.ipv4.conf.all.route_localnet=1").Output()
-	if err != nil {
-		log.Printf("gear: Failed to enable localnet routing: %v", err)
-		log.Printf("gear: error output: %v", output)
-		return err
-	}
-
-	// Enable ip forwarding
-	output, err = exec.Command("ip", "netns", "exec", name, "sysctl", "-w", "net.ipv4.ip_forward=1").Output()
-	if err != nil {
-		log.Printf("gear: Failed to enable ipv4 forwarding: %v", err)
-		log.Printf("gear: error output: %v", output)
-		return err
-	}
-
-	// Restore a set of rules to the table
-	cmd := exec.Command("ip", "netns", "exec", name, "iptables-restore")
-	stdin, errp := cmd.StdinPipe()
-	if errp != nil {
-		log.Printf("gear: Could not open pipe to iptables-restore: %v", errp)
-		return errp
-	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	defer stdin.Close()
-	if err := cmd.Start(); err != nil {
-		log.Printf("gear: Could not start iptables-restore: %v", errp)
-		return err
-	}
-
-	fmt.Fprintf(stdin, "*nat\n")
-	for {
-		link := containers.NetworkLink{}
-		if _, err := fmt.Fscanf(ports, "%s\t%v\t%v\t%s\n", &link.FromHost, &link.FromPort, &link.ToPort, &link.ToHost); err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("gear: Could not read from network links file: %v", err)
-			continue
-		}
-		if err := link.Check(); err != nil {
-			log.Printf("gear: Link in file is not valid: %v", err)
-			continue
-		}
-		if link.Complete() {
-			srcIP, err := net.ResolveIPAddr("ip", link.FromHost)
-			if err != nil {
-				log.Printf("gear: Link source host does not resolve %v", err)
-				continue
-			}
-
-			destIP, err := resolver.ResolveIP(link.ToHost)
-			if err != nil {
-				log.Printf("gear: Link destination host does not resolve %v", err)
-				continue
-			}
-
-			log.Printf("Mapping %s(%s):%d -> %s:%d", sourceAddr.String(), srcIP.String(), link.FromPort, destIP.String(), link.ToPort)
-
-			data := OutboundNetworkIptables{sourceAddr.String(), srcIP.IP.String(), link.FromPort, destIP.String(), link.ToPort}
-			if err := OutboundNetworkIptablesTemplate.Execute(stdin, &data); err != nil {
-				log.Printf("gear: Unable to write network link rules: %v", err)
-				return err
-			}
-		}
-	}
-	fmt.Fprintf(stdin, "COMMIT\n")
-
-	stdin.Close()
-	if err := cmd.Wait(); err != nil {
-		log.Printf("gear: iptables-restore did not successfully complete: %v", err)
-		return err
-	}
-	return nil
-}
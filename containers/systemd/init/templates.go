@@ -37,7 +37,7 @@ for i in $(find / -gid ${old_gid}); do PATH=/bin:/sbin:/usr/bin:/usr/sbin chgrp
 chown -R {{.Uid}}:{{.Gid}} {{.Volumes}}
 {{ end }}
 {{ if .UseSocketProxy }}
-sh -c 'LISTEN_PID=$$ exec /usr/sbin/systemd-socket-proxyd {{ range .PortPairs }}127.0.0.1:{{ .Internal }}{{ end }}' &
+sh -c 'LISTEN_PID=$$ exec /usr/sbin/systemd-socket-proxyd {{ range .PortPairs.Expand }}127.0.0.1:{{ .Internal }}{{ end }}' &
 {{ end }}
 exec su {{.ContainerUser}} -s /.container.init/container-cmd.sh
 `))
@@ -45,20 +45,3 @@ exec su {{.ContainerUser}} -s /.container.init/container-cmd.sh
 var ContainerCmdTemplate = template.Must(template.New("container-cmd.sh").Parse(`#!/bin/sh
 exec {{.Command}}
 `))
-
-type OutboundNetworkIptables struct {
-	// The IP address for inbound source NAT
-	SourceAddr string
-	// The local IP and port to connect to
-	LocalAddr string
-	LocalPort port.Port
-	// The remote IP and port to connect to
-	DestAddr string
-	DestPort port.Port
-}
-
-var OutboundNetworkIptablesTemplate = template.Must(template.New("outbound_network.iptables").Parse(`
--A PREROUTING -d {{.LocalAddr}}/32 -p tcp -m tcp --dport {{.LocalPort}} -j DNAT --to-destination {{.DestAddr}}:{{.DestPort}}
--A OUTPUT -d {{.LocalAddr}}/32 -p tcp -m tcp --dport {{.LocalPort}} -j DNAT --to-destination {{.DestAddr}}:{{.DestPort}}
--A POSTROUTING -o eth0 -j SNAT --to-source {{.SourceAddr}}
-`))
@@ -23,8 +23,12 @@ type ContainerUnit struct {
 	HomeDir         string
 	RunDir          string
 	EnvironmentPath string
-	ExecutablePath  string
-	IncludePath     string
+	// The environment passed to docker, written with secrets decrypted
+	// before the container starts
+	EnvironmentId          containers.Identifier
+	RuntimeEnvironmentPath string
+	ExecutablePath         string
+	IncludePath            string
 
 	PortPairs            port.PortPairs
 	SocketUnitName       string
@@ -45,6 +49,7 @@ Type=simple
 TimeoutStartSec=5m
 {{ if .Slice }}Slice={{.Slice}}{{ end }}
 {{ if .EnvironmentPath }}EnvironmentFile={{.EnvironmentPath}}{{ end }}
+{{ if and .RuntimeEnvironmentPath .DockerFeatures.EnvironmentFile }}ExecStartPre={{.ExecutablePath}} init --env "{{.EnvironmentId}}"{{ end }}
 {{end}}
 
 {{define "COMMON_CONTAINER"}}
@@ -56,8 +61,9 @@ X-ContainerId={{.Id}}
 X-ContainerImage={{.Image}}
 X-ContainerUserId={{.User}}
 X-ContainerRequestId={{.ReqId}}
-X-ContainerType={{ if .Isolate }}isolated{{ else }}simple{{ end }}
-{{range .PortPairs}}X-PortMapping={{.Internal}}:{{.External}}
+{{ if .EnvironmentId }}X-ContainerEnvironmentId={{.EnvironmentId}}
+{{ end }}X-ContainerType={{ if .Isolate }}isolated{{ else }}simple{{ end }}
+{{range .PortPairs}}X-PortMapping={{.ToHeader}}
 {{end}}
 {{end}}
 
@@ -73,12 +79,14 @@ ExecStartPre=-/usr/bin/docker rm "{{.Id}}"
 ExecStartPre={{.ExecutablePath}} init --pre "{{.Id}}" "{{.Image}}"{{ end }}
 ExecStart=/usr/bin/docker run --rm --name "{{.Id}}" \
           --volumes-from "{{.Id}}-data" \
-          {{ if and .EnvironmentPath .DockerFeatures.EnvironmentFile }}--env-file "{{ .EnvironmentPath }}"{{ end }} \
+          {{ if and .RuntimeEnvironmentPath .DockerFeatures.EnvironmentFile }}--env-file "{{ .RuntimeEnvironmentPath }}"{{ end }} \
           -a stdout -a stderr {{.PortSpec}} {{.RunSpec}} {{.BindMountSpec}} \
           {{ if .Isolate }} -v {{.RunDir}}:/.container.init:ro -u root {{end}} \
           "{{.Image}}" {{ if .Isolate }} /.container.init/container-init.sh {{ end }}
-# Set links (requires container have a name)
+# Set links and register routes (requires container have a name)
 ExecStartPost=-{{.ExecutablePath}} init --post "{{.Id}}" "{{.Image}}"
+# Remove routes
+ExecStopPost=-{{.ExecutablePath}} init --post-stop "{{.Id}}" "{{.Image}}"
 ExecReload=-/usr/bin/docker stop "{{.Id}}"
 ExecReload=-/usr/bin/docker rm "{{.Id}}"
 ExecStop=-/usr/bin/docker stop "{{.Id}}"
@@ -96,13 +104,15 @@ ExecStartPre=-/usr/bin/docker rm "{{.Id}}"
 {{ if .Isolate }}# Initialize user and volumes
 ExecStartPre={{.ExecutablePath}} init --pre "{{.Id}}" "{{.Image}}"{{ end }}
 ExecStart=/usr/bin/docker run --rm --foreground \
-          {{ if and .EnvironmentPath .DockerFeatures.EnvironmentFile }}--env-file "{{ .EnvironmentPath }}"{{ end }} \
+          {{ if and .RuntimeEnvironmentPath .DockerFeatures.EnvironmentFile }}--env-file "{{ .RuntimeEnvironmentPath }}"{{ end }} \
           {{.PortSpec}} {{.RunSpec}} {{.BindMountSpec}} \
           --name "{{.Id}}" --volumes-from "{{.Id}}-data" \
           {{ if .Isolate }} -v {{.RunDir}}:/.container.init:ro -u root {{end}} \
           "{{.Image}}" {{ if .Isolate }} /.container.init/container-init.sh {{ end }}
-# Set links (requires container have a name)
+# Set links and register routes (requires container have a name)
 ExecStartPost=-{{.ExecutablePath}} init --post "{{.Id}}" "{{.Image}}"
+# Remove routes
+ExecStopPost=-{{.ExecutablePath}} init --post-stop "{{.Id}}" "{{.Image}}"
 {{template "COMMON_CONTAINER" .}}
 {{end}}
 
@@ -116,7 +126,7 @@ ExecStartPre={{.ExecutablePath}} init --pre "{{.Id}}" "{{.Image}}"
 ExecStart=/usr/bin/docker run \
             --name "{{.Id}}" \
             --volumes-from "{{.Id}}" \
-            {{ if and .EnvironmentPath .DockerFeatures.EnvironmentFile }}--env-file "{{ .EnvironmentPath }}"{{ end }} \
+            {{ if and .RuntimeEnvironmentPath .DockerFeatures.EnvironmentFile }}--env-file "{{ .RuntimeEnvironmentPath }}"{{ end }} \
             -a stdout -a stderr {{.RunSpec}} \
             --env LISTEN_FDS \
             -v {{.RunDir}}:/.container.init:ro \
@@ -124,6 +134,8 @@ ExecStart=/usr/bin/docker run \
             -u root -f --rm \
             "{{.Image}}" /.container.init/container-init.sh
 ExecStartPost=-{{.ExecutablePath}} init --post "{{.Id}}" "{{.Image}}"
+# Remove routes
+ExecStopPost=-{{.ExecutablePath}} init --post-stop "{{.Id}}" "{{.Image}}"
 {{template "COMMON_CONTAINER" .}}
 X-SocketActivated={{.SocketActivationType}}
 {{end}}
@@ -137,7 +149,7 @@ var ContainerSocketTemplate = template.Must(template.New("unit.socket").Parse(`
 Description=Container socket {{.Id}}
 
 [Socket]
-{{range .PortPairs}}ListenStream={{.External}}
+{{range .PortPairs.Expand}}{{if .Protocol.UDP}}ListenDatagram{{else}}ListenStream{{end}}={{.ExternalAddress}}
 {{end}}
 
 [Install]
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -27,26 +28,35 @@ type Deployment struct {
 
 	IdPrefix     string
 	RandomizeIds bool
+
+	// The name the deployment is stored under on a server
+	Name string `json:"Name,omitempty"`
+	// Link to '<container>.<name>' and resolve the instances of the
+	// target when the link is applied, instead of linking to each
+	// instance directly.
+	Discovery bool `json:"Discovery,omitempty"`
 }
 
-func NewDeploymentFromFile(path string) (*Deployment, error) {
+// Load a JSON or YAML deployment descriptor from disk, expanding any
+// parameter references with params.
+func NewDeploymentFromFile(path string, params Parameters) (*Deployment, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	return parseDeployment(file)
+	return parseDeployment(file, params)
 }
 
-func NewDeploymentFromURL(uri string, insecure bool, timeout time.Duration) (*Deployment, error) {
+func NewDeploymentFromURL(uri string, insecure bool, timeout time.Duration, params Parameters) (*Deployment, error) {
 	u, err := url.Parse(uri)
 	if nil != err {
 		return nil, err
 	}
 
 	if "file" == u.Scheme {
-		return NewDeploymentFromFile(u.Path)
+		return NewDeploymentFromFile(u.Path, params)
 	}
 
 	client := NewHttpClient(insecure, timeout)
@@ -54,7 +64,7 @@ func NewDeploymentFromURL(uri string, insecure bool, timeout time.Duration) (*De
 	if nil != err {
 		return nil, err
 	}
-	request.Header.Add("Accept", "application/json")
+	request.Header.Add("Accept", "application/json, application/x-yaml, text/yaml")
 
 	response, err := client.Do(request)
 	if nil != err {
@@ -66,14 +76,31 @@ func NewDeploymentFromURL(uri string, insecure bool, timeout time.Duration) (*De
 		return nil, errors.New("Get(" + uri + "): " + response.Status)
 	}
 
-	return parseDeployment(response.Body)
+	return parseDeployment(response.Body, params)
 }
 
-func parseDeployment(payload io.Reader) (*Deployment, error) {
-	deployment := &Deployment{}
+func parseDeployment(payload io.Reader, params Parameters) (*Deployment, error) {
+	body, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeDescriptor(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := params.substitute(doc); err != nil {
+		return nil, err
+	}
+	if err := checkSchema(doc); err != nil {
+		return nil, err
+	}
+	normalized, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
 
-	decoder := json.NewDecoder(payload)
-	if err := decoder.Decode(deployment); err != nil {
+	deployment := &Deployment{}
+	if err := json.Unmarshal(normalized, deployment); err != nil {
 		return nil, err
 	}
 	return deployment, nil
@@ -86,7 +113,6 @@ func (d Deployment) Describe(placement PlacementStrategy, t transport.Transport)
 	// assign instances to containers or the remove list
 	for i := range d.Instances {
 		instance := &d.Instances[i]
-		copied := *instance
 		// is the instance invalid or no longer part of the cluster
 		if instance.On == nil {
 			continue
@@ -99,6 +125,7 @@ func (d Deployment) Describe(placement PlacementStrategy, t transport.Transport)
 			}
 			instance.on = locator
 		}
+		copied := *instance
 		if placement.RemoveFromLocation(instance.on) {
 			removed = append(removed, &copied)
 			continue
@@ -174,8 +201,16 @@ func (d Deployment) Describe(placement PlacementStrategy, t transport.Transport)
 	}
 
 	// generate the links
+	discovery := ""
+	if d.Discovery {
+		if d.Name == "" {
+			err = errors.New("deployment: a deployment that uses discovery must be stored under a name")
+			return
+		}
+		discovery = d.Name
+	}
 	for i := range links {
-		if erra := links[i].appendLinks(); erra != nil {
+		if erra := links[i].appendLinks(discovery); erra != nil {
 			err = erra
 			return
 		}
@@ -229,6 +264,13 @@ func (d *Deployment) UpdateLinks() {
 		instance := &d.Instances[i]
 		for j := range instance.links {
 			link := &instance.links[j]
+			if link.discovered {
+				continue
+			}
+			if len(link.reserved) > 0 {
+				d.updateBalancedLink(link)
+				continue
+			}
 		Found:
 			for k := range d.Instances {
 				ref := &d.Instances[k]
@@ -245,6 +287,26 @@ func (d *Deployment) UpdateLinks() {
 	}
 }
 
+// Set the external port of each target of a balanced link.
+func (d *Deployment) updateBalancedLink(link *InstanceLink) {
+	for i, reserved := range link.reserved {
+		for k := range d.Instances {
+			ref := &d.Instances[k]
+			if ref.From != link.from {
+				continue
+			}
+			if assignment, ok := ref.Ports.FindTarget(reserved); ok && assignment.External != 0 {
+				if i == 0 {
+					link.ToPort = assignment.External
+				} else {
+					link.Alternates[i-1].Port = assignment.External
+				}
+				break
+			}
+		}
+	}
+}
+
 // A container description
 type Container struct {
 	Name        string
@@ -252,6 +314,10 @@ type Container struct {
 	PublicPorts port.PortPairs                  `json:"PublicPorts,omitempty"`
 	Links       Links                           `json:"Links,omitempty"`
 	Environment containers.EnvironmentVariables `json:",omitempty"`
+	// Routes registered with the router on each instance's host
+	Routes containers.Routes `json:"Routes,omitempty"`
+	// When the idler may stop each instance
+	Idle *containers.IdlePolicy `json:"Idle,omitempty"`
 
 	Count    int
 	Affinity string `json:"Affinity,omitempty"`
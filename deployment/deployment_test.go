@@ -1,6 +1,7 @@
 package deployment
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,12 +9,14 @@ import (
 	"net"
 	gohttp "net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/openshift/geard/containers"
 	"github.com/openshift/geard/http/client"
 	"github.com/openshift/geard/port"
 	"github.com/openshift/geard/transport"
@@ -218,7 +221,7 @@ func TestPrepareDeploymentError(t *testing.T) {
 		}
 	}
 
-	dep.Containers[1].PublicPorts = port.PortPairs{port.PortPair{port.Port(27017), 0}}
+	dep.Containers[1].PublicPorts = port.PortPairs{port.PortPair{Internal: port.Port(27017)}}
 	next, removed, err := dep.Describe(oneHost, loopbackTransport)
 	if err != nil {
 		t.Fatal("Should not have received an error", err.Error())
@@ -234,7 +237,7 @@ func TestPrepareDeploymentError(t *testing.T) {
 	}
 
 	dep.RandomizeIds = true
-	dep.Containers[1].PublicPorts = port.PortPairs{port.PortPair{port.Port(27017), 0}}
+	dep.Containers[1].PublicPorts = port.PortPairs{port.PortPair{Internal: port.Port(27017)}}
 	dep.Containers[0].Links = append(dep.Containers[0].Links, Link{
 		To: "web",
 	})
@@ -405,7 +408,7 @@ func TestNewDeploymentFromURL_200(t *testing.T) {
 	}))
 	defer server.Close()
 
-	actual, err := NewDeploymentFromURL(server.URL, true, 300)
+	actual, err := NewDeploymentFromURL(server.URL, true, 300, nil)
 	if nil != err {
 		t.Errorf("TestNewDeploymentFromURL_200: error %v", err)
 		return
@@ -428,7 +431,7 @@ func TestNewDeploymentFromURL_404(t *testing.T) {
 	}))
 	defer server.Close()
 
-	actual, err := NewDeploymentFromURL(server.URL, true, 300)
+	actual, err := NewDeploymentFromURL(server.URL, true, 300, nil)
 	if nil == err || nil != actual {
 		t.Errorf("TestDeployment_NewDeploymentFromURL_400: Expected error 404 not returned: %v", actual)
 	}
@@ -440,7 +443,7 @@ func TestNewDeploymentFromURL_Secure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_, err := NewDeploymentFromURL(server.URL, false, 300)
+	_, err := NewDeploymentFromURL(server.URL, false, 300, nil)
 	if nil == err || !strings.Contains(err.Error(), "x509: certificate signed by unknown authority") {
 		t.Errorf("TestDeployment_NewDeploymentFromURL_Secure: Expected x509 error unknown authority: %v", err)
 	}
@@ -455,7 +458,7 @@ func TestNewDeploymentFromURL_Timeout(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_, err := NewDeploymentFromURL(server.URL, true, 1)
+	_, err := NewDeploymentFromURL(server.URL, true, 1, nil)
 
 	if nil == err {
 		t.Errorf("TestDeployment_NewDeploymentFromURL_Timeout: Expected timeout: %v", err)
@@ -468,3 +471,442 @@ func TestNewDeploymentFromURL_Timeout(t *testing.T) {
 	}
 	<-done
 }
+
+func TestParseDeploymentYAML(t *testing.T) {
+	expected := loadDeployment("./fixtures/lb_eap_mongo.json")
+
+	params, err := NewParametersFromFile("./fixtures/lb_eap_mongo.params")
+	if err != nil {
+		t.Fatal("Unable to load parameters", err)
+	}
+	actual, err := NewDeploymentFromFile("./fixtures/lb_eap_mongo.yaml", params)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("YAML deployment does not match JSON: expected %+v, actual %+v", expected, actual)
+	}
+
+	if _, err := NewDeploymentFromFile("./fixtures/lb_eap_mongo.yaml", nil); err == nil {
+		t.Fatal("Should have received an error for missing parameters")
+	} else if !strings.Contains(err.Error(), "Containers[0].Image: references ${REGISTRY}") {
+		t.Fatal("Unexpected error message", err.Error())
+	}
+
+	params["LB_PORT"] = "http"
+	if _, err := NewDeploymentFromFile("./fixtures/lb_eap_mongo.yaml", params); err == nil {
+		t.Fatal("Should have received an error for an invalid port")
+	} else if !strings.Contains(err.Error(), "Containers[0].PublicPorts[0].External: must be a port number") {
+		t.Fatal("Unexpected error message", err.Error())
+	}
+}
+
+func TestParseDeploymentParameters(t *testing.T) {
+	params := Parameters{}
+	for _, s := range []string{"TAG=1.2", "PORT=8080", "DB_URL=mongodb://db:27017"} {
+		if err := params.Set(s); err != nil {
+			t.Fatal("Unexpected error setting parameter", err)
+		}
+	}
+	if err := params.Set("TAG"); err == nil {
+		t.Fatal("Should have rejected a parameter without a value")
+	}
+
+	dep, err := parseDeployment(strings.NewReader(`{
+    "containers":[
+      {
+        "name":"web",
+        "count":1,
+        "image":"openshift/busybox-http-app:${TAG}",
+        "publicports":[
+          {"internal":"${PORT}","external":0}
+        ],
+        "environment":[
+          {"name":"DB_URL","value":"${DB_URL}"},
+          {"name":"PRICE","value":"$$5 ${TAG}"},
+          {"name":"TEMPLATE","value":"p$${X}"}
+        ],
+        "links":[
+          {"to":"web","ports":["${PORT}"]}
+        ]
+      }
+    ]
+  }`), params)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	c := dep.Containers[0]
+	if c.Image != "openshift/busybox-http-app:1.2" {
+		t.Fatalf("Image was not expanded: %s", c.Image)
+	}
+	if c.PublicPorts[0].Internal != 8080 || c.Links[0].Ports[0] != 8080 {
+		t.Fatalf("Ports were not expanded: %+v %+v", c.PublicPorts, c.Links[0].Ports)
+	}
+	if c.Environment[0].Value != "mongodb://db:27017" || c.Environment[1].Value != "$5 1.2" || c.Environment[2].Value != "p${X}" {
+		t.Fatalf("Environment was not expanded: %+v", c.Environment)
+	}
+
+	// Written deployments load back unchanged, however often they are
+	// rewritten
+	for i := 0; i < 2; i++ {
+		contents, err := dep.Descriptor()
+		if err != nil {
+			t.Fatal("Unable to encode the deployment", err)
+		}
+		if dep, err = parseDeployment(bytes.NewReader(contents), nil); err != nil {
+			t.Fatal("Should have reloaded the written deployment", err)
+		}
+		if !reflect.DeepEqual(c.Environment, dep.Containers[0].Environment) || dep.Containers[0].Image != c.Image {
+			t.Fatalf("Expected the written deployment to load back unchanged: %+v", dep.Containers[0])
+		}
+	}
+}
+
+func TestValidateFixtures(t *testing.T) {
+	files, err := filepath.Glob("./fixtures/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		dep, err := NewDeploymentFromFile(file, nil)
+		if err != nil {
+			t.Fatalf("Unable to load %s: %v", file, err)
+		}
+		if err := dep.Validate(); err != nil {
+			t.Errorf("Fixture %s should be valid: %v", file, err)
+		}
+	}
+}
+
+func TestValidateDeployment(t *testing.T) {
+	dep := createDeployment(`{
+    "IdPrefix":"bad/prefix",
+    "Containers":[
+      {
+        "Name":"web",
+        "Count":-1,
+        "Image":"openshift/busybox-http-app",
+        "PublicPorts":[
+          {"Internal":8080,"External":80},
+          {"Internal":8080,"External":80}
+        ],
+        "Routes":[
+          {"Hosts":["www.example.com"],"Port":9999},
+          {"SslTerm":"TERM_EDGE"}
+        ],
+        "Links":[
+          {"To":"db"},
+          {"To":"cache"},
+          {"To":"web","Ports":[9090]}
+        ]
+      },
+      {
+        "Name":"db",
+        "Count":1,
+        "Image":"pmorie/sti-db-app",
+        "Idle":{"Never":true,"Timeout":30}
+      },
+      {
+        "Name":"web",
+        "Count":1,
+        "Image":"openshift/busybox-http-app"
+      }
+    ]
+  }`)
+	err := dep.Validate()
+	if err == nil {
+		t.Fatal("Should have received validation errors")
+	}
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, got %T", err)
+	}
+	expected := []string{
+		"IdPrefix",
+		"Containers[0].Count",
+		"Containers[0].Routes[0].Port",
+		"Containers[0].Routes[1]",
+		"Containers[0].PublicPorts[1].Internal",
+		"Containers[0].PublicPorts[1].External",
+		"Containers[1].Idle",
+		"Containers[2].Name",
+		"Containers[0].Links[0].To",
+		"Containers[0].Links[1].To",
+		"Containers[0].Links[2].Ports[0]",
+	}
+	paths := make([]string, len(errs))
+	for i := range errs {
+		paths[i] = errs[i].Path
+	}
+	if !reflect.DeepEqual(expected, paths) {
+		t.Fatalf("Expected errors at %v, got:\n%s", expected, err.Error())
+	}
+}
+
+func TestValidatePortProtocols(t *testing.T) {
+	dep := createDeployment(`{
+    "Containers":[
+      {
+        "Name":"dns",
+        "Count":1,
+        "Image":"openshift/busybox-http-app",
+        "PublicPorts":[
+          {"Internal":53,"External":53},
+          {"Internal":53,"External":53,"Protocol":"udp"},
+          {"Internal":7000,"External":17000,"Count":10},
+          {"Internal":7005,"External":17020},
+          {"Internal":7100,"External":17005}
+        ]
+      },
+      {
+        "Name":"web",
+        "Count":1,
+        "Image":"openshift/busybox-http-app",
+        "PublicPorts":[
+          {"Internal":8053,"External":53,"Protocol":"udp"},
+          {"Internal":8080,"External":17009}
+        ],
+        "Links":[
+          {"To":"dns","Ports":[53]},
+          {"To":"dns","AliasPorts":[{"Internal":53,"Protocol":"udp"},{"Internal":7100,"Protocol":"udp"}]}
+        ]
+      }
+    ]
+  }`)
+	err := dep.Validate()
+	if err == nil {
+		t.Fatal("Should have received validation errors")
+	}
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, got %T", err)
+	}
+	expected := []string{
+		"Containers[0].PublicPorts[3].Internal",
+		"Containers[0].PublicPorts[4].External",
+		"Containers[1].PublicPorts[0].External",
+		"Containers[1].PublicPorts[1].External",
+		"Containers[1].Links[1].AliasPorts[1].Internal",
+	}
+	paths := make([]string, len(errs))
+	for i := range errs {
+		paths[i] = errs[i].Path
+	}
+	if !reflect.DeepEqual(expected, paths) {
+		t.Fatalf("Expected errors at %v, got:\n%s", expected, err.Error())
+	}
+
+	if !strings.Contains(err.Error(), "port 53/udp is already bound by Containers[0].PublicPorts[1]") {
+		t.Errorf("Expected the conflicting port of another container to be named, got:\n%s", err.Error())
+	}
+
+	dep.Containers[0].PublicPorts = dep.Containers[0].PublicPorts[:2]
+	dep.Containers[1].PublicPorts = nil
+	dep.Containers[1].Links = dep.Containers[1].Links[:1]
+	if err := dep.Validate(); err != nil {
+		t.Fatal("Should accept the same port over TCP and UDP", err)
+	}
+
+	changes, _, err := dep.Describe(oneHost, loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	assignPorts(changes)
+	changes.UpdateLinks()
+	web := changes.Instances.ReferencesFor("web")[0]
+	protocols := []string{}
+	for _, link := range web.links {
+		protocols = append(protocols, link.Protocol.String())
+	}
+	if !reflect.DeepEqual([]string{"tcp", "udp"}, protocols) {
+		t.Fatalf("Expected a link for each protocol of port 53, got %+v", web.links)
+	}
+}
+
+func TestParseDeploymentSchemaErrors(t *testing.T) {
+	_, err := parseDeployment(strings.NewReader(`
+Containers:
+  - Name: web
+    Count: two
+    PublicPorts:
+      - Internal: -80
+    Links: db
+`), nil)
+	if err == nil {
+		t.Fatal("Should have received an error")
+	}
+	expected := "Containers[0].Count: must be a whole number\n" +
+		"Containers[0].Links: must be a list\n" +
+		"Containers[0].PublicPorts[0].Internal: must be a positive whole number"
+	if err.Error() != expected {
+		t.Fatalf("Unexpected error message:\n%s", err.Error())
+	}
+}
+
+func TestScaleDeployment(t *testing.T) {
+	dep := createDeployment(`{
+    "containers":[
+      {"name":"web","count":1,"image":"web-app","links":[{"to":"db"}]},
+      {"name":"db","count":2,"image":"db-app","publicports":[{"internal":27017}]}
+    ]
+  }`)
+	first, _, err := dep.Describe(oneHost, loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	assignPorts(first)
+	first.UpdateLinks()
+	body, _ := json.Marshal(first)
+
+	existing := createDeployment(string(body))
+	if err := existing.Scale(map[string]int{"db": 3}); err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	placement, err := existing.ExistingPlacement(loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	if len(placement) != 1 || placement[0].String() != localhost.String() {
+		t.Fatalf("Expected the existing host to be reused: %+v", placement)
+	}
+	changes, removed, err := existing.Describe(placement, loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	if len(changes.Instances) != 4 || len(removed) != 0 {
+		t.Fatalf("Expected 4 instances and none removed, got %d and %d", len(changes.Instances), len(removed))
+	}
+	added := changes.Instances.Added()
+	if len(added) != 1 || added[0].Id != "db-3" {
+		t.Fatalf("Expected only db-3 to be added: %+v", added)
+	}
+	dependents := changes.Containers.Dependents("db")
+	if !reflect.DeepEqual(dependents, []string{"web"}) {
+		t.Fatalf("Expected web to depend on db: %+v", dependents)
+	}
+	linked := changes.Instances.AddedOrFrom(dependents...)
+	if len(linked) != 2 || linked[0].Id != "web-1" || linked[1].Id != "db-3" {
+		t.Fatalf("Expected web-1 and db-3 to be relinked: %+v", linked)
+	}
+	if web, _ := changes.Instances.Find("web-1"); len(web.links) != 3 {
+		t.Fatalf("Expected web-1 to link to 3 db instances: %+v", web.links)
+	}
+
+	if err := existing.Scale(map[string]int{"db": 1}); err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	changes, removed, err = existing.Describe(placement, loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	if len(removed) != 1 || removed[0].Id != "db-2" {
+		t.Fatalf("Expected db-2 to be removed: %+v", removed)
+	}
+	if len(changes.Instances.Added()) != 0 {
+		t.Fatalf("Expected no instances to be added: %+v", changes.Instances.Added())
+	}
+
+	if err := existing.Scale(map[string]int{"cache": 1}); err == nil {
+		t.Fatal("Expected an error scaling a container that is not defined")
+	}
+	for _, s := range []string{"db", "db=", "=2", "db=-1", "db=a"} {
+		if _, _, err := ParseScale(s); err == nil {
+			t.Errorf("Expected an error parsing %s", s)
+		}
+	}
+	if name, count, err := ParseScale("db=0"); err != nil || name != "db" || count != 0 {
+		t.Errorf("Expected db=0 to parse: %s %d %v", name, count, err)
+	}
+}
+
+func TestDescribeDiscovery(t *testing.T) {
+	dep := createDeployment(`{
+    "discovery":true,
+    "containers":[
+      {"name":"web","count":2,"image":"web-app","links":[{"to":"db"}]},
+      {"name":"db","count":2,"image":"db-app","publicports":[{"internal":27017}]}
+    ]
+  }`)
+	if _, _, err := dep.Describe(oneHost, loopbackTransport); err == nil {
+		t.Fatal("Expected an error when discovery is used without a name")
+	}
+	dep.Name = "app"
+	changes, _, err := dep.Describe(oneHost, loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	assignPorts(changes)
+	changes.UpdateLinks()
+
+	for _, id := range []string{"web-1", "web-2"} {
+		web, _ := changes.Instances.Find(containers.Identifier(id))
+		links := web.NetworkLinks()
+		if len(links) != 1 {
+			t.Fatalf("Expected a single link from %s: %+v", id, links)
+		}
+		if links[0].ToHost != "@db.app" || links[0].ToPort != 27017 || links[0].FromPort == 0 {
+			t.Errorf("Expected %s to link to @db.app:27017: %+v", id, links[0])
+		}
+	}
+
+	endpoints, err := changes.Endpoints("db")
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	found := endpoints.HostPortsFor(27017, port.TCP)
+	if len(found) != 2 || found[0].Host != localhost.String() || found[0].Port == 0 || found[0].Port == found[1].Port {
+		t.Fatalf("Expected both db instances to be discovered: %+v", found)
+	}
+	if _, err := changes.Endpoints("cache"); err == nil {
+		t.Error("Expected an error discovering an undefined container")
+	}
+
+	if c, d, err := ParseDiscoveryName("db.app.v2"); err != nil || c != "db" || d != "app.v2" {
+		t.Errorf("Unexpected parse of db.app.v2: %s %s %v", c, d, err)
+	}
+	for _, s := range []string{"db", ".app", "db."} {
+		if _, _, err := ParseDiscoveryName(s); err == nil {
+			t.Errorf("Expected an error parsing %s", s)
+		}
+	}
+	if name, ok := DiscoveryNameFromHost("@db.app"); !ok || name != "db.app" {
+		t.Errorf("Expected @db.app to be a discovery name: %s", name)
+	}
+	if _, ok := DiscoveryNameFromHost("db.example.com"); ok {
+		t.Error("Expected a host name not to be treated as a discovery name")
+	}
+}
+
+func TestBalancedLinks(t *testing.T) {
+	dep := createDeployment(`{
+    "containers":[
+      {"name":"web","count":2,"image":"web-app","links":[{"to":"db","balance":true}]},
+      {"name":"db","count":3,"image":"db-app","publicports":[{"internal":27017}]}
+    ]
+  }`)
+	changes, _, err := dep.Describe(oneHost, loopbackTransport)
+	if err != nil {
+		t.Fatal("Should not have received an error", err)
+	}
+	assignPorts(changes)
+	changes.UpdateLinks()
+
+	for _, id := range []containers.Identifier{"web-1", "web-2"} {
+		web, _ := changes.Instances.Find(id)
+		links := web.NetworkLinks()
+		if len(links) != 1 {
+			t.Fatalf("Expected a single balanced link from %s: %+v", id, links)
+		}
+		targets := links[0].Targets()
+		if len(targets) != 3 {
+			t.Fatalf("Expected %s to balance across 3 db instances: %+v", id, targets)
+		}
+		seen := make(map[port.Port]bool)
+		for _, target := range targets {
+			if target.Port.Default() || seen[target.Port] {
+				t.Errorf("Expected each target of %s to have its own assigned port: %+v", id, targets)
+			}
+			seen[target.Port] = true
+		}
+	}
+}
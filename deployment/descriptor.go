@@ -0,0 +1,66 @@
+package deployment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Decode a JSON or YAML descriptor into the generic form used
+// for parameter substitution.  Documents that begin with '{' or
+// '[' are treated as JSON, everything else as YAML.
+func decodeDescriptor(body []byte) (interface{}, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, errors.New("deployment: the descriptor is empty")
+	}
+
+	var doc interface{}
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+
+	if err := yaml.Unmarshal(trimmed, &doc); err != nil {
+		return nil, err
+	}
+	return fromYAML(doc)
+}
+
+// YAML mappings decode with interface{} keys, which encoding/json
+// can't marshal.  Convert them to string keyed maps.
+func fromYAML(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			s, ok := key.(string)
+			if !ok {
+				s = fmt.Sprintf("%v", key)
+			}
+			converted, err := fromYAML(child)
+			if err != nil {
+				return nil, err
+			}
+			m[s] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for i := range v {
+			converted, err := fromYAML(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,134 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/port"
+)
+
+// The instance of a container reachable at a host, as returned by
+// discovery.
+type Endpoint struct {
+	Id    containers.Identifier
+	Host  string
+	Ports port.PortPairs
+}
+type Endpoints []Endpoint
+
+// Return the host and external port of every endpoint that exposes
+// the internal port over the protocol.
+func (e Endpoints) HostPortsFor(internal port.Port, protocol port.Protocol) []port.HostPort {
+	found := []port.HostPort{}
+	for i := range e {
+		for _, p := range e[i].Ports {
+			if p.Internal == internal && p.Protocol.Equal(protocol) && !p.External.Default() {
+				found = append(found, port.HostPort{Host: e[i].Host, Port: p.External})
+				break
+			}
+		}
+	}
+	return found
+}
+
+// The name a linked container is discovered by when the deployment
+// uses discovery.
+func DiscoveryName(container, deployment string) string {
+	return container + "." + deployment
+}
+
+// Marks the destination of a network link as a discovery name rather
+// than a host.  Host names never contain it, so a real host can't be
+// mistaken for a container of a deployment.
+const DiscoveryPrefix = "@"
+
+// The link destination that is resolved by discovering the container
+// of a deployment.
+func DiscoveryHost(container, deployment string) string {
+	return DiscoveryPrefix + DiscoveryName(container, deployment)
+}
+
+// The discovery name of a link destination, or false if the
+// destination is a host.
+func DiscoveryNameFromHost(host string) (string, bool) {
+	if !strings.HasPrefix(host, DiscoveryPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(host, DiscoveryPrefix), true
+}
+
+// Return the endpoints of a link destination marked for discovery.
+// Returns an error for a destination that is a host.
+func DiscoverHost(host string) (Endpoints, error) {
+	name, ok := DiscoveryNameFromHost(host)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("The link destination '%s' is not a discovery name", host))
+	}
+	return Discover(name)
+}
+
+// Split a '<container>.<deployment>' name.
+func ParseDiscoveryName(name string) (container, deployment string, err error) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		err = errors.New(fmt.Sprintf("The name '%s' must be of the form <container>.<deployment>", name))
+		return
+	}
+	if err = CheckName(parts[1]); err != nil {
+		return
+	}
+	container, deployment = parts[0], parts[1]
+	return
+}
+
+// Return the current endpoints of the named container.
+func (d *Deployment) Endpoints(container string) (Endpoints, error) {
+	if _, found := d.Containers.Find(container); !found {
+		return nil, errors.New(fmt.Sprintf("deployment: no container named '%s' is defined", container))
+	}
+	endpoints := Endpoints{}
+	for _, instance := range d.Instances.ReferencesFor(container) {
+		if instance.On == nil {
+			continue
+		}
+		host := *instance.On
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		endpoints = append(endpoints, Endpoint{instance.Id, host, instance.Ports.PortPairs()})
+	}
+	return endpoints, nil
+}
+
+// Return the other endpoints of the container that exposes target,
+// for replacing a target that has stopped responding.  Returns false
+// if no instance of the deployment exposes target.
+func (d *Deployment) Alternatives(target port.HostPort) ([]port.HostPort, bool) {
+	for i := range d.Containers {
+		endpoints, err := d.Endpoints(d.Containers[i].Name)
+		if err != nil {
+			continue
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.Host != target.Host {
+				continue
+			}
+			for _, p := range endpoint.Ports {
+				if p.External != target.Port {
+					continue
+				}
+				alternatives := []port.HostPort{}
+				for _, hostport := range endpoints.HostPortsFor(p.Internal, p.Protocol) {
+					if hostport != target {
+						alternatives = append(alternatives, hostport)
+					}
+				}
+				return alternatives, true
+			}
+		}
+	}
+	return nil, false
+}
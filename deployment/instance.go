@@ -45,6 +45,27 @@ func (i *Instance) NetworkLinks() containers.NetworkLinks {
 	return i.links.NetworkLinks()
 }
 
+// The routes of the container this instance was created from.  Returns
+// an empty list rather than nil so installing replaces any old routes.
+func (i *Instance) Routes() *containers.Routes {
+	routes := containers.Routes{}
+	if i.container != nil {
+		routes = append(routes, i.container.Routes...)
+	}
+	return &routes
+}
+
+// The idle policy of the container this instance was created from.
+// Returns the default policy rather than nil so installing replaces
+// any old policy.
+func (i *Instance) IdlePolicy() *containers.IdlePolicy {
+	policy := containers.IdlePolicy{}
+	if i.container != nil && i.container.Idle != nil {
+		policy = *i.container.Idle
+	}
+	return &policy
+}
+
 func (i *Instance) EnvironmentVariables() *containers.EnvironmentDescription {
 	return &containers.EnvironmentDescription{Id: i.Id, Variables: i.Environment}
 }
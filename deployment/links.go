@@ -16,6 +16,10 @@ type Link struct {
 
 	NonLocal  bool `json:"NonLocal,omitempty"`
 	MatchPort bool `json:"MatchPort,omitempty"`
+	// Give each source one link per port that spreads connections
+	// across every target instance, instead of one link per target
+	// instance.
+	Balance bool `json:"Balance,omitempty"`
 
 	Ports      port.Ports     `json:"Ports,omitempty"`
 	AliasPorts port.PortPairs `json:"AliasPorts,omitempty"`
@@ -28,9 +32,13 @@ type Links []Link
 type InstanceLink struct {
 	containers.NetworkLink
 
-	from     string
-	fromPort port.Port
-	matched  bool
+	from       string
+	fromPort   port.Port
+	matched    bool
+	discovered bool
+	// the address reserved for each target of a balanced link, used
+	// to find the target's external port
+	reserved []port.HostPort
 }
 type InstanceLinks []InstanceLink
 
@@ -62,19 +70,28 @@ func (sources Containers) OrderLinks() (ordered containerLinks, err error) {
 			}
 			link.container = target
 
-			// ensure all direct ports are copied over to aliased ports
+			// ensure all direct ports are copied over to aliased ports,
+			// once for each protocol the target publishes them on
 			for i := range link.Ports {
-				if _, ok := link.AliasPorts.Find(link.Ports[i]); !ok {
-					link.AliasPorts = append(link.AliasPorts, port.PortPair{link.Ports[i], 0})
+				protocols := target.PublicPorts.ProtocolsOf(link.Ports[i])
+				if len(protocols) == 0 {
+					protocols = []port.Protocol{""}
+				}
+				for _, protocol := range protocols {
+					if _, ok := link.AliasPorts.Find(link.Ports[i], protocol); !ok {
+						link.AliasPorts = append(link.AliasPorts, port.PortPair{Internal: link.Ports[i], Protocol: protocol})
+					}
 				}
 			}
 
-			// by default, use all target ports if non-specified
+			// by default, use all target ports except ranges if non-specified
 			linkedPorts := link.AliasPorts
 			if len(linkedPorts) == 0 {
-				linkedPorts = make(port.PortPairs, len(target.PublicPorts))
+				linkedPorts = make(port.PortPairs, 0, len(target.PublicPorts))
 				for k := range target.PublicPorts {
-					linkedPorts[k].Internal = target.PublicPorts[k].Internal
+					if target.PublicPorts[k].Size() == 1 {
+						linkedPorts = append(linkedPorts, port.PortPair{Internal: target.PublicPorts[k].Internal, Protocol: target.PublicPorts[k].Protocol})
+					}
 				}
 				link.AliasPorts = linkedPorts
 			}
@@ -129,19 +146,21 @@ func (link containerLink) exposePorts() error {
 	instances := link.Target.Instances()
 	for i := range link.AliasPorts {
 		p := link.AliasPorts[i].Internal
+		protocol := link.AliasPorts[i].Protocol
 		for j := range instances {
 			target := instances[j]
 
-			_, found := target.Ports.Find(p)
+			_, found := target.Ports.Find(p, protocol)
 			if !found {
-				if _, has := link.Target.PublicPorts.Find(p); !has {
+				targetPair, has := link.Target.PublicPorts.Find(p, protocol)
+				if !has {
 					return errors.New(fmt.Sprintf("deployment: target port %d on %s is not found, cannot link from %s", p, link.Target.Name, link.Source.Name))
 				}
 				log.Printf("Exposing port %d from target %s so it can be linked", p, target.Id)
 				target.Ports = append(
 					target.Ports,
 					PortMapping{
-						port.PortPair{p, port.InvalidPort},
+						port.PortPair{Internal: p, Protocol: targetPair.Protocol},
 						port.HostPort{"", port.InvalidPort},
 					},
 				)
@@ -157,9 +176,9 @@ func (link containerLink) reserve(pool PortAssignmentStrategy) error {
 		port := link.AliasPorts[i]
 		for j := range instances {
 			instance := instances[j]
-			mapping, found := instance.Ports.Find(port.Internal)
+			mapping, found := instance.Ports.Find(port.Internal, port.Protocol)
 			if !found {
-				return errors.New(fmt.Sprintf("deployment: instance does not expose %d for link %s", port, link.String()))
+				return errors.New(fmt.Sprintf("deployment: instance does not expose %d for link %s", port.Internal, link.String()))
 			}
 
 			if !mapping.Target.Empty() {
@@ -189,17 +208,26 @@ func (link containerLink) reserve(pool PortAssignmentStrategy) error {
 	return nil
 }
 
-func (link containerLink) appendLinks() error {
+// Link each source instance to every target instance, or when
+// discovery names a deployment, to the discovery name of the target.
+func (link containerLink) appendLinks(discovery string) error {
 	targetInstances := link.Target.Instances()
 	sourceInstances := link.Source.Instances()
 
+	if discovery != "" {
+		return link.appendDiscoveryLinks(DiscoveryHost(link.Target.Name, discovery))
+	}
+	if link.Balance {
+		return link.appendBalancedLinks()
+	}
+
 	for i := range sourceInstances {
 		instance := sourceInstances[i]
 		for j := range targetInstances {
 			target := targetInstances[j]
 			for k := range link.AliasPorts {
 				port := link.AliasPorts[k]
-				mapping, found := target.Ports.Find(port.Internal)
+				mapping, found := target.Ports.Find(port.Internal, port.Protocol)
 				if !found {
 					return errors.New(fmt.Sprintf("deployment: instance does not expose %d for link %s", port.Internal, link.String()))
 				}
@@ -215,8 +243,9 @@ func (link containerLink) appendLinks() error {
 						FromHost: mapping.Target.Host,
 						FromPort: mapping.Target.Port,
 
-						ToPort: mapping.External,
-						ToHost: name,
+						ToPort:   mapping.External,
+						ToHost:   name,
+						Protocol: mapping.Protocol,
 					},
 					from:     link.Target.Name,
 					fromPort: port.Internal,
@@ -226,3 +255,81 @@ func (link containerLink) appendLinks() error {
 	}
 	return nil
 }
+
+// A single link per port to the discovery name, using the address
+// reserved by the first target instance so that the address seen by
+// the source is stable as the target scales.
+func (link containerLink) appendDiscoveryLinks(name string) error {
+	targetInstances := link.Target.Instances()
+	if len(targetInstances) == 0 {
+		return nil
+	}
+	target := targetInstances[0]
+	for _, instance := range link.Source.Instances() {
+		for k := range link.AliasPorts {
+			port := link.AliasPorts[k]
+			mapping, found := target.Ports.Find(port.Internal, port.Protocol)
+			if !found {
+				return errors.New(fmt.Sprintf("deployment: instance does not expose %d for link %s", port.Internal, link.String()))
+			}
+			instance.links = append(instance.links, InstanceLink{
+				NetworkLink: containers.NetworkLink{
+					FromHost: mapping.Target.Host,
+					FromPort: mapping.Target.Port,
+
+					ToPort:   port.Internal,
+					ToHost:   name,
+					Protocol: mapping.Protocol,
+				},
+				from:       link.Target.Name,
+				fromPort:   port.Internal,
+				discovered: true,
+			})
+		}
+	}
+	return nil
+}
+
+// A single link per port that spreads connections across every target
+// instance.  The source connects to the address reserved by the first
+// target instance.
+func (link containerLink) appendBalancedLinks() error {
+	targetInstances := link.Target.Instances()
+	if len(targetInstances) == 0 {
+		return nil
+	}
+	for _, instance := range link.Source.Instances() {
+		for k := range link.AliasPorts {
+			alias := link.AliasPorts[k]
+			networkLink := containers.NetworkLink{}
+			reserved := make([]port.HostPort, 0, len(targetInstances))
+			for j, target := range targetInstances {
+				mapping, found := target.Ports.Find(alias.Internal, alias.Protocol)
+				if !found {
+					return errors.New(fmt.Sprintf("deployment: instance does not expose %d for link %s", alias.Internal, link.String()))
+				}
+				name, err := target.ResolveHostname()
+				if err != nil {
+					return err
+				}
+				if j == 0 {
+					networkLink.FromHost = mapping.Target.Host
+					networkLink.FromPort = mapping.Target.Port
+					networkLink.ToHost = name
+					networkLink.ToPort = mapping.External
+					networkLink.Protocol = mapping.Protocol
+				} else {
+					networkLink.Alternates = append(networkLink.Alternates, port.HostPort{Host: name, Port: mapping.External})
+				}
+				reserved = append(reserved, mapping.Target)
+			}
+			instance.links = append(instance.links, InstanceLink{
+				NetworkLink: networkLink,
+				from:        link.Target.Name,
+				fromPort:    alias.Internal,
+				reserved:    reserved,
+			})
+		}
+	}
+	return nil
+}
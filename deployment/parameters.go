@@ -0,0 +1,242 @@
+package deployment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/geard/containers"
+)
+
+// Values substituted for ${NAME} references in a deployment
+// descriptor.  Only the Image, Environment values, and port
+// fields of each container are expanded - use $$ to include
+// a literal '$' in those fields.
+type Parameters map[string]string
+
+var parameterReference = regexp.MustCompile("\\$(\\$|\\{([a-zA-Z_][a-zA-Z0-9_\\.\\-]*)\\})")
+
+func NewParametersFromFile(path string) (Parameters, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	params := Parameters{}
+	if err := params.Load(file); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Read parameters as <name>=<value> lines, the same format as
+// an environment file.
+func (p Parameters) Load(r io.Reader) error {
+	env := containers.EnvironmentDescription{}
+	if err := env.ReadFrom(r); err != nil {
+		return err
+	}
+	for k, v := range env.Map() {
+		p[k] = v
+	}
+	return nil
+}
+
+// Set a single parameter from a <name>=<value> string.
+func (p Parameters) Set(s string) error {
+	pair := strings.SplitN(s, "=", 2)
+	if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+		return errors.New(fmt.Sprintf("The parameter '%s' must be of the form <name>=<value>", s))
+	}
+	p[strings.TrimSpace(pair[0])] = pair[1]
+	return nil
+}
+
+// Replace all parameter references in s, returning an error that
+// names path if a referenced parameter has no value.
+func (p Parameters) Expand(path, s string) (string, error) {
+	var err error
+	expanded := parameterReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		name := parameterReference.FindStringSubmatch(ref)[2]
+		value, ok := p[name]
+		if !ok && err == nil {
+			err = ValidationError{path, fmt.Sprintf("references ${%s} but no value was provided", name)}
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// Escape every '$' in s so that expanding it gives back s.
+func escapeParameters(s string) string {
+	return strings.Replace(s, "$", "$$", -1)
+}
+
+// Encode d as a descriptor, escaping the fields that accept
+// parameters so that loading it again gives back the same values.
+// Deployments written by gear are read back through the same loader
+// as the descriptors users write.
+func (d *Deployment) Descriptor() ([]byte, error) {
+	escaped := *d
+	escaped.Containers = make(Containers, len(d.Containers))
+	for i := range d.Containers {
+		c := d.Containers[i]
+		c.Image = escapeParameters(c.Image)
+		if c.Environment != nil {
+			c.Environment = make(containers.EnvironmentVariables, len(d.Containers[i].Environment))
+			for j, e := range d.Containers[i].Environment {
+				e.Value = escapeParameters(e.Value)
+				c.Environment[j] = e
+			}
+		}
+		escaped.Containers[i] = c
+	}
+	contents, err := json.MarshalIndent(&escaped, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(contents, []byte("\n")...), nil
+}
+
+// Expand parameters in the fields of a decoded descriptor that
+// accept them.  The descriptor is the generic form produced by
+// decodeDescriptor.
+func (p Parameters) substitute(doc interface{}) error {
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	sources, _ := field(root, "Containers").([]interface{})
+	for i := range sources {
+		c, ok := sources[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("Containers[%d]", i)
+
+		if err := p.expandField(c, "Image", path, false); err != nil {
+			return err
+		}
+		env, _ := field(c, "Environment").([]interface{})
+		for j := range env {
+			if v, ok := env[j].(map[string]interface{}); ok {
+				if err := p.expandField(v, "Value", fmt.Sprintf("%s.Environment[%d]", path, j), false); err != nil {
+					return err
+				}
+			}
+		}
+		if err := p.expandPortPairs(c, "PublicPorts", path); err != nil {
+			return err
+		}
+
+		links, _ := field(c, "Links").([]interface{})
+		for j := range links {
+			l, ok := links[j].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			linkPath := fmt.Sprintf("%s.Links[%d]", path, j)
+			ports, _ := field(l, "Ports").([]interface{})
+			for k := range ports {
+				value, err := p.expandPort(ports[k], fmt.Sprintf("%s.Ports[%d]", linkPath, k))
+				if err != nil {
+					return err
+				}
+				ports[k] = value
+			}
+			if err := p.expandPortPairs(l, "AliasPorts", linkPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p Parameters) expandPortPairs(parent map[string]interface{}, name, path string) error {
+	pairs, _ := field(parent, name).([]interface{})
+	for i := range pairs {
+		if pair, ok := pairs[i].(map[string]interface{}); ok {
+			pairPath := fmt.Sprintf("%s.%s[%d]", path, name, i)
+			if err := p.expandField(pair, "Internal", pairPath, true); err != nil {
+				return err
+			}
+			if err := p.expandField(pair, "External", pairPath, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p Parameters) expandField(parent map[string]interface{}, name, path string, isPort bool) error {
+	key, ok := fieldName(parent, name)
+	if !ok {
+		return nil
+	}
+	path = path + "." + name
+	if isPort {
+		value, err := p.expandPort(parent[key], path)
+		if err != nil {
+			return err
+		}
+		parent[key] = value
+		return nil
+	}
+	if s, ok := parent[key].(string); ok {
+		value, err := p.Expand(path, s)
+		if err != nil {
+			return err
+		}
+		parent[key] = value
+	}
+	return nil
+}
+
+// Port fields are numbers in the decoded descriptor unless they
+// reference a parameter, in which case the expanded value must be
+// a valid port.
+func (p Parameters) expandPort(value interface{}, path string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !parameterReference.MatchString(s) {
+		return value, nil
+	}
+	expanded, err := p.Expand(path, s)
+	if err != nil {
+		return nil, err
+	}
+	expanded = strings.TrimSpace(expanded)
+	if _, err := strconv.ParseUint(expanded, 10, 16); err != nil {
+		return nil, ValidationError{path, fmt.Sprintf("must be a port number, but '%s' expanded to '%s'", s, expanded)}
+	}
+	return json.Number(expanded), nil
+}
+
+// Field names in a descriptor are matched without regard to case,
+// the same as when decoding JSON into a struct.
+func fieldName(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func field(m map[string]interface{}, name string) interface{} {
+	if key, ok := fieldName(m, name); ok {
+		return m[key]
+	}
+	return nil
+}
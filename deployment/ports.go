@@ -23,9 +23,9 @@ func newPortMappings(ports port.PortPairs) PortMappings {
 	return assignments
 }
 
-func (p PortMappings) Find(port port.Port) (*PortMapping, bool) {
+func (p PortMappings) Find(port port.Port, protocol port.Protocol) (*PortMapping, bool) {
 	for i := range p {
-		if p[i].Internal == port {
+		if p[i].Internal == port && p[i].Protocol.Equal(protocol) {
 			return &p[i], true
 		}
 	}
@@ -47,7 +47,7 @@ func (ports PortMappings) Update(changed port.PortPairs) bool {
 		port := &ports[i]
 	NextPort:
 		for j := range changed {
-			if port.Internal == changed[j].Internal {
+			if port.Internal == changed[j].Internal && port.Protocol.Equal(changed[j].Protocol) {
 				port.External = changed[j].External
 				break NextPort
 			}
@@ -0,0 +1,107 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/geard/transport"
+)
+
+// Parse a '<container>=<count>' argument.
+func ParseScale(s string) (name string, count int, err error) {
+	pair := strings.SplitN(s, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		err = errors.New(fmt.Sprintf("The scale '%s' must be of the form <container>=<count>", s))
+		return
+	}
+	count, errc := strconv.Atoi(pair[1])
+	if errc != nil || count < 0 {
+		err = errors.New(fmt.Sprintf("The count for '%s' must be zero or a positive number", pair[0]))
+		return
+	}
+	name = pair[0]
+	return
+}
+
+// Set the number of instances of the named containers.  Call
+// Describe afterwards to create or trim instances to match.
+func (d *Deployment) Scale(counts map[string]int) error {
+	for name, count := range counts {
+		c, found := d.Containers.Find(name)
+		if !found {
+			return errors.New(fmt.Sprintf("deployment: no container named '%s' is defined", name))
+		}
+		if count < 0 {
+			return errors.New(fmt.Sprintf("deployment: the count for '%s' may not be negative", name))
+		}
+		c.Count = count
+	}
+	return nil
+}
+
+// A placement that leaves existing instances on their hosts and
+// spreads new instances across those hosts and any additional ones.
+func (d *Deployment) ExistingPlacement(t transport.Transport, additional ...transport.Locator) (SimplePlacement, error) {
+	locators := transport.Locators{}
+	seen := make(map[string]bool)
+	add := func(locator transport.Locator) {
+		if !seen[locator.String()] {
+			seen[locator.String()] = true
+			locators = append(locators, locator)
+		}
+	}
+	for i := range d.Instances {
+		on := d.Instances[i].On
+		if on == nil {
+			continue
+		}
+		locator, err := t.LocatorFor(*on)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("The host %s for instance %s is not recognized - you may be using a different transport than originally specified: %s", *on, d.Instances[i].Id, err.Error()))
+		}
+		add(locator)
+	}
+	for i := range additional {
+		add(additional[i])
+	}
+	return SimplePlacement(locators), nil
+}
+
+// Return the names of the containers that link to any of the named
+// containers.
+func (c Containers) Dependents(names ...string) []string {
+	dependents := []string{}
+	for i := range c {
+	Links:
+		for j := range c[i].Links {
+			for _, name := range names {
+				if c[i].Links[j].To == name {
+					dependents = append(dependents, c[i].Name)
+					break Links
+				}
+			}
+		}
+	}
+	return dependents
+}
+
+// Return the instances that were added or that were created from one
+// of the named containers.
+func (refs Instances) AddedOrFrom(names ...string) InstanceRefs {
+	matched := make(InstanceRefs, 0, len(refs))
+	for i := range refs {
+		if refs[i].add {
+			matched = append(matched, &refs[i])
+			continue
+		}
+		for _, name := range names {
+			if refs[i].From == name {
+				matched = append(matched, &refs[i])
+				break
+			}
+		}
+	}
+	return matched
+}
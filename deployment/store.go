@@ -0,0 +1,95 @@
+package deployment
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/geard/config"
+)
+
+// The directory deployments stored on this server are kept in.
+func StoredDeploymentsPath() string {
+	return filepath.Join(config.ContainerBasePath(), "deployments")
+}
+
+func StoredDeploymentPathFor(name string) string {
+	return filepath.Join(StoredDeploymentsPath(), name+".json")
+}
+
+// Load the deployment stored under name on this server.
+func StoredDeployment(name string) (*Deployment, error) {
+	return NewDeploymentFromFile(StoredDeploymentPathFor(name), nil)
+}
+
+// Load every deployment stored on this server, skipping any that
+// can't be read.
+func StoredDeployments() ([]*Deployment, error) {
+	infos, err := ioutil.ReadDir(StoredDeploymentsPath())
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]*Deployment, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		d, err := NewDeploymentFromFile(filepath.Join(StoredDeploymentsPath(), info.Name()), nil)
+		if err != nil {
+			log.Printf("deployments: Skipping unreadable deployment %s: %v", info.Name(), err)
+			continue
+		}
+		stored = append(stored, d)
+	}
+	return stored, nil
+}
+
+// Store the deployment under name.  The deployment is written to a
+// temporary file of its own and renamed into place, so readers never
+// see a partial deployment and concurrent writers can't interleave.
+func (d *Deployment) Store(name string) error {
+	contents, err := d.Descriptor()
+	if err != nil {
+		return err
+	}
+
+	path := StoredDeploymentPathFor(name)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0640); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Return the endpoints of a '<container>.<deployment>' name from the
+// deployments stored on this server.
+func Discover(name string) (Endpoints, error) {
+	container, deploymentName, err := ParseDiscoveryName(name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := StoredDeployment(deploymentName)
+	if err != nil {
+		return nil, err
+	}
+	return d.Endpoints(container)
+}
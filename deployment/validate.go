@@ -0,0 +1,395 @@
+package deployment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/port"
+)
+
+// A problem with a deployment descriptor and its location in the
+// document, such as Containers[2].Links[0].To
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Every problem found in a descriptor, in document order.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	var buf bytes.Buffer
+	for i := range e {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(e[i].Error())
+	}
+	return buf.String()
+}
+
+func (e *ValidationErrors) add(path, format string, args ...interface{}) {
+	*e = append(*e, ValidationError{path, fmt.Sprintf(format, args...)})
+}
+
+// Check a deployment for problems that would otherwise only be
+// discovered during Describe or when installing instances. Returns
+// ValidationErrors when any are found.
+func (d *Deployment) Validate() error {
+	errs := ValidationErrors{}
+
+	validPrefix := true
+	if d.IdPrefix != "" {
+		if !allowedIdPrefix.MatchString(d.IdPrefix) {
+			errs.add("IdPrefix", "may only contain letters, numbers, '_', '-', and '.'")
+			validPrefix = false
+		} else if len(d.IdPrefix) > maxIdPrefix {
+			errs.add("IdPrefix", "must be %d characters or less", maxIdPrefix)
+			validPrefix = false
+		}
+	}
+
+	if d.Name != "" {
+		if err := CheckName(d.Name); err != nil {
+			errs.add("Name", "%s", err.Error())
+		}
+	}
+
+	names := make(map[string]int)
+	// External ports are bound on the host, so no two containers may
+	// claim the same one.
+	external := make(map[protocolPort]string)
+	for i := range d.Containers {
+		c := &d.Containers[i]
+		path := fmt.Sprintf("Containers[%d]", i)
+
+		switch existing, found := names[c.Name]; {
+		case c.Name == "":
+			errs.add(path+".Name", "is required")
+		case d.Discovery && strings.Contains(c.Name, "."):
+			errs.add(path+".Name", "may not contain '.' when the deployment uses discovery")
+		case found:
+			errs.add(path+".Name", "duplicates the name '%s' of Containers[%d]", c.Name, existing)
+		default:
+			names[c.Name] = i
+			if validPrefix && !d.RandomizeIds && c.Count > 0 {
+				last := d.IdPrefix + c.Name + "-" + strconv.Itoa(c.Count)
+				if _, err := containers.NewIdentifier(last); err != nil {
+					errs.add(path+".Name", "generates the instance id '%s' which is not valid: %s", last, err.Error())
+				}
+			}
+		}
+
+		if c.Count < 0 {
+			errs.add(path+".Count", "must not be negative")
+		}
+		if c.Affinity != "" && c.Affinity != DistributeAffinity {
+			errs.add(path+".Affinity", "must be empty or '%s'", DistributeAffinity)
+		}
+
+		for j := range c.Environment {
+			if err := c.Environment[j].Check(); err != nil {
+				errs.add(fmt.Sprintf("%s.Environment[%d]", path, j), "%s", err.Error())
+			}
+		}
+
+		for j := range c.Routes {
+			route := &c.Routes[j]
+			routePath := fmt.Sprintf("%s.Routes[%d]", path, j)
+			if err := route.Check(); err != nil {
+				errs.add(routePath, "%s", err.Error())
+			} else if _, found := route.PortFrom(c.PublicPorts); !found {
+				errs.add(routePath+".Port", "must be one of the TCP PublicPorts")
+			}
+		}
+
+		if c.Idle != nil {
+			if err := c.Idle.Check(); err != nil {
+				errs.add(path+".Idle", "%s", err.Error())
+			}
+		}
+
+		internal := make(map[protocolPort]string)
+		for j := range c.PublicPorts {
+			pair := &c.PublicPorts[j]
+			pairPath := fmt.Sprintf("%s.PublicPorts[%d]", path, j)
+			if err := pair.Protocol.Check(); err != nil {
+				errs.add(pairPath+".Protocol", "%s", err.Error())
+			}
+			if pair.Size() > port.MaxRange {
+				errs.add(pairPath+".Count", "may not be more than %d", port.MaxRange)
+			}
+			if err := pair.Internal.Check(); err != nil {
+				errs.add(pairPath+".Internal", "%s", err.Error())
+			} else if p, at, found := reservePorts(internal, pair.Internal, pair, pairPath); found {
+				errs.add(pairPath+".Internal", "port %d/%s is already listed at %s", p, pair.Protocol, at)
+			}
+			if pair.External.Default() {
+				continue
+			}
+			if err := pair.External.Check(); err != nil {
+				errs.add(pairPath+".External", "%s", err.Error())
+			} else if p, at, found := reservePorts(external, pair.External, pair, pairPath); found {
+				errs.add(pairPath+".External", "port %d/%s is already bound by %s", p, pair.Protocol, at)
+			}
+		}
+	}
+
+	for i := range d.Containers {
+		d.validateLinks(i, &errs)
+	}
+
+	ids := make(map[containers.Identifier]int)
+	for i := range d.Instances {
+		instance := &d.Instances[i]
+		path := fmt.Sprintf("Instances[%d]", i)
+		if _, err := containers.NewIdentifier(string(instance.Id)); err != nil {
+			errs.add(path+".Id", "%s", err.Error())
+		} else if k, found := ids[instance.Id]; found {
+			errs.add(path+".Id", "duplicates the id of Instances[%d]", k)
+		} else {
+			ids[instance.Id] = i
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (d *Deployment) validateLinks(i int, errs *ValidationErrors) {
+	source := &d.Containers[i]
+	for j := range source.Links {
+		link := &source.Links[j]
+		path := fmt.Sprintf("Containers[%d].Links[%d]", i, j)
+
+		if link.To == "" {
+			errs.add(path+".To", "is required")
+			continue
+		}
+		target, found := d.Containers.Find(link.To)
+		if !found {
+			errs.add(path+".To", "references the container '%s' which is not defined", link.To)
+			continue
+		}
+		if len(target.PublicPorts) == 0 {
+			errs.add(path+".To", "references the container '%s' which has no PublicPorts to link to", link.To)
+			continue
+		}
+
+		for k, p := range link.Ports {
+			protocols := target.PublicPorts.ProtocolsOf(p)
+			if len(protocols) == 0 {
+				errs.add(fmt.Sprintf("%s.Ports[%d]", path, k), "port %d is not one of the PublicPorts of '%s'", p, link.To)
+				continue
+			}
+			for _, protocol := range protocols {
+				if pair, _ := target.PublicPorts.Find(p, protocol); pair.Size() > 1 {
+					errs.add(fmt.Sprintf("%s.Ports[%d]", path, k), "port %d/%s of '%s' is a range, which can't be linked", p, protocol, link.To)
+				}
+			}
+		}
+		for k := range link.AliasPorts {
+			alias := &link.AliasPorts[k]
+			aliasPath := fmt.Sprintf("%s.AliasPorts[%d]", path, k)
+			if err := alias.Protocol.Check(); err != nil {
+				errs.add(aliasPath+".Protocol", "%s", err.Error())
+			} else if pair, ok := target.PublicPorts.Find(alias.Internal, alias.Protocol); !ok {
+				errs.add(aliasPath+".Internal", "port %d/%s is not one of the PublicPorts of '%s'", alias.Internal, alias.Protocol, link.To)
+			} else if pair.Size() > 1 {
+				errs.add(aliasPath+".Internal", "port %d/%s of '%s' is a range, which can't be linked", alias.Internal, alias.Protocol, link.To)
+			}
+			if !alias.External.Default() {
+				if err := alias.External.Check(); err != nil {
+					errs.add(aliasPath+".External", "%s", err.Error())
+				}
+			}
+		}
+	}
+}
+
+// A single port of a protocol, since the same port number may be
+// used once for TCP and once for UDP.
+type protocolPort struct {
+	port.Port
+	protocol string
+}
+
+// Record every port of the range starting at first under path, or
+// return the first port that is already recorded and the path that
+// recorded it.  Ranges that are too large are already reported and
+// aren't recorded.
+func reservePorts(seen map[protocolPort]string, first port.Port, pair *port.PortPair, path string) (port.Port, string, bool) {
+	if pair.Size() > port.MaxRange {
+		return 0, "", false
+	}
+	for n := uint(0); n < pair.Size(); n++ {
+		key := protocolPort{first + port.Port(n), pair.Protocol.String()}
+		if at, found := seen[key]; found {
+			return key.Port, at, true
+		}
+	}
+	for n := uint(0); n < pair.Size(); n++ {
+		seen[protocolPort{first + port.Port(n), pair.Protocol.String()}] = path
+	}
+	return 0, "", false
+}
+
+// Leave room for a container name and instance number within the
+// identifier length limit.
+const maxIdPrefix = 20
+
+var allowedIdPrefix = regexp.MustCompile("\\A[a-zA-Z0-9\\_\\-\\.]+\\z")
+
+var allowedName = regexp.MustCompile("\\A[a-zA-Z0-9\\_\\-][a-zA-Z0-9\\_\\-\\.]{0,63}\\z")
+
+// Check the name a deployment is stored under on a server.
+func CheckName(name string) error {
+	if name == "" {
+		return errors.New("A deployment name must be specified")
+	}
+	if !allowedName.MatchString(name) {
+		return errors.New("A deployment name must be 64 characters or less, may only contain letters, numbers, '_', '-', and '.', and may not start with '.'")
+	}
+	return nil
+}
+
+// Check the shape of a decoded descriptor against the Deployment
+// type, so that a value of the wrong type is reported at its
+// location instead of as a decode error.
+func checkSchema(doc interface{}) error {
+	errs := ValidationErrors{}
+	checkValue(doc, reflect.TypeOf(Deployment{}), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkValue(value interface{}, t reflect.Type, path string, errs *ValidationErrors) {
+	if value == nil {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		checkValue(value, t.Elem(), path, errs)
+
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			errs.add(path, "must be an object")
+			return
+		}
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if f, ok := structField(t, key); ok {
+				checkValue(m[key], f.Type, joinPath(path, f.Name), errs)
+			}
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			errs.add(path, "must be a list")
+			return
+		}
+		for i := range items {
+			checkValue(items[i], t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			errs.add(path, "must be a string")
+		}
+
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			errs.add(path, "must be true or false")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, ok := integer(value); !ok {
+			errs.add(path, "must be a whole number")
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, ok := integer(value); !ok || i < 0 {
+			errs.add(path, "must be a positive whole number")
+		}
+	}
+}
+
+// Integers decode as json.Number from JSON and as int or float64
+// from YAML.
+func integer(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), float64(int64(v)) == v
+	}
+	return 0, false
+}
+
+// Find the field of t that encoding/json would decode key into,
+// including fields promoted from untagged embedded structs.
+func structField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			if promoted, ok := structField(f.Type, key); ok {
+				return promoted, true
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			f.Name = name
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -122,7 +122,6 @@ func (t *TokenConfiguration) Handler(parent http.Handler) http.HandlerFunc {
 		token := &TokenData{}
 		decoder := json.NewDecoder(bytes.NewReader(out))
 		decoder.Decode(token)
-		log.Printf("Decoded %+v", *token)
 
 		if token.Content == "" {
 			log.Printf("The token has no content")
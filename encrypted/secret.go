@@ -0,0 +1,109 @@
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const secretKeySize = 32
+
+// A symmetric key kept on a host to encrypt values at rest.  Only
+// processes that can read the key file can decrypt the values.
+type SecretKey []byte
+
+// Read the key at path.
+func LoadSecretKey(path string) (SecretKey, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != secretKeySize {
+		return nil, errors.New(fmt.Sprintf("The secret key %s must be %d bytes", path, secretKeySize))
+	}
+	return SecretKey(key), nil
+}
+
+// Read the key at path, or create a random key that only the owner can
+// read if the host has none.
+func LoadOrCreateSecretKey(path string) (SecretKey, error) {
+	key, err := LoadSecretKey(path)
+	if !os.IsNotExist(err) {
+		return key, err
+	}
+
+	key = make(SecretKey, secretKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		// created by another process
+		return LoadSecretKey(path)
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Write(key); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k SecretKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt and authenticate value, returning the nonce and cipher text
+// base64 URL encoded.
+func (k SecretKey) Seal(value string) (string, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// Decrypt a value returned by Seal.  Fails if the value was sealed with
+// another key or has been modified.
+func (k SecretKey) Open(sealed string) (string, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.URLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("The sealed value is too short")
+	}
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("The sealed value could not be decrypted with this key")
+	}
+	return string(value), nil
+}
@@ -0,0 +1,41 @@
+package encrypted
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealSecret(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "secrettest")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys", "secret.key")
+
+	key, err := LoadOrCreateSecretKey(path)
+	if err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+	if again, err := LoadOrCreateSecretKey(path); err != nil || string(again) != string(key) {
+		t.Fatalf("Expected the existing key to be read: %v", err)
+	}
+
+	sealed, err := key.Seal("Do some stuff")
+	if err != nil {
+		t.Fatalf("Unable to seal: %v", err)
+	}
+	if other, _ := key.Seal("Do some stuff"); other == sealed {
+		t.Errorf("Expected each seal to use a new nonce")
+	}
+	if value, err := key.Open(sealed); err != nil || value != "Do some stuff" {
+		t.Errorf("Expected the sealed value to open, got %q: %v", value, err)
+	}
+
+	other := make(SecretKey, secretKeySize)
+	if _, err := other.Open(sealed); err == nil {
+		t.Errorf("Expected another key to be rejected")
+	}
+	if _, err := key.Open(sealed[:len(sealed)-4] + "AAAA"); err == nil {
+		t.Errorf("Expected a modified value to be rejected")
+	}
+}
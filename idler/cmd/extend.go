@@ -7,6 +7,7 @@ import (
 	"github.com/openshift/geard/docker"
 	"github.com/openshift/geard/idler"
 	"github.com/openshift/geard/systemd"
+	"github.com/openshift/geard/transport"
 	"github.com/spf13/cobra"
 
 	"net"
@@ -16,6 +17,8 @@ import (
 var (
 	hostIp      string
 	idleTimeout int
+	wakeTimeout int
+	server      string
 )
 
 func init() {
@@ -26,7 +29,9 @@ func init() {
 			Run:   startIdler,
 		}
 		idlerCmd.PersistentFlags().StringVarP(&hostIp, "host-ip", "H", guessHostIp(), "IP address to listen for traffic on")
-		idlerCmd.PersistentFlags().IntVarP(&idleTimeout, "idle-timeout", "T", 60, "Set the number of minutes of inactivity before an application is idled")
+		idlerCmd.PersistentFlags().IntVarP(&idleTimeout, "idle-timeout", "T", 60, "Set the number of minutes of inactivity before an application is idled, unless its idle policy sets a timeout")
+		idlerCmd.PersistentFlags().IntVar(&wakeTimeout, "wake-timeout", 30, "The number of seconds to hold traffic for an idled container while it starts and opens its port")
+		idlerCmd.PersistentFlags().StringVar(&server, "server", "localhost", "The geard daemon that idle and unidle requests are sent to")
 		parent.AddCommand(idlerCmd)
 	}, true)
 }
@@ -40,7 +45,16 @@ func startIdler(c *cobra.Command, args []string) {
 		cmd.Fail(1, "Unable to connect to docker on URI %s", dockerSocket)
 	}
 
-	if err := idler.StartIdler(dockerClient, hostIp, idleTimeout); err != nil {
+	if wakeTimeout < 1 {
+		cmd.Fail(1, "--wake-timeout must be positive")
+	}
+
+	t, ok := transport.GetTransport("http")
+	if !ok {
+		cmd.Fail(1, "The http transport is required to reach the geard daemon")
+	}
+
+	if err := idler.StartIdler(dockerClient, hostIp, idleTimeout, wakeTimeout, t, server); err != nil {
 		cmd.Fail(2, err.Error())
 	}
 }
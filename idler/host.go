@@ -0,0 +1,151 @@
+package idler
+
+import (
+	"github.com/openshift/geard/cmd"
+	"github.com/openshift/geard/config"
+	"github.com/openshift/geard/containers"
+	cjobs "github.com/openshift/geard/containers/jobs"
+	cloc "github.com/openshift/geard/containers/locator"
+	csystemd "github.com/openshift/geard/containers/systemd"
+	"github.com/openshift/geard/docker"
+	"github.com/openshift/geard/port"
+	"github.com/openshift/geard/systemd"
+	"github.com/openshift/geard/transport"
+
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Containers installed on this host.  Idle and unidle jobs are
+// submitted to the geard daemon on server.
+type HostContainers struct {
+	Docker      *docker.DockerClient
+	Transport   transport.Transport
+	Server      string
+	WakeTimeout time.Duration
+}
+
+// Reservations link the external port to the unit definition of the
+// container that holds it.  The port may be reserved on any interface
+// of the host.
+func (h *HostContainers) IdentifierFor(p port.Port) (containers.Identifier, error) {
+	interfaces, err := port.ReadInterfaces(config.ContainerBasePath())
+	if err != nil {
+		return "", err
+	}
+	for _, i := range interfaces {
+		id, err := containers.GetPortReservationOwner(port.ReservationPath(config.ContainerBasePath(), i.Device, port.TCP, p))
+		if !os.IsNotExist(err) {
+			return id, err
+		}
+	}
+	return "", fmt.Errorf("Container ID not found for port %v", p)
+}
+
+func (h *HostContainers) Started(id containers.Identifier) (bool, error) {
+	return csystemd.UnitStartOnBoot(id)
+}
+
+func (h *HostContainers) Idled(id containers.Identifier) bool {
+	_, err := os.Stat(id.IdleUnitPathFor())
+	return err == nil
+}
+
+func (h *HostContainers) IdlePolicy(id containers.Identifier) (*containers.IdlePolicy, error) {
+	return containers.ReadIdlePolicy(id.IdlePolicyPathFor())
+}
+
+func (h *HostContainers) IdleContainer(id containers.Identifier) error {
+	return h.submit(id, &cjobs.IdleContainerRequest{Id: id})
+}
+
+func (h *HostContainers) UnidleContainer(id containers.Identifier) error {
+	return h.submit(id, &cjobs.UnidleContainerRequest{Id: id})
+}
+
+// Run a container job through the geard daemon so that idling is
+// logged and handled like any other change to a container.
+func (h *HostContainers) submit(id containers.Identifier, request cmd.JobRequest) error {
+	on, err := cloc.NewContainerLocators(h.Transport, h.Server+"/"+string(id))
+	if err != nil {
+		return err
+	}
+	failures := cmd.Executor{
+		On: on,
+		Serial: func(cmd.Locator) cmd.JobRequest {
+			return request
+		},
+		Output:    os.Stdout,
+		Transport: h.Transport,
+	}.Stream()
+	if len(failures) > 0 {
+		return failures[0]
+	}
+	return nil
+}
+
+// How often a waking container is checked.
+const wakeInterval = 100 * time.Millisecond
+
+// The container's unit must become active, then the internal port
+// behind the external port must accept connections.
+func (h *HostContainers) Readiness(id containers.Identifier, p port.Port) *Readiness {
+	unitName := id.UnitNameFor()
+	starting := false
+	return &Readiness{
+		UnitActive: func() (bool, error) {
+			props, err := systemd.Connection().GetUnitProperties(unitName)
+			if err != nil {
+				return false, nil
+			}
+			switch props["ActiveState"] {
+			case "active":
+				return true, nil
+			case "activating":
+				starting = true
+			case "failed":
+				// the unit may still be failed from when it was idled
+				if starting {
+					return false, ErrUnitFailed
+				}
+			}
+			return false, nil
+		},
+		Accepting: DialAccepting(func() (string, error) {
+			return h.containerAddress(id, p)
+		}, wakeInterval),
+		Interval: wakeInterval,
+		Timeout:  h.WakeTimeout,
+	}
+}
+
+// The address inside the container that receives traffic for an
+// external port.
+func (h *HostContainers) containerAddress(id containers.Identifier, external port.Port) (string, error) {
+	pairs, err := containers.GetExistingPorts(id)
+	if err != nil {
+		return "", err
+	}
+	var internal port.Port
+	for _, pair := range pairs.Expand() {
+		if pair.External == external && !pair.Protocol.UDP() {
+			internal = pair.Internal
+			break
+		}
+	}
+	if internal.Default() {
+		return "", fmt.Errorf("Container %v has no TCP port mapped to %v", id, external)
+	}
+	ips, err := h.Docker.GetContainerIPs([]string{string(id)})
+	if err != nil {
+		return "", err
+	}
+	for ip := range ips {
+		if ip != "" {
+			return net.JoinHostPort(ip, internal.String()), nil
+		}
+	}
+	return "", fmt.Errorf("Container %v has no IP address", id)
+}
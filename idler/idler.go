@@ -1,179 +1,287 @@
-// +build idler
-
 package idler
 
 import (
 	"github.com/openshift/geard/containers"
 	csystemd "github.com/openshift/geard/containers/systemd"
-	"github.com/openshift/geard/docker"
-	"github.com/openshift/geard/idler/config"
 	"github.com/openshift/geard/idler/iptables"
-	"github.com/openshift/geard/pkg/go-netfilter-queue"
-	"github.com/openshift/geard/systemd"
+	"github.com/openshift/geard/port"
 
 	"bytes"
-	"code.google.com/p/gopacket/layers"
 	"fmt"
 	"os"
-	"strconv"
 	"text/tabwriter"
 	"time"
 )
 
-type Idler struct {
-	d             *docker.DockerClient
-	qh            []*netfilter.NFQueue
-	waitChan      chan uint16
-	openChannels  []containers.Identifier
-	hostIp        string
-	idleTimeout   time.Duration
-	eventListener *csystemd.EventListener
+// A packet for an idle container, held until the idler gives it a
+// verdict.
+type Packet interface {
+	// The external port the packet was sent to
+	Port() (port.Port, error)
+	// Let the packet through
+	Accept()
+	// Hand the packet to another queue
+	Requeue(queue uint16)
 }
 
-var idler *Idler
+// The queues packets for idle containers arrive on.  Queue 0 receives
+// the first packet sent to an idle container, the other queues hold
+// packets while a container wakes.
+type PacketSource interface {
+	Queues() int
+	Packets(queue uint16) <-chan Packet
+}
 
-func StartIdler(pDockerClient *docker.DockerClient, pHostIp string, pIdleTimeout int) error {
-	idler = newIdler(pDockerClient, pHostIp, pIdleTimeout)
-	idler.Run()
-	return nil
+// Decides whether traffic for a container is queued or delivered.
+type RulesManager interface {
+	// Queue traffic for the container on queue 0
+	Idle(id containers.Identifier)
+	// Deliver traffic to the container
+	Unidle(id containers.Identifier)
+	// Remove every rule for the container
+	Delete(id containers.Identifier)
+	// True if traffic for all of the container's ports is queued
+	Idled(id containers.Identifier) (bool, error)
+	// Remove rules for a port no container holds anymore
+	Cleanup(p port.Port)
 }
 
-func newIdler(d *docker.DockerClient, hostIp string, idleTimeout int) *Idler {
-	var err error
+// Reports the traffic each installed container received since the
+// previous call.
+type TrafficCounter interface {
+	Traffic() (map[containers.Identifier]iptables.Traffic, error)
+}
 
-	idler := Idler{}
-	idler.d = d
-	idler.qh = make([]*netfilter.NFQueue, config.NumQueues)
-	idler.waitChan = make(chan uint16)
-	idler.openChannels = make([]containers.Identifier, config.NumQueues)
-	idler.hostIp = hostIp
-	idler.eventListener, err = csystemd.NewEventListener()
-	if err != nil {
-		fmt.Printf("Unable to create Systemd event listener: %v\n", err)
-		return nil
-	}
-	for i := 0; i < config.NumQueues; i++ {
-		idler.qh[i], err = netfilter.NewNFQueue(uint16(i), 100, netfilter.NF_DEFAULT_PACKET_SIZE)
-		if err != nil {
-			fmt.Printf("Unable to open Netfilter Queue: %v\n", err)
-			return nil
-		}
-	}
-	idler.idleTimeout = time.Minute * time.Duration(idleTimeout)
+// The container state the idler reads, and the jobs it runs to change
+// it.
+type Containers interface {
+	// The container holding an external port
+	IdentifierFor(p port.Port) (containers.Identifier, error)
+	// True if the container is expected to be running
+	Started(id containers.Identifier) (bool, error)
+	// True if the container was idled
+	Idled(id containers.Identifier) bool
+	IdlePolicy(id containers.Identifier) (*containers.IdlePolicy, error)
+	IdleContainer(id containers.Identifier) error
+	UnidleContainer(id containers.Identifier) error
+	// When a woken container can handle traffic for an external port
+	Readiness(id containers.Identifier, p port.Port) *Readiness
+}
 
-	return &idler
+// Reports changes to containers, like csystemd.EventListener.
+type EventSource interface {
+	Run() (<-chan *csystemd.ContainerEvent, <-chan error)
 }
 
-func (idler *Idler) Run() {
-	for i := range idler.qh {
-		if i >= 1 {
-			go waitStart(idler.qh[i].GetPackets(), uint16(i), idler.waitChan, idler.hostIp)
-		}
+type Idler struct {
+	packets    PacketSource
+	rules      RulesManager
+	counter    TrafficCounter
+	containers Containers
+	events     EventSource
+
+	// The idle schedule is written here after each count, if set
+	SchedulePath string
+
+	idleTimeout time.Duration
+
+	waitChan     chan uint16
+	openChannels []containers.Identifier
+	// Traffic each container received since its last idle check
+	windows map[containers.Identifier]*trafficWindow
+}
+
+// How often traffic is counted.  Each container is checked once its
+// idle timeout has passed.
+const countInterval = time.Minute
+
+type trafficWindow struct {
+	iptables.Traffic
+	Since time.Time
+}
+
+func NewIdler(packets PacketSource, rules RulesManager, counter TrafficCounter, c Containers, events EventSource, idleTimeout time.Duration) *Idler {
+	return &Idler{
+		packets:      packets,
+		rules:        rules,
+		counter:      counter,
+		containers:   c,
+		events:       events,
+		idleTimeout:  idleTimeout,
+		waitChan:     make(chan uint16),
+		openChannels: make([]containers.Identifier, packets.Queues()),
+		windows:      make(map[containers.Identifier]*trafficWindow),
+	}
+}
+
+// Handle packets, events and traffic counts until done is closed.
+func (idler *Idler) Run(done <-chan struct{}) {
+	for i := 1; i < idler.packets.Queues(); i++ {
+		go idler.waitStart(idler.packets.Packets(uint16(i)), uint16(i), done)
 	}
 
-	packets := idler.qh[0].GetPackets()
-	ticker := time.NewTicker(idler.idleTimeout)
-	events, errors := idler.eventListener.Run()
+	packets := idler.packets.Packets(0)
+	interval := countInterval
+	if idler.idleTimeout < interval {
+		interval = idler.idleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	events, errors := idler.events.Run()
 
-	for true {
+	for {
 		select {
+		case <-done:
+			return
 		case e := <-events:
-			fmt.Printf("[%v] Event: %v\n", time.Now().Format(time.RFC3339), e)
-			switch {
-			case e.Type == containers.Stopped || e.Type == containers.Deleted || e.Type == containers.Errored:
-				iptables.DeleteContainer(e.Id, idler.hostIp)
-			case e.Type == containers.Started:
-				iptables.UnidleContainer(e.Id, idler.hostIp)
-			case e.Type == containers.Idled:
-				//No-op
-			}
+			idler.handleEvent(e)
 		case e := <-errors:
 			fmt.Printf("Error: %v\n", e)
 		case chanId := <-idler.waitChan:
 			idler.openChannels[chanId] = ""
 		case p := <-packets:
-			port, err := portForPacket(p)
-			if err != nil {
-				fmt.Println(err)
-				p.SetVerdict(netfilter.NF_ACCEPT)
-				continue
-			}
+			idler.handlePacket(p)
+		case now := <-ticker.C:
+			idler.checkTraffic(now)
+		}
+	}
+}
 
-			id, err := port.IdentifierFor()
-			if err != nil {
-				fmt.Println(err)
-				iptables.CleanupRulesForPort(port)
-				p.SetVerdict(netfilter.NF_ACCEPT)
-				continue
-			}
+func (idler *Idler) handleEvent(e *csystemd.ContainerEvent) {
+	fmt.Printf("[%v] Event: %v\n", time.Now().Format(time.RFC3339), e)
+	switch {
+	case e.Type == csystemd.Stopped || e.Type == csystemd.Deleted || e.Type == csystemd.Errored:
+		idler.rules.Delete(e.Id)
+	case e.Type == csystemd.Started:
+		// Traffic before the container started doesn't count
+		// toward its next idle check
+		delete(idler.windows, e.Id)
+		idler.rules.Unidle(e.Id)
+	case e.Type == csystemd.Idled:
+		// Containers idled with 'gear idle' need their traffic queued too
+		idler.rules.Idle(e.Id)
+	}
+}
 
-			idler.unidleContainer(id, p)
-		case <-ticker.C:
-			cpkt, err := iptables.GetDockerContainerPacketCounts(idler.d)
-			if err != nil {
-				fmt.Printf("Error retrieving packet counts for containers: %v\n", err)
-			}
+// The first packet for an idle container wakes it up.
+func (idler *Idler) handlePacket(p Packet) {
+	port, err := p.Port()
+	if err != nil {
+		fmt.Println(err)
+		p.Accept()
+		return
+	}
 
-			var packetData bytes.Buffer
-			w := new(tabwriter.Writer)
-			w.Init(&packetData, 0, 8, 0, '\t', 0)
-
-			fmt.Fprintf(w, "[%v] Packet counts:\n\tContainer\tActive?\tIdled?\tPackets\n", time.Now().Format(time.RFC3339))
-			iptables.ResetPacketCount()
-			for id, pkts := range cpkt {
-				started, err := csystemd.UnitStartOnBoot(id)
-				if err != nil {
-					fmt.Printf("Error reading container state for %v: %v\n", id, err)
-				}
-
-				var idleFlag bool
-				_, err = os.Stat(id.IdleUnitPathFor())
-				if err == nil {
-					idleFlag = true
-				}
-
-				fmt.Fprintf(w, "\t%v\t%v\t%v\t%v", id, started, idleFlag, pkts)
-				if started && pkts == 0 {
-					if idler.idleContainer(id) {
-						fmt.Fprintf(w, "\tidling...")
-					}
-				}
-				fmt.Fprintf(w, "\n")
+	id, err := idler.containers.IdentifierFor(port)
+	if err != nil {
+		fmt.Println(err)
+		idler.rules.Cleanup(port)
+		p.Accept()
+		return
+	}
+
+	idler.unidleContainer(id, p)
+}
+
+// Add the traffic since the last count to each container's window and
+// idle the containers whose policy says their window was too quiet.
+func (idler *Idler) checkTraffic(now time.Time) {
+	traffic, err := idler.counter.Traffic()
+	if err != nil {
+		fmt.Printf("Error retrieving packet counts for containers: %v\n", err)
+		return
+	}
+
+	var packetData bytes.Buffer
+	w := new(tabwriter.Writer)
+	w.Init(&packetData, 0, 8, 0, '\t', 0)
+	fmt.Fprintf(w, "[%v] Packet counts:\n\tContainer\tActive?\tIdled?\tPackets\tBytes\tPolicy\tNext check\n", now.Format(time.RFC3339))
+
+	schedule := containers.IdleSchedule{}
+	for id, t := range traffic {
+		started, err := idler.containers.Started(id)
+		if err != nil {
+			fmt.Printf("Error reading container state for %v: %v\n", id, err)
+		}
+		idleFlag := idler.containers.Idled(id)
+		policy, err := idler.containers.IdlePolicy(id)
+		if err != nil {
+			fmt.Printf("Error reading idle policy for %v: %v\n", id, err)
+			policy = &containers.IdlePolicy{}
+		}
+
+		window, found := idler.windows[id]
+		if !found || !started || idleFlag || policy.Never {
+			window = &trafficWindow{Since: now}
+			idler.windows[id] = window
+		}
+		window.Add(t)
+
+		fmt.Fprintf(w, "\t%v\t%v\t%v\t%v\t%v\t%v", id, started, idleFlag, window.Packets, window.Bytes, policy)
+		if !started || idleFlag || policy.Never {
+			fmt.Fprintf(w, "\t-\n")
+			continue
+		}
+
+		next := window.Since.Add(policy.TimeoutOr(idler.idleTimeout))
+		if !now.Before(next) {
+			idle := policy.ShouldIdle(window.Packets, window.Bytes)
+			idler.windows[id] = &trafficWindow{Since: now}
+			if idle && idler.idleContainer(id) {
+				fmt.Fprintf(w, "\tidling...\n")
+				continue
 			}
-			w.Flush()
-			packetData.WriteTo(os.Stdout)
-			fmt.Println("\n")
+			next = now.Add(policy.TimeoutOr(idler.idleTimeout))
+		}
+		schedule[id] = next
+		fmt.Fprintf(w, "\t%v\n", next.Format(time.RFC3339))
+	}
+
+	// Forget containers that no longer exist
+	for id := range idler.windows {
+		if _, found := traffic[id]; !found {
+			delete(idler.windows, id)
+		}
+	}
+	if idler.SchedulePath != "" {
+		if err := schedule.Write(idler.SchedulePath); err != nil {
+			fmt.Printf("Error writing the idle schedule: %v\n", err)
 		}
 	}
+
+	w.Flush()
+	packetData.WriteTo(os.Stdout)
+	fmt.Println()
 }
 
-func (idler *Idler) unidleContainer(id containers.Identifier, p netfilter.NFPacket) {
+func (idler *Idler) unidleContainer(id containers.Identifier, p Packet) {
 	newChanId, wasAlreadyAssigned := idler.getAvailableWaiter(id)
 
 	if newChanId == 0 {
 		fmt.Println("unidle: Error while finding wait channel")
+		p.Accept()
 		return
 	}
 
 	if !wasAlreadyAssigned {
-		//TODO: Ask geard to unidle container
-		if err := os.Remove(id.IdleUnitPathFor()); err != nil {
-			fmt.Printf("unidle: Could not remove idle marker for %s: %v", id.UnitNameFor(), err)
-			p.SetVerdict(netfilter.NF_ACCEPT)
-			return
-		}
-		if err := systemd.Connection().StartUnitJob(id.UnitNameFor(), "fail"); err != nil {
-			fmt.Printf("unidle: Could not start container %s: %v", id.UnitNameFor(), err)
-			p.SetVerdict(netfilter.NF_ACCEPT)
+		if err := idler.containers.UnidleContainer(id); err != nil {
+			fmt.Printf("unidle: Could not unidle container %s: %v\n", id, err)
+			idler.openChannels[newChanId] = ""
+			p.Accept()
 			return
 		}
 	}
 
-	p.SetRequeueVerdict(newChanId)
+	p.Requeue(newChanId)
 }
 
+// Find the wait channel holding packets for the container, or reserve
+// a free one.  When every channel is busy, wait for one to be released.
 func (idler *Idler) getAvailableWaiter(id containers.Identifier) (uint16, bool) {
-	for true {
+	if len(idler.openChannels) < 2 {
+		return 0, false
+	}
+	for {
 		//existing queue is already processing id
 		for i := range idler.openChannels {
 			if i != 0 && idler.openChannels[i] == id {
@@ -189,91 +297,76 @@ func (idler *Idler) getAvailableWaiter(id containers.Identifier) (uint16, bool)
 		}
 
 		//Wait for channels to open
-		time.Sleep(time.Second)
+		chanId := <-idler.waitChan
+		idler.openChannels[chanId] = ""
 	}
-	return 0, false
 }
 
 func (idler *Idler) idleContainer(id containers.Identifier) bool {
-	portPairs, err := containers.GetExistingPorts(id)
+	idled, err := idler.rules.Idled(id)
 	if err != nil {
-		fmt.Printf("idler.idleContainer: Error retrieving ports for container: %v\n", id)
+		fmt.Printf("idler.idleContainer: Error retrieving rules for container %v: %v\n", id, err)
 		return false
 	}
-
-	iptablePorts, err := iptables.GetIdlerRules(id, false)
-	if err != nil {
-		fmt.Printf("idler.idleContainer: Error retrieving ports from iptables: %v\n", id)
+	if idled {
 		return false
 	}
 
-	shouldRecreateRules := false
-	for _, portPair := range portPairs {
-		extPort := strconv.Itoa(int(portPair.External))
-		shouldRecreateRules = shouldRecreateRules || !iptablePorts[extPort]
-	}
-
-	if !shouldRecreateRules {
+	if err := idler.containers.IdleContainer(id); err != nil {
+		fmt.Printf("idler.idleContainer: Could not idle container %s: %v\n", id, err)
 		return false
 	}
 
-	//TODO: Ask geard to idle container
-	f, err := os.Create(id.IdleUnitPathFor())
-	if err != nil {
-		fmt.Printf("idler.idleContainer: Could not create idle marker for %s: %v", id.UnitNameFor(), err)
-		return false
-	}
-	f.Close()
-	if err := systemd.Connection().StopUnitJob(id.UnitNameFor(), "fail"); err != nil {
-		fmt.Printf("idler.idleContainer: Could not stop container %s: %v", id.UnitNameFor(), err)
-		return false
-	}
-
-	iptables.IdleContainer(id, idler.hostIp)
+	idler.rules.Idle(id)
 	return true
 }
 
-func waitStart(pChan <-chan netfilter.NFPacket, chanId uint16, waitChan chan<- uint16, hostIp string) {
-	for true {
-		p := <-pChan
-
-		port, err := portForPacket(p)
-		if err != nil {
-			fmt.Println(err)
-			p.SetVerdict(netfilter.NF_ACCEPT)
-			waitChan <- chanId
-			continue
-		}
-
-		id, err := port.IdentifierFor()
-		if err != nil {
-			fmt.Println(err)
-			p.SetVerdict(netfilter.NF_ACCEPT)
-			waitChan <- chanId
-			continue
+// Hold packets for a woken container until it can handle them, then
+// release them.
+func (idler *Idler) waitStart(pChan <-chan Packet, chanId uint16, done <-chan struct{}) {
+	for {
+		var p Packet
+		select {
+		case <-done:
+			return
+		case p = <-pChan:
 		}
 
-		cInfo, err := systemd.Connection().GetUnitProperties(id.UnitNameFor())
-		if err != nil || cInfo["ActiveState"] != "active" {
-			//TODO: Placeholder for container start detection
-			fmt.Printf("[%v] Waiting for container %v to start\n", time.Now().Format(time.RFC3339), id)
-			time.Sleep(time.Second * 5)
-			fmt.Printf("[%v] Container %v started\n", time.Now().Format(time.RFC3339), id)
+		idler.release(p)
 
-			iptables.UnidleContainer(id, hostIp)
+		select {
+		case <-done:
+			return
+		case idler.waitChan <- chanId:
 		}
-
-		p.SetVerdict(netfilter.NF_ACCEPT)
-		waitChan <- chanId
 	}
 }
 
-func portForPacket(p netfilter.NFPacket) (iptables.Port, error) {
-	tcpLayer := p.Packet.TransportLayer()
-	tcp, ok := tcpLayer.(*layers.TCP)
-	if !ok {
-		return iptables.TcpPort(0), fmt.Errorf("Unknown packet of type %v\n", tcpLayer.LayerType())
+func (idler *Idler) release(p Packet) {
+	defer p.Accept()
+
+	port, err := p.Port()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	id, err := idler.containers.IdentifierFor(port)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
-	return iptables.TcpPort(int(tcp.DstPort)), nil
+	ready := idler.containers.Readiness(id, port)
+	if active, _ := ready.UnitActive(); !active || ready.Accepting() != nil {
+		fmt.Printf("[%v] Waiting for container %v to start\n", time.Now().Format(time.RFC3339), id)
+		latency, err := ready.Wait()
+		if err != nil {
+			fmt.Printf("[%v] Container %v was not ready, releasing packets (%v): %v\n", time.Now().Format(time.RFC3339), id, latency, err)
+		} else {
+			fmt.Printf("[%v] Container %v woke up, %v\n", time.Now().Format(time.RFC3339), id, latency)
+		}
+
+		idler.rules.Unidle(id)
+	}
 }
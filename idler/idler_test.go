@@ -0,0 +1,185 @@
+package idler
+
+import (
+	"github.com/openshift/geard/containers"
+	csystemd "github.com/openshift/geard/containers/systemd"
+	"github.com/openshift/geard/idler/iptables"
+	"github.com/openshift/geard/port"
+
+	"reflect"
+	"testing"
+	"time"
+)
+
+type memoryIdler struct {
+	*Idler
+	packets    *MemoryPacketSource
+	rules      *MemoryRules
+	counter    *MemoryTrafficCounter
+	containers *MemoryContainers
+	events     *MemoryEvents
+}
+
+func newMemoryIdler(queues int) *memoryIdler {
+	m := &memoryIdler{
+		packets:    NewMemoryPacketSource(queues),
+		rules:      NewMemoryRules(),
+		counter:    NewMemoryTrafficCounter(),
+		containers: NewMemoryContainers(),
+		events:     NewMemoryEvents(),
+	}
+	m.Idler = NewIdler(m.packets, m.rules, m.counter, m.containers, m.events, time.Minute)
+	return m
+}
+
+func (m *memoryIdler) add(id containers.Identifier, c *MemoryContainer) {
+	m.containers.Add(id, c)
+	m.counter.Add(id, iptables.Traffic{})
+}
+
+func (m *memoryIdler) jobs() []string {
+	m.containers.Lock()
+	defer m.containers.Unlock()
+	return append([]string{}, m.containers.Jobs...)
+}
+
+func TestCheckTrafficIdlesQuietContainers(t *testing.T) {
+	m := newMemoryIdler(2)
+	m.add("quiet", &MemoryContainer{Ports: []port.Port{4000}, Started: true})
+	m.add("busy", &MemoryContainer{Ports: []port.Port{4001}, Started: true})
+	m.add("never", &MemoryContainer{Ports: []port.Port{4002}, Started: true, Policy: &containers.IdlePolicy{Never: true}})
+	m.add("stopped", &MemoryContainer{Ports: []port.Port{4003}})
+
+	now := time.Now()
+	m.checkTraffic(now)
+	if jobs := m.jobs(); len(jobs) != 0 {
+		t.Fatalf("Containers should not be idled before their timeout passes: %v", jobs)
+	}
+
+	m.counter.Add("busy", iptables.Traffic{Packets: 3, Bytes: 300})
+	m.checkTraffic(now.Add(time.Minute))
+	if jobs := m.jobs(); !reflect.DeepEqual(jobs, []string{"idle quiet"}) {
+		t.Fatalf("Expected only the quiet container to be idled: %v", jobs)
+	}
+	if idled, _ := m.rules.Idled("quiet"); !idled {
+		t.Errorf("Traffic for the idled container should be queued")
+	}
+	if idled, _ := m.rules.Idled("busy"); idled {
+		t.Errorf("Traffic for the busy container should be delivered")
+	}
+}
+
+func TestCheckTrafficSkipsContainersWithQueuedTraffic(t *testing.T) {
+	m := newMemoryIdler(2)
+	m.add("a", &MemoryContainer{Ports: []port.Port{4000}, Started: true})
+	m.rules.Idle("a")
+
+	now := time.Now()
+	m.checkTraffic(now)
+	m.checkTraffic(now.Add(time.Minute))
+	if jobs := m.jobs(); len(jobs) != 0 {
+		t.Errorf("Containers whose traffic is already queued should not be idled again: %v", jobs)
+	}
+
+	m.counter.Remove("a")
+	m.checkTraffic(now.Add(2 * time.Minute))
+	if _, found := m.windows["a"]; found {
+		t.Errorf("Removed containers should be forgotten")
+	}
+}
+
+func TestGetAvailableWaiter(t *testing.T) {
+	m := newMemoryIdler(3)
+
+	if id, assigned := m.getAvailableWaiter("a"); id != 1 || assigned {
+		t.Fatalf("Expected a new waiter 1, got %d %t", id, assigned)
+	}
+	if id, assigned := m.getAvailableWaiter("a"); id != 1 || !assigned {
+		t.Fatalf("Expected the existing waiter 1, got %d %t", id, assigned)
+	}
+	if id, assigned := m.getAvailableWaiter("b"); id != 2 || assigned {
+		t.Fatalf("Expected a new waiter 2, got %d %t", id, assigned)
+	}
+
+	// Every waiter is busy until one is released
+	go func() { m.waitChan <- 1 }()
+	if id, assigned := m.getAvailableWaiter("c"); id != 1 || assigned {
+		t.Fatalf("Expected the released waiter 1, got %d %t", id, assigned)
+	}
+
+	if id, _ := newMemoryIdler(1).getAvailableWaiter("a"); id != 0 {
+		t.Errorf("Expected no waiter without wait queues, got %d", id)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	m := newMemoryIdler(2)
+	m.windows["a"] = &trafficWindow{Since: time.Now()}
+
+	m.handleEvent(&csystemd.ContainerEvent{Id: "a", Type: csystemd.Idled})
+	if idled, _ := m.rules.Idled("a"); !idled {
+		t.Errorf("Traffic should be queued for a container idled elsewhere")
+	}
+
+	m.handleEvent(&csystemd.ContainerEvent{Id: "a", Type: csystemd.Started})
+	if idled, _ := m.rules.Idled("a"); idled {
+		t.Errorf("Traffic should be delivered to a started container")
+	}
+	if _, found := m.windows["a"]; found {
+		t.Errorf("Traffic before a container starts should not count")
+	}
+
+	m.rules.Idle("a")
+	m.handleEvent(&csystemd.ContainerEvent{Id: "a", Type: csystemd.Deleted})
+	if _, found := m.rules.idled["a"]; found {
+		t.Errorf("Rules should be removed for a deleted container")
+	}
+}
+
+func TestRunWakesContainerOnFirstPacket(t *testing.T) {
+	m := newMemoryIdler(3)
+	ready := make(chan struct{})
+	m.add("a", &MemoryContainer{Ports: []port.Port{4000}, Started: true, Idle: true, Ready: ready})
+	m.rules.Idle("a")
+
+	done := make(chan struct{})
+	defer close(done)
+	go m.Run(done)
+
+	first := m.packets.Send(4000)
+	second := m.packets.Send(4000)
+	if first.Accepted(50 * time.Millisecond) {
+		t.Fatalf("Packets should be held until the container accepts connections")
+	}
+	close(ready)
+	if !first.Accepted(time.Second) || !second.Accepted(time.Second) {
+		t.Fatalf("Packets should be released once the container is ready")
+	}
+
+	if jobs := m.jobs(); !reflect.DeepEqual(jobs, []string{"unidle a"}) {
+		t.Errorf("Expected the container to be unidled once: %v", jobs)
+	}
+	if c, _ := m.containers.Get("a"); c.Idle {
+		t.Errorf("The container should no longer be idle")
+	}
+	if idled, _ := m.rules.Idled("a"); idled {
+		t.Errorf("Traffic should be delivered to the woken container")
+	}
+}
+
+func TestRunReleasesPacketsForUnknownPorts(t *testing.T) {
+	m := newMemoryIdler(2)
+
+	done := make(chan struct{})
+	defer close(done)
+	go m.Run(done)
+
+	if !m.packets.Send(5000).Accepted(time.Second) {
+		t.Fatalf("Packets for unknown ports should be accepted")
+	}
+	m.rules.Lock()
+	defer m.rules.Unlock()
+	if !reflect.DeepEqual(m.rules.Cleaned, []port.Port{5000}) {
+		t.Errorf("Rules for unknown ports should be cleaned up: %v", m.rules.Cleaned)
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -124,14 +123,14 @@ func DeleteContainer(id containers.Identifier, hostIp string) {
 	}
 }
 
-func GetDockerContainerPacketCounts(d *docker.DockerClient) (map[containers.Identifier]int, error) {
+func GetDockerContainerTraffic(d *docker.DockerClient) (map[containers.Identifier]Traffic, error) {
 	serviceFiles, err := filepath.Glob(filepath.Join(gearconfig.ContainerBasePath(), "units", "**", containers.IdentifierPrefix+"*.service"))
 	if err != nil {
 		return nil, err
 	}
 
 	ids := make([]string, 0)
-	packetCount := make(map[containers.Identifier]int)
+	traffic := make(map[containers.Identifier]Traffic)
 
 	for _, s := range serviceFiles {
 		id := filepath.Base(s)
@@ -139,7 +138,7 @@ func GetDockerContainerPacketCounts(d *docker.DockerClient) (map[containers.Iden
 			id = id[len(containers.IdentifierPrefix):(len(id) - len(".service"))]
 			if id, err := containers.NewIdentifier(id); err == nil {
 				ids = append(ids, string(id))
-				packetCount[id] = 0
+				traffic[id] = Traffic{}
 			}
 		}
 	}
@@ -161,24 +160,26 @@ func GetDockerContainerPacketCounts(d *docker.DockerClient) (map[containers.Iden
 		if strings.Contains(line, "-A DOCKER ! -i docker0") && strings.Contains(line, "-j DNAT") {
 			//Example: [0:0] -A DOCKER ! -i docker0 -p tcp -m tcp --dport 4000 -j DNAT --to-destination 172.17.0.3:8080
 			items := strings.Fields(line)
-			packets, _ := strconv.Atoi(strings.Split(items[0], ":")[0][1:])
 			destIp := strings.Split(items[15], ":")[0]
-			id,_ := containers.NewIdentifier(containerIPs[destIp])
-
-			packetCount[id] = packetCount[id] + packets
+			if id, err := containers.NewIdentifier(containerIPs[destIp]); err == nil {
+				t := traffic[id]
+				t.Add(parseCounters(items[0]))
+				traffic[id] = t
+			}
 		}
 
 		if strings.Contains(line, "-A OUTPUT -d 127.0.0.1/32 -p tcp -m tcp --dport") && strings.Contains(line, "-m comment --comment ") {
 			//Example: [5850:394136] -A OUTPUT -d 127.0.0.1/32 -p tcp -m tcp --dport 4000 -m comment --comment 0001 -j ACCEPT
 			items := strings.Fields(line)
-			packets, _ := strconv.Atoi(strings.Split(items[0], ":")[0][1:])
 			if id, err := containers.NewIdentifier(items[14]); err == nil {
-				packetCount[id] = packetCount[id] + packets
+				t := traffic[id]
+				t.Add(parseCounters(items[0]))
+				traffic[id] = t
 			}
 		}
 	}
 
-	return packetCount, nil
+	return traffic, nil
 }
 
 func GetIdlerRules(lookupId containers.Identifier, active bool) (map[string]bool, error) {
@@ -0,0 +1,30 @@
+package iptables
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Packets and bytes received by a container since the counters were
+// last reset.
+type Traffic struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+func (t *Traffic) Add(other Traffic) {
+	t.Packets += other.Packets
+	t.Bytes += other.Bytes
+}
+
+// Parse the '[<packets>:<bytes>]' counters of a rule in iptables-save
+// output.
+func parseCounters(s string) Traffic {
+	counters := strings.Split(strings.Trim(s, "[]"), ":")
+	if len(counters) != 2 {
+		return Traffic{}
+	}
+	packets, _ := strconv.ParseUint(counters[0], 10, 64)
+	bytes, _ := strconv.ParseUint(counters[1], 10, 64)
+	return Traffic{packets, bytes}
+}
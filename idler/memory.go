@@ -0,0 +1,305 @@
+package idler
+
+import (
+	"github.com/openshift/geard/containers"
+	csystemd "github.com/openshift/geard/containers/systemd"
+	"github.com/openshift/geard/idler/iptables"
+	"github.com/openshift/geard/port"
+
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// In memory implementations of the idler's dependencies, for running
+// the idler without netfilter, iptables or systemd.
+
+// A packet for an in memory queue.  Its verdict is recorded instead of
+// being passed to the kernel.
+type MemoryPacket struct {
+	DstPort  port.Port
+	source   *MemoryPacketSource
+	accepted chan struct{}
+}
+
+func (p *MemoryPacket) Port() (port.Port, error) {
+	if p.DstPort == 0 {
+		return 0, errors.New("Packet has no TCP port")
+	}
+	return p.DstPort, nil
+}
+
+func (p *MemoryPacket) Accept() {
+	p.accepted <- struct{}{}
+}
+
+func (p *MemoryPacket) Requeue(queue uint16) {
+	go func() { p.source.queues[queue] <- p }()
+}
+
+// Wait for the packet to be accepted.  Returns false if it wasn't
+// accepted within timeout.
+func (p *MemoryPacket) Accepted(timeout time.Duration) bool {
+	select {
+	case <-p.accepted:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+type MemoryPacketSource struct {
+	queues []chan Packet
+}
+
+func NewMemoryPacketSource(queues int) *MemoryPacketSource {
+	s := &MemoryPacketSource{make([]chan Packet, queues)}
+	for i := range s.queues {
+		s.queues[i] = make(chan Packet)
+	}
+	return s
+}
+
+func (s *MemoryPacketSource) Queues() int {
+	return len(s.queues)
+}
+
+func (s *MemoryPacketSource) Packets(queue uint16) <-chan Packet {
+	return s.queues[queue]
+}
+
+// Deliver a packet for the port to queue 0, as the rules for an idle
+// container would.
+func (s *MemoryPacketSource) Send(p port.Port) *MemoryPacket {
+	packet := &MemoryPacket{p, s, make(chan struct{}, 1)}
+	s.queues[0] <- packet
+	return packet
+}
+
+// Tracks which containers have their traffic queued.
+type MemoryRules struct {
+	sync.Mutex
+	idled   map[containers.Identifier]bool
+	Cleaned []port.Port
+}
+
+func NewMemoryRules() *MemoryRules {
+	return &MemoryRules{idled: make(map[containers.Identifier]bool)}
+}
+
+func (r *MemoryRules) Idle(id containers.Identifier) {
+	r.Lock()
+	defer r.Unlock()
+	r.idled[id] = true
+}
+
+func (r *MemoryRules) Unidle(id containers.Identifier) {
+	r.Lock()
+	defer r.Unlock()
+	r.idled[id] = false
+}
+
+func (r *MemoryRules) Delete(id containers.Identifier) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.idled, id)
+}
+
+func (r *MemoryRules) Idled(id containers.Identifier) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.idled[id], nil
+}
+
+func (r *MemoryRules) Cleanup(p port.Port) {
+	r.Lock()
+	defer r.Unlock()
+	r.Cleaned = append(r.Cleaned, p)
+}
+
+// Returns the traffic added since the last call.  Every container known
+// to the counter is reported, even without traffic.
+type MemoryTrafficCounter struct {
+	sync.Mutex
+	traffic map[containers.Identifier]iptables.Traffic
+}
+
+func NewMemoryTrafficCounter() *MemoryTrafficCounter {
+	return &MemoryTrafficCounter{traffic: make(map[containers.Identifier]iptables.Traffic)}
+}
+
+func (c *MemoryTrafficCounter) Add(id containers.Identifier, t iptables.Traffic) {
+	c.Lock()
+	defer c.Unlock()
+	existing := c.traffic[id]
+	existing.Add(t)
+	c.traffic[id] = existing
+}
+
+func (c *MemoryTrafficCounter) Remove(id containers.Identifier) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.traffic, id)
+}
+
+func (c *MemoryTrafficCounter) Traffic() (map[containers.Identifier]iptables.Traffic, error) {
+	c.Lock()
+	defer c.Unlock()
+	traffic := make(map[containers.Identifier]iptables.Traffic)
+	for id, t := range c.traffic {
+		traffic[id] = t
+		c.traffic[id] = iptables.Traffic{}
+	}
+	return traffic, nil
+}
+
+// A container known to MemoryContainers.
+type MemoryContainer struct {
+	Ports   []port.Port
+	Started bool
+	Idle    bool
+	Policy  *containers.IdlePolicy
+	// Closed once a woken container accepts connections.  Without it
+	// the container is ready as soon as it is unidled.
+	Ready chan struct{}
+}
+
+// Containers whose idle and unidle jobs only change their state in
+// memory.
+type MemoryContainers struct {
+	sync.Mutex
+	containers map[containers.Identifier]*MemoryContainer
+	// Jobs run against the containers, in order
+	Jobs []string
+	// How long Readiness waits for a woken container
+	WakeTimeout time.Duration
+}
+
+func NewMemoryContainers() *MemoryContainers {
+	return &MemoryContainers{
+		containers:  make(map[containers.Identifier]*MemoryContainer),
+		WakeTimeout: time.Second,
+	}
+}
+
+func (m *MemoryContainers) Add(id containers.Identifier, c *MemoryContainer) {
+	m.Lock()
+	defer m.Unlock()
+	m.containers[id] = c
+}
+
+func (m *MemoryContainers) Get(id containers.Identifier) (MemoryContainer, bool) {
+	m.Lock()
+	defer m.Unlock()
+	c, found := m.containers[id]
+	if !found {
+		return MemoryContainer{}, false
+	}
+	return *c, true
+}
+
+func (m *MemoryContainers) IdentifierFor(p port.Port) (containers.Identifier, error) {
+	m.Lock()
+	defer m.Unlock()
+	for id, c := range m.containers {
+		for _, other := range c.Ports {
+			if other == p {
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Container ID not found for port %v", p)
+}
+
+func (m *MemoryContainers) Started(id containers.Identifier) (bool, error) {
+	c, found := m.Get(id)
+	if !found {
+		return false, fmt.Errorf("No container %v", id)
+	}
+	return c.Started, nil
+}
+
+func (m *MemoryContainers) Idled(id containers.Identifier) bool {
+	c, _ := m.Get(id)
+	return c.Idle
+}
+
+func (m *MemoryContainers) IdlePolicy(id containers.Identifier) (*containers.IdlePolicy, error) {
+	c, _ := m.Get(id)
+	if c.Policy == nil {
+		return &containers.IdlePolicy{}, nil
+	}
+	return c.Policy, nil
+}
+
+func (m *MemoryContainers) IdleContainer(id containers.Identifier) error {
+	m.Lock()
+	defer m.Unlock()
+	c, found := m.containers[id]
+	if !found {
+		return fmt.Errorf("No container %v", id)
+	}
+	m.Jobs = append(m.Jobs, "idle "+string(id))
+	if !c.Started || c.Idle {
+		return fmt.Errorf("Container %v is not running", id)
+	}
+	c.Idle = true
+	return nil
+}
+
+func (m *MemoryContainers) UnidleContainer(id containers.Identifier) error {
+	m.Lock()
+	defer m.Unlock()
+	c, found := m.containers[id]
+	if !found {
+		return fmt.Errorf("No container %v", id)
+	}
+	m.Jobs = append(m.Jobs, "unidle "+string(id))
+	if !c.Idle {
+		return fmt.Errorf("Container %v is not idle", id)
+	}
+	c.Idle = false
+	return nil
+}
+
+func (m *MemoryContainers) Readiness(id containers.Identifier, p port.Port) *Readiness {
+	return &Readiness{
+		UnitActive: func() (bool, error) {
+			c, _ := m.Get(id)
+			return c.Started && !c.Idle, nil
+		},
+		Accepting: func() error {
+			c, _ := m.Get(id)
+			if c.Ready == nil {
+				return nil
+			}
+			select {
+			case <-c.Ready:
+				return nil
+			default:
+				return errors.New("Not accepting connections")
+			}
+		},
+		Interval: time.Millisecond,
+		Timeout:  m.WakeTimeout,
+	}
+}
+
+// Events sent to the idler through Send.
+type MemoryEvents struct {
+	events chan *csystemd.ContainerEvent
+	errors chan error
+}
+
+func NewMemoryEvents() *MemoryEvents {
+	return &MemoryEvents{make(chan *csystemd.ContainerEvent), make(chan error)}
+}
+
+func (e *MemoryEvents) Run() (<-chan *csystemd.ContainerEvent, <-chan error) {
+	return e.events, e.errors
+}
+
+func (e *MemoryEvents) Send(id containers.Identifier, t csystemd.EventType) {
+	e.events <- &csystemd.ContainerEvent{Id: id, Type: t}
+}
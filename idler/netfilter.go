@@ -0,0 +1,145 @@
+// +build idler
+
+package idler
+
+import (
+	"github.com/openshift/geard/containers"
+	csystemd "github.com/openshift/geard/containers/systemd"
+	"github.com/openshift/geard/docker"
+	"github.com/openshift/geard/idler/config"
+	"github.com/openshift/geard/idler/iptables"
+	"github.com/openshift/geard/pkg/go-netfilter-queue"
+	"github.com/openshift/geard/port"
+	"github.com/openshift/geard/transport"
+
+	"code.google.com/p/gopacket/layers"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func StartIdler(pDockerClient *docker.DockerClient, pHostIp string, pIdleTimeout int, pWakeTimeout int, pTransport transport.Transport, pServer string) error {
+	eventListener, err := csystemd.NewEventListener()
+	if err != nil {
+		return fmt.Errorf("Unable to create Systemd event listener: %v", err)
+	}
+	queues, err := newNetfilterQueues(config.NumQueues)
+	if err != nil {
+		return fmt.Errorf("Unable to open Netfilter Queue: %v", err)
+	}
+
+	idler := NewIdler(
+		queues,
+		&iptablesRules{pHostIp},
+		&iptablesCounter{pDockerClient},
+		&HostContainers{
+			Docker:      pDockerClient,
+			Transport:   pTransport,
+			Server:      pServer,
+			WakeTimeout: time.Second * time.Duration(pWakeTimeout),
+		},
+		eventListener,
+		time.Minute*time.Duration(pIdleTimeout),
+	)
+	idler.SchedulePath = containers.IdleSchedulePath()
+	idler.Run(make(chan struct{}))
+	return nil
+}
+
+type netfilterPacket struct {
+	p netfilter.NFPacket
+}
+
+func (n *netfilterPacket) Port() (port.Port, error) {
+	tcpLayer := n.p.Packet.TransportLayer()
+	tcp, ok := tcpLayer.(*layers.TCP)
+	if !ok {
+		return 0, fmt.Errorf("Unknown packet of type %v\n", tcpLayer.LayerType())
+	}
+	return port.Port(tcp.DstPort), nil
+}
+
+func (n *netfilterPacket) Accept() {
+	n.p.SetVerdict(netfilter.NF_ACCEPT)
+}
+
+func (n *netfilterPacket) Requeue(queue uint16) {
+	n.p.SetRequeueVerdict(queue)
+}
+
+type netfilterQueues []chan Packet
+
+func newNetfilterQueues(count int) (netfilterQueues, error) {
+	queues := make(netfilterQueues, count)
+	for i := range queues {
+		qh, err := netfilter.NewNFQueue(uint16(i), 100, netfilter.NF_DEFAULT_PACKET_SIZE)
+		if err != nil {
+			return nil, err
+		}
+		queues[i] = make(chan Packet)
+		go func(in <-chan netfilter.NFPacket, out chan<- Packet) {
+			for p := range in {
+				out <- &netfilterPacket{p}
+			}
+		}(qh.GetPackets(), queues[i])
+	}
+	return queues, nil
+}
+
+func (q netfilterQueues) Queues() int {
+	return len(q)
+}
+
+func (q netfilterQueues) Packets(queue uint16) <-chan Packet {
+	return q[queue]
+}
+
+type iptablesRules struct {
+	hostIp string
+}
+
+func (r *iptablesRules) Idle(id containers.Identifier) {
+	iptables.IdleContainer(id, r.hostIp)
+}
+
+func (r *iptablesRules) Unidle(id containers.Identifier) {
+	iptables.UnidleContainer(id, r.hostIp)
+}
+
+func (r *iptablesRules) Delete(id containers.Identifier) {
+	iptables.DeleteContainer(id, r.hostIp)
+}
+
+func (r *iptablesRules) Idled(id containers.Identifier) (bool, error) {
+	portPairs, err := containers.GetExistingPorts(id)
+	if err != nil {
+		return false, err
+	}
+	iptablePorts, err := iptables.GetIdlerRules(id, false)
+	if err != nil {
+		return false, err
+	}
+	for _, portPair := range portPairs {
+		if !iptablePorts[strconv.Itoa(int(portPair.External))] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r *iptablesRules) Cleanup(p port.Port) {
+	iptables.CleanupRulesForPort(iptables.TcpPort(int(p)))
+}
+
+type iptablesCounter struct {
+	d *docker.DockerClient
+}
+
+func (c *iptablesCounter) Traffic() (map[containers.Identifier]iptables.Traffic, error) {
+	traffic, err := iptables.GetDockerContainerTraffic(c.d)
+	if err != nil {
+		return nil, err
+	}
+	iptables.ResetPacketCount()
+	return traffic, nil
+}
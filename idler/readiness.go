@@ -0,0 +1,90 @@
+package idler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	ErrUnitFailed   = errors.New("the container failed to start")
+	ErrWakeTimedOut = errors.New("the container was not ready in time")
+)
+
+// Decides when a woken container can handle the packets held for it:
+// its unit must be active, then it must accept connections.
+type Readiness struct {
+	// Returns true once the unit is active, or ErrUnitFailed if it
+	// will not become active
+	UnitActive func() (bool, error)
+	// Returns nil once the container accepts connections
+	Accepting func() error
+	// Time between checks
+	Interval time.Duration
+	// The longest a packet is held waiting for the container
+	Timeout time.Duration
+}
+
+// How long a container took to wake after the first packet arrived.
+type WakeLatency struct {
+	Active time.Duration
+	Ready  time.Duration
+}
+
+func (l WakeLatency) String() string {
+	return fmt.Sprintf("active after %v, ready after %v", l.Active, l.Ready)
+}
+
+// Block until the container is ready or the timeout passes.  The
+// latency is filled in as far as the container got.
+func (r *Readiness) Wait() (WakeLatency, error) {
+	start := time.Now()
+	deadline := start.Add(r.Timeout)
+	latency := WakeLatency{}
+
+	for {
+		active, err := r.UnitActive()
+		if err != nil {
+			return latency, err
+		}
+		if active {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			return latency, ErrWakeTimedOut
+		}
+		time.Sleep(r.Interval)
+	}
+	latency.Active = time.Since(start)
+
+	for {
+		if err := r.Accepting(); err == nil {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			return latency, ErrWakeTimedOut
+		}
+		time.Sleep(r.Interval)
+	}
+	latency.Ready = time.Since(start)
+	return latency, nil
+}
+
+// Accepting succeeds once a TCP connection to the address returned by
+// addr can be opened.  The address is resolved on every attempt since
+// a container has none until it is running.
+func DialAccepting(addr func() (string, error), timeout time.Duration) func() error {
+	return func() error {
+		a, err := addr()
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialTimeout("tcp", a, timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}
+}
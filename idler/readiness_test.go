@@ -0,0 +1,79 @@
+package idler
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadinessWaitsForUnitThenPort(t *testing.T) {
+	checks, probes := 0, 0
+	r := &Readiness{
+		UnitActive: func() (bool, error) {
+			checks++
+			return checks >= 3, nil
+		},
+		Accepting: func() error {
+			probes++
+			if probes < 2 {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		Interval: time.Millisecond,
+		Timeout:  time.Second,
+	}
+	latency, err := r.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checks != 3 || probes != 2 {
+		t.Errorf("Expected 3 unit checks and 2 probes, got %d and %d", checks, probes)
+	}
+	if latency.Active <= 0 || latency.Ready < latency.Active {
+		t.Errorf("Unexpected latency %v", latency)
+	}
+}
+
+func TestReadinessStopsOnFailureOrTimeout(t *testing.T) {
+	r := &Readiness{
+		UnitActive: func() (bool, error) { return false, ErrUnitFailed },
+		Accepting:  func() error { return nil },
+		Interval:   time.Millisecond,
+		Timeout:    time.Second,
+	}
+	if _, err := r.Wait(); err != ErrUnitFailed {
+		t.Errorf("Expected the unit failure, got %v", err)
+	}
+
+	r = &Readiness{
+		UnitActive: func() (bool, error) { return true, nil },
+		Accepting:  func() error { return errors.New("connection refused") },
+		Interval:   time.Millisecond,
+		Timeout:    20 * time.Millisecond,
+	}
+	latency, err := r.Wait()
+	if err != ErrWakeTimedOut {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if latency.Ready != 0 {
+		t.Errorf("A container that never accepted should not report readiness: %v", latency)
+	}
+}
+
+func TestDialAccepting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	accepting := DialAccepting(func() (string, error) { return addr, nil }, time.Second)
+	if err := accepting(); err != nil {
+		t.Errorf("Expected the listener to accept: %v", err)
+	}
+	l.Close()
+	if err := accepting(); err == nil {
+		t.Errorf("Expected a closed listener to refuse connections")
+	}
+}
@@ -1,6 +1,7 @@
 package port
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -13,14 +14,31 @@ const portsPerBlock = Port(100) // changing this breaks disk structure... don't
 const maxReadFailures = 3
 
 func NewPortAllocator(base string, min, max Port) *PortAllocator {
+	return newDeviceAllocator(base, DefaultDevice, "", PortRanges{{min, max}})
+}
+
+// An allocator for a pool of one interface of the host, or for the
+// interface's own ranges if pool is empty.  An unknown pool has no
+// ports.
+func NewInterfaceAllocator(base string, i *Interface, pool string) *PortAllocator {
+	ranges, _ := i.PoolRanges(pool)
+	return newDeviceAllocator(base, i.Device, pool, ranges)
+}
+
+func newDeviceAllocator(base string, device Device, pool string, ranges PortRanges) *PortAllocator {
 	allocator := &PortAllocator{
-		base,
-		make(chan Port),
-		make(chan bool),
-		uint(min / portsPerBlock),
-		0,
-		min,
-		max,
+		path:   base,
+		device: device,
+		pool:   pool,
+		ports:  make(chan Port),
+		done:   make(chan bool),
+		ranges: ranges,
+	}
+	for _, r := range ranges {
+		allocator.blocks += int((r.Max-1)/portsPerBlock-r.Min/portsPerBlock) + 1
+	}
+	if len(ranges) > 0 {
+		allocator.next = ranges[0].Min
 	}
 	return allocator
 }
@@ -42,13 +60,20 @@ func (a *PortAllocator) allocatePort() Port {
 // An example of a very simple Port allocator.
 //
 type PortAllocator struct {
-	path     string
-	ports    chan Port
-	done     chan bool
-	block    uint
+	path   string
+	device Device
+	pool   string
+	ports  chan Port
+	done   chan bool
+	// The ports of the pool, without exclusions
+	ranges PortRanges
+	// The number of blocks searched in a pass over every range
+	blocks int
+	// The range and port the next search starts at
+	current  int
+	next     Port
+	empty    int
 	failures int
-	min      Port
-	max      Port
 }
 
 func (p *PortAllocator) Run() {
@@ -57,47 +82,38 @@ func (p *PortAllocator) Run() {
 }
 
 func (p *PortAllocator) findPorts() {
+	if len(p.ranges) == 0 {
+		log.Printf("ports: %s has no ports to allocate", p)
+		for {
+			if p.exhausted() {
+				return
+			}
+		}
+	}
 	for {
 		foundInBlock := 0
-		start := Port(p.block) * portsPerBlock
-		if start < p.min {
-			start = p.min
-		}
-		end := (Port(p.block) + 1) * portsPerBlock
-		if end > p.max {
-			end = p.max
-			p.block = uint(p.min / portsPerBlock)
-		} else {
-			p.block += 1
-		}
+		start, end := p.nextBlock()
 
-		//log.Printf("ports: searching block %d, %d-%d", p.block, start, end-1)
+		//log.Printf("ports: searching %s, %d-%d", p, start, end-1)
 
-		var taken []string
-		parent, _ := p.portPathsFor(start)
-		f, erro := os.OpenFile(parent, os.O_RDONLY, 0)
-		if erro == nil {
-			names, errr := f.Readdirnames(int(portsPerBlock))
-			f.Close()
-			if errr != nil && errr != io.EOF {
-				log.Printf("ports: failed to read %s: %v", parent, errr)
-				if p.fail() {
-					goto finished
-				}
-				continue
+		// A port is only offered when it is free for every protocol
+		taken, errr := p.reservedNames(start)
+		if errr != nil {
+			if p.fail() {
+				goto finished
 			}
-			taken = names
+			continue
 		}
 
 		if reserved := namesToPorts(taken); len(reserved) > 0 {
 			existing := reserved[0]
 			other := 1
 			for n := start; n < end; n++ {
+				for existing < n && other < len(reserved) {
+					existing = reserved[other]
+					other += 1
+				}
 				if existing == n {
-					if other < len(reserved) {
-						existing = reserved[other]
-						other += 1
-					}
 					continue
 				}
 				select {
@@ -119,8 +135,12 @@ func (p *PortAllocator) findPorts() {
 		}
 
 		if foundInBlock == 0 {
-			log.Printf("ports: failed to find a port between %d-%d ", start, end-1)
-			if p.fail() {
+			// Every block was searched since a port was last found
+			p.empty += 1
+			if p.empty == p.blocks {
+				log.Printf("ports: every port of %s is reserved", p)
+			}
+			if p.empty >= p.blocks && p.exhausted() {
 				goto finished
 			}
 		} else {
@@ -130,30 +150,127 @@ func (p *PortAllocator) findPorts() {
 finished:
 }
 
+// The next block of ports to search, within the current range.  Blocks
+// follow the reservation directories on disk so each search reads one
+// directory.
+func (p *PortAllocator) nextBlock() (start, end Port) {
+	r := p.ranges[p.current]
+	start = p.next
+	end = (start/portsPerBlock + 1) * portsPerBlock
+	if end >= r.Max {
+		end = r.Max
+		p.current = (p.current + 1) % len(p.ranges)
+		p.next = p.ranges[p.current].Min
+	} else {
+		p.next = end
+	}
+	return
+}
+
+func (p *PortAllocator) reservedNames(start Port) ([]string, error) {
+	var taken []string
+	for _, protocol := range []Protocol{TCP, UDP} {
+		parent, _ := p.protocolPathsFor(protocol, start)
+		f, erro := os.OpenFile(parent, os.O_RDONLY, 0)
+		if erro != nil {
+			continue
+		}
+		names, errr := f.Readdirnames(int(portsPerBlock))
+		f.Close()
+		if errr != nil && errr != io.EOF {
+			log.Printf("ports: failed to read %s: %v", parent, errr)
+			return nil, errr
+		}
+		taken = append(taken, names...)
+	}
+	return taken, nil
+}
+
 func (p *PortAllocator) fail() bool {
 	p.failures += 1
 	if p.failures > maxReadFailures {
-		select {
-		case p.ports <- 0:
-		case <-p.done:
-			return true
-		}
+		return p.exhausted()
+	}
+	return false
+}
+
+// Tell the next consumer that no port could be found.  Returns true if
+// the allocator was stopped.
+func (p *PortAllocator) exhausted() bool {
+	select {
+	case p.ports <- 0:
+	case <-p.done:
+		return true
 	}
 	return false
 }
 
 func (p *PortAllocator) foundPorts() {
 	p.failures = 0
+	p.empty = 0
+}
+
+// Returns the first of count consecutive ports, or an error if no
+// run of that length could be allocated from the pool.
+func (a *PortAllocator) allocatePorts(count uint) (Port, error) {
+	if count <= 1 {
+		if p := a.allocatePort(); p != 0 {
+			return p, nil
+		}
+		return 0, &PoolExhaustedError{a.device, a.pool, 1}
+	}
+	var first, last Port
+	run := uint(0)
+	for attempts := a.ranges.Size(); attempts > 0; attempts-- {
+		p := a.allocatePort()
+		if p == 0 {
+			break
+		}
+		if run > 0 && p == last+1 {
+			run += 1
+		} else {
+			first, run = p, 1
+		}
+		last = p
+		if run == count {
+			return first, nil
+		}
+	}
+	return 0, &PoolExhaustedError{a.device, a.pool, count}
+}
+
+func (a *PortAllocator) String() string {
+	if a.pool == "" {
+		return fmt.Sprintf("device %s", a.device)
+	}
+	return fmt.Sprintf("pool '%s' of device %s", a.pool, a.device)
 }
 
 func (a *PortAllocator) portPathsFor(p Port) (base string, path string) {
-	root := a.devicePath(Device("1"))
+	return a.protocolPathsFor(TCP, p)
+}
+
+// TCP reservations keep the original layout, UDP reservations are
+// kept in a parallel tree.
+func (a *PortAllocator) protocolPathsFor(protocol Protocol, p Port) (base string, path string) {
+	root := a.devicePath(a.device)
+	if protocol.UDP() {
+		root = filepath.Join(a.path, "ports", "udp", "interfaces", string(a.device))
+	}
 	prefix := p / portsPerBlock
 	base = filepath.Join(root, strconv.FormatUint(uint64(prefix), 10))
 	path = filepath.Join(base, strconv.FormatUint(uint64(p), 10))
 	return
 }
 
+// The link that reserves an external port of a device on the host
+// rooted at base.  It points to the unit definition of the container
+// that holds the port.
+func ReservationPath(base string, device Device, protocol Protocol, p Port) string {
+	_, path := (&PortAllocator{path: base, device: device}).protocolPathsFor(protocol, p)
+	return path
+}
+
 func (a *PortAllocator) devicePath(d Device) string {
 	return filepath.Join(a.path, "ports", "interfaces", string(d))
 }
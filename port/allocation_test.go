@@ -1,6 +1,7 @@
 package port
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -43,9 +44,10 @@ func TestReserveReleasePorts(t *testing.T) {
 	}
 
 	go alloc.Run()
-	reserve := PortReservation{alloc}
+	reserve := NewPortReservation(dir, nil)
+	reserve.PortAllocator = alloc
 
-	p, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{8080, 0}}, PortPairs{})
+	p, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{Internal: 8080}}, PortPairs{})
 	if err != nil {
 		t.Errorf("Couldn't reserve ports: %s", err.Error())
 	}
@@ -67,3 +69,265 @@ func TestReserveReleasePorts(t *testing.T) {
 		t.Errorf("Should have removed link on filesystem %s: %+v", expected, err)
 	}
 }
+
+func TestReserveRangeByProtocol(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "porttest")
+	defer os.RemoveAll(dir)
+	alloc := NewPortAllocator(dir, 40000, 40010)
+
+	// A TCP reservation makes the port unavailable to any protocol
+	base, link := alloc.portPathsFor(Port(40002))
+	os.MkdirAll(base, 0700)
+	os.Create(link)
+
+	path := filepath.Join(dir, "unit1")
+	if _, err := os.Create(path); err != nil {
+		t.Errorf("Couldn't create temporary file: %s", err.Error())
+	}
+
+	go alloc.Run()
+	reserve := NewPortReservation(dir, nil)
+	reserve.PortAllocator = alloc
+
+	p, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{Internal: 5000, Protocol: UDP, Count: 3}}, PortPairs{})
+	if err != nil {
+		t.Fatalf("Couldn't reserve ports: %s", err.Error())
+	}
+	if len(p) != 1 || p[0].External != 40003 || p[0].Count != 3 || !p[0].Protocol.UDP() {
+		t.Fatalf("Did not reserve a consecutive range after the reserved port, %+v", p)
+	}
+	for n := Port(40003); n < 40006; n++ {
+		_, expected := alloc.protocolPathsFor(UDP, n)
+		if s, _ := os.Readlink(expected); s != path {
+			t.Errorf("Reservation of %d did not link to the supplied file, %s -> %s (actual: %s)", n, expected, path, s)
+		}
+		if _, tcp := alloc.protocolPathsFor(TCP, n); tcp == expected {
+			t.Errorf("UDP reservations should not share the TCP path %s", tcp)
+		}
+	}
+
+	if err := reserve.ReleaseExternalPorts(p); err != nil {
+		t.Errorf("Did not release expected ports, %+v", p)
+	}
+	for n := Port(40003); n < 40006; n++ {
+		if _, expected := alloc.protocolPathsFor(UDP, n); fileExists(expected) {
+			t.Errorf("Should have removed link on filesystem %s", expected)
+		}
+	}
+}
+
+func TestReserveOnInterfaces(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "porttest")
+	defer os.RemoveAll(dir)
+
+	interfaces := Interfaces{
+		{Device: "public", Address: "10.0.0.5", Min: 41000, Max: 41010},
+		{Device: DefaultDevice, Min: 40000, Max: 40010},
+	}
+	if err := interfaces.Write(dir); err != nil {
+		t.Fatalf("Couldn't write interfaces: %v", err)
+	}
+	read, err := ReadInterfaces(dir)
+	if err != nil || len(read) != 2 {
+		t.Fatalf("Couldn't read interfaces %+v: %v", read, err)
+	}
+
+	path := filepath.Join(dir, "unit1")
+	if _, err := os.Create(path); err != nil {
+		t.Errorf("Couldn't create temporary file: %s", err.Error())
+	}
+
+	reserve := NewPortReservation(dir, read)
+	go reserve.Run()
+
+	p, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{Internal: 8080, Address: "10.0.0.5"}, PortPair{Internal: 8081}}, PortPairs{})
+	if err != nil {
+		t.Fatalf("Couldn't reserve ports: %s", err.Error())
+	}
+	if p[0].External != 41000 || p[1].External != 40000 {
+		t.Fatalf("Expected each port from its interface's range, %+v", p)
+	}
+	if link := ReservationPath(dir, "public", TCP, 41000); !fileExists(link) {
+		t.Errorf("Expected a reservation under the public device, %s", link)
+	}
+	if link := ReservationPath(dir, DefaultDevice, TCP, 41000); fileExists(link) {
+		t.Errorf("Should not reserve the port on the default device, %s", link)
+	}
+
+	// The default device is bound on every address
+	if _, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{Internal: 9000, External: 41000}}, PortPairs{}); err == nil {
+		t.Errorf("Should not reserve a port already bound on another interface")
+	}
+	if _, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{Internal: 9000, Address: "10.0.0.6"}}, PortPairs{}); err == nil {
+		t.Errorf("Should not reserve a port on an unknown address")
+	}
+
+	// Moving a port to another interface releases the old reservation
+	moved, err := reserve.AtomicReserveExternalPorts(path, PortPairs{PortPair{Internal: 8080}, PortPair{Internal: 8081}}, p)
+	if err != nil {
+		t.Fatalf("Couldn't move ports: %s", err.Error())
+	}
+	if moved[0].Address != "" || moved[0].External == 41000 || moved[1].External != 40000 {
+		t.Errorf("Unexpected ports after moving, %+v", moved)
+	}
+	if link := ReservationPath(dir, "public", TCP, 41000); fileExists(link) {
+		t.Errorf("Should have released the port on the public device, %s", link)
+	}
+
+	if err := reserve.ReleaseExternalPorts(moved); err != nil {
+		t.Errorf("Did not release expected ports, %+v", moved)
+	}
+}
+
+func TestInterfacesCheck(t *testing.T) {
+	for _, interfaces := range []Interfaces{
+		{{Device: DefaultDevice, Address: "10.0.0.5", Min: 4000, Max: 5000}},
+		{{Device: "public", Min: 5000, Max: 6000}},
+		{{Device: "../x", Address: "10.0.0.5", Min: 5000, Max: 6000}},
+		{{Device: "a", Address: "10.0.0.5", Min: 5000, Max: 6000}, {Device: "b", Address: "10.0.0.6", Min: 5500, Max: 7000}},
+		{{Device: "a", Address: "10.0.0.5", Min: 5000, Max: 6000}, {Device: "b", Address: "10.0.0.5", Min: 7000, Max: 8000}},
+		{{Device: "a", Address: "10.0.0.5", Min: 6000, Max: 5000}},
+		{{Device: "a", Address: "10.0.0.5", Min: 60000, Max: 61000, Pools: []Pool{{Name: "x", Ranges: PortRanges{{5000, 5100}}}}}},
+		{{Device: "a", Address: "10.0.0.5", Min: 60000, Max: 61000, Pools: []Pool{{Name: "x", Ranges: PortRanges{{60500, 60600}}}}}},
+		{{Device: "a", Address: "10.0.0.5", Min: 60000, Max: 61000, Pools: []Pool{{Name: "1x", Ranges: PortRanges{{62000, 62100}}}}}},
+		{{Device: "a", Address: "10.0.0.5", Min: 60000, Max: 61000, Pools: []Pool{{Name: "x"}}}},
+		{{Device: "a", Address: "10.0.0.5", Min: 60000, Max: 61000, Pools: []Pool{{Name: "x", Ranges: PortRanges{{62000, 62100}}}, {Name: "x", Ranges: PortRanges{{63000, 63100}}}}}},
+	} {
+		if err := interfaces.WithDefault().Check(); err == nil {
+			t.Errorf("Expected %+v to be rejected", interfaces)
+		}
+	}
+	if err := (Interfaces{{Device: "a", Address: "10.0.0.5", Min: 60000, Max: 61000}}).WithDefault().Check(); err != nil {
+		t.Errorf("Expected a separate range to be accepted: %v", err)
+	}
+}
+
+func TestAllocatePools(t *testing.T) {
+	var interfaces Interfaces
+	if err := json.Unmarshal([]byte(`[{
+		"Device": "1", "Min": 40000, "Max": 40003,
+		"Ranges": ["40195-40204"],
+		"Exclude": ["40001", "40198-40203"],
+		"Pools": [{"Name": "public", "Ranges": ["41000-41001"]}]
+	}]`), &interfaces); err != nil {
+		t.Fatalf("Couldn't read interfaces: %v", err)
+	}
+	if err := interfaces.Check(); err != nil {
+		t.Fatalf("Expected the interfaces to be valid: %v", err)
+	}
+
+	// Each reservation starts from what is on disk so allocators never
+	// offer a port reserved by an earlier step
+	start := func(reserved ...Port) (*PortReservation, string, func()) {
+		dir, _ := ioutil.TempDir(os.TempDir(), "porttest")
+		path := filepath.Join(dir, "unit1")
+		if _, err := os.Create(path); err != nil {
+			t.Errorf("Couldn't create temporary file: %s", err.Error())
+		}
+		for _, p := range reserved {
+			link := ReservationPath(dir, DefaultDevice, TCP, p)
+			os.MkdirAll(filepath.Dir(link), 0700)
+			os.Symlink(path, link)
+		}
+		reserve := NewPortReservation(dir, interfaces)
+		go reserve.Run()
+		return reserve, path, func() { os.RemoveAll(dir) }
+	}
+
+	reserve, path, cleanup := start()
+	defer cleanup()
+	p, err := reserve.AtomicReserveExternalPorts(path, PortPairs{{Internal: 1}, {Internal: 2}, {Internal: 3}, {Internal: 4}, {Internal: 5}}, PortPairs{})
+	if err != nil {
+		t.Fatalf("Couldn't reserve ports: %v", err)
+	}
+	for i, expected := range []Port{40000, 40002, 40195, 40196, 40197} {
+		if p[i].External != expected {
+			t.Errorf("Expected port %d to skip excluded ports and span ranges, got %+v", i, p)
+			break
+		}
+	}
+	public, err := reserve.AtomicReserveExternalPorts(path, PortPairs{{Internal: 8080, Pool: "public", Count: 2}}, PortPairs{})
+	if err != nil || public[0].External != 41000 {
+		t.Fatalf("Expected a range from the public pool, %+v: %v", public, err)
+	}
+	if _, err := reserve.AtomicReserveExternalPorts(path, PortPairs{{Internal: 9000, Pool: "internal"}}, PortPairs{}); err == nil {
+		t.Errorf("Should not reserve a port from an unknown pool")
+	}
+
+	reserve, path, cleanup = start(41000, 41001)
+	defer cleanup()
+	_, err = reserve.AtomicReserveExternalPorts(path, PortPairs{{Internal: 9000, Pool: "public"}}, PortPairs{})
+	if exhausted, ok := err.(*PoolExhaustedError); !ok || exhausted.Pool != "public" || exhausted.Device != DefaultDevice {
+		t.Errorf("Expected the public pool to be exhausted, got %v", err)
+	}
+
+	// A port from another pool is replaced
+	reserve, path, cleanup = start(40000)
+	defer cleanup()
+	moved, err := reserve.AtomicReserveExternalPorts(path, PortPairs{{Internal: 1, Pool: "public"}}, PortPairs{{Internal: 1, External: 40000}})
+	if err != nil || moved[0].External != 41000 {
+		t.Errorf("Expected the port to move to the public pool, got %+v: %v", moved, err)
+	}
+	if link := ReservationPath(reserve.path, DefaultDevice, TCP, 40000); fileExists(link) {
+		t.Errorf("Should have released the port outside the pool, %s", link)
+	}
+}
+
+func TestListReservations(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "porttest")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "unit1")
+	if _, err := os.Create(path); err != nil {
+		t.Errorf("Couldn't create temporary file: %s", err.Error())
+	}
+	for _, r := range []Reservation{
+		{Device: DefaultDevice, Port: 40002},
+		{Device: DefaultDevice, Port: 40000},
+		{Device: DefaultDevice, Protocol: UDP, Port: 40000},
+		{Device: "public", Port: 41009},
+	} {
+		link := ReservationPath(dir, r.Device, r.Protocol, r.Port)
+		os.MkdirAll(filepath.Dir(link), 0700)
+		if err := os.Symlink(path, link); err != nil {
+			t.Fatalf("Couldn't reserve %+v: %v", r, err)
+		}
+	}
+
+	reservations, err := ListReservations(dir)
+	if err != nil {
+		t.Fatalf("Couldn't list reservations: %v", err)
+	}
+	if len(reservations) != 4 || reservations[0].Port != 40000 || reservations[1].Port != 40000 || reservations[2].Port != 40002 || reservations[3].Device != "public" {
+		t.Fatalf("Unexpected reservations %+v", reservations)
+	}
+	if reservations[0].Path != path || !reservations[1].Protocol.UDP() {
+		t.Errorf("Unexpected reservation details %+v", reservations)
+	}
+
+	usage := Interfaces{
+		{Device: DefaultDevice, Min: 40000, Max: 40010},
+		{Device: "public", Address: "10.0.0.5", Min: 41000, Max: 41010},
+	}.Usage(reservations)
+	if u := usage[0]; u.Reserved != 2 || u.Free != 8 || u.LargestFree != 7 {
+		t.Errorf("Unexpected usage of the default device %+v", u)
+	}
+	if u := usage[1]; u.Reserved != 1 || u.Free != 9 || u.LargestFree != 9 {
+		t.Errorf("Unexpected usage of the public device %+v", u)
+	}
+
+	if err := reservations[3].Release(dir); err != nil {
+		t.Fatalf("Couldn't release %+v: %v", reservations[3], err)
+	}
+	if link := ReservationPath(dir, "public", TCP, 41009); fileExists(link) {
+		t.Errorf("Should have released the reservation, %s", link)
+	}
+	if err := reservations[3].Release(dir); err != nil {
+		t.Errorf("Releasing a released reservation should succeed: %v", err)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,218 @@
+package port
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// The device external ports are reserved on when no bind address is
+// requested.  Its ports are bound on every address of the host.
+const DefaultDevice = Device("1")
+
+// The range the default device allocates from when the host does not
+// configure it.
+const (
+	DefaultMinPort = Port(4000)
+	DefaultMaxPort = Port(60000)
+)
+
+var allowedDevice = regexp.MustCompile(`\A[a-zA-Z0-9_\-]{1,32}\z`)
+
+// An interface or address of the host that external ports are bound
+// on, and the range of ports allocated on it.  Reservations for each
+// interface are tracked under ports/interfaces/<device>.
+type Interface struct {
+	Device  Device
+	Address string `json:"Address,omitempty"`
+	Min     Port
+	Max     Port
+	// More ranges allocated from when no pool is requested
+	Ranges PortRanges `json:"Ranges,omitempty"`
+	// Ports in any range or pool that are never allocated, such as
+	// well known ports
+	Exclude PortRanges `json:"Exclude,omitempty"`
+	Pools   []Pool     `json:"Pools,omitempty"`
+}
+
+type Interfaces []Interface
+
+func (i *Interface) Check() error {
+	if !allowedDevice.MatchString(string(i.Device)) {
+		return errors.New(fmt.Sprintf("The device '%s' must be 1-32 letters, numbers, '_' or '-'", i.Device))
+	}
+	if i.Device == DefaultDevice {
+		if i.Address != "" {
+			return errors.New(fmt.Sprintf("The default device %s is bound on every address and may not have an address", DefaultDevice))
+		}
+	} else if net.ParseIP(i.Address) == nil {
+		return errors.New(fmt.Sprintf("The device '%s' must have an IP address", i.Device))
+	}
+	if err := i.Min.Check(); err != nil {
+		return err
+	}
+	if err := i.Max.Check(); err != nil {
+		return err
+	}
+	if i.Max <= i.Min {
+		return errors.New(fmt.Sprintf("The port range of device '%s' must start with the lower port", i.Device))
+	}
+	for j := range i.Pools {
+		if err := CheckPoolName(i.Pools[j].Name); err != nil {
+			return err
+		}
+		if len(i.Pools[j].Ranges) == 0 {
+			return errors.New(fmt.Sprintf("The pool '%s' of device '%s' has no ranges", i.Pools[j].Name, i.Device))
+		}
+		for k := 0; k < j; k++ {
+			if i.Pools[k].Name == i.Pools[j].Name {
+				return errors.New(fmt.Sprintf("The pool '%s' of device '%s' is defined more than once", i.Pools[j].Name, i.Device))
+			}
+		}
+	}
+	for _, r := range append(i.allRanges(), i.Exclude...) {
+		if err := r.Check(); err != nil {
+			return err
+		}
+	}
+	ranges := i.allRanges()
+	for j := range ranges {
+		for k := 0; k < j; k++ {
+			if ranges[j].overlaps(ranges[k]) {
+				return errors.New(fmt.Sprintf("The port ranges %s and %s of device '%s' overlap", ranges[k], ranges[j], i.Device))
+			}
+		}
+	}
+	return nil
+}
+
+// The ranges of the pool with the excluded ports removed.  The empty
+// name is the interface's own range.
+func (i *Interface) PoolRanges(name string) (PortRanges, bool) {
+	if name == "" {
+		return append(PortRanges{{i.Min, i.Max}}, i.Ranges...).Without(i.Exclude), true
+	}
+	for j := range i.Pools {
+		if i.Pools[j].Name == name {
+			return i.Pools[j].Ranges.Without(i.Exclude), true
+		}
+	}
+	return nil, false
+}
+
+// The names of the pools of the interface, starting with the
+// interface's own range.
+func (i *Interface) PoolNames() []string {
+	names := []string{""}
+	for j := range i.Pools {
+		names = append(names, i.Pools[j].Name)
+	}
+	return names
+}
+
+func (i *Interface) allRanges() PortRanges {
+	ranges := append(PortRanges{{i.Min, i.Max}}, i.Ranges...)
+	for j := range i.Pools {
+		ranges = append(ranges, i.Pools[j].Ranges...)
+	}
+	return ranges
+}
+
+// Devices and addresses must be unique, and the ranges of different
+// interfaces may not overlap since the default device is bound on
+// every address.
+func (interfaces Interfaces) Check() error {
+	for j := range interfaces {
+		a := &interfaces[j]
+		if err := a.Check(); err != nil {
+			return err
+		}
+		for k := 0; k < j; k++ {
+			b := &interfaces[k]
+			if a.Device == b.Device {
+				return errors.New(fmt.Sprintf("The device '%s' is defined more than once", a.Device))
+			}
+			if a.Address != "" && net.ParseIP(a.Address).Equal(net.ParseIP(b.Address)) {
+				return errors.New(fmt.Sprintf("The address %s is used by devices '%s' and '%s'", a.Address, b.Device, a.Device))
+			}
+			for _, ra := range a.allRanges() {
+				for _, rb := range b.allRanges() {
+					if ra.overlaps(rb) {
+						return errors.New(fmt.Sprintf("The port ranges of devices '%s' and '%s' overlap", b.Device, a.Device))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// The interface bound on address, or the default device for an empty
+// address.
+func (interfaces Interfaces) Find(address string) (*Interface, bool) {
+	ip := net.ParseIP(address)
+	for j := range interfaces {
+		i := &interfaces[j]
+		if address == "" && i.Device == DefaultDevice {
+			return i, true
+		}
+		if ip != nil && i.Address != "" && ip.Equal(net.ParseIP(i.Address)) {
+			return i, true
+		}
+	}
+	return nil, false
+}
+
+// The interfaces of the host with the default device added if it
+// isn't configured.
+func (interfaces Interfaces) WithDefault() Interfaces {
+	if _, found := interfaces.Find(""); found {
+		return interfaces
+	}
+	return append(Interfaces{{Device: DefaultDevice, Min: DefaultMinPort, Max: DefaultMaxPort}}, interfaces...)
+}
+
+func InterfacesPath(base string) string {
+	return filepath.Join(base, "ports", "interfaces.json")
+}
+
+// Read the interfaces configured for the host rooted at base.  Returns
+// only the default device if none are configured.
+func ReadInterfaces(base string) (Interfaces, error) {
+	interfaces := Interfaces{}
+	data, err := ioutil.ReadFile(InterfacesPath(base))
+	if os.IsNotExist(err) {
+		return interfaces.WithDefault(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &interfaces); err != nil {
+		return nil, err
+	}
+	interfaces = interfaces.WithDefault()
+	if err := interfaces.Check(); err != nil {
+		return nil, err
+	}
+	return interfaces, nil
+}
+
+// Save the interfaces of the host rooted at base.  The port allocator
+// reads them when the daemon starts.
+func (interfaces Interfaces) Write(base string) error {
+	if err := interfaces.Check(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(interfaces, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(InterfacesPath(base)), 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(InterfacesPath(base), data, 0644)
+}
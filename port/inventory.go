@@ -0,0 +1,142 @@
+package port
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// An external port reserved on a device, and the unit definition its
+// link points to.
+type Reservation struct {
+	Device   Device
+	Protocol Protocol `json:"Protocol,omitempty"`
+	Port     Port
+	Path     string
+}
+type Reservations []Reservation
+
+func (r Reservations) Len() int      { return len(r) }
+func (r Reservations) Swap(a, b int) { r[a], r[b] = r[b], r[a] }
+func (r Reservations) Less(a, b int) bool {
+	if r[a].Device != r[b].Device {
+		return r[a].Device < r[b].Device
+	}
+	if r[a].Port != r[b].Port {
+		return r[a].Port < r[b].Port
+	}
+	return r[a].Protocol.String() < r[b].Protocol.String()
+}
+
+// Read every reservation on the host rooted at base, on every device
+// and for both protocols.
+func ListReservations(base string) (Reservations, error) {
+	reservations := Reservations{}
+	for _, protocol := range []Protocol{"", UDP} {
+		root := filepath.Join(base, "ports", "interfaces")
+		if protocol.UDP() {
+			root = filepath.Join(base, "ports", "udp", "interfaces")
+		}
+		devices, err := ioutil.ReadDir(root)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if !device.IsDir() {
+				continue
+			}
+			blocks, err := ioutil.ReadDir(filepath.Join(root, device.Name()))
+			if err != nil {
+				return nil, err
+			}
+			for _, block := range blocks {
+				if !block.IsDir() {
+					continue
+				}
+				dir := filepath.Join(root, device.Name(), block.Name())
+				links, err := ioutil.ReadDir(dir)
+				if err != nil {
+					return nil, err
+				}
+				for _, link := range links {
+					p, err := strconv.Atoi(link.Name())
+					if err != nil || link.Mode()&os.ModeSymlink == 0 {
+						continue
+					}
+					path, err := os.Readlink(filepath.Join(dir, link.Name()))
+					if err != nil {
+						return nil, err
+					}
+					reservations = append(reservations, Reservation{Device(device.Name()), protocol, Port(p), path})
+				}
+			}
+		}
+	}
+	sort.Sort(reservations)
+	return reservations, nil
+}
+
+// Remove a reservation regardless of whether the container it points
+// to still exists.  Hold LockReservations while checking and
+// releasing.
+func (r *Reservation) Release(base string) error {
+	if err := os.Remove(ReservationPath(base, r.Device, r.Protocol, r.Port)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// How much of a pool of an interface is reserved.  A port counts as
+// reserved if it is reserved for either protocol.
+type InterfaceUsage struct {
+	Device  Device
+	Address string `json:"Address,omitempty"`
+	// Empty for the interface's own ranges
+	Pool string `json:"Pool,omitempty"`
+	// The ports of the pool, without exclusions
+	Ranges   PortRanges
+	Reserved uint
+	Free     uint
+	// The longest run of free ports, the largest range that can be
+	// allocated
+	LargestFree uint
+}
+
+// The usage of each pool of each interface given the reservations on
+// the host.
+func (interfaces Interfaces) Usage(reservations Reservations) []InterfaceUsage {
+	usage := make([]InterfaceUsage, 0, len(interfaces))
+	for j := range interfaces {
+		i := &interfaces[j]
+		for _, name := range i.PoolNames() {
+			ranges, _ := i.PoolRanges(name)
+			reserved := make(map[Port]bool)
+			for _, r := range reservations {
+				if r.Device == i.Device && ranges.Contains(r.Port, 1) {
+					reserved[r.Port] = true
+				}
+			}
+			u := InterfaceUsage{Device: i.Device, Address: i.Address, Pool: name, Ranges: ranges, Reserved: uint(len(reserved))}
+			u.Free = ranges.Size() - u.Reserved
+			for _, rng := range ranges {
+				run := uint(0)
+				for p := rng.Min; p < rng.Max; p++ {
+					if reserved[p] {
+						run = 0
+						continue
+					}
+					run++
+					if run > u.LargestFree {
+						u.LargestFree = run
+					}
+				}
+			}
+			usage = append(usage, u)
+		}
+	}
+	return usage
+}
@@ -0,0 +1,31 @@
+// +build linux
+
+package port
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Wait for the exclusive lock on the reservations of the host rooted
+// at base.  Every process that adds or removes reservations holds it,
+// so that a reservation is never released while it is being reused.
+func LockReservations(base string) (func(), error) {
+	dir := filepath.Join(base, "ports")
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
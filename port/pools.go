@@ -0,0 +1,171 @@
+package port
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A range of ports from Min up to but not including Max.  Configuration
+// writes it as an inclusive '<first>[-<last>]' range.
+type PortRange struct {
+	Min Port
+	Max Port
+}
+type PortRanges []PortRange
+
+func NewPortRange(value string) (PortRange, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	first, err := NewPortFromString(bounds[0])
+	if err != nil {
+		return PortRange{}, err
+	}
+	last := first
+	if len(bounds) == 2 {
+		if last, err = NewPortFromString(bounds[1]); err != nil {
+			return PortRange{}, err
+		}
+	}
+	r := PortRange{first, last + 1}
+	if err := r.Check(); err != nil {
+		return PortRange{}, err
+	}
+	return r, nil
+}
+
+func (r PortRange) Check() error {
+	if err := r.Min.Check(); err != nil {
+		return err
+	}
+	if r.Max <= r.Min || r.Max > 65536 {
+		return errors.New(fmt.Sprintf("The port range %d-%d must start with the lower port", r.Min, r.Max-1))
+	}
+	return nil
+}
+
+func (r PortRange) Size() uint {
+	if r.Max <= r.Min {
+		return 0
+	}
+	return uint(r.Max - r.Min)
+}
+
+// True if count ports starting at p are all in the range.
+func (r PortRange) Contains(p Port, count uint) bool {
+	return p >= r.Min && p+Port(count) <= r.Max
+}
+
+func (r PortRange) overlaps(other PortRange) bool {
+	return r.Min < other.Max && other.Min < r.Max
+}
+
+func (r PortRange) String() string {
+	return FormatPortRange(r.Min, r.Size())
+}
+
+func (r PortRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *PortRange) UnmarshalText(b []byte) error {
+	parsed, err := NewPortRange(string(b))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r PortRanges) Len() int           { return len(r) }
+func (r PortRanges) Swap(a, b int)      { r[a], r[b] = r[b], r[a] }
+func (r PortRanges) Less(a, b int) bool { return r[a].Min < r[b].Min }
+
+func (r PortRanges) Size() uint {
+	size := uint(0)
+	for i := range r {
+		size += r[i].Size()
+	}
+	return size
+}
+
+func (r PortRanges) Contains(p Port, count uint) bool {
+	for i := range r {
+		if r[i].Contains(p, count) {
+			return true
+		}
+	}
+	return false
+}
+
+// The ports of the ranges that aren't excluded, in order.
+func (r PortRanges) Without(excluded PortRanges) PortRanges {
+	remaining := append(PortRanges{}, r...)
+	for _, ex := range excluded {
+		next := make(PortRanges, 0, len(remaining)+1)
+		for _, rng := range remaining {
+			if !rng.overlaps(ex) {
+				next = append(next, rng)
+				continue
+			}
+			if rng.Min < ex.Min {
+				next = append(next, PortRange{rng.Min, ex.Min})
+			}
+			if ex.Max < rng.Max {
+				next = append(next, PortRange{ex.Max, rng.Max})
+			}
+		}
+		remaining = next
+	}
+	sort.Sort(remaining)
+	return remaining
+}
+
+func (r PortRanges) String() string {
+	var s bytes.Buffer
+	for i := range r {
+		if i != 0 {
+			s.WriteString(",")
+		}
+		s.WriteString(r[i].String())
+	}
+	return s.String()
+}
+
+var allowedPool = regexp.MustCompile(`\A[a-zA-Z][a-zA-Z0-9_\-]{0,31}\z`)
+
+// A named set of ranges on an interface that callers may request ports
+// from instead of the interface's own range, such as "public" or
+// "internal".
+type Pool struct {
+	Name   string
+	Ranges PortRanges
+}
+
+func CheckPoolName(name string) error {
+	if !allowedPool.MatchString(name) {
+		return errors.New(fmt.Sprintf("The pool '%s' must start with a letter and have at most 32 letters, numbers, '_' or '-'", name))
+	}
+	return nil
+}
+
+// Returned when every port of a pool is reserved, or no run of free
+// ports is long enough for a range.
+type PoolExhaustedError struct {
+	Device Device
+	Pool   string
+	Count  uint
+}
+
+func (e *PoolExhaustedError) Error() string {
+	pool := "default pool"
+	if e.Pool != "" {
+		pool = fmt.Sprintf("pool '%s'", e.Pool)
+	}
+	if e.Count > 1 {
+		return fmt.Sprintf("No %d consecutive ports are free in the %s of device %s", e.Count, pool, e.Device)
+	}
+	return fmt.Sprintf("No ports are free in the %s of device %s", pool, e.Device)
+}
@@ -11,6 +11,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // An IP port, valid from 1 to 65535.  Use 0 for undefined.
@@ -72,32 +73,223 @@ func (hostport HostPort) Empty() bool {
 }
 
 func (hostport HostPort) Local() bool {
-	return hostport.Host == "" || hostport.Host == "127.0.0.1" || hostport.Host == "localhost"
+	return hostport.Host == "" || hostport.Host == "127.0.0.1" || hostport.Host == "::1" || hostport.Host == "localhost"
 }
 
+// The transport protocol of a port.  The empty value is TCP.
+type Protocol string
+
+const (
+	TCP Protocol = "tcp"
+	UDP Protocol = "udp"
+)
+
+func NewProtocolFromString(value string) (Protocol, error) {
+	switch p := Protocol(strings.ToLower(value)); p {
+	case "", TCP:
+		return "", nil
+	case UDP:
+		return UDP, nil
+	}
+	return "", errors.New(fmt.Sprintf("The protocol '%s' must be 'tcp' or 'udp'", value))
+}
+
+func (p Protocol) UDP() bool {
+	return p == UDP
+}
+
+func (p Protocol) Equal(other Protocol) bool {
+	return p.String() == other.String()
+}
+
+func (p Protocol) Check() error {
+	if _, err := NewProtocolFromString(string(p)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p Protocol) String() string {
+	if p == "" {
+		return string(TCP)
+	}
+	return string(p)
+}
+
+// The largest number of ports a single range may cover.
+const MaxRange = 1024
+
+// Parse a port or an inclusive '<first>-<last>' range of ports,
+// returning the first port and the number of ports in the range (zero
+// for a single port).
+func NewPortRangeFromString(value string) (Port, uint, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	first, err := NewPortFromString(bounds[0])
+	if err != nil {
+		return InvalidPort, 0, err
+	}
+	if len(bounds) == 1 {
+		return first, 0, nil
+	}
+	last, err := NewPortFromString(bounds[1])
+	if err != nil {
+		return InvalidPort, 0, err
+	}
+	if last < first {
+		return InvalidPort, 0, errors.New(fmt.Sprintf("The port range '%s' must start with the lower port", value))
+	}
+	if count := uint(last-first) + 1; count > 1 {
+		if count > MaxRange {
+			return InvalidPort, 0, errors.New(fmt.Sprintf("The port range '%s' may not include more than %d ports", value, MaxRange))
+		}
+		return first, count, nil
+	}
+	return first, 0, nil
+}
+
+// Format count ports starting at first as a port or a range.
+func FormatPortRange(first Port, count uint) string {
+	if count > 1 && first != InvalidPort {
+		return first.String() + "-" + (first + Port(count) - 1).String()
+	}
+	return first.String()
+}
+
+// Split a trailing '/<protocol>' from value.
+func SplitProtocol(value string) (string, Protocol, error) {
+	if i := strings.LastIndex(value, "/"); i != -1 {
+		protocol, err := NewProtocolFromString(value[i+1:])
+		return value[:i], protocol, err
+	}
+	return value, "", nil
+}
+
+// An internal port and the external port it is exposed on.  When
+// Count is greater than one the pair maps that many consecutive
+// ports starting at Internal and External.  The external port is
+// bound on every address of the host unless Address names the
+// address of one of its interfaces.  An allocated external port comes
+// from the interface's own range unless Pool names one of its pools.
 type PortPair struct {
 	Internal Port
-	External Port `json:"External,omitempty"`
+	External Port     `json:"External,omitempty"`
+	Protocol Protocol `json:"Protocol,omitempty"`
+	Count    uint     `json:"Count,omitempty"`
+	Address  string   `json:"Address,omitempty"`
+	Pool     string   `json:"Pool,omitempty"`
 }
 type PortPairs []PortPair
 
-func (p PortPairs) Find(port Port) (*PortPair, bool) {
+// The number of ports mapped by the pair.
+func (p PortPair) Size() uint {
+	if p.Count == 0 {
+		return 1
+	}
+	return p.Count
+}
+
+func (p PortPair) Check() error {
+	if err := p.Internal.Check(); err != nil {
+		return err
+	}
+	if err := p.Protocol.Check(); err != nil {
+		return err
+	}
+	if p.Size() > MaxRange {
+		return errors.New(fmt.Sprintf("A port range may not include more than %d ports", MaxRange))
+	}
+	if uint(p.Internal)+p.Size()-1 > 65535 || (!p.External.Default() && uint(p.External)+p.Size()-1 > 65535) {
+		return errors.New("A port range may not extend past 65535")
+	}
+	if p.Address != "" && net.ParseIP(p.Address) == nil {
+		return errors.New(fmt.Sprintf("The bind address '%s' must be an IP address", p.Address))
+	}
+	if p.Pool != "" {
+		if err := CheckPoolName(p.Pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The external port or range, prefixed by the bind address if there
+// is one.
+func (p PortPair) ExternalAddress() string {
+	external := FormatPortRange(p.External, p.Count)
+	if p.Address == "" {
+		return external
+	}
+	return net.JoinHostPort(p.Address, external)
+}
+
+// The pair in the <internal>:<external>[@<address>][/<protocol>] form
+// used by FromPortPairHeader.  The pool is only written while the
+// external port is unallocated.
+func (p PortPair) ToHeader() string {
+	s := FormatPortRange(p.Internal, p.Count) + ":" + FormatPortRange(p.External, p.Count)
+	if p.External.Default() && p.Pool != "" {
+		s = FormatPortRange(p.Internal, p.Count) + ":" + p.Pool
+	}
+	if p.Address != "" {
+		s += "@" + p.Address
+	}
+	if p.Protocol.UDP() {
+		s += "/" + p.Protocol.String()
+	}
+	return s
+}
+
+func (p PortPair) String() string {
+	s := FormatPortRange(p.Internal, p.Count) + " -> " + p.ExternalAddress()
+	if p.Protocol.UDP() {
+		s += "/" + p.Protocol.String()
+	}
+	return s
+}
+
+// Return the pair for an internal port and protocol.
+func (p PortPairs) Find(port Port, protocol Protocol) (*PortPair, bool) {
 	for i := range p {
-		if p[i].Internal == port {
+		if p[i].Internal == port && p[i].Protocol.Equal(protocol) {
 			return &p[i], true
 		}
 	}
 	return nil, false
 }
+
+// Return the protocols an internal port is listed with.
+func (p PortPairs) ProtocolsOf(port Port) []Protocol {
+	protocols := []Protocol{}
+	for i := range p {
+		if p[i].Internal == port {
+			protocols = append(protocols, p[i].Protocol)
+		}
+	}
+	return protocols
+}
+
+// Return one pair for every port covered by a range.
+func (p PortPairs) Expand() PortPairs {
+	expanded := make(PortPairs, 0, len(p))
+	for i := range p {
+		for n := uint(0); n < p[i].Size(); n++ {
+			pair := PortPair{Internal: p[i].Internal + Port(n), Protocol: p[i].Protocol, Address: p[i].Address, Pool: p[i].Pool}
+			if !p[i].External.Default() {
+				pair.External = p[i].External + Port(n)
+			}
+			expanded = append(expanded, pair)
+		}
+	}
+	return expanded
+}
+
 func (p PortPairs) ToHeader() string {
 	var pairs bytes.Buffer
 	for i := range p {
 		if i != 0 {
 			pairs.WriteString(",")
 		}
-		pairs.WriteString(strconv.Itoa(int(p[i].Internal)))
-		pairs.WriteString(":")
-		pairs.WriteString(strconv.Itoa(int(p[i].External)))
+		pairs.WriteString(p[i].ToHeader())
 	}
 	return pairs.String()
 }
@@ -107,33 +299,58 @@ func (p PortPairs) String() string {
 		if i != 0 {
 			pairs.WriteString(", ")
 		}
-		pairs.WriteString(strconv.Itoa(int(p[i].Internal)))
-		pairs.WriteString(" -> ")
-		pairs.WriteString(strconv.Itoa(int(p[i].External)))
+		pairs.WriteString(p[i].String())
 	}
 	return pairs.String()
 }
 
+// Parse a comma delimited list of
+// <internal>:<external>[@<address>][/<protocol>] pairs, where either
+// port may be an inclusive <first>-<last> range, an external port of 0
+// is allocated by the server, an external pool name is allocated from
+// that pool, and the external port is bound on the given address of
+// the host instead of all of them.
 func FromPortPairHeader(s string) (PortPairs, error) {
 	pairs := strings.Split(s, ",")
 	ports := make(PortPairs, 0, len(pairs))
 	for i := range pairs {
-		pair := pairs[i]
+		pair, protocol, err := SplitProtocol(pairs[i])
+		if err != nil {
+			return PortPairs{}, err
+		}
+		var address string
+		if j := strings.LastIndex(pair, "@"); j != -1 {
+			pair, address = pair[:j], pair[j+1:]
+			if net.ParseIP(address) == nil {
+				return PortPairs{}, errors.New(fmt.Sprintf("The bind address '%s' must be an IP address", address))
+			}
+		}
 		value := strings.SplitN(pair, ":", 2)
 		if len(value) != 2 {
-			return PortPairs{}, errors.New(fmt.Sprintf("The port string '%s' must be a comma delimited list of pairs <internal>:<external>,...", s))
+			return PortPairs{}, errors.New(fmt.Sprintf("The port string '%s' must be a comma delimited list of pairs <internal>:<external>[@<address>][/<protocol>],...", s))
 		}
-		internal, err := NewPortFromString(value[0])
+		internal, count, err := NewPortRangeFromString(value[0])
 		if err != nil {
 			return PortPairs{}, err
 		}
-		external, err := NewPortFromString(value[1])
+		var pool string
+		if value[1] != "" && unicode.IsLetter(rune(value[1][0])) {
+			if err := CheckPoolName(value[1]); err != nil {
+				return PortPairs{}, err
+			}
+			pool, value[1] = value[1], "0"
+		}
+		external, externalCount, err := NewPortRangeFromString(value[1])
 		if err != nil {
 			return PortPairs{}, err
 		}
-		ports = append(ports, PortPair{Port(internal), Port(external)})
+		if externalCount != count && !(external.Default() && externalCount == 0) {
+			return PortPairs{}, errors.New(fmt.Sprintf("The internal and external ranges of '%s' must be the same size", pairs[i]))
+		}
+		ports = append(ports, PortPair{Internal: internal, External: external, Protocol: protocol, Count: count, Address: address, Pool: pool})
 	}
 	return ports, nil
 }
 
+// The name of a host interface in the reservation tree.
 type Device string
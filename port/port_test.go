@@ -0,0 +1,63 @@
+package port
+
+import (
+	"testing"
+)
+
+func TestPortPairHeader(t *testing.T) {
+	pairs, err := FromPortPairHeader("8080:0,53:53/udp,10000-10009:20000-20009/udp,6000-6001:0")
+	if err != nil {
+		t.Fatalf("Unable to parse header: %v", err)
+	}
+	expected := PortPairs{
+		PortPair{Internal: 8080},
+		PortPair{Internal: 53, External: 53, Protocol: UDP},
+		PortPair{Internal: 10000, External: 20000, Protocol: UDP, Count: 10},
+		PortPair{Internal: 6000, Count: 2},
+	}
+	if len(pairs) != len(expected) {
+		t.Fatalf("Expected %d pairs, got %+v", len(expected), pairs)
+	}
+	for i := range expected {
+		if pairs[i] != expected[i] {
+			t.Errorf("Pair %d: expected %+v, got %+v", i, expected[i], pairs[i])
+		}
+	}
+	if s := pairs.ToHeader(); s != "8080:0,53:53/udp,10000-10009:20000-20009/udp,6000-6001:0" {
+		t.Errorf("Header did not round trip: %s", s)
+	}
+	if n := len(pairs.Expand()); n != 14 {
+		t.Errorf("Expected 14 expanded pairs, got %d", n)
+	}
+
+	bound, err := FromPortPairHeader("8080:0@10.0.0.5,53:5353@fd00::1/udp")
+	if err != nil {
+		t.Fatalf("Unable to parse header with addresses: %v", err)
+	}
+	if bound[0] != (PortPair{Internal: 8080, Address: "10.0.0.5"}) || bound[1] != (PortPair{Internal: 53, External: 5353, Protocol: UDP, Address: "fd00::1"}) {
+		t.Errorf("Unexpected pairs with addresses %+v", bound)
+	}
+	if s := bound.ToHeader(); s != "8080:0@10.0.0.5,53:5353@fd00::1/udp" {
+		t.Errorf("Header with addresses did not round trip: %s", s)
+	}
+	if s := bound[1].ExternalAddress(); s != "[fd00::1]:5353" {
+		t.Errorf("Unexpected external address %s", s)
+	}
+
+	pooled, err := FromPortPairHeader("8080:public,10-11:internal@10.0.0.5/udp")
+	if err != nil {
+		t.Fatalf("Unable to parse header with pools: %v", err)
+	}
+	if pooled[0] != (PortPair{Internal: 8080, Pool: "public"}) || pooled[1] != (PortPair{Internal: 10, Protocol: UDP, Count: 2, Address: "10.0.0.5", Pool: "internal"}) {
+		t.Errorf("Unexpected pairs with pools %+v", pooled)
+	}
+	if s := pooled.ToHeader(); s != "8080:public,10-11:internal@10.0.0.5/udp" {
+		t.Errorf("Header with pools did not round trip: %s", s)
+	}
+
+	for _, s := range []string{"53:53/sctp", "10-11:20-22", "20-10:0", "1-2000:0", "8080:0@eth0", "8080:pub!ic"} {
+		if _, err := FromPortPairHeader(s); err == nil {
+			t.Errorf("Expected '%s' to be rejected", s)
+		}
+	}
+}
@@ -4,17 +4,120 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 )
 
-var ErrAllocationFailed = errors.New("A port could not be allocated.")
-
 type PortReservation struct {
 	*PortAllocator
+	// The directory reservations are kept under
+	base string
+	// Allocators for the interfaces bound on a single address, by
+	// address
+	Interfaces map[string]*PortAllocator
+	// Allocators for the named pools of each interface, by address
+	// (empty for the default device) and then by name
+	Pools map[string]map[string]*PortAllocator
+}
+
+// Reserve ports on each of the interfaces of the host rooted at base.
+func NewPortReservation(base string, interfaces Interfaces) *PortReservation {
+	reservation := &PortReservation{
+		base:       base,
+		Interfaces: make(map[string]*PortAllocator),
+		Pools:      make(map[string]map[string]*PortAllocator),
+	}
+	interfaces = interfaces.WithDefault()
+	for i := range interfaces {
+		iface := &interfaces[i]
+		address := ""
+		if iface.Device != DefaultDevice {
+			address = net.ParseIP(iface.Address).String()
+		}
+		pools := make(map[string]*PortAllocator)
+		for _, name := range iface.PoolNames() {
+			allocator := NewInterfaceAllocator(base, iface, name)
+			switch {
+			case name != "":
+				pools[name] = allocator
+			case iface.Device == DefaultDevice:
+				reservation.PortAllocator = allocator
+			default:
+				reservation.Interfaces[address] = allocator
+			}
+		}
+		reservation.Pools[address] = pools
+	}
+	return reservation
+}
+
+// Find free ports on every interface and in every pool.
+func (a *PortReservation) Run() {
+	for _, allocator := range a.Interfaces {
+		go allocator.Run()
+	}
+	for _, pools := range a.Pools {
+		for _, allocator := range pools {
+			go allocator.Run()
+		}
+	}
+	a.PortAllocator.Run()
+}
+
+// The allocator for the named pool of the interface bound on address,
+// or of the default device if address is empty.  The empty pool is
+// the interface's own range.
+func (a *PortReservation) allocatorFor(address, pool string) (*PortAllocator, error) {
+	key, allocator := "", a.PortAllocator
+	if address != "" {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.New(fmt.Sprintf("No interface of this host is bound on the address %s", address))
+		}
+		found := false
+		key = ip.String()
+		if allocator, found = a.Interfaces[key]; !found {
+			return nil, errors.New(fmt.Sprintf("No interface of this host is bound on the address %s", address))
+		}
+	}
+	if pool == "" {
+		return allocator, nil
+	}
+	if allocator, found := a.Pools[key][pool]; found {
+		return allocator, nil
+	}
+	return nil, errors.New(fmt.Sprintf("The %s has no pool named '%s'", allocator, pool))
+}
+
+// The reservation of the same port on another interface, if the port
+// can't also be bound on allocator's interface.  The default device is
+// bound on every address, so its ports conflict with every interface.
+// Pools share the reservations of their interface.
+func (a *PortReservation) boundElsewhere(allocator *PortAllocator, protocol Protocol, p Port) (string, bool) {
+	others := []*PortAllocator{a.PortAllocator}
+	if allocator.device == a.PortAllocator.device {
+		others = others[:0]
+		for _, other := range a.Interfaces {
+			others = append(others, other)
+		}
+	}
+	for _, other := range others {
+		_, direct := other.protocolPathsFor(protocol, p)
+		if _, err := os.Lstat(direct); err == nil {
+			return direct, true
+		}
+	}
+	return "", false
 }
 
 func (a *PortReservation) AtomicReserveExternalPorts(path string, ports, existing PortPairs) (PortPairs, error) {
-	reservations, errp := ports.reserve()
+	unlock, errl := LockReservations(a.base)
+	if errl != nil {
+		return ports, errl
+	}
+	defer unlock()
+
+	reservations, errp := a.reservationsFor(ports)
 	if errp != nil {
 		return ports, errp
 	}
@@ -35,61 +138,89 @@ func (a *PortReservation) AtomicReserveExternalPorts(path string, ports, existin
 	if len(unreserve) > 0 {
 		log.Printf("ports: Releasing %v", unreserve)
 	}
-	a.ReleaseExternalPorts(unreserve) // Ignore errors
+	a.releaseExternalPorts(unreserve) // Ignore errors
 
 	return reserved, nil
 }
 
 func (a *PortReservation) ReleaseExternalPorts(ports PortPairs) error {
+	unlock, err := LockReservations(a.base)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return a.releaseExternalPorts(ports)
+}
+
+func (a *PortReservation) releaseExternalPorts(ports PortPairs) error {
 	var err error
 	for i := range ports {
-		_, direct := a.portPathsFor(ports[i].External)
-		path, errl := os.Readlink(direct)
-		if errl != nil {
-			if !os.IsNotExist(errl) {
-				// REPAIR: link can't be checked, may be broken
-				log.Printf("ports: Path cannot be checked: %v", errl)
-				err = errl
-			}
-			// the port is no longer reserved (link does not exist)
+		allocator, erra := a.allocatorFor(ports[i].Address, "")
+		if erra != nil {
+			log.Printf("ports: Unable to release %v: %v", ports[i], erra)
+			err = erra
 			continue
 		}
-		if _, errs := os.Stat(path); errs != nil {
-			if os.IsNotExist(errs) {
-				// referenced container does not exist, remove the link
-				os.Remove(direct)
-				continue
+		for n := uint(0); n < ports[i].Size(); n++ {
+			if errr := allocator.releasePort(ports[i].Protocol, ports[i].External+Port(n)); errr != nil {
+				err = errr
 			}
-			// REPAIR: can't read the referenced container
-			err = errs
-			continue
-		}
-		if errr := os.Remove(direct); errr != nil {
-			log.Printf("ports: Unable to remove symlink %v", errr)
-			err = errr
-			// REPAIR: reserved ports may not be properly released
-			continue
 		}
 	}
 	return err
 }
 
+func (a *PortAllocator) releasePort(protocol Protocol, p Port) error {
+	_, direct := a.protocolPathsFor(protocol, p)
+	path, errl := os.Readlink(direct)
+	if errl != nil {
+		if !os.IsNotExist(errl) {
+			// REPAIR: link can't be checked, may be broken
+			log.Printf("ports: Path cannot be checked: %v", errl)
+			return errl
+		}
+		// the port is no longer reserved (link does not exist)
+		return nil
+	}
+	if _, errs := os.Stat(path); errs != nil {
+		if os.IsNotExist(errs) {
+			// referenced container does not exist, remove the link
+			os.Remove(direct)
+			return nil
+		}
+		// REPAIR: can't read the referenced container
+		return errs
+	}
+	if errr := os.Remove(direct); errr != nil {
+		log.Printf("ports: Unable to remove symlink %v", errr)
+		// REPAIR: reserved ports may not be properly released
+		return errr
+	}
+	return nil
+}
+
 type portReservation struct {
 	PortPair
+	allocator *PortAllocator
 	reserved  bool
-	allocated bool
+	allocated uint
 	exists    bool
 }
 
 type portReservations []portReservation
 
-// Reserve any unspecified external ports or return an error
-// if no ports are available.
-func (p PortPairs) reserve() (portReservations, error) {
+// Find the interface each pair is bound on or return an error if
+// no interface has the requested address.
+func (a *PortReservation) reservationsFor(p PortPairs) (portReservations, error) {
 	reservation := make(portReservations, len(p))
 	for i := range p {
 		res := &reservation[i]
 		res.PortPair = p[i]
+		allocator, err := a.allocatorFor(p[i].Address, p[i].Pool)
+		if err != nil {
+			return nil, err
+		}
+		res.allocator = allocator
 	}
 	return reservation, nil
 }
@@ -99,32 +230,42 @@ func (p PortPairs) reserve() (portReservations, error) {
 // created links.
 func (a *PortReservation) reserve(path string, p portReservations) error {
 	var err error
+Reserve:
 	for i := range p {
 		res := &p[i]
-		if !res.exists {
-			parent, direct := a.portPathsFor(res.External)
+		if res.exists {
+			continue
+		}
+		for n := uint(0); n < res.Size(); n++ {
+			parent, direct := res.allocator.protocolPathsFor(res.Protocol, res.External+Port(n))
+			if other, found := a.boundElsewhere(res.allocator, res.Protocol, res.External+Port(n)); found {
+				err = errors.New(fmt.Sprintf("The port %d/%s is already bound on another interface", res.External+Port(n), res.Protocol))
+				log.Printf("ports: the reservation failed because %s exists", other)
+				break Reserve
+			}
 			os.MkdirAll(parent, 0770)
-			err = os.Symlink(path, direct)
-			if os.IsExist(err) {
-				if existing, err := os.Readlink(direct); err == nil {
-					log.Printf("ports: the reservation failed because the link %s points to %s", direct, existing)
+			if err = os.Symlink(path, direct); err != nil {
+				if os.IsExist(err) {
+					if existing, errl := os.Readlink(direct); errl == nil {
+						log.Printf("ports: the reservation failed because the link %s points to %s", direct, existing)
+					}
+				} else {
+					log.Printf("ports: Failed to reserve %d/%s, rolling back: %v", res.External+Port(n), res.Protocol, err)
 				}
-			} else if err != nil {
-				log.Printf("ports: Failed to reserve %d, rolling back: %v", res.External, err)
-				break
+				break Reserve
 			}
-			res.allocated = true
+			res.allocated += 1
 		}
 	}
 
 	if err != nil {
 		for i := range p {
 			res := &p[i]
-			if res.allocated {
-				_, direct := a.portPathsFor(res.External)
-				if errr := os.Remove(direct); errr == nil {
-					log.Printf("ports: Unable to rollback allocation %d: %v", res.External, err)
-					res.allocated = false
+			for ; res.allocated > 0; res.allocated-- {
+				_, direct := res.allocator.protocolPathsFor(res.Protocol, res.External+Port(res.allocated-1))
+				if errr := os.Remove(direct); errr != nil {
+					log.Printf("ports: Unable to rollback allocation %d/%s: %v", res.External+Port(res.allocated-1), res.Protocol, errr)
+					break
 				}
 			}
 		}
@@ -134,6 +275,21 @@ func (a *PortReservation) reserve(path string, p portReservations) error {
 	return nil
 }
 
+// True if every port of the pair is reserved on disk.
+func (a *PortReservation) reservedOnDisk(pair PortPair) bool {
+	allocator, err := a.allocatorFor(pair.Address, "")
+	if err != nil {
+		return false
+	}
+	for n := uint(0); n < pair.Size(); n++ {
+		_, direct := allocator.protocolPathsFor(pair.Protocol, pair.External+Port(n))
+		if _, err := os.Stat(direct); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 // Use existing port pairs where possible instead of allocating new ports.
 func (a *PortReservation) reuse(existing PortPairs, p portReservations) (PortPairs, error) {
 	unreserve := make(PortPairs, 0, 4)
@@ -142,25 +298,26 @@ func (a *PortReservation) reuse(existing PortPairs, p portReservations) (PortPai
 		matched := false
 		for i := range p {
 			res := &p[i]
-			if res.Internal == ex.Internal {
+			if res.Internal == ex.Internal && res.Protocol.Equal(ex.Protocol) {
 				if res.exists {
-					return unreserve, errors.New(fmt.Sprintf("The internal port %d is allocated to more than one external port.", res.Internal))
+					return unreserve, errors.New(fmt.Sprintf("The internal port %d/%s is allocated to more than one external port.", res.Internal, res.Protocol))
 				}
-				if res.External == 0 {
-					// Use an already allocated port
+				if !sameAddress(res.Address, ex.Address) {
+					// Moved to another interface
+					unreserve = append(unreserve, *ex)
+				} else if res.External == 0 && res.Size() == ex.Size() && (res.Pool == "" || res.allocator.ranges.Contains(ex.External, ex.Size())) {
+					// Use an already allocated port, unless it came
+					// from another pool than the one requested
 					res.External = ex.External
 					res.exists = true
-				} else if res.External != ex.External {
-					unreserve = append(unreserve, PortPair{0, ex.External})
+				} else if res.External != ex.External || res.Size() != ex.Size() {
+					unreserve = append(unreserve, PortPair{External: ex.External, Protocol: ex.Protocol, Count: ex.Count, Address: ex.Address})
 				} else {
 					res.exists = true
 				}
-				if res.exists {
-					_, direct := a.portPathsFor(ex.External)
-					if _, err := os.Stat(direct); err != nil {
-						res.External = 0
-						res.exists = false
-					}
+				if res.exists && !a.reservedOnDisk(*ex) {
+					res.External = 0
+					res.exists = false
 				}
 				matched = true
 			}
@@ -172,12 +329,20 @@ func (a *PortReservation) reuse(existing PortPairs, p portReservations) (PortPai
 	for i := range p {
 		res := &p[i]
 		if res.External == 0 {
-			res.External = a.allocatePort()
-			if res.External == 0 {
-				return unreserve, ErrAllocationFailed
+			external, err := res.allocator.allocatePorts(res.Size())
+			if err != nil {
+				return unreserve, err
 			}
+			res.External = external
 			res.reserved = true
 		}
 	}
 	return unreserve, nil
 }
+
+func sameAddress(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	return net.ParseIP(a).Equal(net.ParseIP(b))
+}
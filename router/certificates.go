@@ -0,0 +1,163 @@
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrCertificateExists   = errors.New("router: a certificate is already installed for the alias")
+	ErrCertificateNotFound = errors.New("router: no certificate is installed for the alias")
+)
+
+// How long before expiry a certificate is reported as expiring.
+const DefaultCertificateExpiryWarning = 30 * 24 * time.Hour
+
+// Check that the certificate and private key are PEM encoded, belong
+// together, are valid for alias, and have not expired, and return the
+// certificate to store for alias.
+func NewCertificate(alias string, contents, privateKey []byte, password string) (Certificate, error) {
+	key, err := decryptPrivateKey(privateKey, password)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	pair, err := tls.X509KeyPair(contents, key)
+	if err != nil {
+		return Certificate{}, errors.New(fmt.Sprintf("The certificate and private key do not match: %s", err.Error()))
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return Certificate{}, errors.New(fmt.Sprintf("The certificate could not be parsed: %s", err.Error()))
+	}
+	if err := leaf.VerifyHostname(alias); err != nil {
+		return Certificate{}, errors.New(fmt.Sprintf("The certificate is not valid for %s: %s", alias, err.Error()))
+	}
+	if now := time.Now(); now.After(leaf.NotAfter) {
+		return Certificate{}, errors.New(fmt.Sprintf("The certificate expired on %s", leaf.NotAfter.Format(time.RFC3339)))
+	}
+
+	return Certificate{
+		Id:         alias,
+		Contents:   contents,
+		PrivateKey: key,
+		Subject:    leaf.Subject.CommonName,
+		NotAfter:   leaf.NotAfter,
+	}, nil
+}
+
+// The PEM encoded private key, decrypted with password if one is given.
+func decryptPrivateKey(privateKey []byte, password string) ([]byte, error) {
+	if password == "" {
+		return privateKey, nil
+	}
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("The private key is not PEM encoded")
+	}
+	der, err := x509.DecryptPEMBlock(block, []byte(password))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("The private key could not be decrypted: %s", err.Error()))
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+}
+
+// The certificate followed by its private key, the form proxies read
+// from disk.
+func (c *Certificate) PEM(key []byte) []byte {
+	data := make([]byte, 0, len(c.Contents)+len(key)+1)
+	data = append(data, c.Contents...)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	return append(data, key...)
+}
+
+// True if the certificate expires within the given duration.
+func (c *Certificate) ExpiresWithin(d time.Duration) bool {
+	return !c.NotAfter.IsZero() && time.Now().Add(d).After(c.NotAfter)
+}
+
+// Install a certificate for one of the frontend's aliases.  An
+// existing certificate for the alias is only replaced if replace is
+// true.
+func (a *Frontend) AddCertificate(cert Certificate, replace bool) error {
+	if exists(a.HostAliases, cert.Id) == -1 {
+		return ErrAliasNotFound
+	}
+	if _, found := a.Certificates[cert.Id]; found && !replace {
+		return ErrCertificateExists
+	}
+	if a.Certificates == nil {
+		a.Certificates = make(map[string]Certificate)
+	}
+	a.Certificates[cert.Id] = cert
+	a.syncBackendCertificates()
+	return nil
+}
+
+// Remove the certificate of an alias.  Returns false if none is
+// installed.
+func (a *Frontend) RemoveCertificate(alias string) bool {
+	if _, found := a.Certificates[alias]; !found {
+		return false
+	}
+	delete(a.Certificates, alias)
+	a.syncBackendCertificates()
+	return true
+}
+
+// The certificates of the frontend ordered by alias.
+func (a *Frontend) SortedCertificates() []Certificate {
+	aliases := make([]string, 0, len(a.Certificates))
+	for alias := range a.Certificates {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	certs := make([]Certificate, 0, len(aliases))
+	for _, alias := range aliases {
+		certs = append(certs, a.Certificates[alias])
+	}
+	return certs
+}
+
+// Give every backend that terminates TLS at the router the
+// certificates of the frontend, which is where the router container
+// reads them from.
+func (a *Frontend) syncBackendCertificates() {
+	certs := a.SortedCertificates()
+	for id, be := range a.BeTable {
+		if be.SslTerm == TERM_GEAR || len(certs) == 0 {
+			be.Certificates = nil
+		} else {
+			be.Certificates = certs
+		}
+		a.BeTable[id] = be
+	}
+}
+
+// Install a certificate and save its private key in Routes.Keys.
+func AddCertificate(frontendname string, cert Certificate, replace bool) error {
+	key := cert.PrivateKey
+	cert.PrivateKey = nil
+	return updateFrontendAlias(frontendname, cert.Id, false, func(a *Frontend) error {
+		if err := a.AddCertificate(cert, replace); err != nil {
+			return err
+		}
+		return Routes.Keys.Write(cert.Id, key)
+	})
+}
+
+func DeleteCertificate(frontendname string, alias string) error {
+	return updateFrontend(frontendname, false, func(a *Frontend) error {
+		if !a.RemoveCertificate(alias) {
+			return ErrCertificateNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T, host string, notAfter time.Time) (cert, key []byte, priv *rsa.PrivateKey) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return
+}
+
+func TestNewCertificate(t *testing.T) {
+	valid := time.Now().Add(90 * 24 * time.Hour)
+	cert, key, priv := testCertificate(t, "www.example.com", valid)
+
+	c, err := NewCertificate("www.example.com", cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Id != "www.example.com" || c.Subject != "www.example.com" || !c.NotAfter.Equal(valid.Truncate(time.Second)) {
+		t.Errorf("Unexpected certificate details: %s %s %v", c.Id, c.Subject, c.NotAfter)
+	}
+	if c.ExpiresWithin(DefaultCertificateExpiryWarning) || !c.ExpiresWithin(100*24*time.Hour) {
+		t.Errorf("Unexpected expiry warning for %v", c.NotAfter)
+	}
+
+	if _, err := NewCertificate("api.example.com", cert, key, ""); err == nil {
+		t.Error("Expected a certificate for another host to be rejected")
+	}
+	_, otherKey, _ := testCertificate(t, "www.example.com", valid)
+	if _, err := NewCertificate("www.example.com", cert, otherKey, ""); err == nil {
+		t.Error("Expected a certificate with the wrong key to be rejected")
+	}
+	expiredCert, expiredKey, _ := testCertificate(t, "www.example.com", time.Now().Add(-time.Hour))
+	if _, err := NewCertificate("www.example.com", expiredCert, expiredKey, ""); err == nil {
+		t.Error("Expected an expired certificate to be rejected")
+	}
+
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv), []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := pem.EncodeToMemory(block)
+	if _, err := NewCertificate("www.example.com", cert, encrypted, "secret"); err != nil {
+		t.Errorf("Expected an encrypted key to be accepted with its password: %v", err)
+	}
+	if _, err := NewCertificate("www.example.com", cert, encrypted, "wrong"); err == nil {
+		t.Error("Expected an encrypted key to be rejected with the wrong password")
+	}
+}
+
+func TestFrontendCertificates(t *testing.T) {
+	a := testFrontend()
+	a.AddAlias("www.example.com")
+	edge := a.AddBackend("/", "/", nil)
+	passthrough := a.AddBackend("/secure", "/", nil)
+	be := a.BeTable[passthrough]
+	be.SslTerm = TERM_GEAR
+	a.BeTable[passthrough] = be
+
+	cert := Certificate{Id: "www.example.com"}
+	if err := a.AddCertificate(Certificate{Id: "api.example.com"}, false); err != ErrAliasNotFound {
+		t.Errorf("Expected a certificate for an unknown alias to be rejected: %v", err)
+	}
+	if err := a.AddCertificate(cert, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddCertificate(cert, false); err != ErrCertificateExists {
+		t.Errorf("Expected an existing certificate to require replace: %v", err)
+	}
+	if err := a.AddCertificate(cert, true); err != nil {
+		t.Errorf("Expected the certificate to be replaced: %v", err)
+	}
+	if len(a.BeTable[edge].Certificates) != 1 || len(a.BeTable[passthrough].Certificates) != 0 {
+		t.Errorf("Expected only backends terminating TLS at the router to get certificates: %+v", a.BeTable)
+	}
+
+	if !a.RemoveAlias("www.example.com") {
+		t.Fatal("Expected the alias to be removed")
+	}
+	if len(a.Certificates) != 0 || len(a.BeTable[edge].Certificates) != 0 {
+		t.Errorf("Expected removing the alias to remove its certificate: %+v", a)
+	}
+}
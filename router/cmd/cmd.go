@@ -3,18 +3,30 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	. "github.com/openshift/geard/cmd"
 	"github.com/openshift/geard/router"
 	rjobs "github.com/openshift/geard/router/jobs"
 	"github.com/openshift/geard/transport"
 	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"strings"
 )
 
 type Command struct {
 	Transport *transport.TransportFlag
 }
 
+var (
+	replaceCertificate   bool
+	certificatePassword  string
+	expiringDays         int
+	proxyCertificateDir  string
+	proxyReload          string
+	proxyReset           bool
+	renderCertificateDir string
+)
+
 func (e *Command) RegisterRouterCmds(parent *cobra.Command) {
 	routerCmd := &cobra.Command{
 		Use:   "router",
@@ -44,6 +56,13 @@ func (e *Command) RegisterRouterCmds(parent *cobra.Command) {
 	}
 	routerCmd.AddCommand(testCmd)
 
+	testCmd = &cobra.Command{
+		Use:   "delete-alias",
+		Short: "Remove an alias from a given frontend ([<host>/]<id> <alias>).",
+		Run:   e.removeAlias,
+	}
+	routerCmd.AddCommand(testCmd)
+
 	testCmd = &cobra.Command{
 		Use:   "delete-frontend",
 		Short: "Delete an existing frontend from the router.",
@@ -60,23 +79,65 @@ func (e *Command) RegisterRouterCmds(parent *cobra.Command) {
 
 	testCmd = &cobra.Command{
 		Use:   "delete-route",
-		Short: "Remove an existing Endpoint from an existing frontend. Takes two arguments - [<frontendname> <endpoint-id>]. To get the endpoint-id to remove use print-routes <frontendname>",
+		Short: "Remove an existing Endpoint from an existing frontend. Takes two arguments - [<host>/]<frontendname> <endpoint-id>. Backends left without endpoints are removed. To get the endpoint-id to remove use print-routes <frontendname>",
 		Run:   e.removeRoute,
 	}
 	routerCmd.AddCommand(testCmd)
 
 	testCmd = &cobra.Command{
 		Use:   "add-backend",
-		Short: "Add a new endpoint to an existing frontend for the router to load balance.",
-		Run:   addBackend,
+		Short: "Add a backend without endpoints to an existing frontend ([<host>/]<id> [<frontend-path> [<backend-path> [<protocol>...]]]).",
+		Run:   e.addBackend,
 	}
 	routerCmd.AddCommand(testCmd)
 
 	testCmd = &cobra.Command{
 		Use:   "remove-backend",
-		Short: "Remove an existing endpoint from an existing frontend of the router.",
-		Run:   removeBackend,
+		Short: "Remove an existing backend from an existing frontend ([<host>/]<id> <backend-id>). Endpoints only used by the backend are removed.",
+		Run:   e.removeBackend,
+	}
+	routerCmd.AddCommand(testCmd)
+
+	testCmd = &cobra.Command{
+		Use:   "add-certificate",
+		Short: "Install a TLS certificate for an alias of a frontend ([<host>/]<id> <alias> <certificate-file> <key-file>). The certificate must match the key, be valid for the alias, and not be expired.",
+		Run:   e.addCertificate,
 	}
+	testCmd.Flags().BoolVar(&replaceCertificate, "replace", false, "Replace the certificate already installed for the alias")
+	testCmd.Flags().StringVar(&certificatePassword, "password", "", "The password of an encrypted private key")
+	routerCmd.AddCommand(testCmd)
+
+	testCmd = &cobra.Command{
+		Use:   "delete-certificate",
+		Short: "Remove the TLS certificate of an alias of a frontend ([<host>/]<id> <alias>).",
+		Run:   e.removeCertificate,
+	}
+	routerCmd.AddCommand(testCmd)
+
+	testCmd = &cobra.Command{
+		Use:   "list-certificates",
+		Short: "List the TLS certificates of one or more frontends ([<host>/]<id>...) and report those that are expiring.",
+		Run:   e.listCertificates,
+	}
+	testCmd.Flags().IntVar(&expiringDays, "expiring", 30, "Report certificates that expire within this many days")
+	routerCmd.AddCommand(testCmd)
+
+	testCmd = &cobra.Command{
+		Use:   "configure-proxy",
+		Short: "Render the routes for a locally installed proxy (<haproxy|nginx> <config-file>) instead of signaling the router container.",
+		Run:   e.configureProxy,
+	}
+	testCmd.Flags().StringVar(&proxyCertificateDir, "certificate-dir", "", "Where to write certificates, defaults to 'certs' next to the config file")
+	testCmd.Flags().StringVar(&proxyReload, "reload", "", "The command that reloads the proxy, e.g. 'systemctl reload haproxy'")
+	testCmd.Flags().BoolVar(&proxyReset, "reset", false, "Stop rendering for a local proxy and signal the router container again")
+	routerCmd.AddCommand(testCmd)
+
+	testCmd = &cobra.Command{
+		Use:   "render-proxy",
+		Short: "Print the proxy configuration for the local routes (<haproxy|nginx>).",
+		Run:   e.renderProxy,
+	}
+	testCmd.Flags().StringVar(&renderCertificateDir, "certificate-dir", "/etc/geard/router/certs", "The directory the configuration expects certificates in")
 	routerCmd.AddCommand(testCmd)
 
 	testCmd = &cobra.Command{
@@ -93,10 +154,12 @@ func (e *Command) test(cmd *cobra.Command, args []string) {
 	alias := "www.alias.com"
 	router.CreateFrontend(frontendname, alias)
 
-	// empty the global datastucture and re-read to confirm that correct output has been generated
-	router.GlobalRoutes = nil
-	router.ReadRoutes()
-	frontend, ok := router.GlobalRoutes[frontendname]
+	// re-read the routes from disk to confirm that correct output has been generated
+	if err := router.Routes.Load(); err != nil {
+		fmt.Printf("Test failed. Routes could not be read: %s\n", err.Error())
+		return
+	}
+	frontend, ok := router.Routes.Frontend(frontendname)
 	if !ok {
 		fmt.Println("Test failed. Frontend created was not persisted.")
 		return
@@ -114,10 +177,12 @@ func (e *Command) test(cmd *cobra.Command, args []string) {
 	endpoints[0] = s
 	router.AddRoute(frontendname, "", "", nil, endpoints)
 
-	// empty the db again and check for routes
-	router.GlobalRoutes = nil
-	router.ReadRoutes()
-	frontend, ok = router.GlobalRoutes[frontendname]
+	// re-read the routes again and check for routes
+	if err := router.Routes.Load(); err != nil {
+		fmt.Printf("Test failed. Routes could not be read: %s\n", err.Error())
+		return
+	}
+	frontend, ok = router.Routes.Frontend(frontendname)
 	if !ok {
 		fmt.Println("Test failed. Frontend created was not persisted.")
 		return
@@ -135,7 +200,7 @@ func (e *Command) test(cmd *cobra.Command, args []string) {
 
 	// good so far, now delete the testfrontend
 	router.DeleteFrontend(frontendname)
-	_, ok = router.GlobalRoutes[frontendname]
+	_, ok = router.Routes.Frontend(frontendname)
 	if ok {
 		fmt.Println("Test failed. Frontend deletion does not actually remove the frontend from the routing table.")
 	}
@@ -248,16 +313,93 @@ func (e *Command) addRoute(cmd *cobra.Command, args []string) {
 	// router.AddRoute(r.Frontend, r.FrontendPath, r.BackendPath, r.Protocols, r.Endpoints)
 }
 
-func addBackend(cmd *cobra.Command, args []string) {
-	fmt.Println("Adding a backend")
-	fmt.Println(args)
-	// TODO
+func (e *Command) addBackend(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		fmt.Println("At least one argument expected for add-backend (<frontendname> [<frontend-path> [<backend-path> [<protocol>...]]])")
+		return
+	}
+	fePath, bePath := "/", "/"
+	if len(args) > 1 {
+		fePath = args[1]
+	}
+	if len(args) > 2 {
+		bePath = args[2]
+	}
+	var protocols []string
+	if len(args) > 3 {
+		protocols = args[3:]
+	}
+
+	t := e.Transport.Get()
+	id, err := NewResourceLocator(t, "router", args[0])
+	if err != nil {
+		fmt.Println("frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+		return
+	}
+
+	Executor{
+		On: Locators{id},
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.AddBackendRequest{
+				Frontend:     on.(*ResourceLocator).Id,
+				FrontendPath: fePath,
+				BackendPath:  bePath,
+				Protocols:    protocols,
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
 }
 
-func removeBackend(cmd *cobra.Command, args []string) {
-	fmt.Println("Removing a backend")
-	fmt.Println(args)
-	// TODO
+func (e *Command) removeBackend(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Two arguments needed for removing a backend (<frontendname> <backend-id>).")
+		return
+	}
+	t := e.Transport.Get()
+	id, err := NewResourceLocator(t, "router", args[0])
+	if err != nil {
+		fmt.Println("frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+		return
+	}
+
+	Executor{
+		On: Locators{id},
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.DeleteBackendRequest{
+				Frontend:  on.(*ResourceLocator).Id,
+				BackendId: args[1],
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
+}
+
+func (e *Command) removeAlias(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Two arguments needed for removing an alias (<frontendname> <alias>).")
+		return
+	}
+	t := e.Transport.Get()
+	id, err := NewResourceLocator(t, "router", args[0])
+	if err != nil {
+		fmt.Println("frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+		return
+	}
+
+	Executor{
+		On: Locators{id},
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.DeleteAliasRequest{
+				Frontend: on.(*ResourceLocator).Id,
+				Alias:    args[1],
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
 }
 
 func (e *Command) removeFrontend(cmd *cobra.Command, args []string) {
@@ -284,42 +426,178 @@ func (e *Command) removeFrontend(cmd *cobra.Command, args []string) {
 	}.StreamAndExit()
 }
 
-func exists(s []string, e string) int {
-	for i, a := range s {
-		if a == e {
-			return i
-		}
+func (e *Command) removeRoute(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Two string arguments to delete-route needed (<frontendname> <route-id>)")
+		return
+	}
+	t := e.Transport.Get()
+	id, err := NewResourceLocator(t, "router", args[0])
+	if err != nil {
+		fmt.Println("frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+		return
 	}
-	return -1
+
+	Executor{
+		On: Locators{id},
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.DeleteRouteRequest{
+				Frontend:   on.(*ResourceLocator).Id,
+				EndpointId: args[1],
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
 }
 
-func (e *Command) removeRoute(cmd *cobra.Command, args []string) {
+func (e *Command) addCertificate(cmd *cobra.Command, args []string) {
+	if len(args) != 4 {
+		Fail(1, "Valid arguments: <frontendname> <alias> <certificate-file> <key-file>")
+	}
+	certificate, err := ioutil.ReadFile(args[2])
+	if err != nil {
+		Fail(1, "Unable to read the certificate: %s", err.Error())
+	}
+	key, err := ioutil.ReadFile(args[3])
+	if err != nil {
+		Fail(1, "Unable to read the private key: %s", err.Error())
+	}
+	t := e.Transport.Get()
+	id, err := NewResourceLocator(t, "router", args[0])
+	if err != nil {
+		Fail(1, "frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+	}
+
+	Executor{
+		On: Locators{id},
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.AddCertificateRequest{
+				Frontend:           on.(*ResourceLocator).Id,
+				Alias:              args[1],
+				Certificate:        string(certificate),
+				PrivateKey:         string(key),
+				PrivateKeyPassword: certificatePassword,
+				Replace:            replaceCertificate,
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
+}
+
+func (e *Command) removeCertificate(cmd *cobra.Command, args []string) {
 	if len(args) != 2 {
-		fmt.Println("Two string arguments to remove-route needed (<frontendname> <route-id>)")
-		return
+		Fail(1, "Valid arguments: <frontendname> <alias>")
+	}
+	t := e.Transport.Get()
+	id, err := NewResourceLocator(t, "router", args[0])
+	if err != nil {
+		Fail(1, "frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+	}
+
+	Executor{
+		On: Locators{id},
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.DeleteCertificateRequest{
+				Frontend: on.(*ResourceLocator).Id,
+				Alias:    args[1],
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.StreamAndExit()
+}
+
+func (e *Command) listCertificates(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		Fail(1, "Valid arguments: <frontendname>...")
+	}
+	t := e.Transport.Get()
+	ids, err := NewResourceLocators(t, "router", args...)
+	if err != nil {
+		Fail(1, "frontendname should be either <host>/<name> or <name>. Where <host> is remote address of where the router resides.")
+	}
+
+	data, errors := Executor{
+		On: ids,
+		Serial: func(on Locator) JobRequest {
+			return &rjobs.ListCertificatesRequest{
+				Frontend:     on.(*ResourceLocator).Id,
+				ExpiringDays: expiringDays,
+			}
+		},
+		Output:    os.Stdout,
+		Transport: t,
+	}.Gather()
+
+	combined := rjobs.ListCertificatesResponse{}
+	for i := range data {
+		if r, ok := data[i].(*rjobs.ListCertificatesResponse); ok {
+			combined.Append(r)
+		}
+	}
+	combined.WriteTableTo(os.Stdout)
+	if expiring := combined.Expiring(); len(expiring) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d certificate(s) expire within %d days\n", len(expiring), expiringDays)
 	}
-	frontendname := args[0]
-	epid := args[1]
-
-	fmt.Printf("Deleting route %s from %s\n", epid, frontendname)
-	delete(router.GlobalRoutes[frontendname].EndpointTable, epid)
-
-	for _, be := range router.GlobalRoutes[frontendname].BeTable {
-		i := exists(be.EndpointIds, epid)
-		fmt.Printf("Deleting route %s from be_table, %d\n", epid, i)
-		if i != -1 {
-			// Bug here : https://code.google.com/p/go/issues/detail?id=3117
-			// router.GlobalRoutes[frontendname].BeTable[be_id].EndpointIds = a
-			//
-			a := be.EndpointIds
-			a[len(a)-1], a[i], a = "", a[len(a)-1], a[:len(a)-1]
-			be.EndpointIds = a
-			fmt.Printf("Deletion successful\n")
-			break
+	if len(errors) > 0 {
+		for i := range errors {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors[i])
+		}
+		os.Exit(1)
+	}
+}
+
+func (e *Command) configureProxy(cmd *cobra.Command, args []string) {
+	if proxyReset {
+		if len(args) != 0 {
+			Fail(1, "No arguments are accepted with --reset")
+		}
+		if err := router.WriteProxySettings(nil); err != nil {
+			Fail(1, "Unable to remove the proxy settings: %s", err.Error())
 		}
+		fmt.Println("Routes will be loaded by the router container")
+		return
+	}
+	if len(args) != 2 {
+		Fail(1, "Valid arguments: <haproxy|nginx> <config-file>")
+	}
+	settings := &router.ProxySettings{
+		Type:           args[0],
+		ConfigPath:     args[1],
+		CertificateDir: proxyCertificateDir,
+		ReloadCommand:  strings.Fields(proxyReload),
+	}
+	if err := settings.Check(); err != nil {
+		Fail(1, "%s", err.Error())
+	}
+	if err := router.WriteProxySettings(settings); err != nil {
+		Fail(1, "Unable to save the proxy settings: %s", err.Error())
+	}
+	routes, _ := router.Routes.Snapshot()
+	if err := settings.Proxy().Apply(routes); err != nil {
+		Fail(1, "Unable to update the proxy: %s", err.Error())
+	}
+	fmt.Printf("Routes will be rendered for %s to %s\n", settings.Type, settings.ConfigPath)
+}
+
+func (e *Command) renderProxy(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		Fail(1, "Valid arguments: <haproxy|nginx>")
+	}
+	renderer, ok := router.Renderers[args[0]]
+	if !ok {
+		Fail(1, "Unknown proxy type %s", args[0])
+	}
+	routes, _ := router.Routes.Snapshot()
+	config, err := router.NewProxyConfig(routes, router.Routes.Keys, renderCertificateDir)
+	if err != nil {
+		Fail(1, "%s", err.Error())
+	}
+	if err := renderer.Render(os.Stdout, config); err != nil {
+		Fail(1, "Unable to render the configuration: %s", err.Error())
 	}
-	router.WriteRoutes()
-	router.BumpRouter()
 }
 
 func (e *Command) printFrontendRoutes(cmd *cobra.Command, args []string) {
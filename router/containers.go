@@ -0,0 +1,141 @@
+package router
+
+import (
+	"errors"
+	"net"
+
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/port"
+)
+
+// Returned from an update that made no changes so nothing is written.
+var errUnchanged = errors.New("router: no routes changed")
+
+// The address the router reaches containers on this host at.  When
+// empty the first non-loopback IPv4 address of the host is used.
+var EndpointHost string
+
+func endpointHost() string {
+	if EndpointHost != "" {
+		return EndpointHost
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// The endpoint of the container that a route sends requests to.
+func routeEndpoint(route *containers.Route, ports port.PortPairs, host string) (Endpoint, bool) {
+	pair, found := route.PortFrom(ports)
+	if !found || pair.External.Default() {
+		return Endpoint{}, false
+	}
+	if pair.Address != "" {
+		// only reachable on the address it is bound on
+		host = pair.Address
+	}
+	return Endpoint{IP: host, Port: pair.External.String()}, true
+}
+
+func defaultPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// Add the container to the frontend of the route.
+func (a *Frontend) addContainerRoute(route *containers.Route, ep Endpoint) {
+	if a.HostAliases == nil {
+		a.HostAliases = []string{}
+	}
+	for _, host := range route.Hosts {
+		a.AddAlias(host)
+	}
+	be_id := a.AddBackend(defaultPath(route.FrontendPath), defaultPath(route.BackendPath), route.Protocols)
+	be := a.BeTable[be_id]
+	if route.SslTerm != "" && route.SslTerm != be.SslTerm {
+		be.SslTerm = route.SslTerm
+		a.BeTable[be_id] = be
+		a.syncBackendCertificates()
+	}
+	a.addBackendEndpoint(be_id, a.AddEndpoint(ep))
+}
+
+// Remove the container's endpoint from the frontend of the route.
+// Returns false if it was not registered.
+func (a *Frontend) removeContainerRoute(ep Endpoint) bool {
+	for id, existing := range a.EndpointTable {
+		if existing.IP == ep.IP && existing.Port == ep.Port {
+			return a.RemoveEndpoint(id)
+		}
+	}
+	return false
+}
+
+// Register the routes stored for a container with the router, using
+// the external ports reserved for the container.
+func RegisterContainer(id containers.Identifier) error {
+	return updateContainerRoutes(id, true)
+}
+
+// Remove the container's endpoints from the router.  Backends left
+// without endpoints are removed.
+func DeregisterContainer(id containers.Identifier) error {
+	return updateContainerRoutes(id, false)
+}
+
+func updateContainerRoutes(id containers.Identifier, register bool) error {
+	routes, err := containers.ReadRoutes(id.RoutesPathFor())
+	if err != nil || len(routes) == 0 {
+		return err
+	}
+	ports, err := containers.GetExistingPorts(id)
+	if err != nil {
+		return err
+	}
+	host := endpointHost()
+
+	changed := false
+	_, err = Routes.Update(func(table RouteTable) error {
+		for i := range routes {
+			route := &routes[i]
+			ep, found := routeEndpoint(route, ports, host)
+			if !found {
+				continue
+			}
+			name := route.FrontendName()
+			a, exists := table[name]
+			if !register && !exists {
+				continue
+			}
+			a.Name = name
+			a.Init()
+			if register {
+				a.addContainerRoute(route, ep)
+			} else if !a.removeContainerRoute(ep) {
+				continue
+			}
+			table[name] = a
+			changed = true
+		}
+		if !changed {
+			return errUnchanged
+		}
+		return nil
+	})
+	switch {
+	case err == errUnchanged:
+		return nil
+	case err != nil:
+		return err
+	}
+	BumpRouter()
+	return nil
+}
@@ -0,0 +1,38 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/port"
+)
+
+func TestContainerRoutes(t *testing.T) {
+	ports := port.PortPairs{{Internal: 8080, External: 4001}}
+	route := &containers.Route{Hosts: []string{"www.example.com", "example.com"}, SslTerm: TERM_GEAR}
+
+	a := testFrontend()
+	first, _ := routeEndpoint(route, ports, "10.0.0.1")
+	second, _ := routeEndpoint(route, ports, "10.0.0.2")
+	a.addContainerRoute(route, first)
+	a.addContainerRoute(route, second)
+
+	if len(a.HostAliases) != 2 || len(a.BeTable) != 1 || len(a.EndpointTable) != 2 {
+		t.Fatalf("Expected both instances behind one backend: %+v", a)
+	}
+	for _, be := range a.BeTable {
+		if be.FePath != "/" || be.BePath != "/" || be.SslTerm != TERM_GEAR || len(be.EndpointIds) != 2 {
+			t.Errorf("Unexpected backend: %+v", be)
+		}
+	}
+
+	if !a.removeContainerRoute(first) || a.removeContainerRoute(first) {
+		t.Error("Expected the endpoint to be removed once")
+	}
+	if !a.removeContainerRoute(second) {
+		t.Fatal("Expected the second endpoint to be removed")
+	}
+	if len(a.BeTable) != 0 || len(a.EndpointTable) != 0 {
+		t.Errorf("Expected the backend to be removed with its last endpoint: %+v", a)
+	}
+}
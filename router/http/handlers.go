@@ -5,6 +5,7 @@ import (
 	"io"
 
         "fmt"
+	"strconv"
 	"github.com/openshift/geard/router/http/remote"
 	"github.com/openshift/geard/jobs"
 	rjobs "github.com/openshift/geard/router/jobs"
@@ -23,6 +24,12 @@ func (h *HttpExtension) Routes() http.ExtensionMap {
 		&remote.HttpRouterDeleteFrontendRequest{}: HandleRouterDeleteFrontendRequest,
 		&remote.HttpRouterDeleteRouteRequest{}: HandleRouterDeleteRouteRequest,
 		&remote.HttpRouterGetRoutesRequest{}: HandleRouterGetRoutesRequest,
+		&remote.HttpRouterDeleteAliasRequest{}: HandleRouterDeleteAliasRequest,
+		&remote.HttpRouterAddBackendRequest{}: HandleRouterAddBackendRequest,
+		&remote.HttpRouterDeleteBackendRequest{}: HandleRouterDeleteBackendRequest,
+		&remote.HttpRouterAddCertificateRequest{}: HandleRouterAddCertificateRequest,
+		&remote.HttpRouterDeleteCertificateRequest{}: HandleRouterDeleteCertificateRequest,
+		&remote.HttpRouterListCertificatesRequest{}: HandleRouterListCertificatesRequest,
 	}
 }
 
@@ -94,3 +101,55 @@ func HandleRouterAddAliasRequest(conf *http.HttpConfiguration, context *http.Htt
 		data.Frontend = frontendname
 		return &rjobs.AddAliasRequest{frontendname, data.Alias}, nil
 }
+
+func HandleRouterDeleteAliasRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+		frontendname := r.PathParam("id")
+		alias := r.PathParam("alias")
+		return &rjobs.DeleteAliasRequest{Frontend: frontendname, Alias: alias}, nil
+}
+
+func HandleRouterAddBackendRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+		frontendname := r.PathParam("id")
+		var data rjobs.AddBackendRequest
+		if r.Body != nil {
+			dec := json.NewDecoder(io.LimitReader(r.Body, 100*1024))
+			if err := dec.Decode(&data); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		return &rjobs.AddBackendRequest{
+			Frontend:     frontendname,
+			FrontendPath: data.FrontendPath,
+			BackendPath:  data.BackendPath,
+			Protocols:    data.Protocols,
+		}, nil
+}
+
+func HandleRouterDeleteBackendRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+		frontendname := r.PathParam("id")
+		backendid := r.PathParam("backendId")
+		return &rjobs.DeleteBackendRequest{Frontend: frontendname, BackendId: backendid}, nil
+}
+
+func HandleRouterAddCertificateRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+		var data rjobs.AddCertificateRequest
+		if r.Body == nil {
+			return nil, jobs.SimpleError{jobs.ResponseInvalidRequest, "A certificate and private key are required."}
+		}
+		dec := json.NewDecoder(io.LimitReader(r.Body, 100*1024))
+		if err := dec.Decode(&data); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data.Frontend = r.PathParam("id")
+		data.Alias = r.PathParam("alias")
+		return &data, nil
+}
+
+func HandleRouterDeleteCertificateRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+		return &rjobs.DeleteCertificateRequest{Frontend: r.PathParam("id"), Alias: r.PathParam("alias")}, nil
+}
+
+func HandleRouterListCertificatesRequest(conf *http.HttpConfiguration, context *http.HttpContext, r *rest.Request) (interface{}, error) {
+		days, _ := strconv.Atoi(r.URL.Query().Get("expiring"))
+		return &rjobs.ListCertificatesRequest{Frontend: r.PathParam("id"), ExpiringDays: days}, nil
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"github.com/openshift/geard/http/client"
+	rjobs "github.com/openshift/geard/router/jobs"
 )
 
 func (h *HttpRouterCreateFrontendRequest) MarshalHttpRequestBody(w io.Writer) error {
@@ -34,3 +37,34 @@ func (h *HttpRouterAddAliasRequest) MarshalHttpRequestBody(w io.Writer) error {
 	encoder := json.NewEncoder(w)
 	return encoder.Encode(h)
 }
+
+func (h *HttpRouterAddBackendRequest) MarshalHttpRequestBody(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(h)
+}
+
+func (h *HttpRouterAddCertificateRequest) MarshalHttpRequestBody(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(h)
+}
+
+func (h *HttpRouterListCertificatesRequest) MarshalUrlQuery(values *url.Values) {
+	if h.ExpiringDays > 0 {
+		values.Add("expiring", strconv.Itoa(h.ExpiringDays))
+	}
+}
+
+func (h *HttpRouterListCertificatesRequest) UnmarshalHttpResponse(headers http.Header, r io.Reader, mode client.ResponseContentMode) (interface{}, error) {
+	if r == nil {
+		return nil, errors.New("Unexpected empty response body to HttpRouterListCertificatesRequest")
+	}
+	decoder := json.NewDecoder(r)
+	list := &rjobs.ListCertificatesResponse{}
+	if err := decoder.Decode(list); err != nil {
+		return nil, err
+	}
+	for i := range list.Certificates {
+		list.Certificates[i].Server = h.Server
+	}
+	return list, nil
+}
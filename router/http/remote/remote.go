@@ -15,8 +15,22 @@ func HttpJobFor(job interface{}) (exc client.RemoteExecutable, err error) {
 		exc = &HttpRouterAddAliasRequest{AddAliasRequest: *j}
 	case *rjobs.DeleteFrontendRequest:
 		exc = &HttpRouterDeleteFrontendRequest{DeleteFrontendRequest: *j}
+	case *rjobs.DeleteRouteRequest:
+		exc = &HttpRouterDeleteRouteRequest{DeleteRouteRequest: *j}
 	case *rjobs.GetRoutesRequest:
 		exc = &HttpRouterGetRoutesRequest{GetRoutesRequest: *j}
+	case *rjobs.DeleteAliasRequest:
+		exc = &HttpRouterDeleteAliasRequest{DeleteAliasRequest: *j}
+	case *rjobs.AddBackendRequest:
+		exc = &HttpRouterAddBackendRequest{AddBackendRequest: *j}
+	case *rjobs.DeleteBackendRequest:
+		exc = &HttpRouterDeleteBackendRequest{DeleteBackendRequest: *j}
+	case *rjobs.AddCertificateRequest:
+		exc = &HttpRouterAddCertificateRequest{AddCertificateRequest: *j}
+	case *rjobs.DeleteCertificateRequest:
+		exc = &HttpRouterDeleteCertificateRequest{DeleteCertificateRequest: *j}
+	case *rjobs.ListCertificatesRequest:
+		exc = &HttpRouterListCertificatesRequest{ListCertificatesRequest: *j}
 	}
 	return
 }
@@ -47,6 +61,36 @@ type HttpRouterCreateRouteRequest struct {
 	client.DefaultRequest
 }
 
+type HttpRouterDeleteAliasRequest struct {
+	rjobs.DeleteAliasRequest
+	client.DefaultRequest
+}
+
+type HttpRouterAddBackendRequest struct {
+	rjobs.AddBackendRequest
+	client.DefaultRequest
+}
+
+type HttpRouterDeleteBackendRequest struct {
+	rjobs.DeleteBackendRequest
+	client.DefaultRequest
+}
+
+type HttpRouterAddCertificateRequest struct {
+	rjobs.AddCertificateRequest
+	client.DefaultRequest
+}
+
+type HttpRouterDeleteCertificateRequest struct {
+	rjobs.DeleteCertificateRequest
+	client.DefaultRequest
+}
+
+type HttpRouterListCertificatesRequest struct {
+	rjobs.ListCertificatesRequest
+	client.DefaultRequest
+}
+
 type HttpRouterGetRoutesRequest struct {
 	rjobs.GetRoutesRequest
 	client.DefaultRequest
@@ -82,3 +126,32 @@ func (h *HttpRouterAddAliasRequest) HttpPath() string {
 	return client.Inline("/frontend/:id/aliases", string(h.Frontend))
 }
 
+func (h *HttpRouterDeleteAliasRequest) HttpMethod() string { return "DELETE" }
+func (h *HttpRouterDeleteAliasRequest) HttpPath() string {
+	return client.Inline("/frontend/:id/aliases/:alias", string(h.Frontend), string(h.Alias))
+}
+
+func (h *HttpRouterAddBackendRequest) HttpMethod() string { return "POST" }
+func (h *HttpRouterAddBackendRequest) HttpPath() string {
+	return client.Inline("/frontend/:id/backends", string(h.Frontend))
+}
+
+func (h *HttpRouterDeleteBackendRequest) HttpMethod() string { return "DELETE" }
+func (h *HttpRouterDeleteBackendRequest) HttpPath() string {
+	return client.Inline("/frontend/:id/backends/:backendId", string(h.Frontend), string(h.BackendId))
+}
+
+func (h *HttpRouterAddCertificateRequest) HttpMethod() string { return "PUT" }
+func (h *HttpRouterAddCertificateRequest) HttpPath() string {
+	return client.Inline("/frontend/:id/certificates/:alias", string(h.Frontend), string(h.Alias))
+}
+
+func (h *HttpRouterDeleteCertificateRequest) HttpMethod() string { return "DELETE" }
+func (h *HttpRouterDeleteCertificateRequest) HttpPath() string {
+	return client.Inline("/frontend/:id/certificates/:alias", string(h.Frontend), string(h.Alias))
+}
+
+func (h *HttpRouterListCertificatesRequest) HttpMethod() string { return "GET" }
+func (h *HttpRouterListCertificatesRequest) HttpPath() string {
+	return client.Inline("/frontend/:id/certificates", string(h.Frontend))
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	jobs "github.com/openshift/geard/jobs"
+	"github.com/openshift/geard/router"
+)
+
+type AddCertificateRequest struct {
+	Frontend string
+	Alias    string
+	// PEM encoded certificate (and any intermediates) and private key
+	Certificate        string
+	PrivateKey         string
+	PrivateKeyPassword string `json:"PrivateKeyPassword,omitempty"`
+	// Replace an existing certificate for the alias
+	Replace bool `json:"Replace,omitempty"`
+}
+
+type DeleteCertificateRequest struct {
+	Frontend string
+	Alias    string
+}
+
+type ListCertificatesRequest struct {
+	Frontend string
+	// Report certificates that expire within this many days.  Zero uses
+	// the default of 30.
+	ExpiringDays int `json:"ExpiringDays,omitempty"`
+}
+
+func (j AddCertificateRequest) Execute(resp jobs.Response) {
+	if err := checkAlias(j.Alias); err != nil {
+		resp.Failure(err)
+		return
+	}
+	cert, err := router.NewCertificate(j.Alias, []byte(j.Certificate), []byte(j.PrivateKey), j.PrivateKeyPassword)
+	if err != nil {
+		resp.Failure(jobs.SimpleError{Failure: jobs.ResponseInvalidRequest, Reason: err.Error()})
+		return
+	}
+	if err := router.AddCertificate(j.Frontend, cert, j.Replace); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
+	if cert.ExpiresWithin(router.DefaultCertificateExpiryWarning) {
+		log.Printf("router: The certificate for %s on %s expires on %s", j.Alias, j.Frontend, cert.NotAfter.Format(time.RFC3339))
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+func (j DeleteCertificateRequest) Execute(resp jobs.Response) {
+	if err := router.DeleteCertificate(j.Frontend, j.Alias); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+func (j ListCertificatesRequest) Execute(resp jobs.Response) {
+	a, found := router.Routes.Frontend(j.Frontend)
+	if !found {
+		resp.Failure(ErrFrontendNotFound)
+		return
+	}
+	within := router.DefaultCertificateExpiryWarning
+	if j.ExpiringDays > 0 {
+		within = time.Duration(j.ExpiringDays) * 24 * time.Hour
+	}
+	r := &ListCertificatesResponse{Certificates: CertificateResponses{}}
+	for _, cert := range a.SortedCertificates() {
+		r.Certificates = append(r.Certificates, CertificateResponse{
+			Frontend: j.Frontend,
+			Alias:    cert.Id,
+			Subject:  cert.Subject,
+			NotAfter: cert.NotAfter,
+			Expiring: cert.ExpiresWithin(within),
+		})
+	}
+	resp.SuccessWithData(jobs.ResponseOk, r)
+}
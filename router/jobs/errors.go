@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"github.com/openshift/geard/containers"
+	"github.com/openshift/geard/jobs"
+	"github.com/openshift/geard/router"
+)
+
+var (
+	ErrFrontendNotFound = jobs.SimpleError{Failure: jobs.ResponseNotFound, Reason: "The specified frontend does not exist."}
+	ErrFrontendExists   = jobs.SimpleError{Failure: jobs.ResponseAlreadyExists, Reason: "A frontend with this name already exists."}
+	ErrBackendNotFound  = jobs.SimpleError{Failure: jobs.ResponseNotFound, Reason: "The specified backend does not exist."}
+	ErrEndpointNotFound = jobs.SimpleError{Failure: jobs.ResponseNotFound, Reason: "The specified endpoint does not exist."}
+	ErrAliasNotFound    = jobs.SimpleError{Failure: jobs.ResponseNotFound, Reason: "The specified alias is not defined on this frontend."}
+	ErrAliasInUse       = jobs.SimpleError{Failure: jobs.ResponseAlreadyExists, Reason: "The specified alias is defined on another frontend."}
+
+	ErrCertificateExists   = jobs.SimpleError{Failure: jobs.ResponseAlreadyExists, Reason: "A certificate is already installed for this alias."}
+	ErrCertificateNotFound = jobs.SimpleError{Failure: jobs.ResponseNotFound, Reason: "No certificate is installed for this alias."}
+)
+
+// Return the job error for an error from the router package.
+func routerError(err error) error {
+	switch err {
+	case router.ErrFrontendNotFound:
+		return ErrFrontendNotFound
+	case router.ErrFrontendExists:
+		return ErrFrontendExists
+	case router.ErrBackendNotFound:
+		return ErrBackendNotFound
+	case router.ErrEndpointNotFound:
+		return ErrEndpointNotFound
+	case router.ErrAliasNotFound:
+		return ErrAliasNotFound
+	case router.ErrAliasInUse:
+		return ErrAliasInUse
+	case router.ErrCertificateExists:
+		return ErrCertificateExists
+	case router.ErrCertificateNotFound:
+		return ErrCertificateNotFound
+	}
+	return err
+}
+
+// Aliases are written into proxy configurations and certificate file
+// names, so only DNS host names are accepted.
+func checkAlias(alias string) error {
+	if err := containers.CheckHostName(alias); err != nil {
+		return jobs.SimpleError{Failure: jobs.ResponseInvalidRequest, Reason: err.Error()}
+	}
+	return nil
+}
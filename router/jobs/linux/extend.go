@@ -29,6 +29,18 @@ func sharesImplementation(request interface{}) (jobs.Job, error) {
 			return r, nil
 		case *rjobs.DeleteRouteRequest :
 			return r, nil
+		case *rjobs.DeleteAliasRequest :
+			return r, nil
+		case *rjobs.AddBackendRequest :
+			return r, nil
+		case *rjobs.DeleteBackendRequest :
+			return r, nil
+		case *rjobs.AddCertificateRequest :
+			return r, nil
+		case *rjobs.DeleteCertificateRequest :
+			return r, nil
+		case *rjobs.ListCertificatesRequest :
+			return r, nil
 		case *rjobs.GetRoutesRequest :
 			return r, nil
 	}
@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+type CertificateResponse struct {
+	Frontend string
+	Alias    string
+	Subject  string
+	NotAfter time.Time
+	// The certificate expires within the requested number of days
+	Expiring bool   `json:"Expiring,omitempty"`
+	Server   string `json:"Server,omitempty"`
+}
+type CertificateResponses []CertificateResponse
+
+type ListCertificatesResponse struct {
+	Certificates CertificateResponses
+}
+
+func (r *ListCertificatesResponse) Append(other *ListCertificatesResponse) {
+	r.Certificates = append(r.Certificates, other.Certificates...)
+}
+
+// The certificates that are expiring.
+func (r *ListCertificatesResponse) Expiring() CertificateResponses {
+	expiring := CertificateResponses{}
+	for i := range r.Certificates {
+		if r.Certificates[i].Expiring {
+			expiring = append(expiring, r.Certificates[i])
+		}
+	}
+	return expiring
+}
+
+func (r *ListCertificatesResponse) WriteTableTo(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 8, 4, 1, ' ', tabwriter.DiscardEmptyColumns)
+	if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", "FRONTEND", "ALIAS", "SERVER", "SUBJECT", "EXPIRES", ""); err != nil {
+		return err
+	}
+	for i := range r.Certificates {
+		c := &r.Certificates[i]
+		warning := ""
+		if c.Expiring {
+			warning = "EXPIRING"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Frontend, c.Alias, c.Server, c.Subject, c.NotAfter.Format(time.RFC3339), warning); err != nil {
+			return err
+		}
+	}
+	tw.Flush()
+	return nil
+}
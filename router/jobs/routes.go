@@ -4,25 +4,29 @@ import (
 	"fmt"
 	jobs "github.com/openshift/geard/jobs"
 	"github.com/openshift/geard/router"
-	"log"
 )
 
 type AddRouteRequest struct {
-	Frontend          string
+	Frontend     string
 	FrontendPath string
 	BackendPath  string
 	Protocols    []string
-	Endpoints      []router.Endpoint
+	Endpoints    []router.Endpoint
 }
 
 type CreateFrontendRequest struct {
-	Frontend   string
-	Alias string
+	Frontend string
+	Alias    string
 }
 
 type AddAliasRequest struct {
-	Frontend   string
-	Alias string
+	Frontend string
+	Alias    string
+}
+
+type DeleteAliasRequest struct {
+	Frontend string
+	Alias    string
 }
 
 type DeleteFrontendRequest struct {
@@ -30,51 +34,101 @@ type DeleteFrontendRequest struct {
 }
 
 type DeleteRouteRequest struct {
-	Frontend      string
+	Frontend   string
 	EndpointId string
 }
 
+type AddBackendRequest struct {
+	Frontend     string
+	FrontendPath string
+	BackendPath  string
+	Protocols    []string
+}
+
+type DeleteBackendRequest struct {
+	Frontend  string
+	BackendId string
+}
+
 type GetRoutesRequest struct {
 	Frontend string
 }
 
 func (j AddRouteRequest) Execute(resp jobs.Response) {
-	router.AddRoute(j.Frontend, j.FrontendPath, j.BackendPath, j.Protocols, j.Endpoints)
+	if err := router.AddRoute(j.Frontend, j.FrontendPath, j.BackendPath, j.Protocols, j.Endpoints); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
 	resp.Success(jobs.ResponseOk)
 }
 
 func (j DeleteRouteRequest) Execute(resp jobs.Response) {
-	// TODO
+	if err := router.DeleteRoute(j.Frontend, j.EndpointId); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
 	resp.Success(jobs.ResponseOk)
 }
 
 func (j CreateFrontendRequest) Execute(resp jobs.Response) {
-	value, ok := router.GlobalRoutes[j.Frontend]
-	if !ok {
-		router.CreateFrontend(j.Frontend, j.Alias)
-	} else {
-		log.Printf("Error : Frontend %s already exists.", value.Name)
+	if j.Alias != "" {
+		if err := checkAlias(j.Alias); err != nil {
+			resp.Failure(err)
+			return
+		}
+	}
+	if err := router.CreateFrontend(j.Frontend, j.Alias); err != nil {
+		resp.Failure(routerError(err))
+		return
 	}
 	resp.Success(jobs.ResponseOk)
 }
 
 func (j AddAliasRequest) Execute(resp jobs.Response) {
-	value, ok := router.GlobalRoutes[j.Frontend]
-	if ok {
-		router.AddAlias(j.Alias, value.Name)
-	} else {
-		router.CreateFrontend(j.Frontend, j.Alias)
+	if err := checkAlias(j.Alias); err != nil {
+		resp.Failure(err)
+		return
+	}
+	if err := router.AddAlias(j.Alias, j.Frontend); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+func (j DeleteAliasRequest) Execute(resp jobs.Response) {
+	if err := router.DeleteAlias(j.Alias, j.Frontend); err != nil {
+		resp.Failure(routerError(err))
+		return
 	}
 	resp.Success(jobs.ResponseOk)
 }
 
 func (j DeleteFrontendRequest) Execute(resp jobs.Response) {
-	router.DeleteFrontend(j.Frontend)
+	if err := router.DeleteFrontend(j.Frontend); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+func (j AddBackendRequest) Execute(resp jobs.Response) {
+	if _, err := router.AddBackend(j.Frontend, j.FrontendPath, j.BackendPath, j.Protocols); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
+	resp.Success(jobs.ResponseOk)
+}
+
+func (j DeleteBackendRequest) Execute(resp jobs.Response) {
+	if err := router.DeleteBackend(j.Frontend, j.BackendId); err != nil {
+		resp.Failure(routerError(err))
+		return
+	}
 	resp.Success(jobs.ResponseOk)
 }
 
 func (j GetRoutesRequest) Execute(resp jobs.Response) {
-	// router.ReadRoutes()
 	var out string
 	if j.Frontend == "*" {
 		out = router.PrintRoutes()
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/geard/containers"
+)
+
+// Holds the decrypted private keys of installed certificates, one file
+// per alias readable only by its owner.  Keys are kept out of the route
+// table so that they are never returned with the routes.
+type KeyStore struct {
+	dir string
+}
+
+func NewKeyStore(dir string) *KeyStore {
+	return &KeyStore{dir}
+}
+
+func (k *KeyStore) PathFor(alias string) string {
+	return filepath.Join(k.dir, alias+".pem")
+}
+
+func (k *KeyStore) Read(alias string) ([]byte, error) {
+	return ioutil.ReadFile(k.PathFor(alias))
+}
+
+func (k *KeyStore) Write(alias string, key []byte) error {
+	if err := containers.CheckHostName(alias); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(k.dir, 0700); err != nil {
+		return err
+	}
+	return writeAtomic(k.PathFor(alias), key, 0600)
+}
+
+// Remove the keys of aliases that no longer have a certificate.
+func (k *KeyStore) prune(routes RouteTable) error {
+	wanted := make(map[string]bool)
+	for _, a := range routes {
+		for alias := range a.Certificates {
+			wanted[alias+".pem"] = true
+		}
+	}
+	infos, err := ioutil.ReadDir(k.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".pem") || wanted[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(k.dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
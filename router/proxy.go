@@ -0,0 +1,225 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openshift/geard/config"
+)
+
+// Turns the route table into the configuration of a proxy.
+type Renderer interface {
+	Render(w io.Writer, config *ProxyConfig) error
+}
+
+// Makes a proxy read its configuration again.
+type Reloader interface {
+	Reload() error
+}
+
+// The renderers that may be chosen for a local proxy by name.
+var Renderers = map[string]Renderer{
+	"haproxy": HAProxyRenderer,
+	"nginx":   NginxRenderer,
+}
+
+// Signals a container to reload, which is how the geard-router image
+// picks up changes to the routes file.
+type DockerSignalReloader struct {
+	Container string
+	Signal    string
+}
+
+func (r DockerSignalReloader) Reload() error {
+	out, err := exec.Command("docker", "kill", "-s", r.Signal, r.Container).CombinedOutput()
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", err.Error(), strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// Runs a command, such as 'systemctl reload haproxy'.
+type CommandReloader []string
+
+func (r CommandReloader) Reload() error {
+	if len(r) == 0 {
+		return nil
+	}
+	out, err := exec.Command(r[0], r[1:]...).CombinedOutput()
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", err.Error(), strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// The router container reloaded when no local proxy is configured.
+var DefaultReloader Reloader = DockerSignalReloader{"geard-router", "SIGUSR2"}
+
+// How a locally installed proxy is configured from the routes.  Stored
+// at ProxySettingsPath so every process that changes routes renders
+// the same configuration.
+type ProxySettings struct {
+	// A key of Renderers
+	Type string
+	// The file the configuration is written to
+	ConfigPath string
+	// The directory certificates are written to, one PEM file with the
+	// certificate and key per alias
+	CertificateDir string `json:"CertificateDir,omitempty"`
+	// The command run after the configuration changes
+	ReloadCommand []string `json:"ReloadCommand,omitempty"`
+}
+
+func ProxySettingsPath() string {
+	return filepath.Join(config.ContainerBasePath(), "router", "proxy.json")
+}
+
+func (s *ProxySettings) Check() error {
+	if _, found := Renderers[s.Type]; !found {
+		types := make([]string, 0, len(Renderers))
+		for name := range Renderers {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		return errors.New(fmt.Sprintf("The proxy type must be one of %s", strings.Join(types, ", ")))
+	}
+	if !filepath.IsAbs(s.ConfigPath) {
+		return errors.New("The proxy configuration path must be absolute")
+	}
+	if s.CertificateDir != "" && !filepath.IsAbs(s.CertificateDir) {
+		return errors.New("The proxy certificate directory must be absolute")
+	}
+	return nil
+}
+
+// The proxy that renders and reloads with these settings.
+func (s *ProxySettings) Proxy() *Proxy {
+	certDir := s.CertificateDir
+	if certDir == "" {
+		certDir = filepath.Join(filepath.Dir(s.ConfigPath), "certs")
+	}
+	return &Proxy{
+		Renderer:       Renderers[s.Type],
+		ConfigPath:     s.ConfigPath,
+		CertificateDir: certDir,
+		Keys:           Routes.Keys,
+		Reloader:       CommandReloader(s.ReloadCommand),
+	}
+}
+
+// Read the local proxy settings.  Returns nil if no local proxy is
+// configured.
+func ReadProxySettings() (*ProxySettings, error) {
+	data, err := ioutil.ReadFile(ProxySettingsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	settings := &ProxySettings{}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, err
+	}
+	if err := settings.Check(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Save the local proxy settings.  Nil settings go back to reloading
+// the router container.
+func WriteProxySettings(settings *ProxySettings) error {
+	if settings == nil {
+		if err := os.Remove(ProxySettingsPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ProxySettingsPath(), data, 0644)
+}
+
+// A proxy configured from the route table.
+type Proxy struct {
+	Renderer       Renderer
+	ConfigPath     string
+	CertificateDir string
+	// Where the private keys of certificates are read from
+	Keys     *KeyStore
+	Reloader Reloader
+}
+
+// Write the configuration and certificates for the routes and reload
+// the proxy if anything changed.
+func (p *Proxy) Apply(routes RouteTable) error {
+	config, err := NewProxyConfig(routes, p.Keys, p.CertificateDir)
+	if err != nil {
+		return err
+	}
+	changed, err := p.writeCertificates(config)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := p.Renderer.Render(&buf, config); err != nil {
+		return err
+	}
+	if existing, err := ioutil.ReadFile(p.ConfigPath); err != nil || !bytes.Equal(existing, buf.Bytes()) {
+		if err := writeAtomic(p.ConfigPath, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed || p.Reloader == nil {
+		return nil
+	}
+	return p.Reloader.Reload()
+}
+
+// Write a PEM file for each certificate and remove the files of
+// certificates that no longer exist.  Returns true if any file
+// changed.
+func (p *Proxy) writeCertificates(config *ProxyConfig) (bool, error) {
+	changed := false
+	wanted := make(map[string]bool)
+	for i := range config.Frontends {
+		for _, cert := range config.Frontends[i].Certificates {
+			wanted[filepath.Base(cert.Path)] = true
+			if existing, err := ioutil.ReadFile(cert.Path); err == nil && bytes.Equal(existing, cert.pem) {
+				continue
+			}
+			if err := os.MkdirAll(p.CertificateDir, 0700); err != nil {
+				return false, err
+			}
+			if err := writeAtomic(cert.Path, cert.pem, 0600); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	existing, err := filepath.Glob(filepath.Join(p.CertificateDir, "*.pem"))
+	if err != nil {
+		return false, err
+	}
+	for _, path := range existing {
+		if !wanted[filepath.Base(path)] {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	return changed, nil
+}
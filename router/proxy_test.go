@@ -0,0 +1,207 @@
+package router
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingReloader int
+
+func (r *countingReloader) Reload() error {
+	*r += 1
+	return nil
+}
+
+func testRouteTable(t *testing.T) RouteTable {
+	fe := Frontend{Name: "app"}
+	fe.Init()
+	fe.AddAlias("www.example.com")
+	fe.AddAlias("example.com")
+	fe.addBackendEndpoint(fe.AddBackend("/", "/", nil), fe.AddEndpoint(Endpoint{IP: "10.0.0.1", Port: "8080"}))
+	fe.addBackendEndpoint(fe.AddBackend("/api/", "/", nil), fe.AddEndpoint(Endpoint{IP: "10.0.0.2", Port: "9090"}))
+
+	secure := Frontend{Name: "secure"}
+	secure.Init()
+	secure.AddAlias("secure.example.com")
+	be := secure.AddBackend("/", "/", nil)
+	secure.addBackendEndpoint(be, secure.AddEndpoint(Endpoint{IP: "10.0.0.3", Port: "8443"}))
+	b := secure.BeTable[be]
+	b.SslTerm = TERM_GEAR
+	secure.BeTable[be] = b
+
+	// frontends without aliases or endpoints can't be routed to
+	empty := Frontend{Name: "empty"}
+	empty.Init()
+
+	return RouteTable{"app": fe, "secure": secure, "empty": empty}
+}
+
+func render(t *testing.T, r Renderer, config *ProxyConfig) string {
+	var buf bytes.Buffer
+	if err := r.Render(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestNewProxyConfig(t *testing.T) {
+	config, err := NewProxyConfig(testRouteTable(t), nil, "/certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Frontends) != 2 || config.Frontends[0].Name != "app" || config.Frontends[1].Name != "secure" {
+		t.Fatalf("Unexpected frontends %+v", config.Frontends)
+	}
+	routes := config.Frontends[0].Routes
+	if len(routes) != 2 || routes[0].FrontendPath != "/api/" || routes[1].FrontendPath != "/" {
+		t.Fatalf("Routes should be ordered most specific first: %+v", routes)
+	}
+	if !routes[0].Rewrite() || routes[1].Rewrite() {
+		t.Errorf("Only the /api/ route should rewrite its path: %+v", routes)
+	}
+	if !config.HasPassthrough() || config.HasCertificates() {
+		t.Errorf("Expected a passthrough route and no certificates")
+	}
+}
+
+func TestHAProxyRenderer(t *testing.T) {
+	config, err := NewProxyConfig(testRouteTable(t), nil, "/certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := render(t, HAProxyRenderer, config)
+	api := config.Frontends[0].Routes[0].Name
+	secure := config.Frontends[1].Routes[0].Name
+
+	for _, s := range []string{
+		"bind *:80",
+		"use_backend " + api + " if { hdr(host),field(1,:) -i www.example.com example.com } { path_beg /api }",
+		"backend " + api + "\n    balance roundrobin\n    http-request replace-path ^/api/?(.*) /\\1\n    server " + api + "_0 10.0.0.2:9090 check\n",
+		"use_backend " + secure + " if { req.ssl_sni -i secure.example.com }",
+		"backend " + secure + "\n    mode tcp\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the configuration:\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, "ssl crt") {
+		t.Errorf("TLS should not be terminated without certificates:\n%s", out)
+	}
+	if strings.Index(out, "path_beg /api") > strings.Index(out, "path_beg / }") {
+		t.Errorf("The /api route should be matched before /:\n%s", out)
+	}
+}
+
+func TestNginxRenderer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	routes := testRouteTable(t)
+	cert, key, _ := testCertificate(t, "www.example.com", time.Now().Add(24*time.Hour))
+	c, err := NewCertificate("www.example.com", cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe := routes["app"]
+	if err := fe.AddCertificate(c, false); err != nil {
+		t.Fatal(err)
+	}
+	routes["app"] = fe
+	keys := NewKeyStore(dir)
+	if err := keys.Write(c.Id, key); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewProxyConfig(routes, keys, "/certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := render(t, NginxRenderer, config)
+	api := config.Frontends[0].Routes[0].Name
+	secure := config.Frontends[1].Routes[0].Name
+
+	for _, s := range []string{
+		"upstream " + api + " {\n        server 10.0.0.2:9090;\n    }",
+		"server_name www.example.com example.com;",
+		"location /api/ {\n            proxy_pass http://" + api + "/;",
+		"server_name www.example.com;\n        ssl_certificate /certs/www.example.com.pem;",
+		"secure.example.com " + secure + ";",
+		"ssl_preread on;",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the configuration:\n%s", s, out)
+		}
+	}
+}
+
+func TestProxyApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	routes := testRouteTable(t)
+	cert, key, _ := testCertificate(t, "www.example.com", time.Now().Add(24*time.Hour))
+	c, err := NewCertificate("www.example.com", cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe := routes["app"]
+	fe.AddCertificate(c, false)
+	routes["app"] = fe
+	keys := NewKeyStore(filepath.Join(dir, "keys"))
+	if err := keys.Write(c.Id, key); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloads countingReloader
+	p := &Proxy{
+		Renderer:       HAProxyRenderer,
+		ConfigPath:     filepath.Join(dir, "haproxy.cfg"),
+		CertificateDir: filepath.Join(dir, "certs"),
+		Keys:           keys,
+		Reloader:       &reloads,
+	}
+	if err := p.Apply(routes); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 1 {
+		t.Fatalf("Expected one reload, got %d", reloads)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "certs", "www.example.com.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, cert) || !bytes.Contains(data, key) {
+		t.Errorf("The certificate file should hold the certificate and key")
+	}
+
+	if err := p.Apply(routes); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 1 {
+		t.Errorf("An unchanged configuration should not reload the proxy, got %d reloads", reloads)
+	}
+
+	fe = routes["app"]
+	fe.RemoveCertificate("www.example.com")
+	routes["app"] = fe
+	if err := p.Apply(routes); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 2 {
+		t.Errorf("Removing a certificate should reload the proxy, got %d reloads", reloads)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "certs", "www.example.com.pem")); !os.IsNotExist(err) {
+		t.Errorf("The removed certificate should be deleted: %v", err)
+	}
+}
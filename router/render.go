@@ -0,0 +1,319 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/openshift/geard/containers"
+)
+
+// The route table arranged for proxy templates.  Frontends are sorted
+// by name and routes within a frontend by longest path first so that
+// prefix matches pick the most specific route.
+type ProxyConfig struct {
+	Frontends      []ProxyFrontend
+	CertificateDir string
+}
+
+type ProxyFrontend struct {
+	Name         string
+	Hosts        []string
+	Routes       []ProxyRoute
+	Certificates []ProxyCertificate
+}
+
+type ProxyRoute struct {
+	// Unique within the configuration and safe to use as a proxy
+	// identifier
+	Name         string
+	FrontendPath string
+	BackendPath  string
+	SslTerm      string
+	Servers      []string
+}
+
+type ProxyCertificate struct {
+	Alias string
+	Path  string
+	pem   []byte
+}
+
+// True if the proxy forwards TLS connections for the route without
+// terminating them.
+func (r ProxyRoute) Passthrough() bool {
+	return r.SslTerm == TERM_GEAR
+}
+
+// True if the backend is reached over TLS.
+func (r ProxyRoute) Ssl() bool {
+	return r.SslTerm == TERM_GEAR || r.SslTerm == TERM_RESSL
+}
+
+// True if the path must be rewritten before the request is forwarded.
+func (r ProxyRoute) Rewrite() bool {
+	return r.FrontendPath != r.BackendPath
+}
+
+// True if any route forwards TLS connections without terminating them.
+func (c *ProxyConfig) HasPassthrough() bool {
+	for i := range c.Frontends {
+		for _, r := range c.Frontends[i].Routes {
+			if r.Passthrough() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// True if any frontend has a certificate to terminate TLS with.
+func (c *ProxyConfig) HasCertificates() bool {
+	for i := range c.Frontends {
+		if len(c.Frontends[i].Certificates) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Arrange the routes for rendering.  Certificates are placed in
+// certificateDir, one file per alias, with their private key read from
+// keys.
+func NewProxyConfig(routes RouteTable, keys *KeyStore, certificateDir string) (*ProxyConfig, error) {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config := &ProxyConfig{CertificateDir: certificateDir}
+	for i, name := range names {
+		fe := routes[name]
+		pf := ProxyFrontend{Name: name}
+		for _, alias := range fe.HostAliases {
+			if err := containers.CheckHostName(alias); err != nil {
+				log.Printf("router: Skipping alias %q of %s: %v", alias, name, err)
+				continue
+			}
+			pf.Hosts = append(pf.Hosts, alias)
+		}
+		if len(pf.Hosts) == 0 {
+			continue
+		}
+
+		for _, be := range fe.BeTable {
+			route := ProxyRoute{
+				Name:         fmt.Sprintf("be_%d_%s", i, unsafeName.ReplaceAllString(be.Id, "_")),
+				FrontendPath: defaultPath(be.FePath),
+				BackendPath:  defaultPath(be.BePath),
+				SslTerm:      be.SslTerm,
+			}
+			for _, id := range be.EndpointIds {
+				if ep, ok := fe.EndpointTable[id]; ok {
+					route.Servers = append(route.Servers, ep.IP+":"+ep.Port)
+				}
+			}
+			if len(route.Servers) == 0 {
+				continue
+			}
+			sort.Strings(route.Servers)
+			pf.Routes = append(pf.Routes, route)
+		}
+		if len(pf.Routes) == 0 {
+			continue
+		}
+		sort.Sort(byMostSpecificPath(pf.Routes))
+
+		for _, cert := range fe.SortedCertificates() {
+			if err := containers.CheckHostName(cert.Id); err != nil {
+				continue
+			}
+			key, err := keys.Read(cert.Id)
+			if err != nil {
+				return nil, fmt.Errorf("The private key for %s could not be read: %v", cert.Id, err)
+			}
+			pf.Certificates = append(pf.Certificates, ProxyCertificate{
+				Alias: cert.Id,
+				Path:  filepath.Join(certificateDir, cert.Id+".pem"),
+				pem:   cert.PEM(key),
+			})
+		}
+		config.Frontends = append(config.Frontends, pf)
+	}
+	return config, nil
+}
+
+type byMostSpecificPath []ProxyRoute
+
+func (s byMostSpecificPath) Len() int      { return len(s) }
+func (s byMostSpecificPath) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byMostSpecificPath) Less(i, j int) bool {
+	if len(s[i].FrontendPath) != len(s[j].FrontendPath) {
+		return len(s[i].FrontendPath) > len(s[j].FrontendPath)
+	}
+	return s[i].Name < s[j].Name
+}
+
+// Renders the configuration with a text template.
+type TemplateRenderer struct {
+	Template *template.Template
+}
+
+func (r TemplateRenderer) Render(w io.Writer, config *ProxyConfig) error {
+	return r.Template.Execute(w, config)
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	// The path without a trailing slash, so a route for /app/ also
+	// matches /app
+	"prefix": func(path string) string {
+		if trimmed := strings.TrimSuffix(path, "/"); trimmed != "" {
+			return trimmed
+		}
+		return path
+	},
+	"trim": func(path string) string {
+		return strings.TrimSuffix(path, "/")
+	},
+}
+
+// Accepts HTTP on port 80 and TLS on port 443.  TLS connections for
+// passthrough routes are forwarded by SNI, the rest are terminated
+// with the certificates in CertificateDir on a local listener.
+var HAProxyRenderer = TemplateRenderer{template.Must(template.New("haproxy").Funcs(templateFuncs).Parse(`# Generated by geard from the router routes, changes will be overwritten
+global
+    daemon
+    maxconn 4096
+
+defaults
+    mode http
+    option forwardfor
+    timeout connect 5s
+    timeout client 60s
+    timeout server 60s
+
+frontend http-in
+    bind *:80
+{{- range .Frontends}}{{$fe := .}}{{range .Routes}}{{if not .Passthrough}}
+    use_backend {{.Name}} if { hdr(host),field(1,:) -i {{join $fe.Hosts " "}} } { path_beg {{prefix .FrontendPath}} }
+{{- end}}{{end}}{{end}}
+{{- if or .HasCertificates .HasPassthrough}}
+
+frontend tls-in
+    mode tcp
+    bind *:443
+    tcp-request inspect-delay 5s
+    tcp-request content accept if { req.ssl_hello_type 1 }
+{{- range .Frontends}}{{$fe := .}}{{range .Routes}}{{if .Passthrough}}
+    use_backend {{.Name}} if { req.ssl_sni -i {{join $fe.Hosts " "}} }
+{{- end}}{{end}}{{end}}
+{{- if .HasCertificates}}
+    default_backend tls-terminate
+
+backend tls-terminate
+    mode tcp
+    server local 127.0.0.1:10443 send-proxy
+
+frontend https-in
+    bind 127.0.0.1:10443 ssl crt {{.CertificateDir}} accept-proxy
+    http-request set-header X-Forwarded-Proto https
+{{- range .Frontends}}{{$fe := .}}{{range .Routes}}{{if not .Passthrough}}
+    use_backend {{.Name}} if { hdr(host),field(1,:) -i {{join $fe.Hosts " "}} } { path_beg {{prefix .FrontendPath}} }
+{{- end}}{{end}}{{end}}
+{{- end}}
+{{- end}}
+{{- range .Frontends}}{{range .Routes}}
+
+backend {{.Name}}
+{{- if .Passthrough}}
+    mode tcp
+{{- end}}
+    balance roundrobin
+{{- if .Rewrite}}
+    http-request replace-path ^{{trim .FrontendPath}}/?(.*) {{trim .BackendPath}}/\1
+{{- end}}{{$route := .}}
+{{- range $i, $server := .Servers}}
+    server {{$route.Name}}_{{$i}} {{$server}} check{{if and $route.Ssl (not $route.Passthrough)}} ssl verify none{{end}}
+{{- end}}
+{{- end}}{{end}}
+`))}
+
+// Accepts HTTP on port 80 and TLS on port 443.  TLS connections for
+// passthrough routes are forwarded by SNI with the stream module, the
+// rest are terminated with each alias' certificate on a local
+// listener.
+var NginxRenderer = TemplateRenderer{template.Must(template.New("nginx").Funcs(templateFuncs).Parse(`# Generated by geard from the router routes, changes will be overwritten
+{{define "locations"}}{{range .Routes}}{{if not .Passthrough}}
+        location {{.FrontendPath}} {
+            proxy_pass {{if .Ssl}}https{{else}}http{{end}}://{{.Name}}{{.BackendPath}};
+            proxy_set_header Host $host;
+            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+            proxy_set_header X-Forwarded-Proto $scheme;
+        }
+{{- end}}{{end}}{{end -}}
+events {
+    worker_connections 1024;
+}
+
+http {
+{{- range .Frontends}}{{range .Routes}}{{if not .Passthrough}}
+    upstream {{.Name}} {
+{{- range .Servers}}
+        server {{.}};
+{{- end}}
+    }
+{{- end}}{{end}}{{end}}
+{{- range .Frontends}}
+
+    server {
+        listen 80;
+        server_name {{join .Hosts " "}};
+{{- template "locations" .}}
+    }
+{{- $fe := .}}{{range .Certificates}}
+
+    server {
+        listen 127.0.0.1:10443 ssl;
+        server_name {{.Alias}};
+        ssl_certificate {{.Path}};
+        ssl_certificate_key {{.Path}};
+{{- template "locations" $fe}}
+    }
+{{- end}}
+{{- end}}
+}
+{{- if or .HasCertificates .HasPassthrough}}
+
+stream {
+{{- range .Frontends}}{{range .Routes}}{{if .Passthrough}}
+    upstream {{.Name}} {
+{{- range .Servers}}
+        server {{.}};
+{{- end}}
+    }
+{{- end}}{{end}}{{end}}
+
+    map $ssl_preread_server_name $tls_upstream {
+{{- range .Frontends}}{{$fe := .}}{{range .Routes}}{{if .Passthrough}}{{$route := .}}{{range $fe.Hosts}}
+        {{.}} {{$route.Name}};
+{{- end}}{{end}}{{end}}{{end}}
+        default 127.0.0.1:10443;
+    }
+
+    server {
+        listen 443;
+        ssl_preread on;
+        proxy_pass $tls_upstream;
+    }
+}
+{{- end}}
+`))}
@@ -2,11 +2,13 @@ package router
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os/exec"
+	"log"
 	"strconv"
 	"time"
+
+	"github.com/openshift/geard/containers"
 )
 
 const (
@@ -16,20 +18,22 @@ const (
 )
 
 const (
-	TERM_EDGE  = "TERM_EDGE"
-	TERM_GEAR  = "TERM_GEAR"
-	TERM_RESSL = "TERM_RESSL"
+	TERM_EDGE  = containers.RouteTermEdge
+	TERM_GEAR  = containers.RouteTermGear
+	TERM_RESSL = containers.RouteTermRessl
 )
 
 const (
-	RouteFile    = "/var/lib/containers/router/routes.json"
+	RouteFile = "/var/lib/containers/router/routes.json"
 )
 
 type Frontend struct {
-	Name        string
-	HostAliases []string
-	BeTable     map[string]Backend
+	Name          string
+	HostAliases   []string
+	BeTable       map[string]Backend
 	EndpointTable map[string]Endpoint
+	// TLS certificates by the alias they are served for
+	Certificates map[string]Certificate `json:"Certificates,omitempty"`
 }
 
 type Backend struct {
@@ -37,16 +41,20 @@ type Backend struct {
 	FePath       string
 	BePath       string
 	Protocols    []string
-	EndpointIds    []string
+	EndpointIds  []string
 	SslTerm      string
 	Certificates []Certificate
 }
 
 type Certificate struct {
-	Id                 string
-	Contents           []byte
-	PrivateKey         []byte
-	PrivateKeyPassword string
+	Id       string
+	Contents []byte
+	// The decrypted private key, only set while the certificate is
+	// being installed.  Keys are stored in RouteStore.Keys.
+	PrivateKey []byte `json:"-"`
+	// Read from the certificate when it is installed
+	Subject  string    `json:"Subject,omitempty"`
+	NotAfter time.Time `json:"NotAfter,omitempty"`
 }
 
 type Endpoint struct {
@@ -55,7 +63,8 @@ type Endpoint struct {
 	Port string
 }
 
-var GlobalRoutes map[string]Frontend
+// The routes served by this host.
+var Routes = NewRouteStore(RouteFile)
 
 func makeId() string {
 	var s string
@@ -64,45 +73,23 @@ func makeId() string {
 }
 
 func PrintRoutes() string {
-	dat, err := ioutil.ReadFile(RouteFile)
-	var s string
+	routes, _ := Routes.Snapshot()
+	dat, err := json.MarshalIndent(routes, "", "  ")
 	if err != nil {
-		s = fmt.Sprintf("Error reading routes file : %s", err.Error())
-	} else {
-		s = fmt.Sprintf("%s", string(dat))
+		return fmt.Sprintf("Failed to marshal routes : %s", err.Error())
 	}
-	return s
+	return string(dat)
 }
 
 func PrintFrontendRoutes(frontendname string) string {
-	dat, err := json.MarshalIndent(GlobalRoutes[frontendname], "", "  ")
+	a, _ := Routes.Frontend(frontendname)
+	dat, err := json.MarshalIndent(a, "", "  ")
 	if err != nil {
-		fmt.Println("Failed to marshal routes - %s", err.Error())
+		fmt.Printf("Failed to marshal routes - %s\n", err.Error())
 	}
 	return string(dat)
 }
 
-func ReadRoutes() {
-	//fmt.Printf("Reading routes file (%s)\n", RouteFile)
-	dat, err := ioutil.ReadFile(RouteFile)
-	if err != nil {
-		GlobalRoutes = make(map[string]Frontend)
-		return
-	}
-	json.Unmarshal(dat, &GlobalRoutes)
-}
-
-func WriteRoutes() {
-	dat, err := json.MarshalIndent(GlobalRoutes, "", "  ")
-	if err != nil {
-		fmt.Println("Failed to marshal routes - %s", err.Error())
-	}
-	err = ioutil.WriteFile(RouteFile, dat, 0644)
-	if err != nil {
-		fmt.Println("Failed to write to routes file - %s", err.Error())
-	}
-}
-
 func (a *Frontend) Init() {
 	// a.HostAliases = make([]string)
 	// a.Certificates = make([]Certificate)
@@ -114,73 +101,288 @@ func (a *Frontend) Init() {
 	}
 }
 
-func CreateFrontend(name string, url string) {
-	a := Frontend{}
-	a.Init()
-	a.Name = name
-	a.HostAliases = make([]string, 1)
-	if url != "" {
-		a.HostAliases[0] = url
+var (
+	ErrFrontendNotFound = errors.New("router: the frontend does not exist")
+	ErrFrontendExists   = errors.New("router: the frontend already exists")
+	ErrBackendNotFound  = errors.New("router: the backend does not exist")
+	ErrEndpointNotFound = errors.New("router: the endpoint does not exist")
+	ErrAliasNotFound    = errors.New("router: the alias is not defined on the frontend")
+	ErrAliasInUse       = errors.New("router: the alias is defined on another frontend")
+)
+
+// Return a new id that is not used by any backend or endpoint of the
+// frontend.
+func (a *Frontend) newId() string {
+	for {
+		id := makeId()
+		_, be := a.BeTable[id]
+		_, ep := a.EndpointTable[id]
+		if !be && !ep {
+			return id
+		}
 	}
-	GlobalRoutes[a.Name] = a
-	WriteRoutes()
 }
 
-func DeleteFrontend(frontendname string) {
-	delete(GlobalRoutes, frontendname)
-	WriteRoutes()
-	BumpRouter()
+// Add an alias to the frontend if it isn't already defined.
+func (a *Frontend) AddAlias(alias string) {
+	if alias == "" || exists(a.HostAliases, alias) != -1 {
+		return
+	}
+	a.HostAliases = append(a.HostAliases, alias)
 }
 
-func AddAlias(alias string, frontendname string) {
-	a := GlobalRoutes[frontendname]
-	a.HostAliases = append(a.HostAliases, alias)
-	GlobalRoutes[frontendname] = a
-	WriteRoutes()
+// Remove an alias from the frontend.  Returns false if the alias was
+// not defined.
+func (a *Frontend) RemoveAlias(alias string) bool {
+	i := exists(a.HostAliases, alias)
+	if i == -1 {
+		return false
+	}
+	a.HostAliases = append(a.HostAliases[:i], a.HostAliases[i+1:]...)
+	a.RemoveCertificate(alias)
+	return true
 }
 
-func AddRoute(frontendname string, fe_path string, be_path string, protocols []string, endpoints []Endpoint) {
-	var id string
-	a := GlobalRoutes[frontendname]
-	a.Init()
+// Return the id of the endpoint with the same address, adding the
+// endpoint if no such endpoint exists.
+func (a *Frontend) AddEndpoint(endpoint Endpoint) string {
+	for _, ep := range a.EndpointTable {
+		if ep.IP == endpoint.IP && ep.Port == endpoint.Port {
+			return ep.Id
+		}
+	}
+	id := a.newId()
+	a.EndpointTable[id] = Endpoint{id, endpoint.IP, endpoint.Port}
+	return id
+}
 
-	ep_ids := make([]string, 1)
-	for new_ep_id := range endpoints {
-		new_endpoint := endpoints[new_ep_id]
-		found := false
-		for _, ep := range a.EndpointTable {
-			if ep.IP == new_endpoint.IP && ep.Port == new_endpoint.Port {
-				ep_ids = append(ep_ids, ep.Id)
-				found = true
-				break
-			}
+// Return the id of the backend serving fe_path from be_path over
+// protocols, adding the backend if no such backend exists.
+func (a *Frontend) AddBackend(fe_path string, be_path string, protocols []string) string {
+	for _, be := range a.BeTable {
+		if be.FePath == fe_path && be.BePath == be_path && cmpStrSlices(protocols, be.Protocols) {
+			return be.Id
 		}
-		if !found {
-			id = makeId()
-			ep := Endpoint{id, new_endpoint.IP, new_endpoint.Port}
-			a.EndpointTable[id] = ep
-			ep_ids = append(ep_ids, ep.Id)
+	}
+	id := a.newId()
+	a.BeTable[id] = Backend{id, fe_path, be_path, protocols, []string{}, TERM_EDGE, nil}
+	if len(a.Certificates) > 0 {
+		a.syncBackendCertificates()
+	}
+	return id
+}
+
+// Route a backend to an endpoint, ignoring endpoints that are already
+// routed.
+func (a *Frontend) addBackendEndpoint(be_id string, ep_id string) {
+	be := a.BeTable[be_id]
+	if exists(be.EndpointIds, ep_id) == -1 {
+		be.EndpointIds = append(be.EndpointIds, ep_id)
+	}
+	a.BeTable[be_id] = be
+}
+
+// Remove an endpoint and its routes.  Backends left without endpoints
+// are removed.  Returns false if the endpoint does not exist.
+func (a *Frontend) RemoveEndpoint(ep_id string) bool {
+	if _, ok := a.EndpointTable[ep_id]; !ok {
+		return false
+	}
+	delete(a.EndpointTable, ep_id)
+	for id, be := range a.BeTable {
+		i := exists(be.EndpointIds, ep_id)
+		if i == -1 {
+			continue
 		}
+		be.EndpointIds = append(be.EndpointIds[:i], be.EndpointIds[i+1:]...)
+		if len(be.EndpointIds) == 0 {
+			delete(a.BeTable, id)
+			continue
+		}
+		a.BeTable[id] = be
 	}
-	// locate a backend that may already exist with this protocol and fe/be path
-	found := false
+	return true
+}
+
+// Remove a backend.  Endpoints no longer routed by any backend are
+// removed.  Returns false if the backend does not exist.
+func (a *Frontend) RemoveBackend(be_id string) bool {
+	if _, ok := a.BeTable[be_id]; !ok {
+		return false
+	}
+	delete(a.BeTable, be_id)
+	a.removeOrphanedEndpoints()
+	return true
+}
+
+func (a *Frontend) removeOrphanedEndpoints() {
+	routed := make(map[string]bool)
 	for _, be := range a.BeTable {
-		if be.FePath == fe_path && be.BePath == be_path && cmpStrSlices(protocols, be.Protocols) {
-			for _, ep_id := range ep_ids {
-				be.EndpointIds = append(be.EndpointIds, ep_id)
+		for _, ep_id := range be.EndpointIds {
+			routed[ep_id] = true
+		}
+	}
+	for id := range a.EndpointTable {
+		if !routed[id] {
+			delete(a.EndpointTable, id)
+		}
+	}
+}
+
+// An alias may only be defined on one frontend, since the private key
+// and proxy certificate of an alias are stored by its name.
+func (routes RouteTable) checkAliasUnused(alias, frontendname string) error {
+	if alias == "" {
+		return nil
+	}
+	for name, a := range routes {
+		if name != frontendname && exists(a.HostAliases, alias) != -1 {
+			return ErrAliasInUse
+		}
+	}
+	return nil
+}
+
+func exists(s []string, e string) int {
+	for i, a := range s {
+		if a == e {
+			return i
+		}
+	}
+	return -1
+}
+
+// Apply fn to the named frontend and reload the router.  If create is
+// true a missing frontend is created, otherwise ErrFrontendNotFound is
+// returned.
+func updateFrontend(frontendname string, create bool, fn func(a *Frontend) error) error {
+	return updateFrontendAlias(frontendname, "", create, fn)
+}
+
+// Apply fn to the named frontend like updateFrontend, returning
+// ErrAliasInUse if another frontend defines alias.  An empty alias
+// isn't checked.
+func updateFrontendAlias(frontendname, alias string, create bool, fn func(a *Frontend) error) error {
+	_, err := Routes.Update(func(routes RouteTable) error {
+		if err := routes.checkAliasUnused(alias, frontendname); err != nil {
+			return err
+		}
+		a, ok := routes[frontendname]
+		if !ok {
+			if !create {
+				return ErrFrontendNotFound
 			}
-			a.BeTable[be.Id] = be
-			found = true
-			break
+			a.Name = frontendname
+		}
+		a.Init()
+		if err := fn(&a); err != nil {
+			return err
 		}
+		routes[frontendname] = a
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	if !found {
-		id = makeId()
-		a.BeTable[id] = Backend{id, fe_path, be_path, protocols, ep_ids, TERM_EDGE, nil}
+	BumpRouter()
+	return nil
+}
+
+func CreateFrontend(name string, url string) error {
+	_, err := Routes.Update(func(routes RouteTable) error {
+		if _, ok := routes[name]; ok {
+			return ErrFrontendExists
+		}
+		if err := routes.checkAliasUnused(url, name); err != nil {
+			return err
+		}
+		a := Frontend{}
+		a.Init()
+		a.Name = name
+		a.HostAliases = []string{}
+		a.AddAlias(url)
+		routes[a.Name] = a
+		return nil
+	})
+	return err
+}
+
+func DeleteFrontend(frontendname string) error {
+	_, err := Routes.Update(func(routes RouteTable) error {
+		if _, ok := routes[frontendname]; !ok {
+			return ErrFrontendNotFound
+		}
+		delete(routes, frontendname)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	GlobalRoutes[a.Name] = a
-	WriteRoutes()
 	BumpRouter()
+	return nil
+}
+
+// Add an alias to the frontend, creating the frontend if necessary.
+func AddAlias(alias string, frontendname string) error {
+	return updateFrontendAlias(frontendname, alias, true, func(a *Frontend) error {
+		if a.HostAliases == nil {
+			a.HostAliases = []string{}
+		}
+		a.AddAlias(alias)
+		return nil
+	})
+}
+
+func DeleteAlias(alias string, frontendname string) error {
+	return updateFrontend(frontendname, false, func(a *Frontend) error {
+		if !a.RemoveAlias(alias) {
+			return ErrAliasNotFound
+		}
+		return nil
+	})
+}
+
+// Route the endpoints from the backend matching the paths and
+// protocols, creating the frontend and backend if necessary.
+func AddRoute(frontendname string, fe_path string, be_path string, protocols []string, endpoints []Endpoint) error {
+	return updateFrontend(frontendname, true, func(a *Frontend) error {
+		be_id := a.AddBackend(fe_path, be_path, protocols)
+		for i := range endpoints {
+			a.addBackendEndpoint(be_id, a.AddEndpoint(endpoints[i]))
+		}
+		return nil
+	})
+}
+
+// Remove an endpoint from every backend of the frontend.
+func DeleteRoute(frontendname string, ep_id string) error {
+	return updateFrontend(frontendname, false, func(a *Frontend) error {
+		if !a.RemoveEndpoint(ep_id) {
+			return ErrEndpointNotFound
+		}
+		return nil
+	})
+}
+
+// Add a backend without endpoints to an existing frontend and return
+// its id.
+func AddBackend(frontendname string, fe_path string, be_path string, protocols []string) (string, error) {
+	var id string
+	err := updateFrontend(frontendname, false, func(a *Frontend) error {
+		id = a.AddBackend(fe_path, be_path, protocols)
+		return nil
+	})
+	return id, err
+}
+
+// Remove a backend and any endpoints only it routed to.
+func DeleteBackend(frontendname string, be_id string) error {
+	return updateFrontend(frontendname, false, func(a *Frontend) error {
+		if !a.RemoveBackend(be_id) {
+			return ErrBackendNotFound
+		}
+		return nil
+	})
 }
 
 func cmpStrSlices(first []string, second []string) bool {
@@ -203,18 +405,33 @@ func cmpStrSlices(first []string, second []string) bool {
 }
 
 func (a Frontend) PrintOut() {
-	fmt.Println(GlobalRoutes)
+	fmt.Println(a)
 }
 
+// Bring the proxy up to date with the routes.  A locally configured
+// proxy has its configuration rendered and is reloaded, otherwise the
+// router container is signaled to reread the routes file.
 func BumpRouter() {
-	out, err := exec.Command("docker", "kill", "-s", "SIGUSR2", "geard-router").CombinedOutput()
+	settings, err := ReadProxySettings()
 	if err != nil {
-		fmt.Println(string(out))
-		fmt.Printf("Failed to reload the router - %s\n", err.Error())
-		fmt.Println("Router plugin not installed?")
+		fmt.Printf("Failed to read the router proxy settings - %s\n", err.Error())
+		return
+	}
+	if settings == nil {
+		if err := DefaultReloader.Reload(); err != nil {
+			fmt.Printf("Failed to reload the router - %s\n", err.Error())
+			fmt.Println("Router plugin not installed?")
+		}
+		return
+	}
+	routes, _ := Routes.Snapshot()
+	if err := settings.Proxy().Apply(routes); err != nil {
+		fmt.Printf("Failed to update the %s router - %s\n", settings.Type, err.Error())
 	}
 }
 
 func init() {
-	ReadRoutes()
+	if err := Routes.Load(); err != nil {
+		log.Printf("router: Unable to read %s: %v", RouteFile, err)
+	}
 }
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"testing"
+)
+
+func testFrontend() *Frontend {
+	a := &Frontend{Name: "test"}
+	a.Init()
+	return a
+}
+
+func TestAddRouteReusesEndpoints(t *testing.T) {
+	a := testFrontend()
+	be := a.AddBackend("/", "/", []string{ProtocolHttp})
+	first := a.AddEndpoint(Endpoint{IP: "10.0.0.1", Port: "8080"})
+	a.addBackendEndpoint(be, first)
+	a.addBackendEndpoint(be, a.AddEndpoint(Endpoint{IP: "10.0.0.1", Port: "8080"}))
+
+	if len(a.EndpointTable) != 1 {
+		t.Fatalf("Expected the same address to reuse its endpoint: %+v", a.EndpointTable)
+	}
+	if ids := a.BeTable[be].EndpointIds; len(ids) != 1 || ids[0] != first {
+		t.Errorf("Expected the backend to route to one endpoint without empty ids: %+v", ids)
+	}
+	if other := a.AddBackend("/", "/", []string{ProtocolHttp}); other != be {
+		t.Errorf("Expected the matching backend %s to be reused, got %s", be, other)
+	}
+}
+
+func TestRemoveEndpointRemovesEmptyBackends(t *testing.T) {
+	a := testFrontend()
+	web := a.AddBackend("/", "/", nil)
+	api := a.AddBackend("/api", "/", nil)
+	shared := a.AddEndpoint(Endpoint{IP: "10.0.0.1", Port: "8080"})
+	other := a.AddEndpoint(Endpoint{IP: "10.0.0.2", Port: "8080"})
+	a.addBackendEndpoint(web, shared)
+	a.addBackendEndpoint(web, other)
+	a.addBackendEndpoint(api, shared)
+
+	if !a.RemoveEndpoint(shared) {
+		t.Fatal("Expected the endpoint to be removed")
+	}
+	if _, ok := a.BeTable[api]; ok {
+		t.Error("Expected the backend without endpoints to be removed")
+	}
+	if ids := a.BeTable[web].EndpointIds; len(ids) != 1 || ids[0] != other {
+		t.Errorf("Expected the remaining backend to keep its other endpoint: %+v", ids)
+	}
+	if a.RemoveEndpoint(shared) {
+		t.Error("Expected removing a missing endpoint to return false")
+	}
+}
+
+func TestRemoveBackendRemovesOrphanedEndpoints(t *testing.T) {
+	a := testFrontend()
+	web := a.AddBackend("/", "/", nil)
+	api := a.AddBackend("/api", "/", nil)
+	shared := a.AddEndpoint(Endpoint{IP: "10.0.0.1", Port: "8080"})
+	only := a.AddEndpoint(Endpoint{IP: "10.0.0.2", Port: "8080"})
+	a.addBackendEndpoint(web, shared)
+	a.addBackendEndpoint(web, only)
+	a.addBackendEndpoint(api, shared)
+
+	if !a.RemoveBackend(web) {
+		t.Fatal("Expected the backend to be removed")
+	}
+	if _, ok := a.EndpointTable[only]; ok {
+		t.Error("Expected the endpoint only routed by the backend to be removed")
+	}
+	if _, ok := a.EndpointTable[shared]; !ok {
+		t.Error("Expected the endpoint still routed by another backend to remain")
+	}
+}
+
+func TestAliases(t *testing.T) {
+	a := testFrontend()
+	a.AddAlias("")
+	a.AddAlias("www.example.com")
+	a.AddAlias("www.example.com")
+	a.AddAlias("example.com")
+	if len(a.HostAliases) != 2 {
+		t.Fatalf("Expected two distinct aliases: %+v", a.HostAliases)
+	}
+	if !a.RemoveAlias("www.example.com") || a.RemoveAlias("www.example.com") {
+		t.Error("Expected the alias to be removed once")
+	}
+	if len(a.HostAliases) != 1 || a.HostAliases[0] != "example.com" {
+		t.Errorf("Unexpected aliases after removal: %+v", a.HostAliases)
+	}
+
+	routes := RouteTable{"test": *a, "other": Frontend{Name: "other", HostAliases: []string{"api.example.com"}}}
+	if err := routes.checkAliasUnused("example.com", "test"); err != nil {
+		t.Errorf("Expected the frontend's own alias to be accepted: %v", err)
+	}
+	if err := routes.checkAliasUnused("example.com", "other"); err != ErrAliasInUse {
+		t.Errorf("Expected an alias of another frontend to be rejected: %v", err)
+	}
+	if err := routes.checkAliasUnused("new.example.com", "other"); err != nil {
+		t.Errorf("Expected an unused alias to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package router
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The frontends of the router by name.
+type RouteTable map[string]Frontend
+
+// Return a copy of the table that shares no maps or slices with it.
+func (t RouteTable) Copy() RouteTable {
+	copied := make(RouteTable, len(t))
+	for name, a := range t {
+		copied[name] = a.Copy()
+	}
+	return copied
+}
+
+// Return a copy of the frontend that shares no maps or slices with it.
+func (a Frontend) Copy() Frontend {
+	c := Frontend{Name: a.Name}
+	if a.HostAliases != nil {
+		c.HostAliases = append([]string{}, a.HostAliases...)
+	}
+	if a.BeTable != nil {
+		c.BeTable = make(map[string]Backend, len(a.BeTable))
+		for id, be := range a.BeTable {
+			c.BeTable[id] = be.Copy()
+		}
+	}
+	if a.EndpointTable != nil {
+		c.EndpointTable = make(map[string]Endpoint, len(a.EndpointTable))
+		for id, ep := range a.EndpointTable {
+			c.EndpointTable[id] = ep
+		}
+	}
+	if a.Certificates != nil {
+		c.Certificates = make(map[string]Certificate, len(a.Certificates))
+		for alias, cert := range a.Certificates {
+			c.Certificates[alias] = cert
+		}
+	}
+	return c
+}
+
+func (be Backend) Copy() Backend {
+	if be.Protocols != nil {
+		be.Protocols = append([]string{}, be.Protocols...)
+	}
+	if be.EndpointIds != nil {
+		be.EndpointIds = append([]string{}, be.EndpointIds...)
+	}
+	if be.Certificates != nil {
+		be.Certificates = append([]Certificate{}, be.Certificates...)
+	}
+	return be
+}
+
+// Holds the route table in memory and on disk.  Updates are
+// serialized, within this process and with other processes through a
+// lock file, and each one is written to disk before readers can see
+// it.  Concurrent updates never overwrite each other's changes and a
+// crash leaves either the old or the new table on disk.  The file
+// keeps the format read by the router container.
+type RouteStore struct {
+	path string
+	// The private keys of the certificates in the table
+	Keys *KeyStore
+
+	lock    sync.Mutex
+	routes  RouteTable
+	version int64
+	// The file the table was last read from or written to
+	loaded os.FileInfo
+}
+
+func NewRouteStore(path string) *RouteStore {
+	return &RouteStore{path: path, Keys: NewKeyStore(filepath.Join(filepath.Dir(path), "keys")), routes: RouteTable{}}
+}
+
+// Replace the table in memory with the one on disk.  A missing file is
+// an empty table.
+func (s *RouteStore) Load() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.load()
+}
+
+func (s *RouteStore) load() error {
+	routes := RouteTable{}
+	info, err := os.Stat(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		data, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &routes); err != nil {
+				return err
+			}
+		}
+	}
+	s.routes = routes
+	s.loaded = info
+	s.version += 1
+	return nil
+}
+
+// Reload the table if another process has replaced the file.
+func (s *RouteStore) refresh() error {
+	info, err := os.Stat(s.path)
+	switch {
+	case os.IsNotExist(err):
+		if s.loaded == nil {
+			return nil
+		}
+	case err != nil:
+		return err
+	case s.loaded != nil && os.SameFile(s.loaded, info) && s.loaded.ModTime().Equal(info.ModTime()):
+		return nil
+	}
+	return s.load()
+}
+
+// Return a copy of the table and its version.  The version increases
+// every time the table changes.
+func (s *RouteStore) Snapshot() (RouteTable, int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshOrLog()
+	return s.routes.Copy(), s.version
+}
+
+// Return a copy of the named frontend.
+func (s *RouteStore) Frontend(name string) (Frontend, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshOrLog()
+	a, ok := s.routes[name]
+	if !ok {
+		return Frontend{}, false
+	}
+	return a.Copy(), true
+}
+
+// The version of the table.
+func (s *RouteStore) Version() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshOrLog()
+	return s.version
+}
+
+func (s *RouteStore) refreshOrLog() {
+	if err := s.refresh(); err != nil {
+		log.Printf("router: Unable to reload %s: %v", s.path, err)
+	}
+}
+
+// Apply fn to a copy of the latest table and save the result.  If fn
+// or the save fails the table is left unchanged.  Returns the new
+// version.
+func (s *RouteStore) Update(fn func(routes RouteTable) error) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	unlock, err := lockPath(s.path + ".lock")
+	if err != nil {
+		return s.version, err
+	}
+	defer unlock()
+	if err := s.refresh(); err != nil {
+		return s.version, err
+	}
+
+	routes := s.routes.Copy()
+	if err := fn(routes); err != nil {
+		return s.version, err
+	}
+	if err := writeFileAtomic(s.path, routes); err != nil {
+		return s.version, err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return s.version, err
+	}
+	s.routes = routes
+	s.loaded = info
+	s.version += 1
+	if err := s.Keys.prune(routes); err != nil {
+		log.Printf("router: Unable to remove unused private keys: %v", err)
+	}
+	return s.version, nil
+}
+
+// Write the table to a temporary file in the same directory and
+// rename it over path.
+func writeFileAtomic(path string, routes RouteTable) error {
+	data, err := json.MarshalIndent(routes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data, 0644)
+}
+
+func writeAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
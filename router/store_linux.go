@@ -0,0 +1,24 @@
+// +build linux
+
+package router
+
+import (
+	"os"
+	"syscall"
+)
+
+// Wait for an exclusive lock on path, which is created if necessary.
+func lockPath(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,192 @@
+package router
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRouteStoreConcurrentUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "routes.json")
+	s := NewRouteStore(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("frontend-%d", i)
+			_, err := s.Update(func(routes RouteTable) error {
+				a := Frontend{Name: name}
+				a.Init()
+				a.AddAlias(name + ".example.com")
+				routes[name] = a
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if routes, _ := s.Snapshot(); len(routes) == 0 {
+				t.Error("Expected a snapshot after an update to contain it")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	routes, version := s.Snapshot()
+	if len(routes) != 20 || version != 20 {
+		t.Fatalf("Expected 20 frontends at version 20, got %d at %d", len(routes), version)
+	}
+
+	loaded := NewRouteStore(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if routes, _ := loaded.Snapshot(); len(routes) != 20 {
+		t.Errorf("Expected every update to be saved, found %d frontends", len(routes))
+	}
+	files, _ := ioutil.ReadDir(dir)
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			t.Errorf("Expected temporary files to be renamed or removed: %s", file.Name())
+		}
+	}
+}
+
+func TestRouteStoreFailedUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewRouteStore(filepath.Join(dir, "routes.json"))
+
+	failed := fmt.Errorf("failed")
+	version, err := s.Update(func(routes RouteTable) error {
+		routes["test"] = Frontend{Name: "test"}
+		return failed
+	})
+	if err != failed || version != 0 {
+		t.Fatalf("Expected the update to fail without a new version: %v %d", err, version)
+	}
+	if _, ok := s.Frontend("test"); ok {
+		t.Error("Expected a failed update to leave the table unchanged")
+	}
+}
+
+func TestRouteStoreSnapshotIsCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewRouteStore(filepath.Join(dir, "routes.json"))
+	s.Update(func(routes RouteTable) error {
+		a := Frontend{Name: "test"}
+		a.Init()
+		a.AddEndpoint(Endpoint{IP: "10.0.0.1", Port: "8080"})
+		routes["test"] = a
+		return nil
+	})
+
+	routes, _ := s.Snapshot()
+	a := routes["test"]
+	a.AddEndpoint(Endpoint{IP: "10.0.0.2", Port: "8080"})
+	if stored, _ := s.Frontend("test"); len(stored.EndpointTable) != 1 {
+		t.Errorf("Expected changes to a snapshot not to affect the store: %+v", stored.EndpointTable)
+	}
+}
+
+func TestRouteStoreSeesOtherWriters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "routes.json")
+	first, second := NewRouteStore(path), NewRouteStore(path)
+
+	add := func(s *RouteStore, name string) {
+		if _, err := s.Update(func(routes RouteTable) error {
+			routes[name] = Frontend{Name: name}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(first, "a")
+	add(second, "b")
+	add(first, "c")
+
+	for _, s := range []*RouteStore{first, second} {
+		if routes, _ := s.Snapshot(); len(routes) != 3 {
+			t.Errorf("Expected each store to see every update: %+v", routes)
+		}
+	}
+}
+
+func TestRouteStoreKeepsKeysOutOfRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "routes.json")
+	s := NewRouteStore(path)
+
+	cert, key, _ := testCertificate(t, "www.example.com", time.Now().Add(24*time.Hour))
+	c, err := NewCertificate("www.example.com", cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update(func(routes RouteTable) error {
+		a := Frontend{Name: "test"}
+		a.Init()
+		a.AddAlias("www.example.com")
+		if err := a.AddCertificate(c, false); err != nil {
+			return err
+		}
+		routes["test"] = a
+		return s.Keys.Write(c.Id, c.PrivateKey)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "PrivateKey") {
+		t.Errorf("Expected private keys to be left out of the routes:\n%s", data)
+	}
+	info, err := os.Stat(s.Keys.PathFor(c.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the private key to be readable only by its owner, got %v", info.Mode())
+	}
+	if stored, err := s.Keys.Read(c.Id); err != nil || string(stored) != string(key) {
+		t.Errorf("Expected the private key to be stored: %v", err)
+	}
+
+	if _, err := s.Update(func(routes RouteTable) error {
+		delete(routes, "test")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Keys.PathFor(c.Id)); !os.IsNotExist(err) {
+		t.Errorf("Expected the key of a removed certificate to be deleted: %v", err)
+	}
+}